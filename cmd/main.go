@@ -3,9 +3,11 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -14,8 +16,6 @@ import (
 	"lk-auth/internal/app"
 	"lk-auth/internal/config"
 	sl "lk-auth/internal/libs/logger"
-
-	"github.com/lmittmann/tint"
 )
 
 var isShuttingDown atomic.Bool
@@ -29,7 +29,8 @@ func main() {
 
 	cfg := config.MustLoad()
 
-	log := setupLogger(cfg)
+	log, closeLog := setupLogger(cfg)
+	defer closeLog()
 
 	log.Info("Start application...")
 
@@ -60,6 +61,24 @@ func main() {
 		}
 	}()
 
+	// По SIGHUP перечитываем ключ подписи без перезапуска
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+	go func() {
+		for {
+			select {
+			case <-rootCtx.Done():
+				return
+			case <-reload:
+				log.Info("Получен SIGHUP, перезагрузка ключа подписи...")
+				if err := a.ReloadSigningKey(); err != nil {
+					log.Error("Не удалось перезагрузить ключ подписи.", sl.Err(err))
+				}
+			}
+		}
+	}()
+
 	// Ожидаем сигналы к завершению
 	<-rootCtx.Done()
 	// Устанавливаем флаг состояния isShuttingDown true, для оповещения внешних сервисов о завешении работы (см. [server.handleHealthz])
@@ -90,9 +109,8 @@ func main() {
 	log.Info("Server shutdown gracefully.")
 }
 
-func setupLogger(cfg *config.Config) *slog.Logger {
-	var log *slog.Logger
-
+// setupLogger собирает обработчики журнала по настройкам LOGGER_*. Возвращаемая функция закрывает файл журнала
+func setupLogger(cfg *config.Config) (*slog.Logger, func() error) {
 	// If logger.level varable is not set set [slog.Level] to DEBUG for "local" and "dev" and INFO for "prod"
 	if cfg.Logger.Level == nil {
 		var level slog.Level
@@ -104,31 +122,56 @@ func setupLogger(cfg *config.Config) *slog.Logger {
 		cfg.Logger.Level = &level
 	}
 
+	// В prod журнал разбирается сборщиком логов, поэтому по умолчанию пишется в JSON
+	format := cfg.Logger.Format
 	switch cfg.Env {
-	case "local":
-		log = slog.New(
-			tint.NewHandler(os.Stdout, &tint.Options{
-				AddSource: cfg.Logger.ShowPathCall,
-				Level:     cfg.Logger.Level,
-			}),
-		)
-	case "dev":
-		log = slog.New(
-			tint.NewHandler(os.Stdout, &tint.Options{
-				AddSource: cfg.Logger.ShowPathCall,
-				Level:     cfg.Logger.Level,
-			}),
-		)
+	case "local", "dev":
+		if format == "" {
+			format = sl.FormatTint
+		}
 	case "prod":
-		log = slog.New(
-			tint.NewHandler(os.Stdout, &tint.Options{
-				AddSource: cfg.Logger.ShowPathCall,
-				Level:     cfg.Logger.Level,
-			}),
-		)
+		if format == "" {
+			format = sl.FormatJSON
+		}
 	default:
 		panic("unexpected type of environment environment: " + cfg.Env)
 	}
 
-	return log
+	opts := &slog.HandlerOptions{
+		AddSource: cfg.Logger.ShowPathCall,
+		Level:     cfg.Logger.Level,
+	}
+	closeFile := func() error { return nil }
+	handlers := make([]slog.Handler, 0, len(cfg.Logger.Output))
+	for _, output := range cfg.Logger.Output {
+		var (
+			handler slog.Handler
+			err     error
+		)
+		switch strings.TrimSpace(output) {
+		case "stdout":
+			handler, err = sl.NewHandler(format, os.Stdout, opts)
+		case "file":
+			var file *sl.RotatingFile
+			file, err = sl.NewRotatingFile(cfg.Logger.File, cfg.Logger.FileMaxSize<<20, cfg.Logger.FileMaxBackups)
+			if err != nil {
+				break
+			}
+			closeFile = file.Close
+			handler, err = sl.NewHandler(cfg.Logger.FileFormat, file, opts)
+		default:
+			err = fmt.Errorf("unknown LOGGER_OUTPUT %q", output)
+		}
+		if err != nil {
+			panic(err.Error())
+		}
+		handlers = append(handlers, handler)
+	}
+	if len(handlers) == 0 {
+		panic("LOGGER_OUTPUT is empty")
+	}
+
+	// Атрибуты запроса из контекста добавляются до маскирования, чтобы и в них не попали секреты.
+	// Пароли, токены и секреты маскируются до записи в журнал, какой бы обработчик ни был выбран
+	return slog.New(sl.NewContextHandler(sl.NewRedactHandler(sl.NewFanoutHandler(handlers...)))), closeFile
 }
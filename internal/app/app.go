@@ -3,50 +3,324 @@ package app
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"lk-auth/internal/config"
+	"lk-auth/internal/libs/hash"
 	"lk-auth/internal/server"
+	"lk-auth/internal/server/middleware"
 	"lk-auth/internal/service/auth"
 	"lk-auth/internal/service/jwt"
+	"lk-auth/internal/service/mailer"
+	"lk-auth/internal/service/password"
+	"lk-auth/internal/service/rbac"
 
 	"lk-auth/internal/storage"
+	fileStorage "lk-auth/internal/storage/file"
+	memoryStorage "lk-auth/internal/storage/memory"
+	postgresStorage "lk-auth/internal/storage/postgres"
 	redisStorage "lk-auth/internal/storage/redis"
+	"lk-auth/internal/storage/timeout"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type App struct {
-	log    *slog.Logger
-	server *server.Server
-	cfg    *config.Config
+	log        *slog.Logger
+	server     *server.Server
+	cfg        *config.Config
+	jwtService jwt.JWTService
 
-	jwtStorage       storage.JWTStorage
-	blacklistStorage storage.BlackListStorage
-	userStorage      storage.UserStorage
+	storages *storages
+}
+
+// Значения AUDIT_SINK
+const (
+	auditSinkLog      = "log"
+	auditSinkRedis    = "redis"
+	auditSinkPostgres = "postgres"
+	auditSinkFile     = "file"
+)
+
+// storages - хранилища одного бэкенда (Redis или память процесса)
+type storages struct {
+	jwt       storage.JWTStorage
+	session   storage.SessionStorage
+	blackList storage.BlackListStorage
+	user      storage.UserStorage
+	mfa       storage.MFAStorage
+	webAuthn  storage.WebAuthnStorage
+	lockout   storage.LockoutStorage
+	rateLimit storage.RateLimitStorage
+	tokens    storage.OneTimeTokenStorage
+	// nil, если журнал аудита хранится не в этом бэкенде
+	audit storage.AuditStorage
 }
 
 func New(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, log *slog.Logger, isShuttingDown *atomic.Bool) (*App, error) {
+	var err error
 
 	// JWT сервис
+	var signingKey any = []byte(cfg.SecretPhrase)
+	if cfg.SigningKeyPath != "" {
+		signingKey, err = jwt.LoadPrivateKey(cfg.SigningKeyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	retiredKeys := make([]jwt.RetiredKey, 0, len(cfg.RetiredKeyPaths)+len(cfg.RetiredSecretPhrases))
+	for _, entry := range cfg.RetiredKeyPaths {
+		path, retiredAt, err := parseRetired("RETIRED_KEY_PATHS", entry)
+		if err != nil {
+			return nil, err
+		}
+		if time.Since(retiredAt) >= cfg.TTL.Refresh {
+			log.Info("retired key has expired and can be removed from RETIRED_KEY_PATHS", "path", path)
+			continue
+		}
+		key, err := jwt.LoadPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		retiredKeys = append(retiredKeys, jwt.RetiredKey{Key: key, RetiredAt: retiredAt})
+	}
+	for i, entry := range cfg.RetiredSecretPhrases {
+		phrase, retiredAt, err := parseRetired("RETIRED_SECRET_PHRASES", entry)
+		if err != nil {
+			return nil, err
+		}
+		if time.Since(retiredAt) >= cfg.TTL.Refresh {
+			log.Info("retired secret has expired and can be removed from RETIRED_SECRET_PHRASES", "index", i)
+			continue
+		}
+		retiredKeys = append(retiredKeys, jwt.RetiredKey{Key: []byte(phrase), RetiredAt: retiredAt})
+	}
 	jwtService, err := jwt.NewJWTServiceImpl(
-		[]byte(cfg.SecretPhrase),
+		signingKey,
 		cfg.TTL.Access,
 		cfg.TTL.Refresh,
 		log,
+		retiredKeys...,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	// Один хэшер для хранилища пользователей, которое проверяет пароли, и сервиса, который их хэширует
+	hasher := hash.NewArgon2idHasher(hash.Argon2Params{
+		Memory:  cfg.PasswordHash.Argon2Memory,
+		Time:    cfg.PasswordHash.Argon2Time,
+		Threads: cfg.PasswordHash.Argon2Threads,
+		SaltLen: hash.DefaultArgon2Params.SaltLen,
+		KeyLen:  hash.DefaultArgon2Params.KeyLen,
+	}, []byte(cfg.PasswordHash.Pepper))
+	if cfg.PasswordHash.Pepper == "" {
+		log.Info("PASSWORD_PEPPER is empty, password hashes are not peppered")
+	}
+
 	// Хранилища
+	var st *storages
+	if cfg.Storages.Redis == memoryStorage.URL {
+		log.Warn("REDIS_URL=memory://, data is kept in process memory and lost on restart")
+		st, err = newMemoryStorages(ctx, wg, cfg, jwtService, hasher, log)
+	} else {
+		st, err = newRedisStorages(ctx, wg, cfg, jwtService, hasher, log)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Если задан USERS_URL, учётные записи хранятся в PostgreSQL
+	if cfg.Storages.Users != "" {
+		st.user, err = postgresStorage.NewPostgresUserStorage(
+			ctx,
+			wg,
+			cfg.Storages.Users,
+			hasher,
+			log,
+			cfg.PingTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Журнал аудита в Redis создан вместе с остальными хранилищами бэкенда
+	switch cfg.Audit.Sink {
+	case auditSinkRedis:
+	case auditSinkPostgres:
+		if cfg.Storages.Users == "" {
+			return nil, errors.New("AUDIT_SINK=postgres requires USERS_URL")
+		}
+		st.audit, err = postgresStorage.NewPostgresAuditStorage(
+			ctx,
+			wg,
+			cfg.Storages.Users,
+			log,
+			cfg.PingTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+	case auditSinkFile:
+		st.audit, err = fileStorage.NewFileAuditStorage(cfg.Audit.File, log)
+		if err != nil {
+			return nil, err
+		}
+	case "", auditSinkLog:
+		log.Info("AUDIT_SINK is log, audit records are written to the application log and cannot be queried")
+	default:
+		return nil, fmt.Errorf("unknown AUDIT_SINK %q", cfg.Audit.Sink)
+	}
+
+	st.withTimeout(cfg.Timeout.Storage)
+
+	authOpts := []auth.Option{
+		auth.WithPasswordHasher(hasher),
+		auth.WithMFA(st.mfa, cfg.MFAIssuer),
+		auth.WithLockout(st.lockout, auth.LockoutConfig{
+			Account: auth.LockoutPolicy{
+				FreeAttempts: cfg.Lockout.AccountFreeAttempts,
+				MaxAttempts:  cfg.Lockout.AccountMaxAttempts,
+			},
+			IP: auth.LockoutPolicy{
+				FreeAttempts: cfg.Lockout.IPFreeAttempts,
+				MaxAttempts:  cfg.Lockout.IPMaxAttempts,
+			},
+			BaseDelay: cfg.Lockout.BaseDelay,
+			Duration:  cfg.Lockout.Duration,
+		}),
+	}
+	if cfg.WebAuthn.RPID != "" {
+		webAuthn, err := auth.NewWebAuthn(cfg.WebAuthn.RPID, cfg.WebAuthn.RPName, cfg.WebAuthn.Origins)
+		if err != nil {
+			return nil, err
+		}
+		authOpts = append(authOpts, auth.WithWebAuthn(st.webAuthn, webAuthn))
+	} else {
+		log.Info("WEBAUTHN_RP_ID is empty, passkeys are disabled")
+	}
+
+	policy := &password.Policy{
+		MinLength:  cfg.PasswordPolicy.MinLength,
+		MinClasses: cfg.PasswordPolicy.MinClasses,
+	}
+	if cfg.PasswordPolicy.BreachedFile != "" {
+		policy.Breached, err = password.OpenBreachedFile(cfg.PasswordPolicy.BreachedFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Info("PASSWORD_BREACHED_FILE is empty, passwords are not checked against breaches")
+	}
+	authOpts = append(authOpts, auth.WithPasswordPolicy(policy))
+
+	roles := rbac.DefaultRegistry()
+	if cfg.Roles.File != "" {
+		roles, err = rbac.LoadFile(cfg.Roles.File)
+		if err != nil {
+			return nil, err
+		}
+	}
+	authOpts = append(authOpts, auth.WithRoles(roles))
+	if st.audit != nil {
+		authOpts = append(authOpts, auth.WithAudit(st.audit))
+	}
+	if err = bootstrapAdmins(ctx, st.user, roles, cfg.Roles.AdminEmails, log); err != nil {
+		return nil, err
+	}
+
+	mail, err := newMailer(cfg, log)
+	if err != nil {
+		return nil, err
+	}
+	authOpts = append(authOpts, auth.WithPasswordReset(st.tokens, mail, auth.PasswordResetConfig{
+		URL: cfg.PasswordReset.URL,
+		TTL: cfg.PasswordReset.TTL,
+	}))
+	switch mode := auth.EmailVerificationMode(cfg.EmailVerification.Mode); mode {
+	case "", "off":
+		log.Info("EMAIL_VERIFICATION_MODE is off, email addresses are not verified")
+	case auth.EmailVerificationRefuse, auth.EmailVerificationRestrict:
+		authOpts = append(authOpts, auth.WithEmailVerification(mail, auth.EmailVerificationConfig{
+			Mode: mode,
+			URL:  cfg.EmailVerification.URL,
+			TTL:  cfg.EmailVerification.TTL,
+		}))
+	default:
+		return nil, fmt.Errorf("unknown EMAIL_VERIFICATION_MODE %q", mode)
+	}
+
+	authService := auth.NewAuthServiceImpl(
+		jwtService,
+		st.blackList,
+		st.jwt,
+		st.session,
+		st.user,
+		log,
+		authOpts...,
+	)
+
+	if len(cfg.IntrospectionClients) == 0 {
+		log.Warn("INTROSPECTION_CLIENTS is empty, POST /introspect will reject every request")
+	}
+	rateLimits := st.rateLimit
+	if !cfg.RateLimitEnabled {
+		log.Warn("RATE_LIMIT_ENABLED is false, requests are not rate limited")
+		rateLimits = nil
+	}
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	srv := server.NewServer(
+		ctx,
+		authService,
+		jwtService,
+		cfg.IntrospectionClients,
+		rateLimits,
+		trustedProxies,
+		server.Timeouts{Default: cfg.Timeout.Default, Password: cfg.Timeout.Password},
+		log,
+		isShuttingDown,
+	)
+
+	return &App{
+		log:        log,
+		server:     srv,
+		cfg:        cfg,
+		jwtService: jwtService,
+		storages:   st,
+	}, nil
+}
+
+func newRedisStorages(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, jwtService jwt.JWTService, hasher hash.PasswordHasher, log *slog.Logger) (*storages, error) {
 	redisOpts, err := redis.ParseURL(cfg.Storages.Redis)
 	if err != nil {
 		return nil, err
 	}
-	jwtStorage, err := redisStorage.NewRedisJWTStorage(
+	// Иначе go-redis не учитывает срок контекста запроса и ждёт ответа до своих таймаутов
+	redisOpts.ContextTimeoutEnabled = true
+
+	st := &storages{}
+	st.jwt, err = redisStorage.NewRedisJWTStorage(
+		ctx,
+		wg,
+		redisOpts,
+		cfg.TTL.Refresh,
+		log,
+		cfg.PingTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	st.session, err = redisStorage.NewRedisSessionStorage(
 		ctx,
 		wg,
 		redisOpts,
@@ -58,7 +332,7 @@ func New(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, log *slog.
 		return nil, err
 	}
 
-	blackListStorage, err := redisStorage.NewRedisBlackListStorage(
+	st.blackList, err = redisStorage.NewRedisBlackListStorage(
 		ctx,
 		wg,
 		redisOpts,
@@ -70,32 +344,250 @@ func New(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, log *slog.
 		return nil, err
 	}
 
-	userStorage, err := redisStorage.NewRedisUserStorage(
+	st.mfa, err = redisStorage.NewRedisMFAStorage(
 		ctx,
 		wg,
 		redisOpts,
 		log,
 		cfg.PingTime,
 	)
+	if err != nil {
+		return nil, err
+	}
 
-	authService := auth.NewAuthServiceImpl(
-		jwtService,
-		blackListStorage,
-		jwtStorage,
-		userStorage,
+	st.webAuthn, err = redisStorage.NewRedisWebAuthnStorage(
+		ctx,
+		wg,
+		redisOpts,
 		log,
+		cfg.PingTime,
 	)
+	if err != nil {
+		return nil, err
+	}
 
-	srv := server.NewServer(ctx, authService, log, isShuttingDown)
+	st.lockout, err = redisStorage.NewRedisLockoutStorage(
+		ctx,
+		wg,
+		redisOpts,
+		log,
+		cfg.PingTime,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-	return &App{
-		log:              log,
-		server:           srv,
-		cfg:              cfg,
-		jwtStorage:       jwtStorage,
-		blacklistStorage: blackListStorage,
-		userStorage:      userStorage,
-	}, nil
+	st.rateLimit, err = redisStorage.NewRedisRateLimitStorage(
+		ctx,
+		wg,
+		redisOpts,
+		log,
+		cfg.PingTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	st.tokens, err = redisStorage.NewRedisOneTimeTokenStorage(
+		ctx,
+		wg,
+		redisOpts,
+		log,
+		cfg.PingTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Audit.Sink == auditSinkRedis {
+		st.audit, err = redisStorage.NewRedisAuditStorage(
+			ctx,
+			wg,
+			redisOpts,
+			cfg.Audit.RedisMaxLen,
+			log,
+			cfg.PingTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Без USERS_URL учётные записи хранятся в Redis вместе с токенами
+	if cfg.Storages.Users == "" {
+		st.user, err = redisStorage.NewRedisUserStorage(
+			ctx,
+			wg,
+			redisOpts,
+			hasher,
+			log,
+			cfg.PingTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return st, nil
+}
+
+// Хранилища в памяти процесса для локальной разработки, PING_TIME задаёт период очистки истёкших записей
+func newMemoryStorages(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, jwtService jwt.JWTService, hasher hash.PasswordHasher, log *slog.Logger) (*storages, error) {
+	var err error
+	st := &storages{}
+
+	st.jwt, err = memoryStorage.NewMemoryJWTStorage(ctx, wg, cfg.TTL.Refresh, log, cfg.PingTime)
+	if err != nil {
+		return nil, err
+	}
+	st.session, err = memoryStorage.NewMemorySessionStorage(ctx, wg, cfg.TTL.Refresh, log, cfg.PingTime)
+	if err != nil {
+		return nil, err
+	}
+	st.blackList, err = memoryStorage.NewMemoryBlackListStorage(ctx, wg, jwtService, log, cfg.PingTime)
+	if err != nil {
+		return nil, err
+	}
+	st.mfa, err = memoryStorage.NewMemoryMFAStorage(log)
+	if err != nil {
+		return nil, err
+	}
+	st.webAuthn, err = memoryStorage.NewMemoryWebAuthnStorage(ctx, wg, log, cfg.PingTime)
+	if err != nil {
+		return nil, err
+	}
+	st.lockout, err = memoryStorage.NewMemoryLockoutStorage(ctx, wg, log, cfg.PingTime)
+	if err != nil {
+		return nil, err
+	}
+	st.rateLimit, err = memoryStorage.NewMemoryRateLimitStorage(ctx, wg, log, cfg.PingTime)
+	if err != nil {
+		return nil, err
+	}
+	st.tokens, err = memoryStorage.NewMemoryOneTimeTokenStorage(ctx, wg, log, cfg.PingTime)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Audit.Sink == auditSinkRedis {
+		st.audit, err = memoryStorage.NewMemoryAuditStorage(log)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Storages.Users == "" {
+		st.user, err = memoryStorage.NewMemoryUserStorage(hasher, log)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return st, nil
+}
+
+// parseRetired разбирает "<ключ>@<время вывода из оборота в RFC 3339>". Время обязательно: без него срок
+// проверки отсчитывался бы от запуска и продлевался бы каждым перезапуском. Секрет может содержать @,
+// поэтому время отделяется по последнему
+func parseRetired(name, entry string) (string, time.Time, error) {
+	i := strings.LastIndex(entry, "@")
+	if i < 0 {
+		return "", time.Time{}, fmt.Errorf("%s: retirement time is required, use <key>@<RFC 3339 time>", name)
+	}
+	retiredAt, err := time.Parse(time.RFC3339, entry[i+1:])
+	// Текст ошибки разбора не выводится: после @ может оказаться часть секрета
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: invalid retirement time, use <key>@<RFC 3339 time>", name)
+	}
+	return entry[:i], retiredAt, nil
+}
+
+// bootstrapAdmins назначает роль admin пользователям из ADMIN_EMAILS. Ещё не зарегистрированные пропускаются
+func bootstrapAdmins(ctx context.Context, users storage.UserStorage, roles *rbac.Registry, emails []string, log *slog.Logger) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	if !roles.Exists(rbac.RoleAdmin) {
+		return fmt.Errorf("ADMIN_EMAILS is set, but the role registry has no %q role", rbac.RoleAdmin)
+	}
+
+	for _, email := range emails {
+		user, err := users.GetUser(ctx, email)
+		if errors.Is(err, storage.ErrNotFound) {
+			log.Warn("admin from ADMIN_EMAILS is not registered yet", "email", email)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if user.Role == rbac.RoleAdmin {
+			continue
+		}
+		if _, err = users.ChangeRole(ctx, email, rbac.RoleAdmin); err != nil {
+			return err
+		}
+		log.Warn("security event: role granted",
+			"event", "role_granted",
+			"email", email,
+			"role", rbac.RoleAdmin,
+			"admin", "ADMIN_EMAILS",
+		)
+	}
+	return nil
+}
+
+// newMailer выбирает способ доставки писем: SMTP сервер, файл или журнал.
+// В prod нужен SMTP сервер: ссылки сброса пароля из файла или журнала дают доступ к любой учётной записи
+func newMailer(cfg *config.Config, log *slog.Logger) (mailer.Mailer, error) {
+	switch {
+	case cfg.Mail.SMTPAddr != "":
+		return mailer.NewSMTPMailer(cfg.Mail.SMTPAddr, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	case cfg.Env == "prod":
+		return nil, errors.New("MAIL_SMTP_ADDR is required in prod")
+	case cfg.Mail.File != "":
+		log.Warn("MAIL_SMTP_ADDR is empty, mail is written to MAIL_FILE", "file", cfg.Mail.File)
+		return mailer.NewFileMailer(cfg.Mail.File, cfg.Mail.From)
+	default:
+		log.Warn("MAIL_SMTP_ADDR and MAIL_FILE are empty, mail is written to the log without bodies, links cannot be followed")
+		return mailer.NewLogMailer(log), nil
+	}
+}
+
+// withTimeout ограничивает время каждой операции хранилищ, 0 - без ограничения
+func (st *storages) withTimeout(d time.Duration) {
+	st.jwt = timeout.NewJWTStorage(st.jwt, d)
+	st.session = timeout.NewSessionStorage(st.session, d)
+	st.blackList = timeout.NewBlackListStorage(st.blackList, d)
+	st.user = timeout.NewUserStorage(st.user, d)
+	st.mfa = timeout.NewMFAStorage(st.mfa, d)
+	st.webAuthn = timeout.NewWebAuthnStorage(st.webAuthn, d)
+	st.lockout = timeout.NewLockoutStorage(st.lockout, d)
+	st.rateLimit = timeout.NewRateLimitStorage(st.rateLimit, d)
+	st.tokens = timeout.NewOneTimeTokenStorage(st.tokens, d)
+	if st.audit != nil {
+		st.audit = timeout.NewAuditStorage(st.audit, d)
+	}
+}
+
+// shutDown закрывает все хранилища, даже если какое-то из них вернуло ошибку
+func (st *storages) shutDown(shutDownCtx context.Context) error {
+	return errors.Join(
+		st.jwt.ShutDown(shutDownCtx),
+		st.session.ShutDown(shutDownCtx),
+		st.blackList.ShutDown(shutDownCtx),
+		st.user.ShutDown(shutDownCtx),
+		st.mfa.ShutDown(shutDownCtx),
+		st.webAuthn.ShutDown(shutDownCtx),
+		st.lockout.ShutDown(shutDownCtx),
+		st.rateLimit.ShutDown(shutDownCtx),
+		st.tokens.ShutDown(shutDownCtx),
+		st.shutDownAudit(shutDownCtx),
+	)
+}
+
+func (st *storages) shutDownAudit(shutDownCtx context.Context) error {
+	if st.audit == nil {
+		return nil
+	}
+	return st.audit.ShutDown(shutDownCtx)
 }
 
 func (a *App) Run() error {
@@ -103,6 +595,29 @@ func (a *App) Run() error {
 	return a.server.Start(a.cfg.Env, a.cfg.URL+":"+a.cfg.Port)
 }
 
+// ReloadSigningKey перечитывает SIGNING_KEY_PATH и, если ключ изменился, делает его текущим.
+// Прежний ключ продолжает приниматься при проверке, поэтому выданные токены остаются действительными.
+func (a *App) ReloadSigningKey() error {
+	if a == nil {
+		return errors.New("App instance is nil")
+	}
+	if a.cfg.SigningKeyPath == "" {
+		return errors.New("SIGNING_KEY_PATH is not set, nothing to reload")
+	}
+	key, err := jwt.LoadPrivateKey(a.cfg.SigningKeyPath)
+	if err != nil {
+		return err
+	}
+	rotated, err := a.jwtService.RotateKey(key)
+	if err != nil {
+		return err
+	}
+	if !rotated {
+		a.log.Info("Ключ подписи не изменился.")
+	}
+	return nil
+}
+
 func (a *App) ShutDown(shutDownCtx context.Context) error {
 	if a == nil {
 		return errors.New("App instance is nil")
@@ -110,9 +625,7 @@ func (a *App) ShutDown(shutDownCtx context.Context) error {
 
 	err := errors.Join(
 		a.server.ShutDown(shutDownCtx),
-		a.jwtStorage.ShutDown(shutDownCtx),
-		a.blacklistStorage.ShutDown(shutDownCtx),
-		a.userStorage.ShutDown(shutDownCtx),
+		a.storages.shutDown(shutDownCtx),
 	)
 	return err
 }
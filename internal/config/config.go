@@ -1,7 +1,10 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -15,6 +18,108 @@ type Config struct {
 		Users string `env:"USERS_URL" env-default:""`
 	}
 	SecretPhrase string `env:"SECRET_PHRASE" env-default:""`
+	// Путь к PEM файлу с закрытым ключом RSA/ECDSA/Ed25519. Если не задан, используется HS256 с SECRET_PHRASE
+	SigningKeyPath string `env:"SIGNING_KEY_PATH" env-default:""`
+	// Ключи после ротации в виде <ключ>@<время вывода из оборота в RFC 3339>: ими больше не подписывают,
+	// но токены проверяются ещё TTL_REFRESH после этого времени. Перезапуски срок не продлевают
+	RetiredKeyPaths      []string `env:"RETIRED_KEY_PATHS" env-separator:","`
+	RetiredSecretPhrases []string `env:"RETIRED_SECRET_PHRASES" env-separator:","`
+
+	// client_id:client_secret сервисов, которым разрешён POST /introspect
+	IntrospectionClients map[string]string `env:"INTROSPECTION_CLIENTS" env-separator:","`
+
+	// Название сервиса в приложении-аутентификаторе
+	MFAIssuer string `env:"MFA_ISSUER" env-default:"lk-auth"`
+
+	// Вход по ключам доступа (passkeys) включается, если задан RP ID - домен сайта
+	WebAuthn struct {
+		RPID    string   `env:"WEBAUTHN_RP_ID" env-default:""`
+		RPName  string   `env:"WEBAUTHN_RP_NAME" env-default:"lk-auth"`
+		Origins []string `env:"WEBAUTHN_ORIGINS" env-separator:","`
+	}
+
+	// Неудачные попытки входа считаются по email и по IP. После FREE_ATTEMPTS неудач вход
+	// задерживается на BASE_DELAY с удвоением, после MAX_ATTEMPTS блокируется на DURATION
+	Lockout struct {
+		AccountFreeAttempts int64         `env:"LOCKOUT_ACCOUNT_FREE_ATTEMPTS" env-default:"3"`
+		AccountMaxAttempts  int64         `env:"LOCKOUT_ACCOUNT_MAX_ATTEMPTS" env-default:"10"`
+		IPFreeAttempts      int64         `env:"LOCKOUT_IP_FREE_ATTEMPTS" env-default:"20"`
+		IPMaxAttempts       int64         `env:"LOCKOUT_IP_MAX_ATTEMPTS" env-default:"100"`
+		BaseDelay           time.Duration `env:"LOCKOUT_BASE_DELAY" env-default:"1s"`
+		Duration            time.Duration `env:"LOCKOUT_DURATION" env-default:"15m"`
+	}
+
+	// Почта для ссылок сброса пароля и подтверждения email. Без SMTP сервера письма пишутся в MAIL_FILE, а без него - в журнал
+	Mail struct {
+		SMTPAddr     string `env:"MAIL_SMTP_ADDR" env-default:""`
+		SMTPUsername string `env:"MAIL_SMTP_USERNAME" env-default:""`
+		SMTPPassword string `env:"MAIL_SMTP_PASSWORD" env-default:""`
+		From         string `env:"MAIL_FROM" env-default:"lk-auth <noreply@localhost>"`
+		File         string `env:"MAIL_FILE" env-default:""`
+	}
+
+	PasswordReset struct {
+		// Страница сброса пароля, ссылка в письме - PASSWORD_RESET_URL?token=...
+		URL string        `env:"PASSWORD_RESET_URL" env-default:""`
+		TTL time.Duration `env:"PASSWORD_RESET_TTL" env-default:"30m"`
+	}
+
+	// Хэширование паролей Argon2id. PEPPER - необязательный секрет, которым пароль подписывается перед хэшированием.
+	// Хэши bcrypt и хэши с другими параметрами пересчитываются при входе
+	PasswordHash struct {
+		Pepper        string `env:"PASSWORD_PEPPER" env-default:""`
+		Argon2Memory  uint32 `env:"ARGON2_MEMORY" env-default:"19456"`
+		Argon2Time    uint32 `env:"ARGON2_TIME" env-default:"2"`
+		Argon2Threads uint8  `env:"ARGON2_THREADS" env-default:"1"`
+	}
+
+	// Политика паролей при регистрации, смене и сбросе пароля. BREACHED_FILE - выгрузка Pwned Passwords
+	// (строки SHA1:COUNT, отсортированные по хэшу), пароли из неё отклоняются. Пустой путь - проверка по утечкам отключена
+	PasswordPolicy struct {
+		MinLength    int    `env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+		MinClasses   int    `env:"PASSWORD_MIN_CLASSES" env-default:"1"`
+		BreachedFile string `env:"PASSWORD_BREACHED_FILE" env-default:""`
+	}
+
+	// Подтверждение email при регистрации. MODE: off - не проверяется, refuse - вход запрещён до подтверждения,
+	// restrict - до подтверждения выдаются токены с ролью unverified
+	EmailVerification struct {
+		Mode string        `env:"EMAIL_VERIFICATION_MODE" env-default:"off"`
+		URL  string        `env:"EMAIL_VERIFICATION_URL" env-default:""`
+		TTL  time.Duration `env:"EMAIL_VERIFICATION_TTL" env-default:"24h"`
+	}
+
+	// Реестр ролей. FILE - JSON с ролями, их правами и наследованием, пустой путь - роли guest, user и admin.
+	// ADMIN_EMAILS - уже зарегистрированные пользователи, которым при запуске назначается роль admin
+	Roles struct {
+		File        string   `env:"ROLES_FILE" env-default:""`
+		AdminEmails []string `env:"ADMIN_EMAILS" env-separator:","`
+	}
+
+	// Журнал аудита. SINK: log - записи только в журнал приложения, без просмотра через API,
+	// redis - поток в REDIS_URL (до REDIS_MAXLEN записей, 0 - без ограничения), postgres - таблица в USERS_URL, file - JSONL в FILE
+	Audit struct {
+		Sink        string `env:"AUDIT_SINK" env-default:"log"`
+		File        string `env:"AUDIT_FILE" env-default:"audit.jsonl"`
+		RedisMaxLen int64  `env:"AUDIT_REDIS_MAXLEN" env-default:"0"`
+	}
+
+	// Сроки выполнения. DEFAULT и PASSWORD - сроки HTTP запроса: по истечении контекст запроса отменяется вместе
+	// с обращениями к хранилищам в нём. PASSWORD - для эндпоинтов с хэшированием пароля, DEFAULT - для остальных.
+	// STORAGE - срок каждой операции хранилища, в том числе вне запросов: при запуске и при записи в журнал аудита.
+	// 0 - без ограничения
+	Timeout struct {
+		Default  time.Duration `env:"TIMEOUT_DEFAULT" env-default:"5s"`
+		Password time.Duration `env:"TIMEOUT_PASSWORD" env-default:"10s"`
+		Storage  time.Duration `env:"TIMEOUT_STORAGE" env-default:"3s"`
+	}
+
+	// Адреса и подсети (CIDR) обратных прокси и балансировщиков через запятую. Только от них принимается адрес клиента
+	// в X-Forwarded-For и X-Real-IP для лимитов запросов, блокировки входа по IP и сессий. Пустой - адрес соединения
+	TrustedProxies []string `env:"TRUSTED_PROXIES" env-separator:","`
+
+	// Лимиты запросов к эндпоинтам. Отключаются, если их уже обеспечивает шлюз перед сервисом
+	RateLimitEnabled bool `env:"RATE_LIMIT_ENABLED" env-default:"true"`
 
 	URL  string `env:"URL" env-default:""`
 	Port string `env:"PORT" env-default:"80"`
@@ -22,9 +127,19 @@ type Config struct {
 		Access  time.Duration `env:"TTL_ACCESS" env-default:"15m"`
 		Refresh time.Duration `env:"TTL_REFRESH" env-default:"1h"`
 	}
+	// Журнал приложения. FORMAT: text, json или tint (цветной текст), пустой - json в prod и tint в остальных окружениях.
+	// OUTPUT - куда писать через запятую: stdout и (или) file, каждый не больше одного раза. Отправки по OTLP нет:
+	// в коллектор журнал доставляет агент, читающий stdout или файл. Файл FILE в формате FILE_FORMAT по достижении
+	// FILE_MAX_SIZE мегабайт переименовывается в FILE.1, хранится FILE_MAX_BACKUPS прежних файлов
 	Logger struct {
-		Level        *slog.Level `env:"LOGGER_LEVEL" env-default:"INFO"`
-		ShowPathCall bool        `env:"LOGGER_SHOW_PATH_CALL" env-default:"false"`
+		Level          *slog.Level `env:"LOGGER_LEVEL" env-default:"INFO"`
+		ShowPathCall   bool        `env:"LOGGER_SHOW_PATH_CALL" env-default:"false"`
+		Format         string      `env:"LOGGER_FORMAT" env-default:""`
+		Output         []string    `env:"LOGGER_OUTPUT" env-separator:"," env-default:"stdout"`
+		File           string      `env:"LOGGER_FILE" env-default:"lk-auth.log"`
+		FileFormat     string      `env:"LOGGER_FILE_FORMAT" env-default:"json"`
+		FileMaxSize    int64       `env:"LOGGER_FILE_MAX_SIZE" env-default:"100"`
+		FileMaxBackups int         `env:"LOGGER_FILE_MAX_BACKUPS" env-default:"5"`
 	} 
 	PingTime time.Duration `env:"PING_TIME" env-default:"1m"`
 	Shutdown struct {
@@ -47,7 +162,31 @@ func MustLoad() *Config {
 	if err := cleanenv.ReadEnv(cfg); err != nil {
 		panic(err.Error())
 	}
+	if err := cfg.validate(); err != nil {
+		panic(err.Error())
+	}
 
 	return cfg
 }
 
+// validate проверяет то, что cleanenv не проверяет сам
+func (cfg *Config) validate() error {
+	seen := map[string]bool{}
+	for _, output := range cfg.Logger.Output {
+		output = strings.TrimSpace(output)
+		switch output {
+		case "stdout", "file":
+		case "otlp":
+			return errors.New("LOGGER_OUTPUT otlp is not supported, ship stdout or the log file with a collector agent")
+		default:
+			return fmt.Errorf("unknown LOGGER_OUTPUT %q", output)
+		}
+		// Второй file открыл бы тот же файл ещё раз, и первый дескриптор не закрылся бы
+		if seen[output] {
+			return fmt.Errorf("LOGGER_OUTPUT %q is listed more than once", output)
+		}
+		seen[output] = true
+	}
+	return nil
+}
+
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLoggerOutput(t *testing.T) {
+	cases := []struct {
+		output []string
+		valid  bool
+	}{
+		{[]string{"stdout"}, true},
+		{[]string{"stdout", " file"}, true},
+		{[]string{"file", "file"}, false},
+		{[]string{"stdout", " stdout"}, false},
+		{[]string{"otlp"}, false},
+		{[]string{"syslog"}, false},
+	}
+	for _, c := range cases {
+		cfg := &Config{}
+		cfg.Logger.Output = c.output
+		err := cfg.validate()
+		if c.valid {
+			assert.NoError(t, err, c.output)
+		} else {
+			assert.Error(t, err, c.output)
+		}
+	}
+}
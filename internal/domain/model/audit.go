@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// AuditRecord - запись журнала аудита: кто (Actor), что сделал (Action) и с кем (Subject)
+type AuditRecord struct {
+	Time   time.Time
+	Action string
+	// Email того, кто выполнил действие. Пустой, если он неизвестен, например у недействительного токена
+	Actor   string
+	Subject string
+	// Параметры действия, например назначенная роль или строка поиска
+	Details   string
+	IP        string
+	UserAgent string
+	Result    string
+	// Причина неудачи
+	Reason string
+}
+
+// AuditFilter - условия выборки из журнала аудита. Пустые поля выборку не ограничивают
+type AuditFilter struct {
+	// Промежуток времени [From, To)
+	From    time.Time
+	To      time.Time
+	Actor   string
+	Subject string
+	Action  string
+	// Наибольшее число записей, 0 - без ограничения
+	Limit int
+}
+
+// Match проверяет все условия, кроме Limit
+func (f AuditFilter) Match(rec AuditRecord) bool {
+	return (f.From.IsZero() || !rec.Time.Before(f.From)) &&
+		(f.To.IsZero() || rec.Time.Before(f.To)) &&
+		(f.Actor == "" || f.Actor == rec.Actor) &&
+		(f.Subject == "" || f.Subject == rec.Subject) &&
+		(f.Action == "" || f.Action == rec.Action)
+}
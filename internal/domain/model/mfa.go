@@ -0,0 +1,13 @@
+package model
+
+// MFA - настройки второго фактора пользователя
+type MFA struct {
+	// Секрет TOTP в base32
+	Secret string
+	// Секрет подтверждён первым кодом. Только после этого вход требует второй фактор
+	Confirmed bool
+	// SHA-256 неиспользованных кодов восстановления
+	RecoveryCodes []string
+	// Шаг TOTP последнего принятого кода, коды этого и более ранних шагов повторно не принимаются
+	LastCounter int64
+}
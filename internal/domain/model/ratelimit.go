@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Состояние лимита запросов после очередного обращения
+type RateLimit struct {
+	Allowed bool
+	Limit   int64
+	// Сколько ещё запросов разрешено прямо сейчас
+	Remaining int64
+	// Через сколько освободится квота: конец текущего окна или, при отказе, RetryAfter
+	Reset time.Duration
+	// Через сколько будет разрешён следующий запрос. 0, если запрос разрешён
+	RetryAfter time.Duration
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Сессия - один вход пользователя с конкретного устройства.
+// ID сессии совпадает с идентификатором семейства её refresh токенов.
+type Session struct {
+	ID         string
+	Email      string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	IP         string
+	UserAgent  string
+}
+
+// Сведения о клиенте, от имени которого выполняется запрос
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
@@ -0,0 +1,14 @@
+package model
+
+// Назначения одноразовых токенов, отправляемых по почте
+const (
+	TokenPurposePasswordReset = "password_reset"
+)
+
+// Одноразовый токен из письма. Сам токен не хранится, только его хэш
+type OneTimeToken struct {
+	Purpose string
+	Email   string
+	// Версия данных пользователя на момент выдачи: после смены пароля токен недействителен
+	Version float64
+}
@@ -6,4 +6,10 @@ type User struct {
 	PasswordHash string
 	Role         string
 	Version      float64
+	// Владелец подтвердил, что адрес принадлежит ему
+	EmailVerified bool
+	// Заблокирован администратором: вход запрещён
+	Disabled bool
+	// Права роли с учётом наследования. Не хранятся, а вычисляются при выдаче access токена
+	Permissions []string
 }
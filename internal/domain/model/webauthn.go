@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// WebAuthnCredential - ключ доступа (passkey), зарегистрированный пользователем
+type WebAuthnCredential struct {
+	// Идентификатор, выданный аутентификатором
+	ID    []byte
+	Email string
+	// Идентификатор пользователя у аутентификатора (user handle), общий для всех ключей пользователя.
+	// Случайный, чтобы не раскрывать email.
+	UserHandle []byte
+	// Открытый ключ в формате COSE
+	PublicKey       []byte
+	AttestationType string
+	Transports      []string
+	AAGUID          []byte
+	// Счётчик подписей. Если аутентификатор его ведёт, значение только растёт,
+	// уменьшение означает клонированный ключ
+	SignCount      uint32
+	BackupEligible bool
+	BackupState    bool
+	CreatedAt      time.Time
+}
@@ -0,0 +1,178 @@
+package hash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errInvalidHash = errors.New("invalid argon2id hash")
+
+// Argon2Params - параметры Argon2id (RFC 9106)
+type Argon2Params struct {
+	// Память в КиБ
+	Memory uint32
+	// Число проходов
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// Минимальные рекомендации OWASP для Argon2id: 19 МиБ памяти, 2 прохода, 1 поток
+var DefaultArgon2Params = Argon2Params{
+	Memory:  19 * 1024,
+	Time:    2,
+	Threads: 1,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+type Argon2idHasher struct {
+	params Argon2Params
+	// Перец хранится вне базы: без него утёкшие хэши нельзя перебирать.
+	// Хэши с перцем помечаются параметром keyid, чтобы смену перца можно было обнаружить
+	pepper []byte
+	keyID  string
+}
+
+// pepper - необязательный секрет сервера, которым пароль подписывается (HMAC-SHA256) перед хэшированием
+func NewArgon2idHasher(params Argon2Params, pepper []byte) PasswordHasher {
+	h := &Argon2idHasher{params: params}
+	if len(pepper) > 0 {
+		h.pepper = pepper
+		sum := sha256.Sum256(pepper)
+		h.keyID = base64.RawStdEncoding.EncodeToString(sum[:6])
+	}
+	return h
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(h.input(password, h.keyID != ""), salt, h.params.Time, h.params.Memory, h.params.Threads, h.params.KeyLen)
+
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", h.params.Memory, h.params.Time, h.params.Threads)
+	if h.keyID != "" {
+		params += ",keyid=" + h.keyID
+	}
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s",
+		argon2.Version,
+		params,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, bool) {
+	if isBcrypt(encoded) {
+		// bcrypt учитывает только первые 72 байта, поэтому после проверки хэш сразу заменяется на Argon2id
+		ok := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+		return ok, ok
+	}
+
+	// Хэш, который нельзя проверить, занимает столько же времени, сколько обычный: иначе по времени ответа
+	// видно, какие учётные записи заблокированы ForcePasswordReset ("!") или хэшированы со старым перцем
+	hash, err := parseArgon2id(encoded)
+	if err != nil {
+		h.Simulate(password)
+		return false, false
+	}
+	// Хэш вычислен с другим перцем: проверить его нечем
+	if hash.keyID != "" && hash.keyID != h.keyID {
+		h.Simulate(password)
+		return false, false
+	}
+
+	key := argon2.IDKey(h.input(password, hash.keyID != ""), hash.salt, hash.params.Time, hash.params.Memory, hash.params.Threads, uint32(len(hash.key)))
+	if subtle.ConstantTimeCompare(key, hash.key) != 1 {
+		return false, false
+	}
+
+	// Хэш без перца или с параметрами, отличными от текущих, пересчитывается
+	return true, hash.keyID != h.keyID || hash.params != h.params
+}
+
+func (h *Argon2idHasher) Simulate(password string) {
+	salt := make([]byte, h.params.SaltLen)
+	argon2.IDKey(h.input(password, h.keyID != ""), salt, h.params.Time, h.params.Memory, h.params.Threads, h.params.KeyLen)
+}
+
+// input возвращает то, что хэшируется: сам пароль или его HMAC с перцем
+func (h *Argon2idHasher) input(password string, peppered bool) []byte {
+	if !peppered {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+type argon2idHash struct {
+	params Argon2Params
+	keyID  string
+	salt   []byte
+	key    []byte
+}
+
+// parseArgon2id разбирает $argon2id$v=19$m=..,t=..,p=..[,keyid=..]$salt$hash
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return nil, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errInvalidHash
+	}
+
+	hash := &argon2idHash{}
+	for param := range strings.SplitSeq(parts[3], ",") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, errInvalidHash
+		}
+		var err error
+		switch name {
+		case "m":
+			_, err = fmt.Sscanf(value, "%d", &hash.params.Memory)
+		case "t":
+			_, err = fmt.Sscanf(value, "%d", &hash.params.Time)
+		case "p":
+			_, err = fmt.Sscanf(value, "%d", &hash.params.Threads)
+		case "keyid":
+			hash.keyID = value
+		default:
+			err = errInvalidHash
+		}
+		if err != nil {
+			return nil, errInvalidHash
+		}
+	}
+	if hash.params.Memory == 0 || hash.params.Time == 0 || hash.params.Threads == 0 {
+		return nil, errInvalidHash
+	}
+
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errInvalidHash
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hash.key) == 0 {
+		return nil, errInvalidHash
+	}
+	hash.params.SaltLen = uint32(len(hash.salt))
+	hash.params.KeyLen = uint32(len(hash.key))
+
+	return hash, nil
+}
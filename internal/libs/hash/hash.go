@@ -1,13 +1,33 @@
 package hash
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"strings"
+	"sync"
+)
 
-func HashPassword(password string) ([]byte, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 10)
-	return bytes, err
+// PasswordHasher вычисляет и проверяет хэши паролей в формате PHC string format
+// ($id$v=..$param=..,..$salt$hash). Хэши bcrypt, выданные до перехода на Argon2id, только проверяются.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify сообщает, подходит ли пароль к хэшу, и нужно ли пересчитать хэш:
+	// он в устаревшем формате или вычислен с параметрами слабее текущих
+	Verify(password, encoded string) (ok, rehash bool)
+	// Simulate занимает столько же времени, сколько Verify.
+	// Вызывается, когда пользователя нет, чтобы по времени ответа нельзя было понять, существует ли учётная запись.
+	Simulate(password string)
 }
 
-func CheckPasswordHash(password, hash []byte) bool {
-	err := bcrypt.CompareHashAndPassword(hash, password)
-	return err == nil
+// Без явно заданного хэшера используется Argon2id с параметрами по умолчанию и без перца
+var defaultHasher = sync.OnceValue(func() PasswordHasher {
+	return NewArgon2idHasher(DefaultArgon2Params, nil)
+})
+
+// Default возвращает хэшер Argon2id с [DefaultArgon2Params] без перца
+func Default() PasswordHasher {
+	return defaultHasher()
+}
+
+// isBcrypt распознаёт хэши bcrypt в формате $2a$, $2b$ или $2y$
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
 }
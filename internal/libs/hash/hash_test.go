@@ -0,0 +1,132 @@
+package hash
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Слабые параметры ускоряют тесты
+var testParams = Argon2Params{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := NewArgon2idHasher(testParams, nil)
+
+	encoded, err := hasher.Hash("password")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$"), encoded)
+
+	ok, rehash := hasher.Verify("password", encoded)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, _ = hasher.Verify("wrong", encoded)
+	assert.False(t, ok)
+
+	// Соль случайна: одинаковые пароли дают разные хэши
+	other, err := hasher.Hash("password")
+	require.NoError(t, err)
+	assert.NotEqual(t, encoded, other)
+
+	// Пароль длиннее 72 байт не усекается
+	long := strings.Repeat("a", 80)
+	encoded, err = hasher.Hash(long)
+	require.NoError(t, err)
+	ok, _ = hasher.Verify(long[:72], encoded)
+	assert.False(t, ok)
+
+	t.Run("parameters changed", func(t *testing.T) {
+		encoded, err := hasher.Hash("password")
+		require.NoError(t, err)
+
+		stronger := testParams
+		stronger.Time = 2
+		ok, rehash := NewArgon2idHasher(stronger, nil).Verify("password", encoded)
+		assert.True(t, ok)
+		assert.True(t, rehash)
+	})
+
+	t.Run("invalid hash", func(t *testing.T) {
+		for _, encoded := range []string{
+			"",
+			"password",
+			"$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaA",
+			"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaA",
+			"$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaA",
+			"$argon2id$v=19$m=64,t=1,p=1,x=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaA",
+			"$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA",
+		} {
+			ok, _ := hasher.Verify("password", encoded)
+			assert.False(t, ok, encoded)
+		}
+	})
+}
+
+func TestBcryptRehash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	hasher := NewArgon2idHasher(testParams, nil)
+	ok, rehash := hasher.Verify("password", string(legacy))
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	ok, rehash = hasher.Verify("wrong", string(legacy))
+	assert.False(t, ok)
+	assert.False(t, rehash)
+}
+
+func TestPepper(t *testing.T) {
+	plain := NewArgon2idHasher(testParams, nil)
+	peppered := NewArgon2idHasher(testParams, []byte("pepper"))
+
+	encoded, err := peppered.Hash("password")
+	require.NoError(t, err)
+	assert.Contains(t, encoded, ",keyid=")
+
+	ok, rehash := peppered.Verify("password", encoded)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	// Без перца или с другим перцем хэш не проверить
+	ok, _ = plain.Verify("password", encoded)
+	assert.False(t, ok)
+	ok, _ = NewArgon2idHasher(testParams, []byte("other")).Verify("password", encoded)
+	assert.False(t, ok)
+
+	// Хэш, вычисленный до появления перца, проверяется и пересчитывается уже с перцем
+	encoded, err = plain.Hash("password")
+	require.NoError(t, err)
+	ok, rehash = peppered.Verify("password", encoded)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+}
+
+// Непроверяемые хэши проверяются не быстрее обычных, чтобы время ответа не выдавало состояние учётной записи
+func TestVerifyUnverifiableTakesArgon2Time(t *testing.T) {
+	params := Argon2Params{Memory: 32 * 1024, Time: 3, Threads: 1, SaltLen: 16, KeyLen: 32}
+	hasher := NewArgon2idHasher(params, []byte("pepper"))
+	encoded, err := hasher.Hash("password")
+	require.NoError(t, err)
+	otherPepper, err := NewArgon2idHasher(params, []byte("old pepper")).Hash("password")
+	require.NoError(t, err)
+
+	elapsed := func(encoded string) time.Duration {
+		start := time.Now()
+		ok, _ := hasher.Verify("wrong", encoded)
+		assert.False(t, ok)
+		return time.Since(start)
+	}
+	valid := elapsed(encoded)
+	for name, encoded := range map[string]string{
+		"force reset":  "!",
+		"invalid hash": "$argon2id$v=19$m=64$salt$key",
+		"other pepper": otherPepper,
+	} {
+		assert.Greater(t, elapsed(encoded), valid/2, name)
+	}
+}
@@ -0,0 +1,55 @@
+package sl
+
+import (
+	"context"
+	"log/slog"
+)
+
+type ctxKey struct{}
+
+// ContextWith возвращает контекст с атрибутами, которые ContextHandler добавит ко всем записям, сделанным с этим контекстом,
+// например ID запроса и пользователь. Атрибуты родительского контекста сохраняются
+func ContextWith(ctx context.Context, attrs ...slog.Attr) context.Context {
+	parent := AttrsFromContext(ctx)
+	merged := make([]slog.Attr, 0, len(parent)+len(attrs))
+	merged = append(append(merged, parent...), attrs...)
+	return context.WithValue(ctx, ctxKey{}, merged)
+}
+
+// AttrsFromContext возвращает атрибуты, добавленные в контекст ContextWith
+func AttrsFromContext(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	return attrs
+}
+
+// ContextHandler добавляет к записи атрибуты из её контекста, поэтому вызовы slog.*Context не передают их явно
+type ContextHandler struct {
+	next slog.Handler
+}
+
+func NewContextHandler(next slog.Handler) *ContextHandler {
+	return &ContextHandler{next: next}
+}
+
+func (h *ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := AttrsFromContext(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{next: h.next.WithGroup(name)}
+}
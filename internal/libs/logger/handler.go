@@ -0,0 +1,34 @@
+package sl
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/lmittmann/tint"
+)
+
+// Форматы вывода журнала
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	// Цветной текст для терминала, не предназначен для разбора
+	FormatTint = "tint"
+)
+
+// NewHandler создаёт обработчик, пишущий в w в формате format
+func NewHandler(format string, w io.Writer, opts *slog.HandlerOptions) (slog.Handler, error) {
+	switch format {
+	case FormatText:
+		return slog.NewTextHandler(w, opts), nil
+	case FormatJSON:
+		return slog.NewJSONHandler(w, opts), nil
+	case FormatTint:
+		return tint.NewHandler(w, &tint.Options{
+			AddSource: opts.AddSource,
+			Level:     opts.Level,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
@@ -0,0 +1,99 @@
+package sl_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	sl "lk-auth/internal/libs/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHandler(t *testing.T) {
+	for _, format := range []string{sl.FormatText, sl.FormatJSON, sl.FormatTint} {
+		buf := &bytes.Buffer{}
+		h, err := sl.NewHandler(format, buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+		require.NoError(t, err, format)
+
+		log := slog.New(h)
+		log.Debug("hidden")
+		log.Info("shown", "email", "test@example.com")
+
+		assert.NotContains(t, buf.String(), "hidden", format)
+		assert.Contains(t, buf.String(), "test@example.com", format)
+	}
+
+	buf := &bytes.Buffer{}
+	h, err := sl.NewHandler(sl.FormatJSON, buf, nil)
+	require.NoError(t, err)
+	slog.New(h).Info("json")
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "json", entry["msg"])
+
+	_, err = sl.NewHandler("xml", buf, nil)
+	assert.Error(t, err)
+}
+
+func TestFanoutHandler(t *testing.T) {
+	debug, info := &bytes.Buffer{}, &bytes.Buffer{}
+	log := slog.New(sl.NewFanoutHandler(
+		slog.NewJSONHandler(debug, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		slog.NewTextHandler(info, &slog.HandlerOptions{Level: slog.LevelInfo}),
+	))
+
+	log.With("service", "lk-auth").WithGroup("req").Debug("debug only", "path", "/login")
+	log.Info("everywhere")
+
+	assert.Contains(t, debug.String(), `"service":"lk-auth","req":{"path":"/login"}`)
+	assert.Contains(t, debug.String(), "everywhere")
+	assert.NotContains(t, info.String(), "debug only")
+	assert.Contains(t, info.String(), "everywhere")
+}
+
+// failingHandler не может записать ни одной записи
+type failingHandler struct {
+	slog.Handler
+}
+
+func (failingHandler) Handle(context.Context, slog.Record) error {
+	return errors.New("disk full")
+}
+
+func TestFanoutHandlerWritesDespiteErrors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := sl.NewFanoutHandler(
+		failingHandler{slog.NewJSONHandler(buf, nil)},
+		slog.NewJSONHandler(buf, nil),
+	)
+
+	err := h.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "written", 0))
+	assert.Error(t, err)
+	assert.Contains(t, buf.String(), "written")
+}
+
+func TestContextHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(sl.NewContextHandler(sl.NewRedactHandler(slog.NewJSONHandler(buf, nil))))
+
+	ctx := sl.ContextWith(context.Background(), slog.String("request_id", "r1"))
+	ctx = sl.ContextWith(ctx, slog.String("user", "test@example.com"), slog.String("token", jwtToken))
+	log.InfoContext(ctx, "with context")
+
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "r1", entry["request_id"])
+	assert.Equal(t, "test@example.com", entry["user"])
+	// Атрибуты из контекста маскируются так же, как остальные
+	assert.Equal(t, sl.Redacted, entry["token"])
+
+	buf.Reset()
+	log.Info("without context")
+	assert.NotContains(t, buf.String(), "request_id")
+}
@@ -0,0 +1,106 @@
+package sl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted заменяет значения, которые нельзя писать в журнал
+const Redacted = "[REDACTED]"
+
+// Ключи атрибутов с секретами без учёта регистра. Ключи с суффиксами _password, _token и _secret тоже маскируются
+var sensitiveKeys = map[string]struct{}{
+	"password":      {},
+	"token":         {},
+	"refresh_token": {},
+	"secret":        {},
+}
+
+var sensitiveSuffixes = []string{"_password", "_token", "_secret"}
+
+// Три части base64url через точку, заголовок JWT всегда начинается с {" - eyJ
+var jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// RedactHandler маскирует значения атрибутов с секретами в ключе и JWT в сообщениях и значениях,
+// в том числе в атрибутах из WithAttrs, во вложенных группах и в значениях slog.LogValuer
+type RedactHandler struct {
+	next slog.Handler
+}
+
+func NewRedactHandler(next slog.Handler) *RedactHandler {
+	return &RedactHandler{next: next}
+}
+
+func (h *RedactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return &RedactHandler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	return &RedactHandler{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redacted[i] = redactAttr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindAny:
+		// Ошибки, структуры и прочие значения обработчик выводит как текст, поэтому проверяется их текстовое представление
+		text := fmt.Sprintf("%+v", v.Any())
+		if jwtPattern.MatchString(text) {
+			return slog.String(a.Key, redactString(text))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if _, ok := sensitiveKeys[key]; ok {
+		return true
+	}
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactString(s string) string {
+	if !strings.Contains(s, "eyJ") {
+		return s
+	}
+	return jwtPattern.ReplaceAllString(s, Redacted)
+}
@@ -0,0 +1,69 @@
+package sl_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sl "lk-auth/internal/libs/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "lk-auth.log")
+	f, err := sl.NewRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		n, err := f.Write([]byte(line))
+		require.NoError(t, err)
+		assert.Equal(t, len(line), n)
+	}
+	require.NoError(t, f.Close())
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		return string(data)
+	}
+	// Каждая запись переполняет файл, поэтому лежит в своём файле, а самая старая удалена
+	assert.Equal(t, "fourth\n", read(path))
+	assert.Equal(t, "third\n", read(path+".1"))
+	assert.Equal(t, "second\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lk-auth.log")
+	require.NoError(t, os.WriteFile(path, []byte("before restart\n"), 0o644))
+
+	f, err := sl.NewRotatingFile(path, 0, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte(strings.Repeat("x", 100) + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "before restart\n"))
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lk-auth.log")
+	f, err := sl.NewRotatingFile(path, 5, 0)
+	require.NoError(t, err)
+	for _, line := range []string{"first\n", "second\n"} {
+		_, err = f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "second\n", string(data))
+	assert.NoFileExists(t, path+".1")
+}
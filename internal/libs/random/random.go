@@ -0,0 +1,20 @@
+// В этом файле собраны генераторы случайных идентификаторов.
+package random
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// ID возвращает криптографически стойкий 128-битный идентификатор в base64url без выравнивания.
+func ID() string {
+	return String(16)
+}
+
+// String возвращает n случайных байт в кодировке base64url без выравнивания.
+func String(n int) string {
+	b := make([]byte, n)
+	// crypto/rand.Read не возвращает ошибок на поддерживаемых платформах
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,80 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"lk-auth/internal/libs/totp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Тестовый секрет SHA1 из приложения B RFC 6238
+var secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// Последние 6 цифр 8-значных кодов из RFC 6238
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, c := range cases {
+		code, err := totp.Code(secret, time.Unix(c.unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, c.code, code, "time %d", c.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, err := totp.Code(secret, now)
+	require.NoError(t, err)
+
+	counter, ok := totp.Validate(secret, code, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, totp.Counter(now), counter)
+
+	// Соседний шаг допускается, более далёкий - нет
+	_, ok = totp.Validate(secret, code, now.Add(totp.Period), 1)
+	assert.True(t, ok)
+	_, ok = totp.Validate(secret, code, now.Add(2*totp.Period), 1)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(secret, "000000", now, 1)
+	assert.False(t, ok)
+	_, ok = totp.Validate(secret, "12345", now, 1)
+	assert.False(t, ok)
+	_, ok = totp.Validate("not base32!", code, now, 1)
+	assert.False(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	first, second := totp.GenerateSecret(), totp.GenerateSecret()
+	assert.NotEqual(t, first, second)
+
+	_, err := totp.Code(first, time.Now())
+	assert.NoError(t, err)
+}
+
+func TestURI(t *testing.T) {
+	uri := totp.URI("lk-auth", "user@mail.com", "JBSWY3DPEHPK3PXP")
+
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/lk-auth:user@mail.com", u.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", u.Query().Get("secret"))
+	assert.Equal(t, "lk-auth", u.Query().Get("issuer"))
+}
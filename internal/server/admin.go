@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+	"lk-auth/internal/storage"
+)
+
+// Размер страницы списка пользователей и выборки журнала аудита по умолчанию и наибольший
+const (
+	defaultUsersLimit = 50
+	maxUsersLimit     = 100
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	query := r.URL.Query()
+	limit, ok := queryLimit(w, query.Get("limit"), defaultUsersLimit, maxUsersLimit)
+	if !ok {
+		return
+	}
+
+	users, next, err := s.auth.ListUsers(r.Context(), token, query.Get("email"), query.Get("cursor"), limit, clientInfo(r))
+	if err != nil {
+		s.writeAdminErr(w, r, "/admin/users", err)
+		return
+	}
+
+	list := schemas.UserList{Users: make([]schemas.User, len(users)), NextCursor: next}
+	for i, user := range users {
+		list.Users[i] = userSchema(user)
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func (s *Server) handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := model.AuditFilter{
+		Actor:   query.Get("actor"),
+		Subject: query.Get("subject"),
+		Action:  query.Get("action"),
+	}
+	if filter.Limit, ok = queryLimit(w, query.Get("limit"), defaultAuditLimit, maxAuditLimit); !ok {
+		return
+	}
+	for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, name+" must be an RFC 3339 time")
+			return
+		}
+		*dst = t
+	}
+
+	records, err := s.auth.AuditLog(r.Context(), token, filter, clientInfo(r))
+	if err != nil {
+		s.writeAdminErr(w, r, "/admin/audit", err)
+		return
+	}
+
+	auditLog := schemas.AuditLog{Records: make([]schemas.AuditRecord, len(records))}
+	for i, rec := range records {
+		auditLog.Records[i] = schemas.AuditRecord{
+			Time:      rec.Time,
+			Action:    rec.Action,
+			Actor:     rec.Actor,
+			Subject:   rec.Subject,
+			Details:   rec.Details,
+			IP:        rec.IP,
+			UserAgent: rec.UserAgent,
+			Result:    rec.Result,
+			Reason:    rec.Reason,
+		}
+	}
+	json.NewEncoder(w).Encode(auditLog)
+}
+
+// queryLimit разбирает параметр limit. Если он вне [1, maxLimit], отвечает 400 и возвращает false
+func queryLimit(w http.ResponseWriter, raw string, defaultLimit, maxLimit int) (int, bool) {
+	if raw == "" {
+		return defaultLimit, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > maxLimit {
+		writeErr(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxLimit))
+		return 0, false
+	}
+	return n, true
+}
+
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	user, err := s.auth.GetUser(r.Context(), token, r.PathValue("email"), clientInfo(r))
+	if err != nil {
+		s.writeAdminErr(w, r, "/admin/users/{email}", err)
+		return
+	}
+	json.NewEncoder(w).Encode(userSchema(*user))
+}
+
+func (s *Server) handleGrantRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	data := schemas.GrantRoleData{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		s.log.DebugContext(r.Context(), "/admin/users/{email}/role", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if data.Role == "" {
+		writeErr(w, http.StatusBadRequest, "role is required")
+		return
+	}
+
+	err := s.auth.GrantRole(r.Context(), token, r.PathValue("email"), data.Role, clientInfo(r))
+	if err != nil {
+		s.writeAdminErr(w, r, "/admin/users/{email}/role", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUserAction выполняет действие над пользователем из пути без тела запроса и отвечает 204
+func (s *Server) handleUserAction(path string, action func(ctx context.Context, token, email string, client model.ClientInfo) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		token, ok := bearerToken(r)
+		if !ok {
+			writeErr(w, http.StatusUnauthorized, "bearer token is required")
+			return
+		}
+
+		if err := action(r.Context(), token, r.PathValue("email"), clientInfo(r)); err != nil {
+			s.writeAdminErr(w, r, path, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) writeAdminErr(w http.ResponseWriter, r *http.Request, path string, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidAccessToken):
+		writeErr(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		writeErr(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, auth.ErrUnknownRole):
+		writeErr(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, storage.ErrNotFound):
+		writeErr(w, http.StatusNotFound, "user not found")
+	case errors.Is(err, auth.ErrPasswordResetUnavailable),
+		errors.Is(err, auth.ErrAuditUnavailable):
+		writeErr(w, http.StatusNotImplemented, err.Error())
+	default:
+		s.log.ErrorContext(r.Context(), path, sl.Err(err))
+		writeErr(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// userSchema - сведения о пользователе без хэша пароля
+func userSchema(user model.User) schemas.User {
+	return schemas.User{
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+		Disabled:      user.Disabled,
+	}
+}
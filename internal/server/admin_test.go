@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+	"lk-auth/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listUsers(t *testing.T, srv *httptest.Server, accessToken, query string) schemas.UserList {
+	t.Helper()
+
+	res, body := do(t, srv, http.MethodGet, "/admin/users"+query, "", bearer(accessToken))
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+	list := schemas.UserList{}
+	require.NoError(t, json.Unmarshal(body, &list))
+	return list
+}
+
+func TestAdminUsers(t *testing.T) {
+	srv := newTestServer(t, withAdmin(t))
+	user := signinAndLogin(t, srv)
+	admin := loginAdmin(t, srv)
+
+	t.Run("requires users permissions", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodGet, "/admin/users", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		res, _ = do(t, srv, http.MethodGet, "/admin/users", "", bearer(user.Access_token))
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		res, _ = do(t, srv, http.MethodDelete, "/admin/users/"+email, "", bearer(user.Access_token))
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("list and search", func(t *testing.T) {
+		list := listUsers(t, srv, admin.Access_token, "")
+		assert.Len(t, list.Users, 2)
+		assert.Empty(t, list.NextCursor)
+
+		list = listUsers(t, srv, admin.Access_token, "?email=ADMIN")
+		require.Len(t, list.Users, 1)
+		assert.Equal(t, adminEmail, list.Users[0].Email)
+		assert.True(t, list.Users[0].EmailVerified)
+
+		// Постраничный обход возвращает каждого пользователя ровно один раз
+		first := listUsers(t, srv, admin.Access_token, "?limit=1")
+		require.Len(t, first.Users, 1)
+		require.NotEmpty(t, first.NextCursor)
+		second := listUsers(t, srv, admin.Access_token, "?limit=1&cursor="+first.NextCursor)
+		require.Len(t, second.Users, 1)
+		assert.NotEqual(t, first.Users[0].Email, second.Users[0].Email)
+
+		res, _ := do(t, srv, http.MethodGet, "/admin/users?limit=1000", "", bearer(admin.Access_token))
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		res, body := do(t, srv, http.MethodGet, "/admin/users/"+email, "", bearer(admin.Access_token))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.NotContains(t, string(body), "password")
+		got := schemas.User{}
+		require.NoError(t, json.Unmarshal(body, &got))
+		assert.Equal(t, email, got.Email)
+		assert.False(t, got.Disabled)
+
+		res, _ = do(t, srv, http.MethodGet, "/admin/users/unknown@example.com", "", bearer(admin.Access_token))
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("disable and enable", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPost, "/admin/users/"+email+"/disable", "", bearer(admin.Access_token))
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.False(t, introspect(t, srv, user.Access_token).Active)
+
+		res, _ = do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		res, _ = do(t, srv, http.MethodPost, "/admin/users/"+email+"/enable", "", bearer(admin.Access_token))
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+		user = login(t, srv)
+	})
+
+	t.Run("revoke sessions", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodDelete, "/admin/users/"+email+"/sessions", "", bearer(admin.Access_token))
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.False(t, introspect(t, srv, user.Access_token).Active)
+		res, _ = do(t, srv, http.MethodPost, "/refresh", `{"refresh_token":"`+user.Refresh_token+`"}`, nil)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("password reset not configured", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPost, "/admin/users/"+email+"/password-reset", "", bearer(admin.Access_token))
+		assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		user = login(t, srv)
+		res, _ := do(t, srv, http.MethodDelete, "/admin/users/"+email, "", bearer(admin.Access_token))
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.False(t, introspect(t, srv, user.Access_token).Active)
+
+		res, _ = do(t, srv, http.MethodDelete, "/admin/users/"+email, "", bearer(admin.Access_token))
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		res, _ = do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
+
+func TestAdminForcePasswordReset(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	t.Cleanup(wg.Wait)
+	tokenStorage, err := memory.NewMemoryOneTimeTokenStorage(t.Context(), wg, nil, time.Minute)
+	require.NoError(t, err)
+	box := &mailbox{}
+	srv := newTestServer(t, withAdmin(t), auth.WithPasswordReset(tokenStorage, box, auth.PasswordResetConfig{
+		URL: "https://lk-auth.test/reset",
+		TTL: time.Hour,
+	}))
+	user := signinAndLogin(t, srv)
+	admin := loginAdmin(t, srv)
+
+	res, _ := do(t, srv, http.MethodPost, "/admin/users/"+email+"/password-reset", "", bearer(admin.Access_token))
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	// Сессии завершены, старый пароль больше не подходит
+	assert.False(t, introspect(t, srv, user.Access_token).Active)
+	res, _ = do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	sent := box.sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, email, sent[0].To)
+	res, body := do(t, srv, http.MethodPost, "/password/reset", `{"token":"`+resetToken(t, sent[0])+`","new_password":"new-password"}`, nil)
+	require.Equal(t, http.StatusNoContent, res.StatusCode, string(body))
+	res, _ = do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"new-password"}`, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
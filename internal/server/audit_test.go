@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/audit"
+	"lk-auth/internal/service/auth"
+	"lk-auth/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func auditLog(t *testing.T, srv *httptest.Server, accessToken string, query url.Values) []schemas.AuditRecord {
+	t.Helper()
+
+	res, body := do(t, srv, http.MethodGet, "/admin/audit?"+query.Encode(), "", bearer(accessToken))
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+	log := schemas.AuditLog{}
+	require.NoError(t, json.Unmarshal(body, &log))
+	return log.Records
+}
+
+func TestAuditLog(t *testing.T) {
+	auditStorage, err := memory.NewMemoryAuditStorage(nil)
+	require.NoError(t, err)
+	srv := newTestServer(t, withAdmin(t), auth.WithAudit(auditStorage))
+
+	start := time.Now().Add(-time.Second)
+	user := signinAndLogin(t, srv)
+	res, _ := do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"wrong password"}`, nil)
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	admin := loginAdmin(t, srv)
+
+	t.Run("requires audit permission", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodGet, "/admin/audit", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		res, _ = do(t, srv, http.MethodGet, "/admin/audit", "", bearer(user.Access_token))
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("login results", func(t *testing.T) {
+		records := auditLog(t, srv, admin.Access_token, url.Values{
+			"subject": {email},
+			"action":  {audit.ActionLogin},
+		})
+		require.Len(t, records, 2)
+		assert.Equal(t, audit.ResultSuccess, records[0].Result)
+		assert.Equal(t, audit.ResultFailure, records[1].Result)
+		assert.NotEmpty(t, records[1].Reason)
+		assert.Equal(t, "127.0.0.1", records[1].IP)
+		assert.NotEmpty(t, records[1].UserAgent)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		records := auditLog(t, srv, admin.Access_token, url.Values{"actor": {email}})
+		require.NotEmpty(t, records)
+		assert.Equal(t, audit.ActionSignup, records[0].Action)
+		for _, rec := range records {
+			assert.Equal(t, email, rec.Actor)
+		}
+
+		records = auditLog(t, srv, admin.Access_token, url.Values{"from": {start.Format(time.RFC3339)}, "limit": {"1"}})
+		require.Len(t, records, 1)
+		assert.Equal(t, audit.ActionSignup, records[0].Action)
+
+		records = auditLog(t, srv, admin.Access_token, url.Values{"to": {start.Format(time.RFC3339)}})
+		assert.Empty(t, records)
+
+		res, _ := do(t, srv, http.MethodGet, "/admin/audit?from=yesterday", "", bearer(admin.Access_token))
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		res, _ = do(t, srv, http.MethodGet, "/admin/audit?limit=5000", "", bearer(admin.Access_token))
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("query is audited", func(t *testing.T) {
+		records := auditLog(t, srv, admin.Access_token, url.Values{"action": {audit.ActionAuditQuery}})
+		// Отказ пользователю без права audit:read тоже записан
+		require.GreaterOrEqual(t, len(records), 2)
+		assert.Equal(t, email, records[0].Actor)
+		assert.Equal(t, audit.ResultFailure, records[0].Result)
+		assert.Equal(t, adminEmail, records[len(records)-1].Actor)
+		assert.Equal(t, audit.ResultSuccess, records[len(records)-1].Result)
+	})
+}
+
+func TestAuditLogUnavailable(t *testing.T) {
+	srv := newTestServer(t, withAdmin(t))
+	admin := loginAdmin(t, srv)
+
+	res, _ := do(t, srv, http.MethodGet, "/admin/audit", "", bearer(admin.Access_token))
+	assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+}
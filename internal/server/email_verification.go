@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+)
+
+func (s *Server) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeErr(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	if err := s.auth.VerifyEmail(r.Context(), token); err != nil {
+		s.writeEmailVerificationErr(w, r, "/verify-email", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	data := schemas.ResendVerificationData{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		s.log.DebugContext(r.Context(), "/verify-email/resend", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if data.Email == "" {
+		writeErr(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	// Ответ одинаков для неизвестного, подтверждённого и неподтверждённого email
+	if err := s.auth.ResendVerificationEmail(r.Context(), data.Email); err != nil {
+		s.writeEmailVerificationErr(w, r, "/verify-email/resend", err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) writeEmailVerificationErr(w http.ResponseWriter, r *http.Request, path string, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidVerificationToken):
+		writeErr(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, auth.ErrEmailVerificationUnavailable):
+		writeErr(w, http.StatusNotImplemented, err.Error())
+	default:
+		s.log.ErrorContext(r.Context(), path, sl.Err(err))
+		writeErr(w, http.StatusInternalServerError, "internal error")
+	}
+}
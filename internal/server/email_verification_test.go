@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func verificationToken(t *testing.T, box *mailbox) string {
+	t.Helper()
+
+	sent := box.sent()
+	require.NotEmpty(t, sent)
+	assert.Equal(t, email, sent[len(sent)-1].To)
+	return mailToken(t, sent[len(sent)-1], "https://lk-auth.test/verify")
+}
+
+func TestEmailVerificationRefuse(t *testing.T) {
+	box := &mailbox{}
+	srv := newTestServer(t, auth.WithEmailVerification(box, auth.EmailVerificationConfig{
+		Mode: auth.EmailVerificationRefuse,
+		URL:  "https://lk-auth.test/verify",
+		TTL:  time.Hour,
+	}))
+
+	res, _ := do(t, srv, http.MethodPost, "/signin", `{"email":"`+email+`","password":"`+password+`","role":"user"}`, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	token := verificationToken(t, box)
+
+	res, _ = do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// Ссылка из письма не даёт доступа к ресурсам
+	assert.False(t, introspect(t, srv, token).Active)
+
+	t.Run("resend", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPost, "/verify-email/resend", `{"email":"`+email+`"}`, nil)
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+		require.Len(t, box.sent(), 2)
+
+		// Для неизвестного email ответ тот же, но письмо не отправляется
+		res, _ = do(t, srv, http.MethodPost, "/verify-email/resend", `{"email":"unknown@example.com"}`, nil)
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+		assert.Len(t, box.sent(), 2)
+	})
+
+	res, _ = do(t, srv, http.MethodGet, "/verify-email?token=wrong", "", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, body := do(t, srv, http.MethodGet, "/verify-email?token="+token, "", nil)
+	require.Equal(t, http.StatusNoContent, res.StatusCode, string(body))
+	login(t, srv)
+
+	t.Run("resend to verified email", func(t *testing.T) {
+		sent := len(box.sent())
+		res, _ := do(t, srv, http.MethodPost, "/verify-email/resend", `{"email":"`+email+`"}`, nil)
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+		assert.Len(t, box.sent(), sent)
+	})
+
+	t.Run("resend is throttled", func(t *testing.T) {
+		var res *http.Response
+		for range 4 {
+			res, _ = do(t, srv, http.MethodPost, "/verify-email/resend", `{"email":"throttled@example.com"}`, nil)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	})
+}
+
+func TestEmailVerificationRestrict(t *testing.T) {
+	box := &mailbox{}
+	srv := newTestServer(t, auth.WithEmailVerification(box, auth.EmailVerificationConfig{
+		Mode: auth.EmailVerificationRestrict,
+		URL:  "https://lk-auth.test/verify",
+		TTL:  time.Hour,
+	}))
+	tokens := signinAndLogin(t, srv)
+
+	info := introspect(t, srv, tokens.Access_token)
+	assert.True(t, info.Active)
+	assert.Equal(t, auth.RoleUnverified, info.Role)
+
+	// Второй фактор и ключи доступа подключаются только после подтверждения email
+	res, _ := do(t, srv, http.MethodPost, "/mfa/totp", "", bearer(tokens.Access_token))
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = do(t, srv, http.MethodPost, "/webauthn/register/begin", "", bearer(tokens.Access_token))
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res, _ = do(t, srv, http.MethodGet, "/verify-email?token="+verificationToken(t, box), "", nil)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	// Роль пользователя возвращается при обновлении токенов
+	res, body := do(t, srv, http.MethodPost, "/refresh", `{"refresh_token":"`+tokens.Refresh_token+`"}`, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+	rotated := schemas.Tokens{}
+	require.NoError(t, json.Unmarshal(body, &rotated))
+	assert.Equal(t, "user", introspect(t, srv, rotated.Access_token).Role)
+
+	res, _ = do(t, srv, http.MethodPost, "/mfa/totp", "", bearer(rotated.Access_token))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestEmailVerificationNotConfigured(t *testing.T) {
+	srv := newTestServer(t)
+
+	res, _ := do(t, srv, http.MethodGet, "/verify-email?token=token", "", nil)
+	assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+	res, _ = do(t, srv, http.MethodPost, "/verify-email/resend", `{"email":"`+email+`"}`, nil)
+	assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+}
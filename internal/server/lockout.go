@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"lk-auth/internal/service/auth"
+)
+
+// writeLockedErr отвечает 429 с Retry-After, если вход временно заблокирован
+func writeLockedErr(w http.ResponseWriter, err error) bool {
+	var locked *auth.LoginLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+	writeErr(w, http.StatusTooManyRequests, locked.Error())
+	return true
+}
+
+func (s *Server) handleClearLockout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	query := r.URL.Query()
+	email, ip := query.Get("email"), query.Get("ip")
+	if email == "" && ip == "" {
+		writeErr(w, http.StatusBadRequest, "email or ip is required")
+		return
+	}
+
+	err := s.auth.ClearLockout(r.Context(), token, email, ip, clientInfo(r))
+	if err != nil {
+		s.writeAdminErr(w, r, "/admin/lockouts", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginLockout(t *testing.T) {
+	srv := newTestServer(t, withAdmin(t))
+	user := signinAndLogin(t, srv)
+
+	// Три неудачи бесплатны, четвёртая блокирует вход на BaseDelay
+	for range 4 {
+		res, _ := do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"wrong"}`, nil)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	// Пока действует блокировка, не помогает и верный пароль
+	res, _ := do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+	require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+
+	res, _ = do(t, srv, http.MethodPost, "/password/change",
+		`{"email":"`+email+`","old_password":"`+password+`","new_password":"new-password"}`, nil)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+
+	t.Run("clear requires admin", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodDelete, "/admin/lockouts?email="+email, "", nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		res, _ = do(t, srv, http.MethodDelete, "/admin/lockouts?email="+email, "", bearer(user.Access_token))
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	admin := loginAdmin(t, srv)
+
+	res, _ = do(t, srv, http.MethodDelete, "/admin/lockouts", "", bearer(admin.Access_token))
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, _ = do(t, srv, http.MethodDelete, "/admin/lockouts?email="+email, "", bearer(admin.Access_token))
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	login(t, srv)
+}
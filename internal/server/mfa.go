@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+)
+
+func (s *Server) handleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	data := schemas.LoginMFAData{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		s.log.DebugContext(r.Context(), "/login/mfa", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	accessToken, refreshToken, err := s.auth.LoginMFA(r.Context(), data.MFAToken, data.Code, clientInfo(r))
+	if err != nil {
+		s.writeMFAErr(w, r, "/login/mfa", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(schemas.Tokens{
+		Access_token:  accessToken,
+		Refresh_token: refreshToken,
+	})
+}
+
+func (s *Server) handleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// Ответ содержит секрет
+	w.Header().Set("Cache-Control", "no-store")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	secret, uri, err := s.auth.EnrollTOTP(r.Context(), token)
+	if err != nil {
+		s.writeMFAErr(w, r, "/mfa/totp", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(schemas.TOTPEnrollment{
+		Secret: secret,
+		URI:    uri,
+	})
+}
+
+func (s *Server) handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	data := schemas.MFACodeData{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		s.log.DebugContext(r.Context(), "/mfa/totp/confirm", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	codes, err := s.auth.ConfirmTOTP(r.Context(), token, data.Code, clientInfo(r))
+	if err != nil {
+		s.writeMFAErr(w, r, "/mfa/totp/confirm", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(schemas.RecoveryCodes{
+		RecoveryCodes: codes,
+	})
+}
+
+func (s *Server) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	data := schemas.MFACodeData{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		s.log.DebugContext(r.Context(), "/mfa/totp", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.auth.DisableTOTP(r.Context(), token, data.Code, clientInfo(r)); err != nil {
+		s.writeMFAErr(w, r, "/mfa/totp", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) writeMFAErr(w http.ResponseWriter, r *http.Request, path string, err error) {
+	if writeLockedErr(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, auth.ErrInvalidAccessToken),
+		errors.Is(err, auth.ErrInvalidMFAToken),
+		errors.Is(err, auth.ErrInvalidMFACode):
+		writeErr(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled),
+		errors.Is(err, auth.ErrMFANotEnabled):
+		writeErr(w, http.StatusConflict, err.Error())
+	case errors.Is(err, auth.ErrEmailNotVerified):
+		writeErr(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, auth.ErrMFAUnavailable):
+		writeErr(w, http.StatusNotImplemented, err.Error())
+	default:
+		s.log.ErrorContext(r.Context(), path, sl.Err(err))
+		writeErr(w, http.StatusInternalServerError, "internal error")
+	}
+}
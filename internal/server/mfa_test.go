@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lk-auth/internal/libs/totp"
+	"lk-auth/internal/server/schemas"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enableTOTP подключает второй фактор и возвращает секрет и коды восстановления
+func enableTOTP(t *testing.T, srv *httptest.Server, accessToken string) (string, []string) {
+	t.Helper()
+
+	res, body := do(t, srv, http.MethodPost, "/mfa/totp", "", bearer(accessToken))
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+	enrollment := schemas.TOTPEnrollment{}
+	require.NoError(t, json.Unmarshal(body, &enrollment))
+	assert.Contains(t, enrollment.URI, "otpauth://totp/")
+
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	res, body = do(t, srv, http.MethodPost, "/mfa/totp/confirm", `{"code":"`+code+`"}`, bearer(accessToken))
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+	codes := schemas.RecoveryCodes{}
+	require.NoError(t, json.Unmarshal(body, &codes))
+	require.Len(t, codes.RecoveryCodes, 10)
+
+	return enrollment.Secret, codes.RecoveryCodes
+}
+
+// mfaChallenge выполняет первый шаг входа и возвращает токен подтверждения
+func mfaChallenge(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+
+	res, body := do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+	challenge := schemas.MFAChallenge{}
+	require.NoError(t, json.Unmarshal(body, &challenge))
+	require.True(t, challenge.MFARequired)
+	require.NotEmpty(t, challenge.MFAToken)
+
+	return challenge.MFAToken
+}
+
+func loginMFA(t *testing.T, srv *httptest.Server, mfaToken, code string) (*http.Response, schemas.Tokens) {
+	t.Helper()
+
+	res, body := do(t, srv, http.MethodPost, "/login/mfa", `{"mfa_token":"`+mfaToken+`","code":"`+code+`"}`, nil)
+	tokens := schemas.Tokens{}
+	if res.StatusCode == http.StatusOK {
+		require.NoError(t, json.Unmarshal(body, &tokens))
+	}
+	return res, tokens
+}
+
+func TestLoginMFA(t *testing.T) {
+	srv := newTestServer(t)
+	secret, recoveryCodes := enableTOTP(t, srv, signinAndLogin(t, srv).Access_token)
+
+	mfaToken := mfaChallenge(t, srv)
+	// Токен подтверждения не даёт доступа и не обменивается через /refresh
+	assert.False(t, introspect(t, srv, mfaToken).Active)
+	res, _ := do(t, srv, http.MethodPost, "/refresh", `{"refresh_token":"`+mfaToken+`"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, _ = loginMFA(t, srv, mfaToken, "000000")
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// Код подтверждения подключения уже использован, поэтому берётся код следующего шага
+	code, err := totp.Code(secret, time.Now().Add(totp.Period))
+	require.NoError(t, err)
+	res, tokens := loginMFA(t, srv, mfaToken, code)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, introspect(t, srv, tokens.Access_token).Active)
+
+	t.Run("challenge is single-use", func(t *testing.T) {
+		res, _ := loginMFA(t, srv, mfaToken, recoveryCodes[0])
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("code is single-use", func(t *testing.T) {
+		res, _ := loginMFA(t, srv, mfaChallenge(t, srv), code)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		res, tokens := loginMFA(t, srv, mfaChallenge(t, srv), recoveryCodes[0])
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.True(t, introspect(t, srv, tokens.Access_token).Active)
+
+		res, _ = loginMFA(t, srv, mfaChallenge(t, srv), recoveryCodes[0])
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("email in another case", func(t *testing.T) {
+		res, body := do(t, srv, http.MethodPost, "/login", `{"email":"Test@Example.COM","password":"`+password+`"}`, nil)
+		require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+		challenge := schemas.MFAChallenge{}
+		require.NoError(t, json.Unmarshal(body, &challenge))
+		assert.True(t, challenge.MFARequired)
+
+		res, tokens := loginMFA(t, srv, challenge.MFAToken, recoveryCodes[2])
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, email, introspect(t, srv, tokens.Access_token).Email)
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodDelete, "/mfa/totp", `{"code":"`+recoveryCodes[1]+`"}`, bearer(tokens.Access_token))
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		login(t, srv)
+	})
+}
+
+func TestDisableTOTPLockout(t *testing.T) {
+	srv := newTestServer(t)
+	tokens := signinAndLogin(t, srv)
+	_, recoveryCodes := enableTOTP(t, srv, tokens.Access_token)
+
+	// Коды перебираются с тем же счётчиком неудач, что и при входе: три бесплатны, четвёртая блокирует
+	for range 4 {
+		res, _ := do(t, srv, http.MethodDelete, "/mfa/totp", `{"code":"000000"}`, bearer(tokens.Access_token))
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	// Пока действует блокировка, не помогает и верный код
+	res, _ := do(t, srv, http.MethodDelete, "/mfa/totp", `{"code":"`+recoveryCodes[0]+`"}`, bearer(tokens.Access_token))
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.NotEmpty(t, res.Header.Get("Retry-After"))
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	srv := newTestServer(t)
+	accessToken := signinAndLogin(t, srv).Access_token
+
+	t.Run("wrong confirmation code", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPost, "/mfa/totp", "", bearer(accessToken))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res, _ = do(t, srv, http.MethodPost, "/mfa/totp/confirm", `{"code":"000000"}`, bearer(accessToken))
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		// Неподтверждённый секрет не влияет на вход
+		login(t, srv)
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		enableTOTP(t, srv, accessToken)
+
+		res, _ := do(t, srv, http.MethodPost, "/mfa/totp", "", bearer(accessToken))
+		assert.Equal(t, http.StatusConflict, res.StatusCode)
+	})
+
+	t.Run("requires access token", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPost, "/mfa/totp", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+// ClientAuth пропускает только запросы с client credentials из clients (client_id -> client_secret),
+// переданными через HTTP Basic, как того требует RFC 7662 для эндпоинта интроспекции.
+func ClientAuth(realm string, clients map[string]string) Middleware {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id, secret, ok := r.BasicAuth()
+			if !ok || !checkClient(clients, id, secret) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(struct {
+					Code int    `json:"code"`
+					Msg  string `json:"msg"`
+				}{
+					Code: http.StatusUnauthorized,
+					Msg:  "invalid client credentials",
+				})
+				return
+			}
+			f(w, r)
+		}
+	}
+}
+
+func checkClient(clients map[string]string, id, secret string) bool {
+	expected, found := clients[id]
+	// Сравниваем хэши, чтобы время проверки не зависело ни от длины секрета, ни от наличия клиента
+	got := sha256.Sum256([]byte(secret))
+	want := sha256.Sum256([]byte(expected))
+	match := subtle.ConstantTimeCompare(got[:], want[:]) == 1
+
+	return found && expected != "" && match
+}
@@ -0,0 +1,48 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lk-auth/internal/server/middleware"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientAuth(t *testing.T) {
+	handler := middleware.Chain(
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) },
+		middleware.ClientAuth("introspect", map[string]string{"gateway": "s3cret"}),
+	)
+
+	cases := []struct {
+		name     string
+		id       string
+		secret   string
+		withAuth bool
+		code     int
+	}{
+		{"Valid credentials", "gateway", "s3cret", true, http.StatusOK},
+		{"Wrong secret", "gateway", "wrong", true, http.StatusUnauthorized},
+		{"Unknown client", "unknown", "", true, http.StatusUnauthorized},
+		{"No credentials", "", "", false, http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/introspect", nil)
+			if c.withAuth {
+				r.SetBasicAuth(c.id, c.secret)
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, r)
+
+			assert.Equal(t, c.code, w.Code)
+			if c.code == http.StatusUnauthorized {
+				assert.Equal(t, `Basic realm="introspect"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	ForwardedForHeader = "X-Forwarded-For"
+	RealIPHeader       = "X-Real-IP"
+)
+
+type clientIPKey struct{}
+
+// ParseTrustedProxies разбирает адреса и подсети (CIDR) прокси, которым разрешено передавать адрес клиента
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// RealIP определяет адрес клиента и кладёт его в контекст запроса для ClientIP.
+// X-Forwarded-For и X-Real-IP учитываются, только если запрос пришёл от доверенного прокси: иначе клиент
+// подставил бы в них любой адрес и обошёл лимиты и блокировку по IP. В X-Forwarded-For адресом клиента считается
+// последний адрес, не принадлежащий доверенным прокси, - левее него адреса может дописать сам клиент
+func RealIP(trusted []netip.Prefix) Middleware {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trusted)
+			f(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+		}
+	}
+}
+
+// ClientIP возвращает адрес клиента из RealIP, вне RealIP - адрес соединения
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+func resolveClientIP(r *http.Request, trusted []netip.Prefix) string {
+	peer := peerIP(r)
+	if !isTrusted(peer, trusted) {
+		return peer
+	}
+
+	if header := r.Header.Values(ForwardedForHeader); len(header) > 0 {
+		hops := strings.Split(strings.Join(header, ","), ",")
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, ok := parseIP(hops[i])
+			if !ok {
+				// Неразборчивый адрес мог записать кто угодно, левее него доверять нечему
+				break
+			}
+			client = addr.String()
+			if !isTrusted(client, trusted) {
+				return client
+			}
+		}
+		if client != "" {
+			return client
+		}
+	}
+	if addr, ok := parseIP(r.Header.Get(RealIPHeader)); ok {
+		return addr.String()
+	}
+	return peer
+}
+
+func peerIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, ok := parseIP(ip)
+	if !ok {
+		return false
+	}
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP разбирает адрес с портом или без, IPv4 в IPv6 приводится к IPv4
+func parseIP(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		addrPort, err := netip.ParseAddrPort(s)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = addrPort.Addr()
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,63 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lk-auth/internal/server/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted, err := middleware.ParseTrustedProxies([]string{"10.0.0.0/8", " 192.168.1.1 ", "fd00::/8"})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		ip         string
+	}{
+		{"Direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"Untrusted peer sets X-Forwarded-For", "203.0.113.7:5000", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.7"},
+		{"Trusted proxy", "10.0.0.2:5000", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"Spoofed hop left of client", "10.0.0.2:5000", http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1"}}, "198.51.100.1"},
+		{"Chain of trusted proxies", "10.0.0.2:5000", http.Header{"X-Forwarded-For": {"198.51.100.1, 192.168.1.1", "10.1.1.1"}}, "198.51.100.1"},
+		{"Only proxies", "10.0.0.2:5000", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.4"}}, "10.0.0.3"},
+		{"X-Real-IP", "192.168.1.1:5000", http.Header{"X-Real-Ip": {"198.51.100.2"}}, "198.51.100.2"},
+		{"Invalid X-Real-IP", "192.168.1.1:5000", http.Header{"X-Real-Ip": {"unknown"}}, "192.168.1.1"},
+		{"IPv6 proxy", "[fd00::1]:5000", http.Header{"X-Forwarded-For": {"2001:db8::1"}}, "2001:db8::1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var ip, key string
+			handler := middleware.Chain(func(w http.ResponseWriter, r *http.Request) {
+				ip = middleware.ClientIP(r)
+				key = middleware.ByIP(r)
+			}, middleware.RealIP(trusted))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = c.remoteAddr
+			for k, v := range c.header {
+				r.Header[k] = v
+			}
+			handler(httptest.NewRecorder(), r)
+			assert.Equal(t, c.ip, ip)
+			assert.Equal(t, c.ip, key)
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.0/33", "proxy.local", "10.0.0"} {
+		_, err := middleware.ParseTrustedProxies([]string{proxy})
+		assert.Error(t, err, proxy)
+	}
+
+	trusted, err := middleware.ParseTrustedProxies(nil)
+	require.NoError(t, err)
+	assert.Empty(t, trusted)
+}
@@ -4,15 +4,26 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+
+	sl "lk-auth/internal/libs/logger"
 )
 
-func Logging(log *slog.Logger) Middleware {
+// Logging добавляет в контекст запроса пользователя, которого user определяет по запросу (пустая строка - неизвестен),
+// и пишет строку о запросе. Обработчик журнала sl.NewContextHandler добавляет атрибуты контекста, в том числе ID запроса
+// из RequestID, ко всем записям, сделанным с контекстом запроса
+func Logging(log *slog.Logger, user KeyFunc) Middleware {
 	return func(f http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			if email := user(r); email != "" {
+				r = r.WithContext(sl.ContextWith(r.Context(), slog.String("user", email)))
+			}
+
 			defer func() {
-				log.Info(
+				log.InfoContext(
+					r.Context(),
 					r.URL.Path,
+					"method", r.Method,
 					"duration", time.Since(start).String(),
 				)
 			}()
@@ -0,0 +1,67 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/server/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogging(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(sl.NewContextHandler(slog.NewJSONHandler(buf, nil)))
+	user := func(r *http.Request) string { return r.Header.Get("X-User") }
+
+	handler := middleware.Chain(
+		func(w http.ResponseWriter, r *http.Request) {
+			log.InfoContext(r.Context(), "handled")
+			w.WriteHeader(http.StatusOK)
+		},
+		middleware.Logging(log, user),
+		middleware.RequestID,
+	)
+
+	entries := func() []map[string]any {
+		t.Helper()
+		var entries []map[string]any
+		dec := json.NewDecoder(buf)
+		for dec.More() {
+			entry := map[string]any{}
+			require.NoError(t, dec.Decode(&entry))
+			entries = append(entries, entry)
+		}
+		buf.Reset()
+		return entries
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+	r.Header.Set("X-User", "test@example.com")
+	handler(httptest.NewRecorder(), r)
+
+	logged := entries()
+	require.Len(t, logged, 2)
+	assert.Equal(t, "handled", logged[0]["msg"])
+	assert.Equal(t, "/sessions", logged[1]["msg"])
+	assert.Equal(t, http.MethodGet, logged[1]["method"])
+	// Записи обработчика и строка о запросе связаны ID запроса
+	assert.NotEmpty(t, logged[0]["request_id"])
+	assert.Equal(t, logged[0]["request_id"], logged[1]["request_id"])
+	assert.NotEmpty(t, logged[1]["trace_id"])
+	assert.Equal(t, "test@example.com", logged[0]["user"])
+	assert.Equal(t, "test@example.com", logged[1]["user"])
+
+	// У каждого запроса свой ID, анонимный запрос без пользователя
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sessions", nil))
+	anonymous := entries()
+	require.Len(t, anonymous, 2)
+	assert.NotEqual(t, logged[0]["request_id"], anonymous[0]["request_id"])
+	assert.NotContains(t, anonymous[0], "user")
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+)
+
+// Сколько байт тела читает ByEmail. Тела запросов сервиса - небольшие JSON объекты
+const maxKeyBodySize = 64 << 10
+
+// KeyFunc извлекает из запроса ключ, по которому считаются запросы.
+// Пустой ключ означает, что лимит к запросу не применяется.
+type KeyFunc func(r *http.Request) string
+
+// Limit - не больше Requests запросов за Window на каждый ключ
+type Limit struct {
+	// Отделяет счётчики разных маршрутов и видов ключей, например "login:ip"
+	Name     string
+	Requests int64
+	Window   time.Duration
+	Key      KeyFunc
+}
+
+// RateLimit отклоняет запрос с 429, если превышен хотя бы один из limits.
+// В заголовках RateLimit-* сообщается состояние самого строгого из них.
+// Если хранилище недоступно, запрос пропускается: отказ в обслуживании хуже временного отсутствия лимитов.
+func RateLimit(limiter storage.RateLimitStorage, log *slog.Logger, limits ...Limit) Middleware {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		if limiter == nil || len(limits) == 0 {
+			return f
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			var (
+				strictest model.RateLimit
+				found     bool
+			)
+			for _, limit := range limits {
+				key := limit.Key(r)
+				if key == "" {
+					continue
+				}
+				res, err := limiter.Hit(r.Context(), limit.Name+":"+key, limit.Requests, limit.Window)
+				if err != nil {
+					log.ErrorContext(r.Context(), "cannot check rate limit", sl.Err(err), "limit", limit.Name)
+					continue
+				}
+				if !found || stricter(res, strictest) {
+					strictest, found = res, true
+				}
+				if !res.Allowed {
+					log.WarnContext(r.Context(), "rate limit exceeded",
+						"event", "rate_limited",
+						"limit", limit.Name,
+						"path", r.URL.Path,
+					)
+					break
+				}
+			}
+
+			if found {
+				writeRateLimitHeaders(w, strictest)
+			}
+			if found && !strictest.Allowed {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", strconv.FormatInt(ceilSeconds(strictest.RetryAfter), 10))
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(struct {
+					Code int    `json:"code"`
+					Msg  string `json:"msg"`
+				}{
+					Code: http.StatusTooManyRequests,
+					Msg:  "too many requests",
+				})
+				return
+			}
+			f(w, r)
+		}
+	}
+}
+
+// stricter сообщает, ограничивает ли a сильнее, чем b
+func stricter(a, b model.RateLimit) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+// Заголовки по draft-ietf-httpapi-ratelimit-headers
+func writeRateLimitHeaders(w http.ResponseWriter, res model.RateLimit) {
+	w.Header().Set("RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+	w.Header().Set("RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+	w.Header().Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// ByIP - ключ по IP адресу клиента с учётом доверенных прокси, см. RealIP
+func ByIP(r *http.Request) string {
+	return ClientIP(r)
+}
+
+// ByEmail - ключ по полю email JSON тела. Прочитанное тело возвращается обработчику
+func ByEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxKeyBodySize))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	data := struct {
+		Email string `json:"email"`
+	}{}
+	if json.Unmarshal(body, &data) != nil {
+		return ""
+	}
+	return strings.ToLower(data.Email)
+}
+
+// readCloser отдаёт уже прочитанное начало тела, затем остаток, и закрывает исходное тело
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// BySubject - ключ по владельцу bearer токена. subject должен проверять подпись токена,
+// иначе поддельными токенами можно было бы распределить запросы по многим ключам.
+// Запросы без токена или с недействительным токеном не ограничиваются: их отклонит обработчик.
+func BySubject(subject func(ctx context.Context, token string) (string, error)) KeyFunc {
+	return func(r *http.Request) string {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return ""
+		}
+		sub, err := subject(r.Context(), token)
+		if err != nil {
+			return ""
+		}
+		return sub
+	}
+}
@@ -0,0 +1,99 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lk-auth/internal/server/middleware"
+	"lk-auth/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	t.Cleanup(wg.Wait)
+	limiter, err := memory.NewMemoryRateLimitStorage(t.Context(), wg, nil, time.Minute)
+	require.NoError(t, err)
+
+	var bodies []string
+	handler := middleware.Chain(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			w.WriteHeader(http.StatusOK)
+		},
+		middleware.RateLimit(limiter, slog.New(slog.DiscardHandler),
+			middleware.Limit{Name: "login:ip", Requests: 3, Window: time.Minute, Key: middleware.ByIP},
+			middleware.Limit{Name: "login:email", Requests: 2, Window: time.Minute, Key: middleware.ByEmail},
+			middleware.Limit{Name: "login:sub", Requests: 1, Window: time.Minute, Key: middleware.BySubject(
+				func(_ context.Context, token string) (string, error) {
+					if token != "valid" {
+						return "", errors.New("invalid token")
+					}
+					return "owner@example.com", nil
+				},
+			)},
+		),
+	)
+	request := func(addr, body, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		r.RemoteAddr = addr
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	t.Run("Email", func(t *testing.T) {
+		body := `{"email":"Test@Example.com"}`
+
+		w := request("10.0.0.1:1234", body, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+		assert.NotEmpty(t, w.Header().Get("RateLimit-Reset"))
+		// Обработчик получает тело целиком, хотя его уже прочитал ByEmail
+		assert.Equal(t, body, bodies[len(bodies)-1])
+
+		w = request("10.0.0.2:1234", `{"email":"test@example.com"}`, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = request("10.0.0.3:1234", body, "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		assert.Equal(t, w.Header().Get("Retry-After"), w.Header().Get("RateLimit-Reset"))
+	})
+
+	t.Run("IP", func(t *testing.T) {
+		for i := range 3 {
+			w := request("10.0.1.1:1234", `{"email":"user`+string(rune('a'+i))+`@example.com"}`, "")
+			require.Equal(t, http.StatusOK, w.Code)
+		}
+		w := request("10.0.1.1:4321", `{"email":"other@example.com"}`, "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("Subject", func(t *testing.T) {
+		w := request("10.0.2.1:1234", "", "valid")
+		require.Equal(t, http.StatusOK, w.Code)
+		w = request("10.0.2.2:1234", "", "valid")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+		// Недействительный токен не даёт ключа, запрос отклонит обработчик
+		w = request("10.0.2.3:1234", "", "forged")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
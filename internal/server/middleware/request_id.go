@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/libs/random"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	// Контекст трассировки W3C Trace Context: версия-trace_id-parent_id-флаги
+	TraceParentHeader = "traceparent"
+)
+
+// Длиннее ID запроса от клиента не принимается, чтобы нельзя было раздуть журнал
+const maxRequestIDLen = 128
+
+type (
+	requestIDKey   struct{}
+	traceParentKey struct{}
+)
+
+// RequestID принимает ID запроса из X-Request-ID и контекст трассировки из traceparent или создаёт новые,
+// кладёт их в контекст запроса и возвращает в заголовках ответа. Для traceparent сервис начинает свой span:
+// trace_id сохраняется, parent_id заменяется новым. ID запроса и trace_id добавляются ко всем записям журнала с контекстом запроса
+func RequestID(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = random.ID()
+		}
+		traceID, flags, ok := parseTraceParent(r.Header.Get(TraceParentHeader))
+		if !ok {
+			traceID, flags = randomHex(16), "00"
+		}
+		traceParent := "00-" + traceID + "-" + randomHex(8) + "-" + flags
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+		ctx = context.WithValue(ctx, traceParentKey{}, traceParent)
+		ctx = sl.ContextWith(ctx, slog.String("request_id", requestID), slog.String("trace_id", traceID))
+
+		w.Header().Set(RequestIDHeader, requestID)
+		w.Header().Set(TraceParentHeader, traceParent)
+		f(w, r.WithContext(ctx))
+	}
+}
+
+// RequestIDFromContext возвращает ID запроса, пустую строку вне RequestID
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// TraceParentFromContext возвращает traceparent для запросов к другим сервисам, пустую строку вне RequestID
+func TraceParentFromContext(ctx context.Context) string {
+	traceParent, _ := ctx.Value(traceParentKey{}).(string)
+	return traceParent
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range []byte(id) {
+		// Только видимые ASCII символы: ID попадает в журнал и заголовок ответа как есть
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTraceParent возвращает trace_id и флаги заголовка traceparent.
+// Версия ff и нулевые ID недопустимы, заголовки будущих версий разбираются по полям версии 00
+func parseTraceParent(header string) (traceID, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 {
+		return "", "", false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", "", false
+	}
+	if !isLowerHex(traceID, 32) || !isLowerHex(parentID, 16) || !isLowerHex(flags, 2) {
+		return "", "", false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(parentID, "0") == "" {
+		return "", "", false
+	}
+	return traceID, flags, true
+}
+
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	// crypto/rand.Read не возвращает ошибок на поддерживаемых платформах
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,101 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lk-auth/internal/server/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func TestRequestID(t *testing.T) {
+	var requestID, traceParent string
+	handler := middleware.Chain(
+		func(w http.ResponseWriter, r *http.Request) {
+			requestID = middleware.RequestIDFromContext(r.Context())
+			traceParent = middleware.TraceParentFromContext(r.Context())
+		},
+		middleware.RequestID,
+	)
+	serve := func(header http.Header) http.Header {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		for key, values := range header {
+			for _, value := range values {
+				r.Header.Add(key, value)
+			}
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Header()
+	}
+
+	t.Run("accepts request ID", func(t *testing.T) {
+		header := serve(http.Header{middleware.RequestIDHeader: {"gateway-42"}})
+
+		assert.Equal(t, "gateway-42", requestID)
+		assert.Equal(t, "gateway-42", header.Get(middleware.RequestIDHeader))
+	})
+
+	t.Run("generates request ID", func(t *testing.T) {
+		for _, id := range []string{"", "with space", "line\nbreak", strings.Repeat("a", 129)} {
+			header := serve(http.Header{middleware.RequestIDHeader: {id}})
+
+			assert.NotEmpty(t, requestID)
+			assert.NotEqual(t, id, requestID)
+			assert.Equal(t, requestID, header.Get(middleware.RequestIDHeader))
+		}
+
+		serve(nil)
+		first := requestID
+		serve(nil)
+		assert.NotEqual(t, first, requestID)
+	})
+
+	t.Run("continues trace", func(t *testing.T) {
+		incoming := "00-" + traceID + "-00f067aa0ba902b7-01"
+		header := serve(http.Header{"Traceparent": {incoming}})
+
+		parts := strings.Split(traceParent, "-")
+		require.Len(t, parts, 4)
+		assert.Equal(t, "00", parts[0])
+		assert.Equal(t, traceID, parts[1])
+		// Свой span сервиса
+		assert.NotEqual(t, "00f067aa0ba902b7", parts[2])
+		assert.Len(t, parts[2], 16)
+		assert.Equal(t, "01", parts[3])
+		assert.Equal(t, traceParent, header.Get(middleware.TraceParentHeader))
+	})
+
+	t.Run("starts trace", func(t *testing.T) {
+		for _, incoming := range []string{
+			"",
+			"garbage",
+			"00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01",
+			"00-" + traceID + "-0000000000000000-01",
+			"ff-" + traceID + "-00f067aa0ba902b7-01",
+			"00-" + strings.ToUpper(traceID) + "-00f067aa0ba902b7-01",
+			"00-" + traceID + "-00f067aa0ba902b7-01-extra",
+		} {
+			serve(http.Header{"Traceparent": {incoming}})
+
+			parts := strings.Split(traceParent, "-")
+			require.Len(t, parts, 4, incoming)
+			assert.Len(t, parts[1], 32, incoming)
+			assert.NotEqual(t, traceID, parts[1], incoming)
+			assert.Equal(t, "00", parts[3], incoming)
+		}
+	})
+
+	t.Run("future version", func(t *testing.T) {
+		serve(http.Header{"Traceparent": {"01-" + traceID + "-00f067aa0ba902b7-01-extra"}})
+
+		assert.True(t, strings.HasPrefix(traceParent, "00-"+traceID+"-"))
+	})
+}
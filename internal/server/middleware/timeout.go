@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeout ограничивает время обработки запроса: по истечении d контекст запроса отменяется,
+// и обращения к хранилищам с этим контекстом прерываются. d <= 0 - без ограничения
+func Timeout(d time.Duration) Middleware {
+	return func(f http.HandlerFunc) http.HandlerFunc {
+		if d <= 0 {
+			return f
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			f(w, r.WithContext(ctx))
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lk-auth/internal/server/middleware"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	t.Run("Deadline", func(t *testing.T) {
+		var err error
+		handler := middleware.Chain(
+			func(w http.ResponseWriter, r *http.Request) {
+				deadline, ok := r.Context().Deadline()
+				assert.True(t, ok)
+				assert.WithinDuration(t, time.Now().Add(10*time.Millisecond), deadline, 10*time.Millisecond)
+				<-r.Context().Done()
+				err = r.Context().Err()
+			},
+			middleware.Timeout(10*time.Millisecond),
+		)
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		handler := middleware.Chain(
+			func(w http.ResponseWriter, r *http.Request) {
+				_, ok := r.Context().Deadline()
+				assert.False(t, ok)
+			},
+			middleware.Timeout(0),
+		)
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
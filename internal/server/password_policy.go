@@ -0,0 +1,30 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"lk-auth/internal/server/schemas"
+	passwordpkg "lk-auth/internal/service/password"
+)
+
+// writePasswordPolicyErr отвечает 400 со списком нарушенных правил, если пароль не соответствует политике
+func writePasswordPolicyErr(w http.ResponseWriter, err error) bool {
+	var policyErr *passwordpkg.PolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	violations := make([]schemas.PasswordViolation, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		violations[i] = schemas.PasswordViolation{Rule: v.Rule, Message: v.Message}
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(schemas.PasswordPolicyErr{
+		Code:       http.StatusBadRequest,
+		Msg:        policyErr.Error(),
+		Violations: violations,
+	})
+	return true
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+	passwordpkg "lk-auth/internal/service/password"
+	"lk-auth/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func violatedRules(t *testing.T, body []byte) []string {
+	t.Helper()
+
+	res := schemas.PasswordPolicyErr{}
+	require.NoError(t, json.Unmarshal(body, &res))
+	var rules []string
+	for _, v := range res.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	t.Cleanup(wg.Wait)
+	tokenStorage, err := memory.NewMemoryOneTimeTokenStorage(t.Context(), wg, nil, time.Minute)
+	require.NoError(t, err)
+	box := &mailbox{}
+	srv := newTestServer(t,
+		auth.WithPasswordPolicy(&passwordpkg.Policy{MinLength: 8, MinClasses: 2}),
+		auth.WithPasswordReset(tokenStorage, box, auth.PasswordResetConfig{URL: "https://lk-auth.test/reset", TTL: time.Hour}),
+	)
+
+	res, body := do(t, srv, http.MethodPost, "/signin", `{"email":"`+email+`","password":"short","role":"user"}`, nil)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, []string{passwordpkg.RuleMinLength, passwordpkg.RuleClasses}, violatedRules(t, body))
+
+	res, _ = do(t, srv, http.MethodPost, "/signin", `{"email":"`+email+`","password":"password-1","role":"user"}`, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	t.Run("change", func(t *testing.T) {
+		res, body := do(t, srv, http.MethodPost, "/password/change",
+			`{"email":"`+email+`","old_password":"password-1","new_password":"`+email+`"}`, nil)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, []string{passwordpkg.RuleEmail}, violatedRules(t, body))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPost, "/password/forgot", `{"email":"`+email+`"}`, nil)
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+		token := resetToken(t, box.sent()[0])
+
+		res, body := do(t, srv, http.MethodPost, "/password/reset", `{"token":"`+token+`","new_password":"weakpassword"}`, nil)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, []string{passwordpkg.RuleClasses}, violatedRules(t, body))
+
+		// Отклонённый пароль не расходует токен
+		res, body = do(t, srv, http.MethodPost, "/password/reset", `{"token":"`+token+`","new_password":"strong-password"}`, nil)
+		assert.Equal(t, http.StatusNoContent, res.StatusCode, string(body))
+	})
+}
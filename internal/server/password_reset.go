@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+)
+
+func (s *Server) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	data := schemas.ForgotPasswordData{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		s.log.DebugContext(r.Context(), "/password/forgot", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if data.Email == "" {
+		writeErr(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	// Ответ одинаков для известного и неизвестного email
+	if err := s.auth.ForgotPassword(r.Context(), data.Email); err != nil {
+		s.writePasswordResetErr(w, r, "/password/forgot", err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	data := schemas.ResetPasswordData{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		s.log.DebugContext(r.Context(), "/password/reset", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if data.Token == "" || data.NewPassword == "" {
+		writeErr(w, http.StatusBadRequest, "token and new_password are required")
+		return
+	}
+
+	if err := s.auth.ResetPassword(r.Context(), data.Token, data.NewPassword, clientInfo(r)); err != nil {
+		s.writePasswordResetErr(w, r, "/password/reset", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) writePasswordResetErr(w http.ResponseWriter, r *http.Request, path string, err error) {
+	if writePasswordPolicyErr(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, auth.ErrInvalidResetToken):
+		writeErr(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, auth.ErrPasswordResetUnavailable):
+		writeErr(w, http.StatusNotImplemented, err.Error())
+	default:
+		s.log.ErrorContext(r.Context(), path, sl.Err(err))
+		writeErr(w, http.StatusInternalServerError, "internal error")
+	}
+}
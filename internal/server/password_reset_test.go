@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lk-auth/internal/service/auth"
+	"lk-auth/internal/service/mailer"
+	"lk-auth/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mailbox запоминает отправленные письма
+type mailbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *mailbox) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *mailbox) sent() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mailer.Message(nil), m.messages...)
+}
+
+// mailToken достаёт токен из ссылки на страницу page в письме
+func mailToken(t *testing.T, msg mailer.Message, page string) string {
+	t.Helper()
+
+	for line := range strings.Lines(msg.Body) {
+		if link, ok := strings.CutPrefix(strings.TrimSpace(line), page+"?"); ok {
+			query, err := url.ParseQuery(link)
+			require.NoError(t, err)
+			return query.Get("token")
+		}
+	}
+	require.Fail(t, "no link to "+page+" in mail", msg.Body)
+	return ""
+}
+
+func resetToken(t *testing.T, msg mailer.Message) string {
+	t.Helper()
+	return mailToken(t, msg, "https://lk-auth.test/reset")
+}
+
+func TestPasswordReset(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	t.Cleanup(wg.Wait)
+	tokenStorage, err := memory.NewMemoryOneTimeTokenStorage(t.Context(), wg, nil, time.Minute)
+	require.NoError(t, err)
+	box := &mailbox{}
+	srv := newTestServer(t, auth.WithPasswordReset(tokenStorage, box, auth.PasswordResetConfig{
+		URL: "https://lk-auth.test/reset",
+		TTL: time.Hour,
+	}))
+	tokens := signinAndLogin(t, srv)
+
+	// Для неизвестного email ответ тот же, но письмо не отправляется
+	res, _ := do(t, srv, http.MethodPost, "/password/forgot", `{"email":"unknown@example.com"}`, nil)
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+	assert.Empty(t, box.sent())
+
+	res, _ = do(t, srv, http.MethodPost, "/password/forgot", `{"email":"`+email+`"}`, nil)
+	require.Equal(t, http.StatusAccepted, res.StatusCode)
+	sent := box.sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, email, sent[0].To)
+	token := resetToken(t, sent[0])
+
+	res, _ = do(t, srv, http.MethodPost, "/password/reset", `{"token":"wrong","new_password":"new-password"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// Пароль, нарушающий политику, не гасит токен
+	res, body := do(t, srv, http.MethodPost, "/password/reset", `{"token":"`+token+`","new_password":"`+email+`"}`, nil)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode, string(body))
+	assert.Contains(t, string(body), "not_email")
+
+	res, body = do(t, srv, http.MethodPost, "/password/reset", `{"token":"`+token+`","new_password":"new-password"}`, nil)
+	require.Equal(t, http.StatusNoContent, res.StatusCode, string(body))
+
+	// Старые сессии завершены, действует только новый пароль
+	assert.False(t, introspect(t, srv, tokens.Access_token).Active)
+	res, _ = do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	res, _ = do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"new-password"}`, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	t.Run("token is single-use", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPost, "/password/reset", `{"token":"`+token+`","new_password":"other-password"}`, nil)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("password change invalidates earlier tokens", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPost, "/password/forgot", `{"email":"`+email+`"}`, nil)
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+		sent := box.sent()
+		stale := resetToken(t, sent[len(sent)-1])
+
+		res, _ = do(t, srv, http.MethodPost, "/password/change",
+			`{"email":"`+email+`","old_password":"new-password","new_password":"third-password"}`, nil)
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		res, _ = do(t, srv, http.MethodPost, "/password/reset", `{"token":"`+stale+`","new_password":"other-password"}`, nil)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		srv := newTestServer(t)
+		res, _ := do(t, srv, http.MethodPost, "/password/forgot", `{"email":"`+email+`"}`, nil)
+		assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+	})
+}
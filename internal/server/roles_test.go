@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/libs/hash"
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+	"lk-auth/internal/service/rbac"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const adminEmail = "admin@example.com"
+
+// withAdmin заводит администратора в хранилище: через /signin роль admin не получить
+func withAdmin(t *testing.T) auth.Option {
+	t.Helper()
+
+	passwordHash, err := hash.Default().Hash(password)
+	require.NoError(t, err)
+	return func(s *auth.AuthServiceImpl) {
+		require.NoError(t, s.UserStorage.AddUser(context.Background(), &model.User{
+			Email:         adminEmail,
+			PasswordHash:  passwordHash,
+			Role:          rbac.RoleAdmin,
+			Version:       1,
+			EmailVerified: true,
+		}))
+	}
+}
+
+func loginAdmin(t *testing.T, srv *httptest.Server) schemas.Tokens {
+	t.Helper()
+
+	res, body := do(t, srv, http.MethodPost, "/login", `{"email":"`+adminEmail+`","password":"`+password+`"}`, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+	tokens := schemas.Tokens{}
+	require.NoError(t, json.Unmarshal(body, &tokens))
+	return tokens
+}
+
+func TestSigninRole(t *testing.T) {
+	srv := newTestServer(t)
+
+	res, _ := do(t, srv, http.MethodPost, "/signin", `{"email":"`+email+`","password":"`+password+`","role":"admin"}`, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = do(t, srv, http.MethodPost, "/signin", `{"email":"`+email+`","password":"`+password+`","role":"superuser"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// Без роли назначается роль по умолчанию, её права попадают в access токен
+	res, _ = do(t, srv, http.MethodPost, "/signin", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	info := introspect(t, srv, login(t, srv).Access_token)
+	assert.Equal(t, rbac.RoleUser, info.Role)
+	assert.Equal(t, "profile:read profile:write", info.Scope)
+}
+
+func TestGrantRole(t *testing.T) {
+	srv := newTestServer(t, withAdmin(t))
+	user := signinAndLogin(t, srv)
+	admin := loginAdmin(t, srv)
+
+	info := introspect(t, srv, admin.Access_token)
+	assert.Contains(t, strings.Fields(info.Scope), rbac.PermRolesGrant)
+
+	path := "/admin/users/" + email + "/role"
+	t.Run("requires roles:grant", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPut, path, `{"role":"admin"}`, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		res, _ = do(t, srv, http.MethodPut, path, `{"role":"admin"}`, bearer(user.Access_token))
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	res, _ := do(t, srv, http.MethodPut, path, `{"role":"superuser"}`, bearer(admin.Access_token))
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = do(t, srv, http.MethodPut, "/admin/users/unknown@example.com/role", `{"role":"guest"}`, bearer(admin.Access_token))
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, _ = do(t, srv, http.MethodPut, path, `{"role":"admin"}`, bearer(admin.Access_token))
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	// Токены со старой ролью больше не действуют
+	assert.False(t, introspect(t, srv, user.Access_token).Active)
+	info = introspect(t, srv, login(t, srv).Access_token)
+	assert.Equal(t, rbac.RoleAdmin, info.Role)
+	assert.Contains(t, strings.Fields(info.Scope), rbac.PermLockoutsManage)
+}
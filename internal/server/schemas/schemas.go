@@ -1,15 +1,155 @@
 package schemas
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type Tokens struct {
 	Access_token  string `json:"access_token"`
 	Refresh_token string `json:"refresh_token"`
 }
 
+// Ответ интроспекции по RFC 7662
+type Introspection struct {
+	Active bool   `json:"active"`
+	Sub    string `json:"sub,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Role   string `json:"role,omitempty"`
+	// Права владельца access токена через пробел
+	Scope     string `json:"scope,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	// Оставшееся время жизни токена в секундах
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+type Session struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	// Сессия, в которой выдан access токен запроса
+	Current bool `json:"current"`
+}
+
 type LoginData struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+// Ответ /login, если у пользователя включён второй фактор
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type LoginMFAData struct {
+	MFAToken string `json:"mfa_token"`
+	// Код TOTP или код восстановления
+	Code string `json:"code"`
+}
+
+type MFACodeData struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	// otpauth:// URI для QR кода
+	URI string `json:"uri"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Начало регистрации или входа по ключу доступа
+type WebAuthnOptions struct {
+	CeremonyID string `json:"ceremony_id"`
+	// Передаются в navigator.credentials.create() или navigator.credentials.get()
+	Options any `json:"options"`
+}
+
+type WebAuthnLoginData struct {
+	// Пустой email - выбор любого ключа, сохранённого на устройстве
+	Email string `json:"email"`
+}
+
+type WebAuthnFinishData struct {
+	CeremonyID string `json:"ceremony_id"`
+	// Результат navigator.credentials.*() в JSON (PublicKeyCredential, бинарные поля в base64url)
+	Credential json.RawMessage `json:"credential"`
+}
+
+type ChangePasswordData struct {
+	Email       string `json:"email"`
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type ForgotPasswordData struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordData struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// User - учётная запись в административном API
+type User struct {
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+	Disabled      bool   `json:"disabled"`
+}
+
+type UserList struct {
+	Users []User `json:"users"`
+	// Передаётся в cursor для получения следующей страницы. Отсутствует на последней странице
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// AuditRecord - запись журнала аудита
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	Subject   string    `json:"subject"`
+	Details   string    `json:"details,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Result    string    `json:"result"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+type AuditLog struct {
+	Records []AuditRecord `json:"records"`
+}
+
+type GrantRoleData struct {
+	Role string `json:"role"`
+}
+
+type ResendVerificationData struct {
+	Email string `json:"email"`
+}
+
+// PasswordPolicyErr - ответ на пароль, не соответствующий политике
+type PasswordPolicyErr struct {
+	Code       int                 `json:"code"`
+	Msg        string              `json:"msg"`
+	Violations []PasswordViolation `json:"violations"`
+}
+
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
 type SigninData struct {
 	Email    string `json:""`
 	Password string `json:""`
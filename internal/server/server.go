@@ -3,24 +3,34 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 	"sync/atomic"
+	"time"
 
+	"lk-auth/internal/domain/model"
 	sl "lk-auth/internal/libs/logger"
 	"lk-auth/internal/server/middleware"
 	"lk-auth/internal/server/schemas"
 	"lk-auth/internal/service/auth"
+	"lk-auth/internal/service/jwt"
+	"lk-auth/internal/storage"
 
 	"github.com/gorilla/csrf"
 )
 
 type Server struct {
-	ctx            context.Context
-	router         *http.ServeMux
+	ctx    context.Context
+	router *http.ServeMux
+	// router с адресом клиента, ID запроса и контекстом трассировки
+	handler        http.Handler
 	auth           auth.AuthService
+	jwt            jwt.JWTService
 	log            *slog.Logger
 	isShuttingDown *atomic.Bool
 	server         http.Server
@@ -31,37 +41,174 @@ type ErrMsg struct {
 	Msg  string `json:"msg"`
 }
 
-func NewServer(ctx context.Context, auth auth.AuthService, log *slog.Logger, isShuttingDown *atomic.Bool) *Server {
+// Timeouts - сроки обработки запросов, 0 - без ограничения
+type Timeouts struct {
+	Default time.Duration
+	// Эндпоинты с хэшированием пароля: Argon2id занимает заметное время
+	Password time.Duration
+}
+
+// introspectionClients - client_id -> client_secret сервисов, которым разрешена интроспекция токенов.
+// rateLimits - счётчики лимитов запросов, nil отключает лимиты.
+// trustedProxies - прокси, от которых принимается адрес клиента в X-Forwarded-For и X-Real-IP
+func NewServer(ctx context.Context, auth auth.AuthService, jwt jwt.JWTService, introspectionClients map[string]string, rateLimits storage.RateLimitStorage, trustedProxies []netip.Prefix, timeouts Timeouts, log *slog.Logger, isShuttingDown *atomic.Bool) *Server {
 	s := &Server{
 		ctx:            ctx,
 		router:         http.NewServeMux(),
 		auth:           auth,
+		jwt:            jwt,
 		log:            log,
 		isShuttingDown: isShuttingDown,
 	}
 
+	// Строка о каждом запросе. Пользователь определяется по bearer токену, подпись которого проверена
+	logging := middleware.Logging(log, middleware.BySubject(jwt.GetEmail))
+	// Срок обработки действует и на проверку лимитов, и на обращения к хранилищам в обработчике
+	timeout := middleware.Timeout(timeouts.Default)
+	passwordTimeout := middleware.Timeout(timeouts.Password)
+
+	// Лимиты запросов. Лимит по email на входе дополняет блокировку после неудачных попыток:
+	// он действует и на запросы с верным паролем. Интроспекцию вызывают только доверенные сервисы, она не ограничивается
+	limit := func(limits ...middleware.Limit) middleware.Middleware {
+		return middleware.RateLimit(rateLimits, log, limits...)
+	}
+	perIP := func(name string, requests int64, window time.Duration) middleware.Limit {
+		return middleware.Limit{Name: name + ":ip", Requests: requests, Window: window, Key: middleware.ByIP}
+	}
+	perEmail := func(name string, requests int64, window time.Duration) middleware.Limit {
+		return middleware.Limit{Name: name + ":email", Requests: requests, Window: window, Key: middleware.ByEmail}
+	}
+	perSubject := func(name string, requests int64, window time.Duration) middleware.Limit {
+		return middleware.Limit{Name: name + ":sub", Requests: requests, Window: window, Key: middleware.BySubject(jwt.GetEmail)}
+	}
+	// Общий лимит эндпоинтов управления учётной записью по access токену
+	accountLimit := limit(perIP("account", 120, time.Minute), perSubject("account", 60, time.Minute))
+	// Начало и завершение входа по ключу доступа считаются вместе
+	webAuthnLoginLimit := limit(perIP("webauthn_login", 30, time.Minute))
+
 	s.router.HandleFunc("GET /ping",
-		middleware.Chain(s.handlePing, middleware.Logging(log)),
+		middleware.Chain(s.handlePing, logging),
 	)
 	s.router.HandleFunc("POST /signin",
-		middleware.Chain(s.handleSignin, middleware.Logging(log)),
+		middleware.Chain(s.handleSignin, limit(perIP("signin", 10, time.Hour)), passwordTimeout, logging),
 	)
 	s.router.HandleFunc("POST /login",
-		middleware.Chain(s.handleLogin, middleware.Logging(log)),
+		middleware.Chain(s.handleLogin, limit(perIP("login", 30, time.Minute), perEmail("login", 10, time.Minute)), passwordTimeout, logging),
+	)
+	s.router.HandleFunc("POST /login/mfa",
+		middleware.Chain(s.handleLoginMFA, limit(perIP("login_mfa", 30, time.Minute)), timeout, logging),
 	)
 	s.router.HandleFunc("POST /refresh",
-		middleware.Chain(s.handleRefresh, middleware.Logging(log)),
+		middleware.Chain(s.handleRefresh, limit(perIP("refresh", 60, time.Minute)), timeout, logging),
 	)
 	s.router.HandleFunc("POST /logout",
-		middleware.Chain(s.handleLogout, middleware.Logging(log)),
+		middleware.Chain(s.handleLogout, limit(perIP("logout", 60, time.Minute)), timeout, logging),
+	)
+	s.router.HandleFunc("POST /introspect",
+		middleware.Chain(s.handleIntrospect,
+			middleware.ClientAuth("introspect", introspectionClients),
+			timeout,
+			logging,
+		),
+	)
+	s.router.HandleFunc("POST /logout/all",
+		middleware.Chain(s.handleLogoutAll, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("POST /password/change",
+		middleware.Chain(s.handleChangePassword, limit(perIP("password_change", 10, time.Minute), perEmail("password_change", 5, time.Minute)), passwordTimeout, logging),
+	)
+	s.router.HandleFunc("POST /password/forgot",
+		middleware.Chain(s.handleForgotPassword,
+			limit(perIP("password_forgot", 10, time.Hour), perEmail("password_forgot", 3, time.Hour)),
+			timeout,
+			logging,
+		),
+	)
+	s.router.HandleFunc("POST /password/reset",
+		middleware.Chain(s.handleResetPassword, limit(perIP("password_reset", 10, time.Minute)), passwordTimeout, logging),
+	)
+	s.router.HandleFunc("GET /verify-email",
+		middleware.Chain(s.handleVerifyEmail, limit(perIP("verify_email", 30, time.Minute)), timeout, logging),
+	)
+	s.router.HandleFunc("POST /verify-email/resend",
+		middleware.Chain(s.handleResendVerification,
+			limit(perIP("verify_email_resend", 10, time.Hour), perEmail("verify_email_resend", 3, time.Hour)),
+			timeout,
+			logging,
+		),
+	)
+	s.router.HandleFunc("GET /sessions",
+		middleware.Chain(s.handleListSessions, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("DELETE /sessions/{id}",
+		middleware.Chain(s.handleRevokeSession, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("DELETE /sessions",
+		middleware.Chain(s.handleRevokeOtherSessions, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("POST /mfa/totp",
+		middleware.Chain(s.handleEnrollTOTP, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("POST /mfa/totp/confirm",
+		middleware.Chain(s.handleConfirmTOTP, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("DELETE /mfa/totp",
+		middleware.Chain(s.handleDisableTOTP, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("POST /webauthn/register/begin",
+		middleware.Chain(s.handleBeginWebAuthnRegistration, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("POST /webauthn/register/finish",
+		middleware.Chain(s.handleFinishWebAuthnRegistration, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("POST /webauthn/login/begin",
+		middleware.Chain(s.handleBeginWebAuthnLogin, webAuthnLoginLimit, timeout, logging),
+	)
+	s.router.HandleFunc("POST /webauthn/login/finish",
+		middleware.Chain(s.handleFinishWebAuthnLogin, webAuthnLoginLimit, timeout, logging),
+	)
+	s.router.HandleFunc("DELETE /admin/lockouts",
+		middleware.Chain(s.handleClearLockout, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("GET /admin/audit",
+		middleware.Chain(s.handleAuditLog, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("GET /admin/users",
+		middleware.Chain(s.handleListUsers, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("GET /admin/users/{email}",
+		middleware.Chain(s.handleGetUser, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("DELETE /admin/users/{email}",
+		middleware.Chain(s.handleUserAction("/admin/users/{email}", s.auth.DeleteUser), accountLimit, timeout, logging),
 	)
-	// TODO: может нужно переимновать в /validate
-	s.router.HandleFunc("POST /checktoken",
-		middleware.Chain(s.handleCheckToken, middleware.Logging(log)),
+	s.router.HandleFunc("PUT /admin/users/{email}/role",
+		middleware.Chain(s.handleGrantRole, accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("POST /admin/users/{email}/disable",
+		middleware.Chain(s.handleUserAction("/admin/users/{email}/disable", func(ctx context.Context, token, email string, client model.ClientInfo) error {
+			return s.auth.SetUserDisabled(ctx, token, email, true, client)
+		}), accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("POST /admin/users/{email}/enable",
+		middleware.Chain(s.handleUserAction("/admin/users/{email}/enable", func(ctx context.Context, token, email string, client model.ClientInfo) error {
+			return s.auth.SetUserDisabled(ctx, token, email, false, client)
+		}), accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("POST /admin/users/{email}/password-reset",
+		middleware.Chain(s.handleUserAction("/admin/users/{email}/password-reset", s.auth.ForcePasswordReset), accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("DELETE /admin/users/{email}/sessions",
+		middleware.Chain(s.handleUserAction("/admin/users/{email}/sessions", s.auth.RevokeUserSessions), accountLimit, timeout, logging),
+	)
+	s.router.HandleFunc("GET /.well-known/jwks.json",
+		middleware.Chain(s.handleJWKS, logging),
 	)
 	// TODO: добавить в OAPI спецификацию
 	s.router.HandleFunc("GET /healthz", s.handleHealthz)
 
+	s.handler = middleware.Chain(s.router.ServeHTTP, middleware.RealIP(trustedProxies), middleware.RequestID)
+
 	return s
 }
 
@@ -72,7 +219,7 @@ func (s *Server) Start(env, addr string) error {
 	// csrfProt := csrf.Protect([]byte("32-byte-long-auth-key"))
 	s.server = http.Server{
 		Addr:    addr,
-		Handler: s.router,
+		Handler: s.handler,
 		BaseContext: func(_ net.Listener) context.Context {
 			return s.ctx
 		},
@@ -99,7 +246,7 @@ func (s *Server) handleSignin(w http.ResponseWriter, r *http.Request) {
 	signinData := schemas.SigninData{}
 	err := json.NewDecoder(r.Body).Decode(&signinData)
 	if err != nil {
-		s.log.Debug("/signin", sl.Err(err))
+		s.log.DebugContext(r.Context(), "/signin", sl.Err(err))
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(
 			ErrMsg{
@@ -109,10 +256,21 @@ func (s *Server) handleSignin(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
-	s.log.Debug("/signin", "Email", signinData.Email, "Password", signinData.Password)
-	err = s.auth.Signin(signinData.Email, signinData.Password, signinData.Role)
+	s.log.DebugContext(r.Context(), "/signin", "email", signinData.Email)
+	err = s.auth.Signin(r.Context(), signinData.Email, signinData.Password, signinData.Role, clientInfo(r))
+	if writePasswordPolicyErr(w, err) {
+		return
+	}
+	if errors.Is(err, auth.ErrForbidden) {
+		writeErr(w, http.StatusForbidden, "role can only be granted by an administrator")
+		return
+	}
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		writeErr(w, http.StatusBadRequest, "the email has already been used")
+		return
+	}
 	if err != nil {
-		s.log.Debug("/signin", sl.Err(err))
+		s.log.DebugContext(r.Context(), "/signin", sl.Err(err))
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(
 			ErrMsg{
@@ -132,7 +290,7 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	loginData := schemas.LoginData{}
 	err := json.NewDecoder(r.Body).Decode(&loginData)
 	if err != nil {
-		s.log.Debug("/login", sl.Err(err))
+		s.log.DebugContext(r.Context(), "/login", sl.Err(err))
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(
 			ErrMsg{
@@ -142,17 +300,31 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
-	s.log.Debug("/login", "Email", loginData.Email, "Password", loginData.Password)
-	accessToken, refreshToken, err := s.auth.Login(loginData.Email, loginData.Password)
+	s.log.DebugContext(r.Context(), "/login", "email", loginData.Email)
+	accessToken, refreshToken, err := s.auth.Login(r.Context(), loginData.Email, loginData.Password, clientInfo(r))
+	var mfaRequired *auth.MFARequiredError
+	if errors.As(err, &mfaRequired) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(schemas.MFAChallenge{
+			MFARequired: true,
+			MFAToken:    mfaRequired.Token,
+		})
+		return
+	}
+	if writeLockedErr(w, err) {
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		writeErr(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if errors.Is(err, auth.ErrEmailNotVerified) || errors.Is(err, auth.ErrAccountDisabled) {
+		writeErr(w, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
-		s.log.Debug("/login", sl.Err(err))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(
-			ErrMsg{
-				Code: 400,
-				Msg:  err.Error(),
-			},
-		)
+		s.log.ErrorContext(r.Context(), "/login", sl.Err(err))
+		writeErr(w, http.StatusInternalServerError, "internal error")
 		return
 	}
 
@@ -170,7 +342,7 @@ func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	}{}
 	err := json.NewDecoder(r.Body).Decode(&inputToken)
 	if err != nil {
-		s.log.Debug("/refresh", sl.Err(err))
+		s.log.DebugContext(r.Context(), "/refresh", sl.Err(err))
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(
 			ErrMsg{
@@ -181,9 +353,9 @@ func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, refreshToken, err := s.auth.Refresh(inputToken.Token)
+	accessToken, refreshToken, err := s.auth.Refresh(r.Context(), inputToken.Token, clientInfo(r))
 	if err != nil {
-		s.log.Debug("/refresh", sl.Err(err))
+		s.log.DebugContext(r.Context(), "/refresh", sl.Err(err))
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(
 			ErrMsg{
@@ -218,7 +390,7 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
-	err = s.auth.Logout(token.AccessToken)
+	err = s.auth.Logout(r.Context(), clientInfo(r), token.AccessToken)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(
@@ -232,13 +404,65 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (s *Server) handleCheckToken(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleLogoutAll(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	token := struct {
-		AccessToken string `json:"access_token"`
-	}{}
-	err := json.NewDecoder(r.Body).Decode(&token)
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	err := s.auth.LogoutAll(r.Context(), token, clientInfo(r))
+	if errors.Is(err, auth.ErrInvalidAccessToken) {
+		writeErr(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		s.log.ErrorContext(r.Context(), "/logout/all", sl.Err(err))
+		writeErr(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	data := schemas.ChangePasswordData{}
+	err := json.NewDecoder(r.Body).Decode(&data)
 	if err != nil {
+		s.log.DebugContext(r.Context(), "/password/change", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = s.auth.ChangePassword(r.Context(), data.Email, data.OldPassword, data.NewPassword, clientInfo(r))
+	if writeLockedErr(w, err) || writePasswordPolicyErr(w, err) {
+		return
+	}
+	if errors.Is(err, auth.ErrAccountDisabled) {
+		writeErr(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		s.log.DebugContext(r.Context(), "/password/change", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RFC 7662: токен передаётся в теле application/x-www-form-urlencoded,
+// для неактивного токена возвращается только {"active": false}
+func (s *Server) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// Ответ зависит от состояния чёрного списка и не должен кэшироваться
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := r.ParseForm()
+	if err != nil {
+		s.log.DebugContext(r.Context(), "/introspect", sl.Err(err))
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(
 			ErrMsg{
@@ -248,21 +472,65 @@ func (s *Server) handleCheckToken(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
-	res, err := s.auth.ValidateToken(token.AccessToken)
-	if err != nil {
-		s.log.Warn("token validation error", sl.Err(err))
-	}
-	if !res {
+	token := r.PostForm.Get("token")
+	if token == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(
 			ErrMsg{
 				Code: 400,
-				Msg:  "token is invalid",
+				Msg:  "token parameter is required",
 			},
 		)
 		return
 	}
+
+	info, err := s.auth.Introspect(r.Context(), token)
+	if err != nil {
+		s.log.ErrorContext(r.Context(), "/introspect", sl.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(
+			ErrMsg{
+				Code: 500,
+				Msg:  "introspection failed",
+			},
+		)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(introspection(info))
+}
+
+// introspection - ответ интроспекции. Отсутствующие в токене iat и exp не выводятся
+func introspection(info auth.TokenInfo) schemas.Introspection {
+	if !info.Active {
+		return schemas.Introspection{Active: false}
+	}
+	res := schemas.Introspection{
+		Active:    true,
+		Sub:       info.Email,
+		Email:     info.Email,
+		Role:      info.Role,
+		Scope:     info.Scope,
+		TokenType: info.Type + "_token",
+	}
+	if !info.IssuedAt.IsZero() {
+		res.Iat = info.IssuedAt.Unix()
+	}
+	if !info.ExpiresAt.IsZero() {
+		res.Exp = info.ExpiresAt.Unix()
+		res.TTL = max(int64(time.Until(info.ExpiresAt).Seconds()), 0)
+	}
+	return res
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// Ключи меняются редко, но при ротации потребители должны быстро получить новый набор
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s.jwt.JWKS())
 }
 
 func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
@@ -273,6 +541,33 @@ func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "OK")
 }
 
+// clientInfo извлекает сведения об устройстве, с которого пришёл запрос
+func clientInfo(r *http.Request) model.ClientInfo {
+	return model.ClientInfo{
+		IP:        middleware.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// bearerToken извлекает access токен из заголовка "Authorization: Bearer <token>"
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func writeErr(w http.ResponseWriter, code int, msg string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(
+		ErrMsg{
+			Code: code,
+			Msg:  msg,
+		},
+	)
+}
+
 func (s *Server) ShutDown(shutDownCtx context.Context) error {
 	return s.server.Shutdown(shutDownCtx)
 }
@@ -0,0 +1,317 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+	"lk-auth/internal/service/jwt"
+	"lk-auth/internal/storage/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	email    = "test@example.com"
+	password = "password"
+)
+
+// newTestServer собирает сервис целиком на хранилищах в памяти. opts дополняют или заменяют возможности по умолчанию
+func newTestServer(t *testing.T, opts ...auth.Option) *httptest.Server {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	log := slog.New(slog.DiscardHandler)
+
+	jwtService, err := jwt.NewJWTServiceImpl([]byte("a-string-secret-at-least-256-bits-long"), time.Minute, time.Hour, log)
+	require.NoError(t, err)
+	jwtStorage, err := memory.NewMemoryJWTStorage(ctx, wg, time.Hour, log, time.Minute)
+	require.NoError(t, err)
+	sessionStorage, err := memory.NewMemorySessionStorage(ctx, wg, time.Hour, log, time.Minute)
+	require.NoError(t, err)
+	blackListStorage, err := memory.NewMemoryBlackListStorage(ctx, wg, jwtService, log, time.Minute)
+	require.NoError(t, err)
+	userStorage, err := memory.NewMemoryUserStorage(nil, log)
+	require.NoError(t, err)
+	mfaStorage, err := memory.NewMemoryMFAStorage(log)
+	require.NoError(t, err)
+	webAuthnStorage, err := memory.NewMemoryWebAuthnStorage(ctx, wg, log, time.Minute)
+	require.NoError(t, err)
+	webAuthn, err := auth.NewWebAuthn(rpID, "lk-auth", []string{rpOrigin})
+	require.NoError(t, err)
+	lockoutStorage, err := memory.NewMemoryLockoutStorage(ctx, wg, log, time.Minute)
+	require.NoError(t, err)
+	rateLimitStorage, err := memory.NewMemoryRateLimitStorage(ctx, wg, log, time.Minute)
+	require.NoError(t, err)
+
+	authService := auth.NewAuthServiceImpl(jwtService, blackListStorage, jwtStorage, sessionStorage, userStorage, log,
+		append([]auth.Option{
+			auth.WithMFA(mfaStorage, "lk-auth"),
+			auth.WithWebAuthn(webAuthnStorage, webAuthn),
+			auth.WithLockout(lockoutStorage, auth.LockoutConfig{
+				Account:   auth.LockoutPolicy{FreeAttempts: 3, MaxAttempts: 5},
+				IP:        auth.LockoutPolicy{FreeAttempts: 20, MaxAttempts: 100},
+				BaseDelay: time.Second,
+				Duration:  15 * time.Minute,
+			}),
+		}, opts...)...,
+	)
+	s := NewServer(ctx, authService, jwtService, map[string]string{"gateway": "s3cret"}, rateLimitStorage, nil, Timeouts{Default: 5 * time.Second, Password: 10 * time.Second}, log, &atomic.Bool{})
+
+	srv := httptest.NewServer(s.handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, body string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	res, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, data
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func signinAndLogin(t *testing.T, srv *httptest.Server) schemas.Tokens {
+	t.Helper()
+
+	res, _ := do(t, srv, http.MethodPost, "/signin", `{"email":"`+email+`","password":"`+password+`","role":"user"}`, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	return login(t, srv)
+}
+
+func login(t *testing.T, srv *httptest.Server) schemas.Tokens {
+	t.Helper()
+
+	res, body := do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+
+	tokens := schemas.Tokens{}
+	require.NoError(t, json.Unmarshal(body, &tokens))
+	require.NotEmpty(t, tokens.Access_token)
+	require.NotEmpty(t, tokens.Refresh_token)
+	return tokens
+}
+
+func introspect(t *testing.T, srv *httptest.Server, token string) schemas.Introspection {
+	t.Helper()
+
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.SetBasicAuth("gateway", "s3cret")
+	header.Set("Authorization", req.Header.Get("Authorization"))
+
+	res, body := do(t, srv, http.MethodPost, "/introspect", url.Values{"token": {token}}.Encode(), header)
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+
+	info := schemas.Introspection{}
+	require.NoError(t, json.Unmarshal(body, &info))
+	return info
+}
+
+func TestSigninAndLogin(t *testing.T) {
+	srv := newTestServer(t)
+	tokens := signinAndLogin(t, srv)
+
+	info := introspect(t, srv, tokens.Access_token)
+	assert.True(t, info.Active)
+	assert.Equal(t, email, info.Email)
+	assert.Equal(t, "access_token", info.TokenType)
+	// Refresh токен не даёт доступа к ресурсам
+	assert.False(t, introspect(t, srv, tokens.Refresh_token).Active)
+
+	t.Run("duplicate email", func(t *testing.T) {
+		res, body := do(t, srv, http.MethodPost, "/signin", `{"email":"`+email+`","password":"`+password+`","role":"user"}`, nil)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Contains(t, string(body), "the email has already been used")
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		for _, address := range []string{"", "not-an-email", "Test <other@example.com>"} {
+			res, _ := do(t, srv, http.MethodPost, "/signin", `{"email":"`+address+`","password":"`+password+`","role":"user"}`, nil)
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode, address)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		res, body := do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"wrong"}`, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		// Неизвестный email неотличим от неверного пароля
+		unknownRes, unknownBody := do(t, srv, http.MethodPost, "/login", `{"email":"unknown@example.com","password":"wrong"}`, nil)
+		assert.Equal(t, res.StatusCode, unknownRes.StatusCode)
+		assert.JSONEq(t, string(body), string(unknownBody))
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	srv := newTestServer(t)
+	tokens := signinAndLogin(t, srv)
+
+	res, body := do(t, srv, http.MethodPost, "/refresh", `{"refresh_token":"`+tokens.Refresh_token+`"}`, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+	rotated := schemas.Tokens{}
+	require.NoError(t, json.Unmarshal(body, &rotated))
+	assert.NotEqual(t, tokens.Refresh_token, rotated.Refresh_token)
+
+	assert.False(t, introspect(t, srv, tokens.Access_token).Active)
+	assert.True(t, introspect(t, srv, rotated.Access_token).Active)
+
+	// Повторное предъявление обменянного токена завершает всю сессию
+	res, _ = do(t, srv, http.MethodPost, "/refresh", `{"refresh_token":"`+tokens.Refresh_token+`"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.False(t, introspect(t, srv, rotated.Access_token).Active)
+	assert.False(t, introspect(t, srv, rotated.Refresh_token).Active)
+}
+
+func TestLogout(t *testing.T) {
+	srv := newTestServer(t)
+	tokens := signinAndLogin(t, srv)
+
+	res, _ := do(t, srv, http.MethodPost, "/logout", `{"access_token":"`+tokens.Access_token+`"}`, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	assert.False(t, introspect(t, srv, tokens.Access_token).Active)
+	res, _ = do(t, srv, http.MethodPost, "/refresh", `{"refresh_token":"`+tokens.Refresh_token+`"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestSessions(t *testing.T) {
+	srv := newTestServer(t)
+	first := signinAndLogin(t, srv)
+	second := login(t, srv)
+
+	res, body := do(t, srv, http.MethodGet, "/sessions", "", bearer(first.Access_token))
+	require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+	sessions := []schemas.Session{}
+	require.NoError(t, json.Unmarshal(body, &sessions))
+	require.Len(t, sessions, 2)
+
+	var other string
+	for _, session := range sessions {
+		if !session.Current {
+			other = session.ID
+		}
+	}
+	require.NotEmpty(t, other)
+
+	res, _ = do(t, srv, http.MethodDelete, "/sessions/"+other, "", bearer(first.Access_token))
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.False(t, introspect(t, srv, second.Access_token).Active)
+	assert.True(t, introspect(t, srv, first.Access_token).Active)
+
+	res, _ = do(t, srv, http.MethodGet, "/sessions", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestLogoutAll(t *testing.T) {
+	srv := newTestServer(t)
+	first := signinAndLogin(t, srv)
+	second := login(t, srv)
+
+	res, _ := do(t, srv, http.MethodPost, "/logout/all", "", bearer(first.Access_token))
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	assert.False(t, introspect(t, srv, first.Access_token).Active)
+	assert.False(t, introspect(t, srv, second.Access_token).Active)
+}
+
+func TestChangePassword(t *testing.T) {
+	srv := newTestServer(t)
+	tokens := signinAndLogin(t, srv)
+
+	res, _ := do(t, srv, http.MethodPost, "/password/change",
+		`{"email":"`+email+`","old_password":"`+password+`","new_password":"new-password"}`, nil)
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	assert.False(t, introspect(t, srv, tokens.Access_token).Active)
+	res, _ = do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	res, _ = do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"new-password"}`, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestIntrospectRequiresClientAuth(t *testing.T) {
+	srv := newTestServer(t)
+	tokens := signinAndLogin(t, srv)
+
+	res, _ := do(t, srv, http.MethodPost, "/introspect", url.Values{"token": {tokens.Access_token}}.Encode(),
+		http.Header{"Content-Type": {"application/x-www-form-urlencoded"}})
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestIntrospectionClaims(t *testing.T) {
+	exp := time.Now().Add(time.Minute).Truncate(time.Second)
+	iat := exp.Add(-15 * time.Minute)
+
+	res, err := json.Marshal(introspection(auth.TokenInfo{
+		Active: true, Email: email, Role: "user", Type: "access", IssuedAt: iat, ExpiresAt: exp,
+	}))
+	require.NoError(t, err)
+	assert.Contains(t, string(res), fmt.Sprintf(`"iat":%d`, iat.Unix()))
+	assert.Contains(t, string(res), fmt.Sprintf(`"exp":%d`, exp.Unix()))
+	assert.Contains(t, string(res), `"ttl":`)
+
+	// Токен без iat и exp
+	res, err = json.Marshal(introspection(auth.TokenInfo{Active: true, Email: email, Role: "user", Type: "access"}))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"active":true,"sub":"`+email+`","email":"`+email+`","role":"user","token_type":"access_token"}`, string(res))
+
+	res, err = json.Marshal(introspection(auth.TokenInfo{Active: false, Email: email, IssuedAt: iat}))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"active":false}`, string(res))
+}
+
+func TestJWKSAndHealthz(t *testing.T) {
+	srv := newTestServer(t)
+
+	res, body := do(t, srv, http.MethodGet, "/.well-known/jwks.json", "", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"keys":[]}`, string(body))
+
+	res, _ = do(t, srv, http.MethodGet, "/healthz", "", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	srv := newTestServer(t)
+
+	res, _ := do(t, srv, http.MethodPost, "/login", `{"email":"`+email+`","password":"`+password+`"}`,
+		http.Header{"X-Request-Id": {"gateway-42"}})
+	assert.Equal(t, "gateway-42", res.Header.Get("X-Request-ID"))
+	assert.NotEmpty(t, res.Header.Get("Traceparent"))
+
+	res, _ = do(t, srv, http.MethodGet, "/healthz", "", nil)
+	assert.NotEmpty(t, res.Header.Get("X-Request-ID"))
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+)
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	sessions, currentID, err := s.auth.Sessions(r.Context(), token)
+	if err != nil {
+		s.writeSessionErr(w, r, "/sessions", err)
+		return
+	}
+
+	res := make([]schemas.Session, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, schemas.Session{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			IP:         session.IP,
+			UserAgent:  session.UserAgent,
+			Current:    session.ID == currentID,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	err := s.auth.RevokeSession(r.Context(), token, r.PathValue("id"), clientInfo(r))
+	if err != nil {
+		s.writeSessionErr(w, r, "/sessions/{id}", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	err := s.auth.RevokeOtherSessions(r.Context(), token, clientInfo(r))
+	if err != nil {
+		s.writeSessionErr(w, r, "/sessions", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) writeSessionErr(w http.ResponseWriter, r *http.Request, path string, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidAccessToken):
+		writeErr(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, auth.ErrSessionNotFound):
+		writeErr(w, http.StatusNotFound, err.Error())
+	default:
+		s.log.ErrorContext(r.Context(), path, sl.Err(err))
+		writeErr(w, http.StatusInternalServerError, "internal error")
+	}
+}
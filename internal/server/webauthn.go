@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/server/schemas"
+	"lk-auth/internal/service/auth"
+
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+func (s *Server) handleBeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	ceremonyID, options, err := s.auth.BeginWebAuthnRegistration(r.Context(), token)
+	if err != nil {
+		s.writeWebAuthnErr(w, r, "/webauthn/register/begin", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(schemas.WebAuthnOptions{
+		CeremonyID: ceremonyID,
+		Options:    options,
+	})
+}
+
+func (s *Server) handleFinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeErr(w, http.StatusUnauthorized, "bearer token is required")
+		return
+	}
+
+	data := schemas.WebAuthnFinishData{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		s.log.DebugContext(r.Context(), "/webauthn/register/finish", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(data.Credential))
+	if err != nil {
+		s.log.DebugContext(r.Context(), "/webauthn/register/finish", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, protocolErrMsg(err))
+		return
+	}
+
+	if err = s.auth.FinishWebAuthnRegistration(r.Context(), token, data.CeremonyID, response); err != nil {
+		s.writeWebAuthnErr(w, r, "/webauthn/register/finish", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleBeginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Тело необязательно: без email выполняется вход с выбором ключа на устройстве
+	data := schemas.WebAuthnLoginData{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil && !errors.Is(err, io.EOF) {
+		s.log.DebugContext(r.Context(), "/webauthn/login/begin", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ceremonyID, options, err := s.auth.BeginWebAuthnLogin(r.Context(), data.Email)
+	if err != nil {
+		s.writeWebAuthnErr(w, r, "/webauthn/login/begin", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(schemas.WebAuthnOptions{
+		CeremonyID: ceremonyID,
+		Options:    options,
+	})
+}
+
+func (s *Server) handleFinishWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	data := schemas.WebAuthnFinishData{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		s.log.DebugContext(r.Context(), "/webauthn/login/finish", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(data.Credential))
+	if err != nil {
+		s.log.DebugContext(r.Context(), "/webauthn/login/finish", sl.Err(err))
+		writeErr(w, http.StatusBadRequest, protocolErrMsg(err))
+		return
+	}
+
+	accessToken, refreshToken, err := s.auth.FinishWebAuthnLogin(r.Context(), data.CeremonyID, response, clientInfo(r))
+	if err != nil {
+		s.writeWebAuthnErr(w, r, "/webauthn/login/finish", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(schemas.Tokens{
+		Access_token:  accessToken,
+		Refresh_token: refreshToken,
+	})
+}
+
+func (s *Server) writeWebAuthnErr(w http.ResponseWriter, r *http.Request, path string, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidAccessToken),
+		errors.Is(err, auth.ErrWebAuthnFailed):
+		writeErr(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, auth.ErrWebAuthnCeremony),
+		errors.Is(err, auth.ErrNoPasskeys):
+		writeErr(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, auth.ErrEmailNotVerified),
+		errors.Is(err, auth.ErrAccountDisabled):
+		writeErr(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, auth.ErrWebAuthnUnavailable):
+		writeErr(w, http.StatusNotImplemented, err.Error())
+	default:
+		s.log.ErrorContext(r.Context(), path, sl.Err(err))
+		writeErr(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// protocolErrMsg дополняет ошибку разбора ответа аутентификатора пояснением библиотеки
+func protocolErrMsg(err error) string {
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.DevInfo != "" {
+		return protocolErr.Details + ": " + protocolErr.DevInfo
+	}
+	return err.Error()
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lk-auth/internal/server/schemas"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	rpID     = "lk-auth.test"
+	rpOrigin = "https://lk-auth.test"
+)
+
+// Флаги authenticatorData: пользователь присутствовал, проверен, в данных есть новый ключ
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator - программный аутентификатор с одним ключом ES256 и аттестацией "none"
+type softAuthenticator struct {
+	t          *testing.T
+	key        *ecdsa.PrivateKey
+	id         []byte
+	userHandle []byte
+	signCount  uint32
+	origin     string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{t: t, key: key, id: id, origin: rpOrigin}
+}
+
+// Параметры navigator.credentials.*() в том виде, в котором их отдаёт сервер
+type webAuthnOptions struct {
+	CeremonyID string `json:"ceremony_id"`
+	Options    struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": challenge,
+		"origin":    a.origin,
+	})
+	require.NoError(a.t, err)
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags|flagUserPresent|flagUserVerified)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+// create отвечает на navigator.credentials.create()
+func (a *softAuthenticator) create(options webAuthnOptions) string {
+	var err error
+	a.userHandle, err = b64.DecodeString(options.Options.PublicKey.User.ID)
+	require.NoError(a.t, err)
+
+	// Открытый ключ в COSE: kty EC2, alg ES256, crv P-256
+	publicKey, err := webauthncbor.Marshal(map[int]any{
+		1:  2,
+		3:  -7,
+		-1: 1,
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(a.t, err)
+
+	authData := a.authData(flagAttestedData)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.id)))
+	authData = append(authData, a.id...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	require.NoError(a.t, err)
+
+	return a.finishBody(options.CeremonyID, map[string]any{
+		"id":    b64.EncodeToString(a.id),
+		"rawId": b64.EncodeToString(a.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", options.Options.PublicKey.Challenge)),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	})
+}
+
+// get отвечает на navigator.credentials.get()
+func (a *softAuthenticator) get(options webAuthnOptions) string {
+	a.signCount++
+	authData := a.authData(0)
+	clientData := a.clientData("webauthn.get", options.Options.PublicKey.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(a.t, err)
+
+	return a.finishBody(options.CeremonyID, map[string]any{
+		"id":    b64.EncodeToString(a.id),
+		"rawId": b64.EncodeToString(a.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(a.userHandle),
+		},
+	})
+}
+
+func (a *softAuthenticator) finishBody(ceremonyID string, credential any) string {
+	body, err := json.Marshal(map[string]any{
+		"ceremony_id": ceremonyID,
+		"credential":  credential,
+	})
+	require.NoError(a.t, err)
+	return string(body)
+}
+
+func beginWebAuthn(t *testing.T, srv *httptest.Server, path, body string, header http.Header) webAuthnOptions {
+	t.Helper()
+
+	res, data := do(t, srv, http.MethodPost, path, body, header)
+	require.Equal(t, http.StatusOK, res.StatusCode, string(data))
+	options := webAuthnOptions{}
+	require.NoError(t, json.Unmarshal(data, &options))
+	require.NotEmpty(t, options.CeremonyID)
+	require.NotEmpty(t, options.Options.PublicKey.Challenge)
+	return options
+}
+
+// registerPasskey регистрирует ключ программного аутентификатора для владельца accessToken
+func registerPasskey(t *testing.T, srv *httptest.Server, accessToken string) *softAuthenticator {
+	t.Helper()
+
+	authenticator := newSoftAuthenticator(t)
+	options := beginWebAuthn(t, srv, "/webauthn/register/begin", "", bearer(accessToken))
+	res, body := do(t, srv, http.MethodPost, "/webauthn/register/finish", authenticator.create(options), bearer(accessToken))
+	require.Equal(t, http.StatusNoContent, res.StatusCode, string(body))
+	return authenticator
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	srv := newTestServer(t)
+	tokens := signinAndLogin(t, srv)
+	authenticator := registerPasskey(t, srv, tokens.Access_token)
+
+	loginWith := func(t *testing.T, beginBody string) {
+		options := beginWebAuthn(t, srv, "/webauthn/login/begin", beginBody, nil)
+		res, body := do(t, srv, http.MethodPost, "/webauthn/login/finish", authenticator.get(options), nil)
+		require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+
+		passkeyTokens := schemas.Tokens{}
+		require.NoError(t, json.Unmarshal(body, &passkeyTokens))
+		info := introspect(t, srv, passkeyTokens.Access_token)
+		assert.True(t, info.Active)
+		assert.Equal(t, email, info.Email)
+		assert.Equal(t, "user", info.Role)
+
+		// Вход по ключу создаёт обычную сессию с обновлением токенов
+		res, _ = do(t, srv, http.MethodPost, "/refresh", `{"refresh_token":"`+passkeyTokens.Refresh_token+`"}`, nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	t.Run("with email", func(t *testing.T) {
+		loginWith(t, `{"email":"`+email+`"}`)
+	})
+
+	t.Run("discoverable", func(t *testing.T) {
+		loginWith(t, "")
+	})
+
+	t.Run("ceremony is single-use", func(t *testing.T) {
+		options := beginWebAuthn(t, srv, "/webauthn/login/begin", "", nil)
+		res, body := do(t, srv, http.MethodPost, "/webauthn/login/finish", authenticator.get(options), nil)
+		require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+
+		res, _ = do(t, srv, http.MethodPost, "/webauthn/login/finish", authenticator.get(options), nil)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("foreign key", func(t *testing.T) {
+		// Тот же ID ключа, но подпись другим закрытым ключом
+		impostor := newSoftAuthenticator(t)
+		impostor.id = authenticator.id
+		impostor.userHandle = authenticator.userHandle
+		impostor.signCount = authenticator.signCount + 10
+
+		options := beginWebAuthn(t, srv, "/webauthn/login/begin", "", nil)
+		res, _ := do(t, srv, http.MethodPost, "/webauthn/login/finish", impostor.get(options), nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("wrong origin", func(t *testing.T) {
+		authenticator.origin = "https://phishing.test"
+		defer func() { authenticator.origin = rpOrigin }()
+
+		options := beginWebAuthn(t, srv, "/webauthn/login/begin", "", nil)
+		res, _ := do(t, srv, http.MethodPost, "/webauthn/login/finish", authenticator.get(options), nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("cloned authenticator", func(t *testing.T) {
+		// Клон продолжает со старого значения счётчика
+		clone := *authenticator
+		clone.signCount = 0
+
+		options := beginWebAuthn(t, srv, "/webauthn/login/begin", "", nil)
+		res, _ := do(t, srv, http.MethodPost, "/webauthn/login/finish", clone.get(options), nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("unknown email", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPost, "/webauthn/login/begin", `{"email":"unknown@example.com"}`, nil)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestWebAuthnRegister(t *testing.T) {
+	srv := newTestServer(t)
+	tokens := signinAndLogin(t, srv)
+
+	t.Run("requires access token", func(t *testing.T) {
+		res, _ := do(t, srv, http.MethodPost, "/webauthn/register/begin", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("several passkeys", func(t *testing.T) {
+		first := registerPasskey(t, srv, tokens.Access_token)
+
+		// Уже зарегистрированный ключ исключается, второй ключ получает тот же user handle
+		options := beginWebAuthn(t, srv, "/webauthn/register/begin", "", bearer(tokens.Access_token))
+		handle, err := b64.DecodeString(options.Options.PublicKey.User.ID)
+		require.NoError(t, err)
+		assert.Equal(t, first.userHandle, handle)
+
+		second := newSoftAuthenticator(t)
+		res, body := do(t, srv, http.MethodPost, "/webauthn/register/finish", second.create(options), bearer(tokens.Access_token))
+		require.Equal(t, http.StatusNoContent, res.StatusCode, string(body))
+
+		// Повторная регистрация того же ключа отклоняется
+		options = beginWebAuthn(t, srv, "/webauthn/register/begin", "", bearer(tokens.Access_token))
+		res, _ = do(t, srv, http.MethodPost, "/webauthn/register/finish", second.create(options), bearer(tokens.Access_token))
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("wrong challenge", func(t *testing.T) {
+		options := beginWebAuthn(t, srv, "/webauthn/register/begin", "", bearer(tokens.Access_token))
+		options.Options.PublicKey.Challenge = b64.EncodeToString([]byte("forged challenge"))
+		res, _ := do(t, srv, http.MethodPost, "/webauthn/register/finish",
+			newSoftAuthenticator(t).create(options), bearer(tokens.Access_token))
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("login ceremony cannot register", func(t *testing.T) {
+		options := beginWebAuthn(t, srv, "/webauthn/login/begin", "", nil)
+		res, _ := do(t, srv, http.MethodPost, "/webauthn/register/finish",
+			newSoftAuthenticator(t).create(options), bearer(tokens.Access_token))
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("malformed credential", func(t *testing.T) {
+		options := beginWebAuthn(t, srv, "/webauthn/register/begin", "", bearer(tokens.Access_token))
+		res, _ := do(t, srv, http.MethodPost, "/webauthn/register/finish",
+			`{"ceremony_id":"`+options.CeremonyID+`","credential":{}}`, bearer(tokens.Access_token))
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
@@ -0,0 +1,41 @@
+// Пакет audit перечисляет действия и итоги, которые записываются в журнал аудита ([model.AuditRecord])
+package audit
+
+// Действия пользователей
+const (
+	ActionSignup         = "auth.signup"
+	ActionLogin          = "auth.login"
+	ActionLoginMFA       = "auth.login_mfa"
+	ActionLoginWebAuthn  = "auth.login_webauthn"
+	ActionRefresh        = "auth.refresh"
+	ActionLogout         = "auth.logout"
+	ActionLogoutAll      = "auth.logout_all"
+	ActionSessionRevoke  = "auth.session.revoke"
+	ActionSessionsRevoke = "auth.session.revoke_others"
+	ActionPasswordChange = "auth.password.change"
+	ActionPasswordReset  = "auth.password.reset"
+	ActionMFAEnable      = "auth.mfa.enable"
+	ActionMFADisable     = "auth.mfa.disable"
+)
+
+// Действия администратора
+const (
+	ActionUserList           = "admin.user.list"
+	ActionUserGet            = "admin.user.get"
+	ActionUserRole           = "admin.user.role"
+	ActionUserDisable        = "admin.user.disable"
+	ActionUserEnable         = "admin.user.enable"
+	ActionUserPasswordReset  = "admin.user.password_reset"
+	ActionUserRevokeSessions = "admin.user.revoke_sessions"
+	ActionUserDelete         = "admin.user.delete"
+	ActionLockoutClear       = "admin.lockout.clear"
+	ActionAuditQuery         = "admin.audit.query"
+)
+
+// Итог действия
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// Пароль верен, но для входа требуется второй фактор
+	ResultMFARequired = "mfa_required"
+)
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/service/audit"
+	"lk-auth/internal/service/rbac"
+	"lk-auth/internal/storage"
+)
+
+var (
+	ErrAccountDisabled  = errors.New("account is disabled")
+	ErrAuditUnavailable = errors.New("audit log is not stored")
+)
+
+// Хэш, к которому не подходит ни один пароль, как "!" в /etc/shadow. Ставится при принудительном сбросе пароля
+const unusablePasswordHash = "!"
+
+// WithAudit сохраняет журнал аудита в хранилище вместо журнала приложения и включает его просмотр
+func WithAudit(auditStorage storage.AuditStorage) Option {
+	return func(s *AuthServiceImpl) {
+		s.AuditStorage = auditStorage
+	}
+}
+
+// ListUsers ищет пользователей по подстроке email. Требует право users:read
+func (s *AuthServiceImpl) ListUsers(ctx context.Context, accessToken, query, cursor string, limit int, client model.ClientInfo) ([]model.User, string, error) {
+	var (
+		users []model.User
+		next  string
+	)
+	err := s.adminAction(ctx, accessToken, rbac.PermUsersRead, model.AuditRecord{Action: audit.ActionUserList, Details: query}, client,
+		func(string) (err error) {
+			users, next, err = s.UserStorage.ListUsers(ctx, query, cursor, limit)
+			return err
+		},
+	)
+	return users, next, err
+}
+
+// GetUser возвращает учётную запись пользователя. Требует право users:read
+func (s *AuthServiceImpl) GetUser(ctx context.Context, accessToken, email string, client model.ClientInfo) (*model.User, error) {
+	email = normalizeEmail(email)
+	var user *model.User
+	err := s.adminAction(ctx, accessToken, rbac.PermUsersRead, model.AuditRecord{Action: audit.ActionUserGet, Subject: email}, client,
+		func(string) (err error) {
+			user, err = s.UserStorage.GetUser(ctx, email)
+			return err
+		},
+	)
+	return user, err
+}
+
+// SetUserDisabled блокирует или разблокирует вход пользователя. Требует право users:write.
+// Блокировка увеличивает версию данных и завершает все сессии пользователя
+func (s *AuthServiceImpl) SetUserDisabled(ctx context.Context, accessToken, email string, disabled bool, client model.ClientInfo) error {
+	email = normalizeEmail(email)
+	action := audit.ActionUserEnable
+	if disabled {
+		action = audit.ActionUserDisable
+	}
+	return s.adminAction(ctx, accessToken, rbac.PermUsersWrite, model.AuditRecord{Action: action, Subject: email}, client,
+		func(string) error {
+			if _, err := s.UserStorage.SetDisabled(ctx, email, disabled); err != nil {
+				return err
+			}
+			if disabled {
+				s.revokeAllSessions(ctx, email)
+			}
+			return nil
+		},
+	)
+}
+
+// ForcePasswordReset делает текущий пароль пользователя недействительным, завершает все его сессии
+// и отправляет ему ссылку сброса пароля. Требует право users:write
+func (s *AuthServiceImpl) ForcePasswordReset(ctx context.Context, accessToken, email string, client model.ClientInfo) error {
+	email = normalizeEmail(email)
+	return s.adminAction(ctx, accessToken, rbac.PermUsersWrite, model.AuditRecord{Action: audit.ActionUserPasswordReset, Subject: email}, client,
+		func(string) error {
+			if s.OneTimeTokenStorage == nil || s.mailer == nil {
+				return ErrPasswordResetUnavailable
+			}
+			if _, err := s.UserStorage.ChangePassword(ctx, email, unusablePasswordHash); err != nil {
+				return err
+			}
+			s.revokeAllSessions(ctx, email)
+
+			// Токен сброса выдаётся на новую версию данных
+			user, err := s.UserStorage.GetUser(ctx, email)
+			if err != nil {
+				return err
+			}
+			token, err := s.issueResetToken(ctx, *user)
+			if err != nil {
+				return err
+			}
+			return s.sendResetEmail(ctx, user.Email, token, true)
+		},
+	)
+}
+
+// RevokeUserSessions завершает все сессии пользователя увеличением версии данных. Требует право users:write
+func (s *AuthServiceImpl) RevokeUserSessions(ctx context.Context, accessToken, email string, client model.ClientInfo) error {
+	email = normalizeEmail(email)
+	return s.adminAction(ctx, accessToken, rbac.PermUsersWrite, model.AuditRecord{Action: audit.ActionUserRevokeSessions, Subject: email}, client,
+		func(string) error {
+			if _, err := s.UserStorage.IncrementVersion(ctx, email); err != nil {
+				return err
+			}
+			s.revokeAllSessions(ctx, email)
+			return nil
+		},
+	)
+}
+
+// DeleteUser безвозвратно удаляет пользователя, его сессии, второй фактор и ключи доступа. Требует право users:write
+func (s *AuthServiceImpl) DeleteUser(ctx context.Context, accessToken, email string, client model.ClientInfo) error {
+	email = normalizeEmail(email)
+	return s.adminAction(ctx, accessToken, rbac.PermUsersWrite, model.AuditRecord{Action: audit.ActionUserDelete, Subject: email}, client,
+		func(string) error {
+			// После удаления записи токены пользователя уже недействительны, остальное только подчищается
+			if err := s.UserStorage.DeleteUser(ctx, email); err != nil {
+				return err
+			}
+			s.revokeAllSessions(ctx, email)
+
+			if s.MFAStorage != nil {
+				if err := s.MFAStorage.DeleteMFA(ctx, email); err != nil && !errors.Is(err, storage.ErrNotFound) {
+					s.log.ErrorContext(ctx, "cannot delete second factor", sl.Err(err), "email", email)
+				}
+			}
+			// Иначе ключи доступа удалённого пользователя подошли бы к новой учётной записи с тем же email
+			if s.WebAuthnStorage != nil {
+				if err := s.WebAuthnStorage.DeleteCredentials(ctx, email); err != nil {
+					s.log.ErrorContext(ctx, "cannot delete passkeys", sl.Err(err), "email", email)
+				}
+			}
+			return nil
+		},
+	)
+}
+
+// AuditLog возвращает записи журнала аудита. Требует право audit:read
+func (s *AuthServiceImpl) AuditLog(ctx context.Context, accessToken string, filter model.AuditFilter, client model.ClientInfo) ([]model.AuditRecord, error) {
+	var records []model.AuditRecord
+	err := s.adminAction(ctx, accessToken, rbac.PermAuditRead, model.AuditRecord{Action: audit.ActionAuditQuery, Details: auditFilterDetails(filter)}, client,
+		func(string) (err error) {
+			if s.AuditStorage == nil {
+				return ErrAuditUnavailable
+			}
+			records, err = s.AuditStorage.ListRecords(ctx, filter)
+			return err
+		},
+	)
+	return records, err
+}
+
+// auditFilterDetails - условия выборки для записи о просмотре журнала
+func auditFilterDetails(filter model.AuditFilter) string {
+	var details []string
+	if !filter.From.IsZero() {
+		details = append(details, "from="+filter.From.Format(time.RFC3339))
+	}
+	if !filter.To.IsZero() {
+		details = append(details, "to="+filter.To.Format(time.RFC3339))
+	}
+	for _, cond := range [][2]string{{"actor", filter.Actor}, {"subject", filter.Subject}, {"action", filter.Action}} {
+		if cond[1] != "" {
+			details = append(details, cond[0]+"="+cond[1])
+		}
+	}
+	return strings.Join(details, " ")
+}
+
+// adminAction проверяет право владельца access токена, выполняет действие и записывает его итог в журнал аудита.
+// action получает email администратора
+func (s *AuthServiceImpl) adminAction(ctx context.Context, accessToken, permission string, rec model.AuditRecord, client model.ClientInfo, action func(actor string) error) error {
+	actor, err := s.authorize(ctx, accessToken, permission)
+	if err == nil {
+		err = action(actor)
+	}
+
+	rec.Actor = actor
+	s.record(ctx, rec, client, err)
+	return err
+}
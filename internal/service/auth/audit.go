@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/service/audit"
+)
+
+// record дописывает в журнал аудита итог действия err. Без хранилища журнала запись попадает в журнал приложения.
+// Ошибка записи только логируется: действие уже выполнено
+func (s *AuthServiceImpl) record(ctx context.Context, rec model.AuditRecord, client model.ClientInfo, err error) {
+	rec.Time = time.Now()
+	rec.IP = client.IP
+	rec.UserAgent = client.UserAgent
+	rec.Result = audit.ResultSuccess
+
+	var mfaRequired *MFARequiredError
+	switch {
+	case errors.As(err, &mfaRequired):
+		rec.Result = audit.ResultMFARequired
+	case err != nil:
+		rec.Result = audit.ResultFailure
+		rec.Reason = err.Error()
+	}
+
+	if s.AuditStorage == nil {
+		s.log.LogAttrs(ctx, slog.LevelInfo, "audit: "+rec.Action,
+			slog.String("event", "audit"),
+			slog.String("action", rec.Action),
+			slog.String("actor", rec.Actor),
+			slog.String("subject", rec.Subject),
+			slog.String("details", rec.Details),
+			slog.String("ip", rec.IP),
+			slog.String("user_agent", rec.UserAgent),
+			slog.String("result", rec.Result),
+			slog.String("reason", rec.Reason),
+		)
+		return
+	}
+	// Запись не теряется, если клиент прервал запрос после того, как действие выполнено
+	if err := s.AuditStorage.AddRecord(context.WithoutCancel(ctx), &rec); err != nil {
+		s.log.ErrorContext(ctx, "cannot write audit record", sl.Err(err), "action", rec.Action)
+	}
+}
@@ -1,10 +1,86 @@
 // Здесь должна быть бизнес логика ответсвенная за авторизацию
 package auth
 
+import (
+	"context"
+	"time"
+
+	"lk-auth/internal/domain/model"
+
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+// TokenInfo - сведения о токене для интроспекции (RFC 7662)
+type TokenInfo struct {
+	Active bool
+	Email  string
+	Role   string
+	Type   string
+	// Права владельца через пробел, только у access токенов
+	Scope     string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Вход, обновление и завершение сессий, регистрация, смена пароля и второго фактора записываются в журнал аудита
+// ctx - контекст запроса, он передаётся хранилищам и во все записи журнала
 type AuthService interface {
-	Login(email, password string) (string, string, error)
-	Refresh(string) (string, string, error)
-	ValidateToken(string) (bool, error)
-	Logout(...string) error
-	Signin(email, password, role string) error
+	// Если у пользователя включён второй фактор, возвращает *MFARequiredError с токеном подтверждения
+	Login(ctx context.Context, email, password string, client model.ClientInfo) (string, string, error)
+	// Второй шаг входа: токен подтверждения и код TOTP или код восстановления
+	LoginMFA(ctx context.Context, mfaToken, code string, client model.ClientInfo) (string, string, error)
+	Refresh(ctx context.Context, token string, client model.ClientInfo) (string, string, error)
+	// true, если token - действующий access токен
+	ValidateToken(ctx context.Context, token string) (bool, error)
+	// Неактивный токен не считается ошибкой: возвращается TokenInfo с Active == false
+	Introspect(ctx context.Context, token string) (TokenInfo, error)
+	Logout(ctx context.Context, client model.ClientInfo, tokens ...string) error
+	// Если включена проверка email, учётная запись создаётся неподтверждённой и на email отправляется ссылка подтверждения.
+	// Пустая роль заменяется ролью по умолчанию, роль не из реестра - ErrUnknownRole, роль, которую нельзя выбрать самому, - ErrForbidden
+	Signin(ctx context.Context, email, password, role string, client model.ClientInfo) error
+	// Подтверждение email по токену из письма и повторная отправка письма
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerificationEmail(ctx context.Context, email string) error
+	// Смена пароля и выход со всех устройств увеличивают версию данных пользователя,
+	// что делает недействительными все выданные ему токены
+	ChangePassword(ctx context.Context, email, oldPassword, newPassword string, client model.ClientInfo) error
+	// Сброс забытого пароля: ссылка с одноразовым токеном отправляется на email, по токену задаётся новый пароль
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string, client model.ClientInfo) error
+	LogoutAll(ctx context.Context, accessToken string, client model.ClientInfo) error
+
+	// Управление сессиями владельца access токена
+	Sessions(ctx context.Context, accessToken string) (sessions []model.Session, currentID string, err error)
+	RevokeSession(ctx context.Context, accessToken, sessionID string, client model.ClientInfo) error
+	RevokeOtherSessions(ctx context.Context, accessToken string, client model.ClientInfo) error
+
+	// Подключение TOTP: секрет и otpauth:// URI, затем подтверждение первым кодом
+	EnrollTOTP(ctx context.Context, accessToken string) (secret, uri string, err error)
+	ConfirmTOTP(ctx context.Context, accessToken, code string, client model.ClientInfo) (recoveryCodes []string, err error)
+	DisableTOTP(ctx context.Context, accessToken, code string, client model.ClientInfo) error
+
+	// Регистрация ключа доступа (passkey) владельцем access токена.
+	// ceremonyID связывает начало и завершение, options передаются в navigator.credentials.create()
+	BeginWebAuthnRegistration(ctx context.Context, accessToken string) (ceremonyID string, options *protocol.CredentialCreation, err error)
+	FinishWebAuthnRegistration(ctx context.Context, accessToken, ceremonyID string, response *protocol.ParsedCredentialCreationData) error
+	// Вход по ключу доступа без пароля. Пустой email - выбор любого ключа, сохранённого на устройстве
+	BeginWebAuthnLogin(ctx context.Context, email string) (ceremonyID string, options *protocol.CredentialAssertion, err error)
+	FinishWebAuthnLogin(ctx context.Context, ceremonyID string, response *protocol.ParsedCredentialAssertionData, client model.ClientInfo) (string, string, error)
+
+	// Администрирование. Каждое действие, в том числе отказ в нём, записывается в журнал аудита от имени владельца access токена.
+	// Снятие блокировки входа по email и (или) IP. Требует право lockouts:manage
+	ClearLockout(ctx context.Context, accessToken, email, ip string, client model.ClientInfo) error
+	// Назначение пользователю роли. Требует право roles:grant, завершает все сессии пользователя
+	GrantRole(ctx context.Context, accessToken, email, role string, client model.ClientInfo) error
+	// Поиск по подстроке email и просмотр пользователя. Требуют право users:read
+	ListUsers(ctx context.Context, accessToken, query, cursor string, limit int, client model.ClientInfo) (users []model.User, next string, err error)
+	GetUser(ctx context.Context, accessToken, email string, client model.ClientInfo) (*model.User, error)
+	// Остальные действия требуют право users:write. Блокировка, принудительный сброс пароля
+	// и завершение сессий увеличивают версию данных пользователя
+	SetUserDisabled(ctx context.Context, accessToken, email string, disabled bool, client model.ClientInfo) error
+	ForcePasswordReset(ctx context.Context, accessToken, email string, client model.ClientInfo) error
+	RevokeUserSessions(ctx context.Context, accessToken, email string, client model.ClientInfo) error
+	DeleteUser(ctx context.Context, accessToken, email string, client model.ClientInfo) error
+	// Записи журнала аудита по возрастанию времени. Требует право audit:read, без хранилища журнала - ErrAuditUnavailable
+	AuditLog(ctx context.Context, accessToken string, filter model.AuditFilter, client model.ClientInfo) ([]model.AuditRecord, error)
 }
@@ -3,26 +3,40 @@
 package auth_test
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"os"
 	"testing"
+	"time"
 
 	"lk-auth/internal/domain/model"
+	"lk-auth/internal/libs/hash"
+	"lk-auth/internal/service/audit"
 	authpkg "lk-auth/internal/service/auth"
+	"lk-auth/internal/service/mailer"
+	"lk-auth/internal/service/rbac"
+	storagepkg "lk-auth/internal/storage"
 	"lk-auth/internal/testutil/mock/jwt"
 	"lk-auth/internal/testutil/mock/storage"
 
+	jwtlib "github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 var (
+	ctx         = context.Background()
 	correctUser = model.User{
 		Email:        "example@mail.com",
 		PasswordHash: "123",
 		Version:      1,
 		Role:         "student",
 	}
+	client = model.ClientInfo{
+		IP:        "127.0.0.1",
+		UserAgent: "test",
+	}
 	log = slog.New(
 		slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 	)
@@ -33,12 +47,14 @@ func TestLogin(t *testing.T) {
 		jwtService := &jwt.MockJWTService{}
 		userStorage := &storage.MockUserStorage{}
 		jwtStorage := &storage.MockJWTStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
 		blackListStorage := &storage.MockBlackListStorage{}
 
 		auth := authpkg.NewAuthServiceImpl(
 			jwtService,
 			blackListStorage,
 			jwtStorage,
+			sessionStorage,
 			userStorage,
 			log,
 		)
@@ -49,12 +65,16 @@ func TestLogin(t *testing.T) {
 			Role:    correctUser.Role,
 		}
 
-		userStorage.On("Login", correctUser.Email, correctUser.PasswordHash).Return(correctUser.Version, correctUser.Role, nil).Once()
-		jwtService.On("CreateAccessToken", userForToken).Return("new_access_token", nil).Once()
-		jwtService.On("CreateRefreshToken", userForToken).Return("new_refresh_token", nil).Once()
-		jwtStorage.On("AddPair", "new_access_token", "new_refresh_token").Return(nil).Once()
+		userStorage.On("Login", mock.Anything, correctUser.Email, correctUser.PasswordHash).Return(correctUser.Version, correctUser.Role, nil).Once()
+		jwtService.On("CreateAccessToken", mock.Anything, userForToken, mock.AnythingOfType("string")).Return("new_access_token", nil).Once()
+		jwtService.On("CreateRefreshToken", mock.Anything, userForToken, mock.AnythingOfType("string")).Return("new_refresh_token", nil).Once()
+		jwtStorage.On("AddPair", mock.Anything, "new_access_token", "new_refresh_token").Return(nil).Once()
+		jwtStorage.On("AddFamily", mock.Anything, mock.AnythingOfType("string"), "new_refresh_token").Return(nil).Once()
+		sessionStorage.On("AddSession", mock.Anything, mock.MatchedBy(func(session *model.Session) bool {
+			return session.Email == correctUser.Email && session.IP == client.IP && session.UserAgent == client.UserAgent
+		})).Return(nil).Once()
 
-		access, refresh, err := auth.Login(correctUser.Email, correctUser.PasswordHash)
+		access, refresh, err := auth.Login(ctx, correctUser.Email, correctUser.PasswordHash, client)
 
 		assert.NoError(t, err)
 		assert.Equal(t, "new_access_token", access)
@@ -63,88 +83,322 @@ func TestLogin(t *testing.T) {
 		jwtService.AssertExpectations(t)
 		userStorage.AssertExpectations(t)
 		jwtStorage.AssertExpectations(t)
+		sessionStorage.AssertExpectations(t)
+	})
+
+	t.Run("Second factor required", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		userStorage := &storage.MockUserStorage{}
+		jwtStorage := &storage.MockJWTStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		mfaStorage := &storage.MockMFAStorage{}
+
+		auth := authpkg.NewAuthServiceImpl(
+			jwtService,
+			blackListStorage,
+			jwtStorage,
+			sessionStorage,
+			userStorage,
+			log,
+			authpkg.WithMFA(mfaStorage, "lk-auth"),
+		)
+
+		userForToken := model.User{
+			Email:   correctUser.Email,
+			Version: correctUser.Version,
+			Role:    correctUser.Role,
+		}
+
+		userStorage.On("Login", mock.Anything, correctUser.Email, correctUser.PasswordHash).Return(correctUser.Version, correctUser.Role, nil).Once()
+		mfaStorage.On("GetMFA", mock.Anything, correctUser.Email).Return(&model.MFA{Secret: "JBSWY3DPEHPK3PXP", Confirmed: true}, nil).Once()
+		jwtService.On("CreateMFAToken", mock.Anything, userForToken).Return("mfa_token", nil).Once()
+
+		access, refresh, err := auth.Login(ctx, correctUser.Email, correctUser.PasswordHash, client)
+
+		var mfaRequired *authpkg.MFARequiredError
+		assert.ErrorAs(t, err, &mfaRequired)
+		assert.Equal(t, "mfa_token", mfaRequired.Token)
+		assert.Empty(t, access)
+		assert.Empty(t, refresh)
+
+		jwtService.AssertExpectations(t)
+		mfaStorage.AssertExpectations(t)
+		// Сессия начинается только после второго шага
+		jwtService.AssertNotCalled(t, "CreateAccessToken", mock.Anything, mock.Anything, mock.Anything)
+		sessionStorage.AssertNotCalled(t, "AddSession", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Second factor required for email in another case", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		userStorage := &storage.MockUserStorage{}
+		mfaStorage := &storage.MockMFAStorage{}
+
+		auth := authpkg.NewAuthServiceImpl(
+			jwtService,
+			&storage.MockBlackListStorage{},
+			&storage.MockJWTStorage{},
+			&storage.MockSessionStorage{},
+			userStorage,
+			log,
+			authpkg.WithMFA(mfaStorage, "lk-auth"),
+		)
+
+		userForToken := model.User{
+			Email:   correctUser.Email,
+			Version: correctUser.Version,
+			Role:    correctUser.Role,
+		}
+
+		// Второй фактор подключён под тем же адресом в нижнем регистре, под которым хранится пользователь
+		userStorage.On("Login", mock.Anything, correctUser.Email, correctUser.PasswordHash).Return(correctUser.Version, correctUser.Role, nil).Once()
+		mfaStorage.On("GetMFA", mock.Anything, correctUser.Email).Return(&model.MFA{Secret: "JBSWY3DPEHPK3PXP", Confirmed: true}, nil).Once()
+		jwtService.On("CreateMFAToken", mock.Anything, userForToken).Return("mfa_token", nil).Once()
+
+		_, _, err := auth.Login(ctx, "Example@Mail.COM", correctUser.PasswordHash, client)
+
+		var mfaRequired *authpkg.MFARequiredError
+		assert.ErrorAs(t, err, &mfaRequired)
+
+		userStorage.AssertExpectations(t)
+		mfaStorage.AssertExpectations(t)
+		jwtService.AssertNotCalled(t, "CreateAccessToken", mock.Anything, mock.Anything, mock.Anything)
 	})
 
 	t.Run("Failed login", func(t *testing.T) {
 		jwtService := &jwt.MockJWTService{}
 		userStorage := &storage.MockUserStorage{}
 		jwtStorage := &storage.MockJWTStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
 		blackListStorage := &storage.MockBlackListStorage{}
 
 		auth := authpkg.NewAuthServiceImpl(
 			jwtService,
 			blackListStorage,
 			jwtStorage,
+			sessionStorage,
 			userStorage,
 			log,
 		)
 
-		userStorage.On("Login", "wrong@mail.com", "wrongpassword").Return(float64(-1), "", errors.New("incorrect email and password")).Once()
+		userStorage.On("Login", mock.Anything, "wrong@mail.com", "wrongpassword").Return(float64(-1), "", storagepkg.ErrInvalidCredentials).Once()
 
-		access, refresh, err := auth.Login("wrong@mail.com", "wrongpassword")
+		access, refresh, err := auth.Login(ctx, "wrong@mail.com", "wrongpassword", client)
 
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, authpkg.ErrInvalidCredentials)
 		assert.Equal(t, "", access)
 		assert.Equal(t, "", refresh)
 
 		userStorage.AssertExpectations(t)
-		jwtService.AssertNotCalled(t, "CreateAccessToken", "mock.Anything")
-		jwtService.AssertNotCalled(t, "CreateRefreshToken", "mock.Anything")
-		jwtStorage.AssertNotCalled(t, "AddPair", "mock.Anything", "mock.Anything")
+		jwtService.AssertNotCalled(t, "CreateAccessToken", mock.Anything, "mock.Anything")
+		jwtService.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, "mock.Anything")
+		jwtStorage.AssertNotCalled(t, "AddPair", mock.Anything, "mock.Anything", "mock.Anything")
 	})
 }
 
 func TestRefresh(t *testing.T) {
-	jwtService := &jwt.MockJWTService{}
-	userStorage := &storage.MockUserStorage{}
-	jwtStorage := &storage.MockJWTStorage{}
-	blackListStorage := &storage.MockBlackListStorage{}
-
-	auth := authpkg.NewAuthServiceImpl(
-		jwtService,
-		blackListStorage,
-		jwtStorage,
-		userStorage,
-		log,
-	)
-
 	oldRefreshToken := "old_refresh_token"
 	oldAccessToken := "old_access_token"
+	family := "family"
 	user := model.User{Email: "test@test.com", Version: 1, Role: "user"}
+	// В access токен попадают права роли
+	accessUser := user
+	accessUser.Permissions = []string{"profile:read", "profile:write"}
+
+	t.Run("Successful refresh", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		userStorage := &storage.MockUserStorage{}
+		jwtStorage := &storage.MockJWTStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
+		blackListStorage := &storage.MockBlackListStorage{}
+
+		auth := authpkg.NewAuthServiceImpl(
+			jwtService,
+			blackListStorage,
+			jwtStorage,
+			sessionStorage,
+			userStorage,
+			log,
+		)
 
-	blackListStorage.On("IsAllowed", oldRefreshToken).Return(true, nil).Once()
-	jwtService.On("GetUserInfo", oldRefreshToken).Return(user, nil).Once()
-	userStorage.On("IsVersionValid", user.Email, user.Version).Return(true, nil).Once()
-	jwtService.On("CreateAccessToken", user).Return("new_access_token", nil).Once()
-	jwtService.On("CreateRefreshToken", user).Return("new_refresh_token", nil).Once()
-	jwtStorage.On("GetAccessByRefresh", oldRefreshToken).Return(oldAccessToken, nil).Once()
+		jwtService.On("GetUserInfo", mock.Anything, oldRefreshToken).Return(user, nil).Once()
+		jwtService.On("GetFamilyID", mock.Anything, oldRefreshToken).Return(family, nil).Once()
+		blackListStorage.On("IsAllowed", mock.Anything, oldRefreshToken).Return(true, nil).Once()
+		userStorage.On("IsVersionValid", mock.Anything, user.Email, user.Version).Return(true, nil).Once()
+		jwtService.On("CreateAccessToken", mock.Anything, accessUser, family).Return("new_access_token", nil).Once()
+		jwtService.On("CreateRefreshToken", mock.Anything, user, family).Return("new_refresh_token", nil).Once()
+		jwtStorage.On("RotateFamily", mock.Anything, family, oldRefreshToken, "new_refresh_token").Return(true, nil).Once()
+		jwtStorage.On("AddPair", mock.Anything, "new_access_token", "new_refresh_token").Return(nil).Once()
+		sessionStorage.On("TouchSession", mock.Anything, family, client).Return(nil).Once()
+		jwtStorage.On("GetAccessByRefresh", mock.Anything, oldRefreshToken).Return(oldAccessToken, nil).Once()
 
-	blackListStorage.On("AddTokens", []string{oldRefreshToken, oldAccessToken}).Return(nil).Once()
-	blackListStorage.On("AddTokens", []string{oldRefreshToken}).Return(nil).Once()
+		blackListStorage.On("AddTokens", mock.Anything, []string{oldRefreshToken, oldAccessToken}).Return(nil).Once()
 
-	access, refresh, err := auth.Refresh(oldRefreshToken)
+		access, refresh, err := auth.Refresh(ctx, oldRefreshToken, client)
 
-	assert.NoError(t, err)
-	assert.Equal(t, "new_access_token", access)
-	assert.Equal(t, "new_refresh_token", refresh)
+		assert.NoError(t, err)
+		assert.Equal(t, "new_access_token", access)
+		assert.Equal(t, "new_refresh_token", refresh)
 
-	jwtService.AssertExpectations(t)
-	userStorage.AssertExpectations(t)
-	jwtStorage.AssertExpectations(t)
-	blackListStorage.AssertExpectations(t)
+		jwtService.AssertExpectations(t)
+		userStorage.AssertExpectations(t)
+		jwtStorage.AssertExpectations(t)
+		sessionStorage.AssertExpectations(t)
+		blackListStorage.AssertExpectations(t)
+	})
+
+	t.Run("Storage error while retiring old pair", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		userStorage := &storage.MockUserStorage{}
+		jwtStorage := &storage.MockJWTStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
+		blackListStorage := &storage.MockBlackListStorage{}
+
+		auth := authpkg.NewAuthServiceImpl(
+			jwtService,
+			blackListStorage,
+			jwtStorage,
+			sessionStorage,
+			userStorage,
+			log,
+		)
+
+		jwtService.On("GetUserInfo", mock.Anything, oldRefreshToken).Return(user, nil).Once()
+		jwtService.On("GetFamilyID", mock.Anything, oldRefreshToken).Return(family, nil).Once()
+		blackListStorage.On("IsAllowed", mock.Anything, oldRefreshToken).Return(true, nil).Once()
+		userStorage.On("IsVersionValid", mock.Anything, user.Email, user.Version).Return(true, nil).Once()
+		jwtService.On("CreateAccessToken", mock.Anything, accessUser, family).Return("new_access_token", nil).Once()
+		jwtService.On("CreateRefreshToken", mock.Anything, user, family).Return("new_refresh_token", nil).Once()
+		jwtStorage.On("RotateFamily", mock.Anything, family, oldRefreshToken, "new_refresh_token").Return(true, nil).Once()
+		jwtStorage.On("AddPair", mock.Anything, "new_access_token", "new_refresh_token").Return(nil).Once()
+		sessionStorage.On("TouchSession", mock.Anything, family, client).Return(nil).Once()
+		storageErr := errors.New("connection refused")
+		jwtStorage.On("GetAccessByRefresh", mock.Anything, oldRefreshToken).Return("", storageErr).Once()
+
+		_, _, err := auth.Refresh(ctx, oldRefreshToken, client)
+
+		assert.ErrorIs(t, err, storageErr)
+		blackListStorage.AssertNotCalled(t, "AddTokens", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Reuse of rotated token revokes family", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		userStorage := &storage.MockUserStorage{}
+		jwtStorage := &storage.MockJWTStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
+		blackListStorage := &storage.MockBlackListStorage{}
+
+		auth := authpkg.NewAuthServiceImpl(
+			jwtService,
+			blackListStorage,
+			jwtStorage,
+			sessionStorage,
+			userStorage,
+			log,
+		)
+
+		jwtService.On("GetUserInfo", mock.Anything, oldRefreshToken).Return(user, nil).Once()
+		jwtService.On("GetFamilyID", mock.Anything, oldRefreshToken).Return(family, nil).Once()
+		blackListStorage.On("IsAllowed", mock.Anything, oldRefreshToken).Return(false, nil).Once()
+		jwtStorage.On("GetFamilyHead", mock.Anything, family).Return("current_refresh_token", nil).Once()
+		jwtStorage.On("GetAccessByRefresh", mock.Anything, "current_refresh_token").Return("current_access_token", nil).Once()
+		blackListStorage.On("AddTokens", mock.Anything, []string{"current_refresh_token", "current_access_token"}).Return(nil).Once()
+		jwtStorage.On("DeleteFamily", mock.Anything, family).Return(nil).Once()
+		sessionStorage.On("DeleteSession", mock.Anything, family).Return(nil).Once()
+
+		access, refresh, err := auth.Refresh(ctx, oldRefreshToken, client)
+
+		assert.ErrorIs(t, err, authpkg.ErrRefreshTokenReuse)
+		assert.Equal(t, "", access)
+		assert.Equal(t, "", refresh)
+
+		jwtService.AssertNotCalled(t, "CreateAccessToken", mock.Anything, mock.Anything)
+		jwtStorage.AssertExpectations(t)
+		blackListStorage.AssertExpectations(t)
+	})
+
+	t.Run("Concurrent rotation revokes family", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		userStorage := &storage.MockUserStorage{}
+		jwtStorage := &storage.MockJWTStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
+		blackListStorage := &storage.MockBlackListStorage{}
+
+		auth := authpkg.NewAuthServiceImpl(
+			jwtService,
+			blackListStorage,
+			jwtStorage,
+			sessionStorage,
+			userStorage,
+			log,
+		)
+
+		jwtService.On("GetUserInfo", mock.Anything, oldRefreshToken).Return(user, nil).Once()
+		jwtService.On("GetFamilyID", mock.Anything, oldRefreshToken).Return(family, nil).Once()
+		blackListStorage.On("IsAllowed", mock.Anything, oldRefreshToken).Return(true, nil).Once()
+		userStorage.On("IsVersionValid", mock.Anything, user.Email, user.Version).Return(true, nil).Once()
+		jwtService.On("CreateAccessToken", mock.Anything, accessUser, family).Return("new_access_token", nil).Once()
+		jwtService.On("CreateRefreshToken", mock.Anything, user, family).Return("new_refresh_token", nil).Once()
+		jwtStorage.On("RotateFamily", mock.Anything, family, oldRefreshToken, "new_refresh_token").Return(false, nil).Once()
+		jwtStorage.On("GetFamilyHead", mock.Anything, family).Return("parallel_refresh_token", nil).Once()
+		jwtStorage.On("GetAccessByRefresh", mock.Anything, "parallel_refresh_token").Return("", storagepkg.ErrNotFound).Once()
+		blackListStorage.On("AddTokens", mock.Anything, []string{"parallel_refresh_token"}).Return(nil).Once()
+		jwtStorage.On("DeleteFamily", mock.Anything, family).Return(nil).Once()
+		sessionStorage.On("DeleteSession", mock.Anything, family).Return(nil).Once()
+
+		_, _, err := auth.Refresh(ctx, oldRefreshToken, client)
+
+		assert.ErrorIs(t, err, authpkg.ErrRefreshTokenReuse)
+		jwtStorage.AssertExpectations(t)
+		blackListStorage.AssertExpectations(t)
+	})
+
+	t.Run("Revoked family", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		userStorage := &storage.MockUserStorage{}
+		jwtStorage := &storage.MockJWTStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
+		blackListStorage := &storage.MockBlackListStorage{}
+
+		auth := authpkg.NewAuthServiceImpl(
+			jwtService,
+			blackListStorage,
+			jwtStorage,
+			sessionStorage,
+			userStorage,
+			log,
+		)
+
+		jwtService.On("GetUserInfo", mock.Anything, oldRefreshToken).Return(user, nil).Once()
+		jwtService.On("GetFamilyID", mock.Anything, oldRefreshToken).Return(family, nil).Once()
+		blackListStorage.On("IsAllowed", mock.Anything, oldRefreshToken).Return(true, nil).Once()
+		userStorage.On("IsVersionValid", mock.Anything, user.Email, user.Version).Return(true, nil).Once()
+		jwtService.On("CreateAccessToken", mock.Anything, accessUser, family).Return("new_access_token", nil).Once()
+		jwtService.On("CreateRefreshToken", mock.Anything, user, family).Return("new_refresh_token", nil).Once()
+		jwtStorage.On("RotateFamily", mock.Anything, family, oldRefreshToken, "new_refresh_token").Return(false, storagepkg.ErrNotFound).Once()
+
+		_, _, err := auth.Refresh(ctx, oldRefreshToken, client)
+
+		assert.ErrorIs(t, err, authpkg.ErrTokenBlocked)
+		jwtStorage.AssertNotCalled(t, "AddPair", mock.Anything, mock.Anything, mock.Anything)
+	})
 }
 
 func TestValidateToken(t *testing.T) {
 	t.Run("Valid token", func(t *testing.T) {
 		jwtService := &jwt.MockJWTService{}
 		blackListStorage := &storage.MockBlackListStorage{}
-		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, log)
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, userStorage, log)
 
 		token := "valid_token"
-		blackListStorage.On("IsAllowed", token).Return(true, nil).Once()
-		jwtService.On("IsTokenValid", token).Return(true, nil).Once()
+		blackListStorage.On("IsAllowed", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("IsTokenValid", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("GetType", mock.Anything, token).Return("access", nil).Once()
+		jwtService.On("GetUserInfo", mock.Anything, token).Return(correctUser, nil).Once()
+		userStorage.On("IsVersionValid", mock.Anything, correctUser.Email, correctUser.Version).Return(true, nil).Once()
 
-		isValid, err := auth.ValidateToken(token)
+		isValid, err := auth.ValidateToken(ctx, token)
 
 		assert.NoError(t, err)
 		assert.True(t, isValid)
@@ -152,32 +406,71 @@ func TestValidateToken(t *testing.T) {
 		jwtService.AssertExpectations(t)
 	})
 
+	t.Run("Stale data version", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, userStorage, log)
+
+		token := "token_before_password_change"
+		blackListStorage.On("IsAllowed", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("IsTokenValid", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("GetType", mock.Anything, token).Return("access", nil).Once()
+		jwtService.On("GetUserInfo", mock.Anything, token).Return(correctUser, nil).Once()
+		userStorage.On("IsVersionValid", mock.Anything, correctUser.Email, correctUser.Version).Return(false, nil).Once()
+
+		isValid, err := auth.ValidateToken(ctx, token)
+
+		assert.NoError(t, err)
+		assert.False(t, isValid)
+		userStorage.AssertExpectations(t)
+	})
+
+	t.Run("Refresh token is not an access token", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, userStorage, log)
+
+		token := "refresh_token"
+		blackListStorage.On("IsAllowed", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("IsTokenValid", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("GetType", mock.Anything, token).Return("refresh", nil).Once()
+
+		isValid, err := auth.ValidateToken(ctx, token)
+
+		assert.NoError(t, err)
+		assert.False(t, isValid)
+		jwtService.AssertExpectations(t)
+		userStorage.AssertNotCalled(t, "IsVersionValid", mock.Anything, mock.Anything, mock.Anything)
+	})
+
 	t.Run("Token in blacklist", func(t *testing.T) {
 		jwtService := &jwt.MockJWTService{}
 		blackListStorage := &storage.MockBlackListStorage{}
-		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, log)
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, nil, log)
 
 		token := "blacklisted_token"
-		blackListStorage.On("IsAllowed", token).Return(false, nil).Once()
+		blackListStorage.On("IsAllowed", mock.Anything, token).Return(false, nil).Once()
 
-		isValid, err := auth.ValidateToken(token)
+		isValid, err := auth.ValidateToken(ctx, token)
 
 		assert.NoError(t, err)
 		assert.False(t, isValid)
 		blackListStorage.AssertExpectations(t)
-		jwtService.AssertNotCalled(t, "IsTokenValid", "mock.Anything")
+		jwtService.AssertNotCalled(t, "IsTokenValid", mock.Anything, "mock.Anything")
 	})
 
 	t.Run("Invalid token signature", func(t *testing.T) {
 		jwtService := &jwt.MockJWTService{}
 		blackListStorage := &storage.MockBlackListStorage{}
-		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, log)
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, nil, log)
 
 		token := "invalid_signature_token"
-		blackListStorage.On("IsAllowed", token).Return(true, nil).Once()
-		jwtService.On("IsTokenValid", token).Return(false, errors.New("bad signature")).Once()
+		blackListStorage.On("IsAllowed", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("IsTokenValid", mock.Anything, token).Return(false, errors.New("bad signature")).Once()
 
-		isValid, err := auth.ValidateToken(token)
+		isValid, err := auth.ValidateToken(ctx, token)
 
 		assert.Error(t, err)
 		assert.False(t, isValid)
@@ -187,17 +480,632 @@ func TestValidateToken(t *testing.T) {
 }
 
 func TestLogout(t *testing.T) {
+	jwtService := &jwt.MockJWTService{}
 	blackListStorage := &storage.MockBlackListStorage{}
+	jwtStorage := &storage.MockJWTStorage{}
+	sessionStorage := &storage.MockSessionStorage{}
 
-	auth := authpkg.NewAuthServiceImpl(nil, blackListStorage, nil, nil, log)
+	auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, jwtStorage, sessionStorage, nil, log)
 
 	accessToken := "some_access_token"
 	refreshToken := "some_refresh_token"
+	session := "session"
 
-	blackListStorage.On("AddTokens", []string{accessToken, refreshToken}).Return(nil).Once()
+	blackListStorage.On("AddTokens", mock.Anything, []string{accessToken, refreshToken}).Return(nil).Once()
+	jwtService.On("GetEmail", mock.Anything, accessToken).Return(correctUser.Email, nil).Once()
+	jwtService.On("GetSessionID", mock.Anything, accessToken).Return(session, nil).Once()
+	jwtService.On("GetSessionID", mock.Anything, refreshToken).Return(session, nil).Once()
+	jwtStorage.On("GetFamilyHead", mock.Anything, session).Return(refreshToken, nil).Once()
+	jwtStorage.On("GetFamilyHead", mock.Anything, session).Return("", storagepkg.ErrNotFound).Once()
+	jwtStorage.On("GetAccessByRefresh", mock.Anything, refreshToken).Return(accessToken, nil).Once()
+	blackListStorage.On("AddTokens", mock.Anything, []string{refreshToken, accessToken}).Return(nil).Once()
+	jwtStorage.On("DeleteFamily", mock.Anything, session).Return(nil).Once()
+	sessionStorage.On("DeleteSession", mock.Anything, session).Return(nil).Twice()
 
-	err := auth.Logout(accessToken, refreshToken)
+	err := auth.Logout(ctx, client, accessToken, refreshToken)
 
 	assert.NoError(t, err)
 	blackListStorage.AssertExpectations(t)
+	jwtStorage.AssertExpectations(t)
+	sessionStorage.AssertExpectations(t)
+}
+
+func TestIntrospect(t *testing.T) {
+	t.Run("Active token", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, userStorage, log)
+
+		token := "valid_token"
+		iat := time.Now().Add(-time.Minute).Truncate(time.Second)
+		exp := iat.Add(15 * time.Minute)
+		blackListStorage.On("IsAllowed", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("IsTokenValid", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("GetType", mock.Anything, token).Return("access", nil).Once()
+		jwtService.On("GetUserInfo", mock.Anything, token).Return(correctUser, nil).Once()
+		userStorage.On("IsVersionValid", mock.Anything, correctUser.Email, correctUser.Version).Return(true, nil).Once()
+		jwtService.On("GetTokenClaims", mock.Anything, token).Return(jwtlib.MapClaims{
+			"email": correctUser.Email,
+			"role":  correctUser.Role,
+			"type":  "access",
+			"iat":   float64(iat.Unix()),
+			"exp":   float64(exp.Unix()),
+		}, nil).Once()
+
+		info, err := auth.Introspect(ctx, token)
+
+		assert.NoError(t, err)
+		assert.Equal(t, authpkg.TokenInfo{
+			Active:    true,
+			Email:     correctUser.Email,
+			Role:      correctUser.Role,
+			Type:      "access",
+			IssuedAt:  iat,
+			ExpiresAt: exp,
+		}, info)
+		blackListStorage.AssertExpectations(t)
+		jwtService.AssertExpectations(t)
+	})
+
+	t.Run("Blacklisted token is inactive", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, nil, log)
+
+		token := "blacklisted_token"
+		blackListStorage.On("IsAllowed", mock.Anything, token).Return(false, nil).Once()
+
+		info, err := auth.Introspect(ctx, token)
+
+		assert.NoError(t, err)
+		assert.False(t, info.Active)
+		jwtService.AssertNotCalled(t, "GetTokenClaims", mock.Anything, token)
+	})
+
+	t.Run("Refresh token is inactive", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, nil, log)
+
+		token := "refresh_token"
+		blackListStorage.On("IsAllowed", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("IsTokenValid", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("GetType", mock.Anything, token).Return("refresh", nil).Once()
+
+		info, err := auth.Introspect(ctx, token)
+
+		assert.NoError(t, err)
+		assert.False(t, info.Active)
+		jwtService.AssertNotCalled(t, "GetTokenClaims", mock.Anything, token)
+	})
+
+	t.Run("Token with bad signature is inactive", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, nil, log)
+
+		token := "invalid_signature_token"
+		blackListStorage.On("IsAllowed", mock.Anything, token).Return(true, nil).Once()
+		jwtService.On("IsTokenValid", mock.Anything, token).Return(false, errors.New("bad signature")).Once()
+
+		info, err := auth.Introspect(ctx, token)
+
+		assert.NoError(t, err)
+		assert.False(t, info.Active)
+	})
+}
+
+func TestRevokeSession(t *testing.T) {
+	accessToken := "access_token"
+	currentSession := "current"
+
+	newAuth := func() (authpkg.AuthService, *jwt.MockJWTService, *storage.MockBlackListStorage, *storage.MockJWTStorage, *storage.MockSessionStorage, *storage.MockUserStorage) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		jwtStorage := &storage.MockJWTStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
+		userStorage := &storage.MockUserStorage{}
+
+		blackListStorage.On("IsAllowed", mock.Anything, accessToken).Return(true, nil).Once()
+		jwtService.On("IsTokenValid", mock.Anything, accessToken).Return(true, nil).Once()
+		jwtService.On("GetUserInfo", mock.Anything, accessToken).Return(correctUser, nil).Once()
+		userStorage.On("IsVersionValid", mock.Anything, correctUser.Email, correctUser.Version).Return(true, nil).Once()
+		jwtService.On("GetType", mock.Anything, accessToken).Return("access", nil).Once()
+		jwtService.On("GetEmail", mock.Anything, accessToken).Return(correctUser.Email, nil).Once()
+		jwtService.On("GetSessionID", mock.Anything, accessToken).Return(currentSession, nil).Once()
+
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, jwtStorage, sessionStorage, userStorage, log)
+		return auth, jwtService, blackListStorage, jwtStorage, sessionStorage, userStorage
+	}
+
+	t.Run("Own session", func(t *testing.T) {
+		auth, _, blackListStorage, jwtStorage, sessionStorage, _ := newAuth()
+
+		sessionStorage.On("GetSession", mock.Anything, "lost_phone").Return(&model.Session{ID: "lost_phone", Email: correctUser.Email}, nil).Once()
+		jwtStorage.On("GetFamilyHead", mock.Anything, "lost_phone").Return("phone_refresh", nil).Once()
+		jwtStorage.On("GetAccessByRefresh", mock.Anything, "phone_refresh").Return("phone_access", nil).Once()
+		blackListStorage.On("AddTokens", mock.Anything, []string{"phone_refresh", "phone_access"}).Return(nil).Once()
+		jwtStorage.On("DeleteFamily", mock.Anything, "lost_phone").Return(nil).Once()
+		sessionStorage.On("DeleteSession", mock.Anything, "lost_phone").Return(nil).Once()
+
+		err := auth.RevokeSession(ctx, accessToken, "lost_phone", client)
+
+		assert.NoError(t, err)
+		blackListStorage.AssertExpectations(t)
+		jwtStorage.AssertExpectations(t)
+		sessionStorage.AssertExpectations(t)
+	})
+
+	t.Run("Foreign session", func(t *testing.T) {
+		auth, _, _, jwtStorage, sessionStorage, _ := newAuth()
+
+		sessionStorage.On("GetSession", mock.Anything, "foreign").Return(&model.Session{ID: "foreign", Email: "other@mail.com"}, nil).Once()
+
+		err := auth.RevokeSession(ctx, accessToken, "foreign", client)
+
+		assert.ErrorIs(t, err, authpkg.ErrSessionNotFound)
+		jwtStorage.AssertNotCalled(t, "DeleteFamily", mock.Anything, mock.Anything)
+		sessionStorage.AssertNotCalled(t, "DeleteSession", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Other sessions", func(t *testing.T) {
+		auth, _, blackListStorage, jwtStorage, sessionStorage, _ := newAuth()
+
+		sessionStorage.On("ListSessions", mock.Anything, correctUser.Email).Return([]model.Session{
+			{ID: currentSession, Email: correctUser.Email},
+			{ID: "laptop", Email: correctUser.Email},
+		}, nil).Once()
+		jwtStorage.On("GetFamilyHead", mock.Anything, "laptop").Return("", storagepkg.ErrNotFound).Once()
+		sessionStorage.On("DeleteSession", mock.Anything, "laptop").Return(nil).Once()
+
+		err := auth.RevokeOtherSessions(ctx, accessToken, client)
+
+		assert.NoError(t, err)
+		sessionStorage.AssertNotCalled(t, "DeleteSession", mock.Anything, currentSession)
+		blackListStorage.AssertExpectations(t)
+		jwtStorage.AssertExpectations(t)
+		sessionStorage.AssertExpectations(t)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Run("Successful change", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		jwtStorage := &storage.MockJWTStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, jwtStorage, sessionStorage, userStorage, log)
+
+		userStorage.On("Login", mock.Anything, correctUser.Email, "old_password").Return(correctUser.Version, correctUser.Role, nil).Once()
+		userStorage.On("ChangePassword", mock.Anything, correctUser.Email, mock.MatchedBy(func(passwordHash string) bool {
+			ok, _ := hash.Default().Verify("new_password", passwordHash)
+			return ok
+		})).Return(correctUser.Version+1, nil).Once()
+		sessionStorage.On("ListSessions", mock.Anything, correctUser.Email).Return([]model.Session{{ID: "laptop"}}, nil).Once()
+		jwtStorage.On("GetFamilyHead", mock.Anything, "laptop").Return("", storagepkg.ErrNotFound).Once()
+		sessionStorage.On("DeleteSession", mock.Anything, "laptop").Return(nil).Once()
+
+		err := auth.ChangePassword(ctx, correctUser.Email, "old_password", "new_password", client)
+
+		assert.NoError(t, err)
+		userStorage.AssertExpectations(t)
+		sessionStorage.AssertExpectations(t)
+	})
+
+	t.Run("Wrong old password", func(t *testing.T) {
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(nil, nil, nil, nil, userStorage, log)
+
+		userStorage.On("Login", mock.Anything, correctUser.Email, "wrong").Return(float64(-1), "", storagepkg.ErrInvalidCredentials).Once()
+
+		err := auth.ChangePassword(ctx, correctUser.Email, "wrong", "new_password", client)
+
+		assert.ErrorIs(t, err, authpkg.ErrInvalidCredentials)
+		userStorage.AssertNotCalled(t, "ChangePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestLogoutAll(t *testing.T) {
+	jwtService := &jwt.MockJWTService{}
+	blackListStorage := &storage.MockBlackListStorage{}
+	jwtStorage := &storage.MockJWTStorage{}
+	sessionStorage := &storage.MockSessionStorage{}
+	userStorage := &storage.MockUserStorage{}
+	auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, jwtStorage, sessionStorage, userStorage, log)
+
+	accessToken := "access_token"
+	blackListStorage.On("IsAllowed", mock.Anything, accessToken).Return(true, nil).Once()
+	jwtService.On("IsTokenValid", mock.Anything, accessToken).Return(true, nil).Once()
+	jwtService.On("GetUserInfo", mock.Anything, accessToken).Return(correctUser, nil).Once()
+	userStorage.On("IsVersionValid", mock.Anything, correctUser.Email, correctUser.Version).Return(true, nil).Once()
+	jwtService.On("GetType", mock.Anything, accessToken).Return("access", nil).Once()
+	jwtService.On("GetEmail", mock.Anything, accessToken).Return(correctUser.Email, nil).Once()
+	jwtService.On("GetSessionID", mock.Anything, accessToken).Return("current", nil).Once()
+	userStorage.On("IncrementVersion", mock.Anything, correctUser.Email).Return(correctUser.Version+1, nil).Once()
+	sessionStorage.On("ListSessions", mock.Anything, correctUser.Email).Return([]model.Session{}, nil).Once()
+
+	err := auth.LogoutAll(ctx, accessToken, client)
+
+	assert.NoError(t, err)
+	userStorage.AssertExpectations(t)
+	sessionStorage.AssertExpectations(t)
+}
+
+func TestLockout(t *testing.T) {
+	cfg := authpkg.LockoutConfig{
+		Account:   authpkg.LockoutPolicy{FreeAttempts: 3, MaxAttempts: 10},
+		IP:        authpkg.LockoutPolicy{FreeAttempts: 20, MaxAttempts: 100},
+		BaseDelay: time.Second,
+		Duration:  15 * time.Minute,
+	}
+	accountKey := "account:" + correctUser.Email
+	ipKey := "ip:" + client.IP
+
+	t.Run("Locked login does not check password", func(t *testing.T) {
+		userStorage := &storage.MockUserStorage{}
+		lockoutStorage := &storage.MockLockoutStorage{}
+		auth := authpkg.NewAuthServiceImpl(nil, nil, nil, nil, userStorage, log, authpkg.WithLockout(lockoutStorage, cfg))
+
+		lockoutStorage.On("LockedFor", mock.Anything, accountKey).Return(2*time.Second, nil).Once()
+		lockoutStorage.On("LockedFor", mock.Anything, ipKey).Return(5*time.Second, nil).Once()
+
+		_, _, err := auth.Login(ctx, correctUser.Email, "password", client)
+
+		var locked *authpkg.LoginLockedError
+		assert.ErrorAs(t, err, &locked)
+		assert.Equal(t, 5*time.Second, locked.RetryAfter)
+		lockoutStorage.AssertExpectations(t)
+		userStorage.AssertNotCalled(t, "Login", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Failures back off exponentially", func(t *testing.T) {
+		userStorage := &storage.MockUserStorage{}
+		lockoutStorage := &storage.MockLockoutStorage{}
+		auth := authpkg.NewAuthServiceImpl(nil, nil, nil, nil, userStorage, log, authpkg.WithLockout(lockoutStorage, cfg))
+
+		lockoutStorage.On("LockedFor", mock.Anything, mock.Anything).Return(time.Duration(0), nil)
+		userStorage.On("Login", mock.Anything, correctUser.Email, "wrong").Return(float64(-1), "", storagepkg.ErrInvalidCredentials).Once()
+		// Шестая неудача: третья сверх бесплатных, задержка 1s * 2^2
+		lockoutStorage.On("AddFailure", mock.Anything, accountKey, cfg.Duration).Return(int64(6), nil).Once()
+		lockoutStorage.On("Lock", mock.Anything, accountKey, 4*time.Second).Return(nil).Once()
+		lockoutStorage.On("AddFailure", mock.Anything, ipKey, cfg.Duration).Return(int64(6), nil).Once()
+
+		_, _, err := auth.Login(ctx, correctUser.Email, "wrong", client)
+
+		assert.ErrorIs(t, err, authpkg.ErrInvalidCredentials)
+		lockoutStorage.AssertExpectations(t)
+		lockoutStorage.AssertNotCalled(t, "Lock", mock.Anything, ipKey, mock.Anything)
+	})
+
+	t.Run("Max attempts lock for full duration", func(t *testing.T) {
+		userStorage := &storage.MockUserStorage{}
+		lockoutStorage := &storage.MockLockoutStorage{}
+		auth := authpkg.NewAuthServiceImpl(nil, nil, nil, nil, userStorage, log, authpkg.WithLockout(lockoutStorage, cfg))
+
+		lockoutStorage.On("LockedFor", mock.Anything, mock.Anything).Return(time.Duration(0), nil)
+		userStorage.On("Login", mock.Anything, "unknown@mail.com", "wrong").Return(float64(-1), "", storagepkg.ErrInvalidCredentials).Once()
+		lockoutStorage.On("AddFailure", mock.Anything, "account:unknown@mail.com", cfg.Duration).Return(int64(10), nil).Once()
+		lockoutStorage.On("Lock", mock.Anything, "account:unknown@mail.com", cfg.Duration).Return(nil).Once()
+		lockoutStorage.On("AddFailure", mock.Anything, ipKey, cfg.Duration).Return(int64(1), nil).Once()
+
+		_, _, err := auth.Login(ctx, "unknown@mail.com", "wrong", client)
+
+		assert.ErrorIs(t, err, authpkg.ErrInvalidCredentials)
+		lockoutStorage.AssertExpectations(t)
+	})
+
+	t.Run("Clear requires admin", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		userStorage := &storage.MockUserStorage{}
+		lockoutStorage := &storage.MockLockoutStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, userStorage, log, authpkg.WithLockout(lockoutStorage, cfg))
+
+		accessToken := "access_token"
+		blackListStorage.On("IsAllowed", mock.Anything, accessToken).Return(true, nil)
+		jwtService.On("IsTokenValid", mock.Anything, accessToken).Return(true, nil)
+		jwtService.On("GetUserInfo", mock.Anything, accessToken).Return(correctUser, nil)
+		userStorage.On("IsVersionValid", mock.Anything, correctUser.Email, correctUser.Version).Return(true, nil)
+		jwtService.On("GetType", mock.Anything, accessToken).Return("access", nil)
+		jwtService.On("GetEmail", mock.Anything, accessToken).Return(correctUser.Email, nil)
+		jwtService.On("GetSessionID", mock.Anything, accessToken).Return("current", nil)
+		jwtService.On("GetRole", mock.Anything, accessToken).Return(correctUser.Role, nil).Once()
+
+		err := auth.ClearLockout(ctx, accessToken, "victim@mail.com", "", client)
+		assert.ErrorIs(t, err, authpkg.ErrForbidden)
+		lockoutStorage.AssertNotCalled(t, "Reset", mock.Anything, mock.Anything)
+
+		jwtService.On("GetRole", mock.Anything, accessToken).Return(rbac.RoleAdmin, nil).Once()
+		lockoutStorage.On("Reset", mock.Anything, "account:victim@mail.com").Return(nil).Once()
+		lockoutStorage.On("Reset", mock.Anything, "ip:10.0.0.1").Return(nil).Once()
+
+		err = auth.ClearLockout(ctx, accessToken, "Victim@mail.com", "10.0.0.1", client)
+		assert.NoError(t, err)
+		lockoutStorage.AssertExpectations(t)
+	})
+}
+
+// mailbox запоминает отправленные письма
+type mailbox []mailer.Message
+
+func (m *mailbox) Send(msg mailer.Message) error {
+	*m = append(*m, msg)
+	return nil
+}
+
+func TestEmailVerification(t *testing.T) {
+	cfg := authpkg.EmailVerificationConfig{
+		Mode: authpkg.EmailVerificationRefuse,
+		URL:  "https://lk-auth.test/verify",
+		TTL:  time.Hour,
+	}
+	unverified := correctUser
+	unverified.EmailVerified = false
+
+	t.Run("Signin creates unverified user and sends link", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		userStorage := &storage.MockUserStorage{}
+		box := &mailbox{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, nil, nil, nil, userStorage, log, authpkg.WithEmailVerification(box, cfg))
+
+		userStorage.On("AddUser", mock.Anything, mock.MatchedBy(func(user *model.User) bool {
+			return user.Email == correctUser.Email && !user.EmailVerified
+		})).Return(nil).Once()
+		jwtService.On("CreateEmailVerificationToken", mock.Anything, mock.Anything, cfg.TTL).Return("token", nil).Once()
+
+		err := auth.Signin(ctx, correctUser.Email, "password", rbac.RoleUser, client)
+
+		assert.NoError(t, err)
+		userStorage.AssertExpectations(t)
+		if assert.Len(t, *box, 1) {
+			assert.Equal(t, correctUser.Email, (*box)[0].To)
+			assert.Contains(t, (*box)[0].Body, "https://lk-auth.test/verify?token=token")
+		}
+	})
+
+	t.Run("Signin rejects invalid email", func(t *testing.T) {
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(nil, nil, nil, nil, userStorage, log)
+
+		for _, email := range []string{"", "example", "Name <example@mail.com>", "example@mail.com "} {
+			assert.ErrorIs(t, auth.Signin(ctx, email, "password", correctUser.Role, client), authpkg.ErrInvalidEmail, email)
+		}
+		userStorage.AssertNotCalled(t, "AddUser", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Login refused until verified", func(t *testing.T) {
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(nil, nil, nil, nil, userStorage, log, authpkg.WithEmailVerification(&mailbox{}, cfg))
+
+		userStorage.On("Login", mock.Anything, correctUser.Email, "password").Return(correctUser.Version, correctUser.Role, nil).Once()
+		userStorage.On("GetUser", mock.Anything, correctUser.Email).Return(&unverified, nil).Once()
+
+		_, _, err := auth.Login(ctx, correctUser.Email, "password", client)
+
+		assert.ErrorIs(t, err, authpkg.ErrEmailNotVerified)
+		userStorage.AssertExpectations(t)
+	})
+
+	t.Run("VerifyEmail accepts only verification tokens", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, userStorage, log, authpkg.WithEmailVerification(&mailbox{}, cfg))
+
+		blackListStorage.On("IsAllowed", mock.Anything, mock.Anything).Return(true, nil)
+		jwtService.On("IsTokenValid", mock.Anything, mock.Anything).Return(true, nil)
+		jwtService.On("GetUserInfo", mock.Anything, mock.Anything).Return(correctUser, nil)
+		userStorage.On("IsVersionValid", mock.Anything, correctUser.Email, correctUser.Version).Return(true, nil)
+		jwtService.On("GetType", mock.Anything, "access").Return("access", nil).Once()
+		jwtService.On("GetType", mock.Anything, "verification").Return("email_verification", nil).Once()
+		jwtService.On("GetEmail", mock.Anything, "verification").Return(correctUser.Email, nil).Once()
+		userStorage.On("VerifyEmail", mock.Anything, correctUser.Email).Return(nil).Once()
+
+		assert.ErrorIs(t, auth.VerifyEmail(ctx, "access"), authpkg.ErrInvalidVerificationToken)
+		assert.NoError(t, auth.VerifyEmail(ctx, "verification"))
+		userStorage.AssertExpectations(t)
+	})
+}
+
+func TestRoles(t *testing.T) {
+	t.Run("Signin validates role", func(t *testing.T) {
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(nil, nil, nil, nil, userStorage, log)
+
+		assert.ErrorIs(t, auth.Signin(ctx, correctUser.Email, "password", "student", client), authpkg.ErrUnknownRole)
+		// Роль администратора можно только назначить
+		assert.ErrorIs(t, auth.Signin(ctx, correctUser.Email, "password", rbac.RoleAdmin, client), authpkg.ErrForbidden)
+		userStorage.AssertNotCalled(t, "AddUser", mock.Anything, mock.Anything)
+
+		userStorage.On("AddUser", mock.Anything, mock.MatchedBy(func(user *model.User) bool {
+			return user.Role == rbac.RoleUser
+		})).Return(nil).Once()
+		assert.NoError(t, auth.Signin(ctx, correctUser.Email, "password", "", client))
+		userStorage.AssertExpectations(t)
+	})
+
+	t.Run("GrantRole requires roles:grant", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, sessionStorage, userStorage, log)
+
+		accessToken := "access_token"
+		blackListStorage.On("IsAllowed", mock.Anything, accessToken).Return(true, nil)
+		jwtService.On("IsTokenValid", mock.Anything, accessToken).Return(true, nil)
+		jwtService.On("GetUserInfo", mock.Anything, accessToken).Return(correctUser, nil)
+		userStorage.On("IsVersionValid", mock.Anything, correctUser.Email, correctUser.Version).Return(true, nil)
+		jwtService.On("GetType", mock.Anything, accessToken).Return("access", nil)
+		jwtService.On("GetEmail", mock.Anything, accessToken).Return(correctUser.Email, nil)
+		jwtService.On("GetSessionID", mock.Anything, accessToken).Return("current", nil)
+		jwtService.On("GetRole", mock.Anything, accessToken).Return(rbac.RoleUser, nil).Once()
+
+		err := auth.GrantRole(ctx, accessToken, "user@mail.com", rbac.RoleAdmin, client)
+		assert.ErrorIs(t, err, authpkg.ErrForbidden)
+
+		jwtService.On("GetRole", mock.Anything, accessToken).Return(rbac.RoleAdmin, nil)
+		err = auth.GrantRole(ctx, accessToken, "user@mail.com", "superuser", client)
+		assert.ErrorIs(t, err, authpkg.ErrUnknownRole)
+		userStorage.AssertNotCalled(t, "ChangeRole", mock.Anything, mock.Anything, mock.Anything)
+
+		userStorage.On("ChangeRole", mock.Anything, "user@mail.com", rbac.RoleAdmin).Return(float64(2), nil).Once()
+		sessionStorage.On("ListSessions", mock.Anything, "user@mail.com").Return([]model.Session{}, nil).Once()
+
+		err = auth.GrantRole(ctx, accessToken, "user@mail.com", rbac.RoleAdmin, client)
+		assert.NoError(t, err)
+		userStorage.AssertExpectations(t)
+		sessionStorage.AssertExpectations(t)
+	})
+}
+
+func TestAdmin(t *testing.T) {
+	// newAdmin создаёт сервис, в котором access_token принадлежит владельцу роли role
+	newAdmin := func(role string, opts ...authpkg.Option) (*jwt.MockJWTService, *storage.MockUserStorage, *storage.MockSessionStorage, authpkg.AuthService) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		sessionStorage := &storage.MockSessionStorage{}
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, sessionStorage, userStorage, log, opts...)
+
+		accessToken := "access_token"
+		blackListStorage.On("IsAllowed", mock.Anything, accessToken).Return(true, nil)
+		jwtService.On("IsTokenValid", mock.Anything, accessToken).Return(true, nil)
+		jwtService.On("GetUserInfo", mock.Anything, accessToken).Return(correctUser, nil)
+		userStorage.On("IsVersionValid", mock.Anything, correctUser.Email, correctUser.Version).Return(true, nil)
+		jwtService.On("GetType", mock.Anything, accessToken).Return("access", nil)
+		jwtService.On("GetEmail", mock.Anything, accessToken).Return(correctUser.Email, nil)
+		jwtService.On("GetSessionID", mock.Anything, accessToken).Return("current", nil)
+		jwtService.On("GetRole", mock.Anything, accessToken).Return(role, nil)
+		return jwtService, userStorage, sessionStorage, auth
+	}
+
+	t.Run("Refusal is audited", func(t *testing.T) {
+		auditStorage := &storage.MockAuditStorage{}
+		_, userStorage, _, auth := newAdmin(rbac.RoleUser, authpkg.WithAudit(auditStorage))
+
+		auditStorage.On("AddRecord", mock.Anything, mock.MatchedBy(func(rec *model.AuditRecord) bool {
+			return rec.Action == audit.ActionUserDelete &&
+				rec.Actor == correctUser.Email &&
+				rec.Subject == "user@mail.com" &&
+				rec.IP == client.IP &&
+				rec.UserAgent == client.UserAgent &&
+				rec.Result == audit.ResultFailure &&
+				rec.Reason == authpkg.ErrForbidden.Error()
+		})).Return(nil).Once()
+
+		err := auth.DeleteUser(ctx, "access_token", "user@mail.com", client)
+
+		assert.ErrorIs(t, err, authpkg.ErrForbidden)
+		userStorage.AssertNotCalled(t, "DeleteUser", mock.Anything, mock.Anything)
+		auditStorage.AssertExpectations(t)
+	})
+
+	t.Run("Disable revokes sessions", func(t *testing.T) {
+		auditStorage := &storage.MockAuditStorage{}
+		_, userStorage, sessionStorage, auth := newAdmin(rbac.RoleAdmin, authpkg.WithAudit(auditStorage))
+
+		userStorage.On("SetDisabled", mock.Anything, "user@mail.com", true).Return(float64(2), nil).Once()
+		sessionStorage.On("ListSessions", mock.Anything, "user@mail.com").Return([]model.Session{}, nil).Once()
+		auditStorage.On("AddRecord", mock.Anything, mock.MatchedBy(func(rec *model.AuditRecord) bool {
+			return rec.Action == audit.ActionUserDisable && rec.Result == audit.ResultSuccess
+		})).Return(nil).Once()
+
+		assert.NoError(t, auth.SetUserDisabled(ctx, "access_token", "user@mail.com", true, client))
+		userStorage.AssertExpectations(t)
+		sessionStorage.AssertExpectations(t)
+		auditStorage.AssertExpectations(t)
+	})
+
+	t.Run("Delete removes second factor and passkeys", func(t *testing.T) {
+		mfaStorage := &storage.MockMFAStorage{}
+		webAuthnStorage := &storage.MockWebAuthnStorage{}
+		_, userStorage, sessionStorage, auth := newAdmin(rbac.RoleAdmin,
+			authpkg.WithMFA(mfaStorage, "lk-auth"),
+			authpkg.WithWebAuthn(webAuthnStorage, nil),
+		)
+
+		userStorage.On("DeleteUser", mock.Anything, "user@mail.com").Return(nil).Once()
+		sessionStorage.On("ListSessions", mock.Anything, "user@mail.com").Return([]model.Session{}, nil).Once()
+		mfaStorage.On("DeleteMFA", mock.Anything, "user@mail.com").Return(storagepkg.ErrNotFound).Once()
+		webAuthnStorage.On("DeleteCredentials", mock.Anything, "user@mail.com").Return(nil).Once()
+
+		assert.NoError(t, auth.DeleteUser(ctx, "access_token", "user@mail.com", client))
+		userStorage.AssertExpectations(t)
+		mfaStorage.AssertExpectations(t)
+		webAuthnStorage.AssertExpectations(t)
+	})
+
+	t.Run("Disabled account cannot log in", func(t *testing.T) {
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(nil, nil, nil, nil, userStorage, log)
+
+		userStorage.On("Login", mock.Anything, correctUser.Email, "password").Return(float64(0), "", storagepkg.ErrUserDisabled).Once()
+
+		_, _, err := auth.Login(ctx, correctUser.Email, "password", client)
+
+		assert.ErrorIs(t, err, authpkg.ErrAccountDisabled)
+		userStorage.AssertExpectations(t)
+	})
+}
+
+func TestAudit(t *testing.T) {
+	t.Run("Failed login is recorded", func(t *testing.T) {
+		userStorage := &storage.MockUserStorage{}
+		auditStorage := &storage.MockAuditStorage{}
+		auth := authpkg.NewAuthServiceImpl(nil, nil, nil, nil, userStorage, log, authpkg.WithAudit(auditStorage))
+
+		userStorage.On("Login", mock.Anything, correctUser.Email, "wrong").Return(float64(-1), "", storagepkg.ErrInvalidCredentials).Once()
+		auditStorage.On("AddRecord", mock.Anything, mock.MatchedBy(func(rec *model.AuditRecord) bool {
+			return rec.Action == audit.ActionLogin &&
+				rec.Actor == correctUser.Email &&
+				rec.IP == client.IP &&
+				rec.Result == audit.ResultFailure &&
+				rec.Reason == authpkg.ErrInvalidCredentials.Error() &&
+				!rec.Time.IsZero()
+		})).Return(nil).Once()
+
+		_, _, err := auth.Login(ctx, correctUser.Email, "wrong", client)
+
+		assert.ErrorIs(t, err, authpkg.ErrInvalidCredentials)
+		auditStorage.AssertExpectations(t)
+	})
+
+	t.Run("Write error does not fail the action", func(t *testing.T) {
+		userStorage := &storage.MockUserStorage{}
+		auditStorage := &storage.MockAuditStorage{}
+		auth := authpkg.NewAuthServiceImpl(nil, nil, nil, nil, userStorage, log, authpkg.WithAudit(auditStorage))
+
+		userStorage.On("AddUser", mock.Anything, mock.Anything).Return(nil).Once()
+		auditStorage.On("AddRecord", mock.Anything, mock.Anything).Return(errors.New("disk full")).Once()
+
+		assert.NoError(t, auth.Signin(ctx, correctUser.Email, "password", "", client))
+		auditStorage.AssertExpectations(t)
+	})
+
+	t.Run("AuditLog requires audit:read and storage", func(t *testing.T) {
+		jwtService := &jwt.MockJWTService{}
+		blackListStorage := &storage.MockBlackListStorage{}
+		userStorage := &storage.MockUserStorage{}
+		auth := authpkg.NewAuthServiceImpl(jwtService, blackListStorage, nil, nil, userStorage, log)
+
+		accessToken := "access_token"
+		blackListStorage.On("IsAllowed", mock.Anything, accessToken).Return(true, nil)
+		jwtService.On("IsTokenValid", mock.Anything, accessToken).Return(true, nil)
+		jwtService.On("GetUserInfo", mock.Anything, accessToken).Return(correctUser, nil)
+		userStorage.On("IsVersionValid", mock.Anything, correctUser.Email, correctUser.Version).Return(true, nil)
+		jwtService.On("GetType", mock.Anything, accessToken).Return("access", nil)
+		jwtService.On("GetEmail", mock.Anything, accessToken).Return(correctUser.Email, nil)
+		jwtService.On("GetSessionID", mock.Anything, accessToken).Return("current", nil)
+		jwtService.On("GetRole", mock.Anything, accessToken).Return(rbac.RoleUser, nil).Once()
+
+		_, err := auth.AuditLog(ctx, accessToken, model.AuditFilter{}, client)
+		assert.ErrorIs(t, err, authpkg.ErrForbidden)
+
+		jwtService.On("GetRole", mock.Anything, accessToken).Return(rbac.RoleAdmin, nil).Once()
+		_, err = auth.AuditLog(ctx, accessToken, model.AuditFilter{}, client)
+		assert.ErrorIs(t, err, authpkg.ErrAuditUnavailable)
+	})
 }
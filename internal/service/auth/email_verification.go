@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/service/mailer"
+	"lk-auth/internal/storage"
+)
+
+// Роль в токенах пользователя с неподтверждённым email в режиме [EmailVerificationRestrict].
+// Сторонние сервисы не должны давать ей доступа к ресурсам
+const RoleUnverified = "unverified"
+
+var (
+	ErrInvalidEmail                 = errors.New("invalid email address")
+	ErrEmailNotVerified             = errors.New("email is not verified")
+	ErrEmailVerificationUnavailable = errors.New("email verification is not configured")
+	ErrInvalidVerificationToken     = errors.New("invalid or expired email verification token")
+)
+
+// EmailVerificationMode определяет, как вход обходится с неподтверждённым email
+type EmailVerificationMode string
+
+const (
+	// Вход запрещён до подтверждения email
+	EmailVerificationRefuse EmailVerificationMode = "refuse"
+	// Вход разрешён, но в токенах роль [RoleUnverified] вместо роли пользователя.
+	// После подтверждения роль возвращается при следующем обновлении токенов
+	EmailVerificationRestrict EmailVerificationMode = "restrict"
+)
+
+type EmailVerificationConfig struct {
+	Mode EmailVerificationMode
+	// Адрес страницы подтверждения, к нему добавляется ?token=. Если пуст, в письме только токен
+	URL string
+	TTL time.Duration
+}
+
+// WithEmailVerification создаёт учётные записи неподтверждёнными и отправляет ссылку подтверждения email
+func WithEmailVerification(m mailer.Mailer, cfg EmailVerificationConfig) Option {
+	return func(s *AuthServiceImpl) {
+		s.mailer = m
+		s.emailVerification = cfg
+	}
+}
+
+// normalizeEmail приводит email к виду, под которым хранятся данные пользователя.
+// Адреса сравниваются без учёта регистра, иначе "Alice@x" и "alice@x" получили бы разные сессии, второй фактор и ключи доступа
+func normalizeEmail(email string) string {
+	return strings.ToLower(email)
+}
+
+// validateEmail принимает только адрес без отображаемого имени и угловых скобок
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// VerifyEmail отмечает email подтверждённым по токену из письма
+func (s *AuthServiceImpl) VerifyEmail(ctx context.Context, token string) error {
+	if s.emailVerification.Mode == "" {
+		return ErrEmailVerificationUnavailable
+	}
+
+	ok, err := s.checkToken(ctx, token, "email_verification")
+	if err != nil || !ok {
+		return ErrInvalidVerificationToken
+	}
+	email, err := s.JWTService.GetEmail(ctx, token)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	err = s.UserStorage.VerifyEmail(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+	s.log.InfoContext(ctx, "email verified", "email", email)
+
+	return nil
+}
+
+// ResendVerificationEmail повторно отправляет ссылку подтверждения.
+// Для неизвестного или уже подтверждённого email ничего не отправляется, но и ошибки нет,
+// чтобы по ответу нельзя было проверить наличие учётной записи.
+func (s *AuthServiceImpl) ResendVerificationEmail(ctx context.Context, email string) error {
+	email = normalizeEmail(email)
+	if s.emailVerification.Mode == "" {
+		return ErrEmailVerificationUnavailable
+	}
+
+	user, err := s.UserStorage.GetUser(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		s.log.InfoContext(ctx, "email verification requested for unknown email", "email", email)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	s.sendVerificationEmail(ctx, *user)
+	return nil
+}
+
+// sendVerificationEmail отправляет ссылку подтверждения. Ошибки только логируются: ссылку можно запросить повторно
+func (s *AuthServiceImpl) sendVerificationEmail(ctx context.Context, user model.User) {
+	token, err := s.JWTService.CreateEmailVerificationToken(ctx, user, s.emailVerification.TTL)
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot create email verification token", sl.Err(err), "email", user.Email)
+		return
+	}
+
+	link := token
+	if s.emailVerification.URL != "" {
+		link = s.emailVerification.URL + "?token=" + url.QueryEscape(token)
+	}
+	err = s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: "To confirm that this address belongs to you, open the link below. It is valid for " + s.emailVerification.TTL.String() + ":\n\n" +
+			link + "\n\n" +
+			"If you didn't create an account, ignore this email.",
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot send email verification email", sl.Err(err), "email", user.Email)
+		return
+	}
+	s.log.InfoContext(ctx, "email verification email sent", "email", user.Email)
+}
+
+// checkEmailVerified применяет к входу режим проверки email: отказывает во входе
+// или заменяет роль в выдаваемых токенах на [RoleUnverified]
+func (s *AuthServiceImpl) checkEmailVerified(ctx context.Context, user *model.User, client model.ClientInfo) error {
+	if s.emailVerification.Mode == "" {
+		return nil
+	}
+
+	stored, err := s.UserStorage.GetUser(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+	if stored.EmailVerified {
+		return nil
+	}
+
+	if s.emailVerification.Mode == EmailVerificationRestrict {
+		user.Role = RoleUnverified
+		return nil
+	}
+	s.log.WarnContext(ctx, "security event: login with unverified email refused",
+		"event", "login_unverified_email",
+		"email", user.Email,
+		"ip", client.IP,
+		"user_agent", client.UserAgent,
+	)
+	return ErrEmailNotVerified
+}
+
+// restoreVerifiedRole возвращает роль пользователя в токены, выданные до подтверждения email
+func (s *AuthServiceImpl) restoreVerifiedRole(ctx context.Context, user *model.User) error {
+	if user.Role != RoleUnverified {
+		return nil
+	}
+
+	stored, err := s.UserStorage.GetUser(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+	if stored.EmailVerified {
+		user.Role = stored.Role
+	}
+	return nil
+}
+
+// authenticateVerified проверяет access токен как [AuthServiceImpl.authenticate]
+// и отказывает владельцу токена с неподтверждённым email
+func (s *AuthServiceImpl) authenticateVerified(ctx context.Context, accessToken string) (string, string, error) {
+	email, sessionID, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	role, err := s.JWTService.GetRole(ctx, accessToken)
+	if err != nil {
+		return "", "", ErrInvalidAccessToken
+	}
+	if role == RoleUnverified {
+		return "", "", ErrEmailNotVerified
+	}
+
+	return email, sessionID, nil
+}
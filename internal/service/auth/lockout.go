@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/service/audit"
+	"lk-auth/internal/service/rbac"
+	"lk-auth/internal/storage"
+)
+
+var (
+	// Единая ошибка входа: по ней нельзя понять, существует ли пользователь
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrForbidden          = errors.New("insufficient permissions")
+)
+
+// LoginLockedError возвращается, пока вход заблокирован после неудачных попыток
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+// LockoutPolicy - пороги одного вида счётчика
+type LockoutPolicy struct {
+	// Неудачи, после которых ещё не вводится задержка
+	FreeAttempts int64
+	// После стольких неудач вход блокируется на [LockoutConfig.Duration]. 0 - счётчик не ведётся
+	MaxAttempts int64
+}
+
+type LockoutConfig struct {
+	// Счётчик по email учитывает и несуществующие учётные записи, иначе блокировка выдала бы их
+	Account LockoutPolicy
+	// Счётчик по IP ограничивает перебор многих учётных записей с одного адреса
+	IP LockoutPolicy
+	// Задержка после первой неудачи сверх бесплатных, затем удваивается с каждой неудачей
+	BaseDelay time.Duration
+	// Длительность блокировки. Столько же хранится счётчик после последней неудачи
+	Duration time.Duration
+}
+
+// delay возвращает, на сколько заблокировать вход после failures неудач подряд
+func (c LockoutConfig) delay(policy LockoutPolicy, failures int64) time.Duration {
+	if failures >= policy.MaxAttempts {
+		return c.Duration
+	}
+	if failures <= policy.FreeAttempts {
+		return 0
+	}
+	// Сдвиг ограничен, чтобы не переполнить Duration
+	shift := min(failures-policy.FreeAttempts-1, 30)
+	return min(c.BaseDelay<<shift, c.Duration)
+}
+
+// WithLockout включает счётчики неудачных попыток входа и временную блокировку
+func WithLockout(lockoutStorage storage.LockoutStorage, cfg LockoutConfig) Option {
+	return func(s *AuthServiceImpl) {
+		s.LockoutStorage = lockoutStorage
+		s.lockout = cfg
+	}
+}
+
+type lockoutKey struct {
+	key    string
+	policy LockoutPolicy
+}
+
+// lockoutKeys возвращает счётчики, которые затрагивает попытка входа. IP неизвестен при смене пароля.
+func (s *AuthServiceImpl) lockoutKeys(email string, client model.ClientInfo) []lockoutKey {
+	var keys []lockoutKey
+	if s.lockout.Account.MaxAttempts > 0 {
+		keys = append(keys, lockoutKey{accountLockoutKey(email), s.lockout.Account})
+	}
+	if s.lockout.IP.MaxAttempts > 0 && client.IP != "" {
+		keys = append(keys, lockoutKey{ipLockoutKey(client.IP), s.lockout.IP})
+	}
+	return keys
+}
+
+func accountLockoutKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipLockoutKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLockout возвращает *LoginLockedError, если вход для email или с IP клиента заблокирован
+func (s *AuthServiceImpl) checkLockout(ctx context.Context, email string, client model.ClientInfo) error {
+	if s.LockoutStorage == nil {
+		return nil
+	}
+
+	var retryAfter time.Duration
+	for _, k := range s.lockoutKeys(email, client) {
+		locked, err := s.LockoutStorage.LockedFor(ctx, k.key)
+		if err != nil {
+			return err
+		}
+		retryAfter = max(retryAfter, locked)
+	}
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// registerFailure учитывает неудачную попытку и при необходимости блокирует вход.
+// Ошибки хранилища только журналируются: вызывающий уже возвращает клиенту отказ.
+func (s *AuthServiceImpl) registerFailure(ctx context.Context, email string, client model.ClientInfo) {
+	if s.LockoutStorage == nil {
+		return
+	}
+
+	for _, k := range s.lockoutKeys(email, client) {
+		failures, err := s.LockoutStorage.AddFailure(ctx, k.key, s.lockout.Duration)
+		if err != nil {
+			s.log.ErrorContext(ctx, "cannot count failed login attempt", sl.Err(err), "key", k.key)
+			continue
+		}
+
+		delay := s.lockout.delay(k.policy, failures)
+		if delay == 0 {
+			continue
+		}
+		if err = s.LockoutStorage.Lock(ctx, k.key, delay); err != nil {
+			s.log.ErrorContext(ctx, "cannot lock login", sl.Err(err), "key", k.key)
+			continue
+		}
+		if failures >= k.policy.MaxAttempts {
+			s.log.WarnContext(ctx, "security event: login locked out",
+				"event", "login_locked",
+				"key", k.key,
+				"failures", failures,
+				"duration", delay,
+			)
+		}
+	}
+}
+
+// resetFailures обнуляет счётчик учётной записи после успешного входа.
+// Счётчик IP не сбрасывается: иначе, зная один пароль, можно было бы продолжать перебор других учётных записей.
+func (s *AuthServiceImpl) resetFailures(ctx context.Context, email string) {
+	if s.LockoutStorage == nil || s.lockout.Account.MaxAttempts == 0 {
+		return
+	}
+	if err := s.LockoutStorage.Reset(ctx, accountLockoutKey(email)); err != nil {
+		s.log.ErrorContext(ctx, "cannot reset failed login attempts", sl.Err(err), "email", email)
+	}
+}
+
+// ClearLockout снимает блокировку входа для email и (или) IP. Требует право lockouts:manage.
+func (s *AuthServiceImpl) ClearLockout(ctx context.Context, accessToken, email, ip string, client model.ClientInfo) error {
+	email = normalizeEmail(email)
+	rec := model.AuditRecord{Action: audit.ActionLockoutClear, Subject: email, Details: ip}
+	return s.adminAction(ctx, accessToken, rbac.PermLockoutsManage, rec, client, func(admin string) error {
+		if s.LockoutStorage == nil {
+			return nil
+		}
+
+		var keys []string
+		if email != "" {
+			keys = append(keys, accountLockoutKey(email))
+		}
+		if ip != "" {
+			keys = append(keys, ipLockoutKey(ip))
+		}
+		for _, key := range keys {
+			if err := s.LockoutStorage.Reset(ctx, key); err != nil {
+				return err
+			}
+			s.log.InfoContext(ctx, "login lockout cleared", "key", key, "admin", admin)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/libs/totp"
+	"lk-auth/internal/service/audit"
+	"lk-auth/internal/storage"
+)
+
+const (
+	recoveryCodesCount = 10
+	// Допустимое расхождение часов клиента в шагах TOTP
+	totpSkew = 1
+)
+
+var (
+	ErrMFAUnavailable    = errors.New("two-factor authentication is not available")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFAToken   = errors.New("mfa token is invalid or expired")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+)
+
+// MFARequiredError возвращается из Login, если у пользователя включён второй фактор.
+// Token обменивается на пару токенов в [AuthServiceImpl.LoginMFA] вместе с кодом.
+type MFARequiredError struct {
+	Token string
+}
+
+func (e *MFARequiredError) Error() string {
+	return "second factor required"
+}
+
+// WithMFA включает двухфакторную аутентификацию, issuer отображается в приложении-аутентификаторе
+func WithMFA(mfaStorage storage.MFAStorage, issuer string) Option {
+	return func(s *AuthServiceImpl) {
+		s.MFAStorage = mfaStorage
+		s.mfaIssuer = issuer
+	}
+}
+
+// requireMFA возвращает *MFARequiredError с токеном подтверждения, если у пользователя включён второй фактор
+func (s *AuthServiceImpl) requireMFA(ctx context.Context, user model.User) error {
+	if s.MFAStorage == nil {
+		return nil
+	}
+
+	mfa, err := s.MFAStorage.GetMFA(ctx, user.Email)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !mfa.Confirmed {
+		return nil
+	}
+
+	token, err := s.JWTService.CreateMFAToken(ctx, user)
+	if err != nil {
+		return err
+	}
+	return &MFARequiredError{Token: token}
+}
+
+// LoginMFA завершает вход: обменивает токен подтверждения и код TOTP или код восстановления на пару токенов
+func (s *AuthServiceImpl) LoginMFA(ctx context.Context, mfaToken, code string, client model.ClientInfo) (access, refresh string, err error) {
+	var user model.User
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionLoginMFA, Actor: user.Email, Subject: user.Email}, client, err)
+	}()
+
+	if s.MFAStorage == nil {
+		return "", "", ErrMFAUnavailable
+	}
+
+	user, err = s.checkMFAToken(ctx, mfaToken)
+	if err != nil {
+		return "", "", err
+	}
+	// Иначе коды можно было бы перебирать, пока действует токен подтверждения
+	if err = s.checkLockout(ctx, user.Email, client); err != nil {
+		return "", "", err
+	}
+
+	mfa, err := s.MFAStorage.GetMFA(ctx, user.Email)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", "", ErrInvalidMFAToken
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if !mfa.Confirmed {
+		return "", "", ErrInvalidMFAToken
+	}
+
+	ok, err := s.useCode(ctx, user.Email, mfa, code)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		s.log.WarnContext(ctx, "security event: invalid second factor code",
+			"event", "mfa_failed",
+			"email", user.Email,
+			"ip", client.IP,
+			"user_agent", client.UserAgent,
+		)
+		s.registerFailure(ctx, user.Email, client)
+		return "", "", ErrInvalidMFACode
+	}
+
+	// Токен подтверждения одноразовый
+	if err = s.BlackListStorage.AddTokens(ctx, mfaToken); err != nil {
+		return "", "", err
+	}
+
+	accessToken, refreshToken, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return "", "", err
+	}
+	s.resetFailures(ctx, user.Email)
+
+	return accessToken, refreshToken, nil
+}
+
+// EnrollTOTP создаёт новый секрет TOTP для владельца accessToken.
+// Второй фактор начинает действовать только после подтверждения первым кодом в [AuthServiceImpl.ConfirmTOTP].
+func (s *AuthServiceImpl) EnrollTOTP(ctx context.Context, accessToken string) (string, string, error) {
+	email, _, err := s.authenticateVerified(ctx, accessToken)
+	if err != nil {
+		return "", "", err
+	}
+	if s.MFAStorage == nil {
+		return "", "", ErrMFAUnavailable
+	}
+
+	mfa, err := s.MFAStorage.GetMFA(ctx, email)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return "", "", err
+	}
+	if err == nil && mfa.Confirmed {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+
+	secret := totp.GenerateSecret()
+	if err = s.MFAStorage.SetMFA(ctx, email, &model.MFA{Secret: secret}); err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.URI(s.mfaIssuer, email, secret), nil
+}
+
+// ConfirmTOTP включает второй фактор, если code соответствует выданному секрету.
+// Возвращает коды восстановления: они показываются один раз, хранятся только их хэши.
+func (s *AuthServiceImpl) ConfirmTOTP(ctx context.Context, accessToken, code string, client model.ClientInfo) (recoveryCodes []string, err error) {
+	var email string
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionMFAEnable, Actor: email, Subject: email}, client, err)
+	}()
+
+	email, _, err = s.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if s.MFAStorage == nil {
+		return nil, ErrMFAUnavailable
+	}
+
+	mfa, err := s.MFAStorage.GetMFA(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrMFANotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Confirmed {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	counter, ok := totp.Validate(mfa.Secret, normalizeCode(code), time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes := newRecoveryCodes()
+	mfa.Confirmed = true
+	// Код подтверждения нельзя использовать ещё раз для входа
+	mfa.LastCounter = counter
+	mfa.RecoveryCodes = hashes
+	if err = s.MFAStorage.SetMFA(ctx, email, mfa); err != nil {
+		return nil, err
+	}
+	s.log.InfoContext(ctx, "two-factor authentication enabled", "email", email)
+
+	return codes, nil
+}
+
+// DisableTOTP отключает второй фактор. Нужен действующий код TOTP или код восстановления.
+func (s *AuthServiceImpl) DisableTOTP(ctx context.Context, accessToken, code string, client model.ClientInfo) (err error) {
+	var email string
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionMFADisable, Actor: email, Subject: email}, client, err)
+	}()
+
+	email, _, err = s.authenticateVerified(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if s.MFAStorage == nil {
+		return ErrMFAUnavailable
+	}
+	// Иначе с украденным access токеном можно было бы перебирать коды, пока второй фактор не отключится
+	if err = s.checkLockout(ctx, email, client); err != nil {
+		return err
+	}
+
+	mfa, err := s.MFAStorage.GetMFA(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+
+	// Неподтверждённый секрет ещё ничего не защищает
+	if mfa.Confirmed {
+		ok, err := s.useCode(ctx, email, mfa, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			s.log.WarnContext(ctx, "security event: invalid second factor code",
+				"event", "mfa_failed",
+				"email", email,
+				"ip", client.IP,
+				"user_agent", client.UserAgent,
+			)
+			s.registerFailure(ctx, email, client)
+			return ErrInvalidMFACode
+		}
+		s.resetFailures(ctx, email)
+	}
+
+	if err = s.MFAStorage.DeleteMFA(ctx, email); err != nil {
+		return err
+	}
+	s.log.InfoContext(ctx, "two-factor authentication disabled", "email", email)
+
+	return nil
+}
+
+// checkMFAToken проверяет токен подтверждения входа и возвращает пользователя, для которого он выдан
+func (s *AuthServiceImpl) checkMFAToken(ctx context.Context, mfaToken string) (model.User, error) {
+	ok, err := s.BlackListStorage.IsAllowed(ctx, mfaToken)
+	if err != nil {
+		return model.User{}, err
+	}
+	if !ok {
+		return model.User{}, ErrInvalidMFAToken
+	}
+
+	ok, err = s.JWTService.IsTokenValid(ctx, mfaToken)
+	if err != nil || !ok {
+		return model.User{}, ErrInvalidMFAToken
+	}
+
+	tokenType, err := s.JWTService.GetType(ctx, mfaToken)
+	if err != nil || tokenType != "mfa" {
+		return model.User{}, ErrInvalidMFAToken
+	}
+
+	user, err := s.JWTService.GetUserInfo(ctx, mfaToken)
+	if err != nil {
+		return model.User{}, ErrInvalidMFAToken
+	}
+
+	// Смена пароля между шагами входа делает токен недействительным
+	ok, err = s.UserStorage.IsVersionValid(ctx, user.Email, user.Version)
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot check data version", sl.Err(err), "email", user.Email)
+		return model.User{}, ErrInvalidMFAToken
+	}
+	if !ok {
+		return model.User{}, ErrInvalidMFAToken
+	}
+
+	return user, nil
+}
+
+// useCode принимает код TOTP (6 цифр) или код восстановления. Оба одноразовые.
+func (s *AuthServiceImpl) useCode(ctx context.Context, email string, mfa *model.MFA, code string) (bool, error) {
+	code = normalizeCode(code)
+
+	if isTOTPCode(code) {
+		counter, ok := totp.Validate(mfa.Secret, code, time.Now(), totpSkew)
+		if !ok {
+			return false, nil
+		}
+		return s.MFAStorage.UseTOTPCounter(ctx, email, counter)
+	}
+
+	ok, err := s.MFAStorage.UseRecoveryCode(ctx, email, hashRecoveryCode(code))
+	if ok {
+		s.log.InfoContext(ctx, "recovery code used", "email", email)
+	}
+	return ok, err
+}
+
+// Коды вида "abcde-fghij": 50 бит энтропии, без похожих друг на друга символов
+func newRecoveryCodes() ([]string, []string) {
+	encoding := base32.NewEncoding("abcdefghijkmnpqrstuvwxyz23456789").WithPadding(base32.NoPadding)
+
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		rand.Read(b)
+		raw := encoding.EncodeToString(b)[:10]
+		codes[i] = fmt.Sprintf("%s-%s", raw[:5], raw[5:])
+		hashes[i] = hashRecoveryCode(raw)
+	}
+	return codes, hashes
+}
+
+// Коды восстановления случайны и достаточно длинны, поэтому медленный хэш им не нужен
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeCode убирает пробелы и дефисы, которые пользователи вводят вместе с кодом
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/libs/random"
+	"lk-auth/internal/service/audit"
+	"lk-auth/internal/service/mailer"
+	"lk-auth/internal/storage"
+)
+
+var (
+	ErrPasswordResetUnavailable = errors.New("password reset is not configured")
+	ErrInvalidResetToken        = errors.New("invalid or expired password reset token")
+)
+
+type PasswordResetConfig struct {
+	// Адрес страницы сброса пароля, к нему добавляется ?token=. Если пуст, в письме только токен
+	URL string
+	TTL time.Duration
+}
+
+// WithPasswordReset включает сброс забытого пароля по токену из письма
+func WithPasswordReset(tokenStorage storage.OneTimeTokenStorage, m mailer.Mailer, cfg PasswordResetConfig) Option {
+	return func(s *AuthServiceImpl) {
+		s.OneTimeTokenStorage = tokenStorage
+		s.mailer = m
+		s.passwordReset = cfg
+	}
+}
+
+// ForgotPassword отправляет на email ссылку сброса пароля.
+// Для неизвестного email ничего не отправляется, но и ошибки нет, чтобы по ответу нельзя было проверить наличие учётной записи.
+func (s *AuthServiceImpl) ForgotPassword(ctx context.Context, email string) error {
+	email = normalizeEmail(email)
+	if s.OneTimeTokenStorage == nil || s.mailer == nil {
+		return ErrPasswordResetUnavailable
+	}
+
+	user, err := s.UserStorage.GetUser(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		s.log.InfoContext(ctx, "password reset requested for unknown email", "email", email)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled {
+		s.log.InfoContext(ctx, "password reset requested for disabled account", "email", email)
+		return nil
+	}
+
+	token, err := s.issueResetToken(ctx, *user)
+	if err != nil {
+		return err
+	}
+	if err = s.sendResetEmail(ctx, user.Email, token, false); err != nil {
+		// Ошибка не возвращается: ответ для существующего email не должен отличаться от ответа для неизвестного
+		s.log.ErrorContext(ctx, "cannot send password reset email", sl.Err(err), "email", user.Email)
+	}
+
+	return nil
+}
+
+// issueResetToken сохраняет хэш нового токена сброса пароля, действующего до изменения версии данных пользователя
+func (s *AuthServiceImpl) issueResetToken(ctx context.Context, user model.User) (string, error) {
+	token := random.String(32)
+	err := s.OneTimeTokenStorage.SaveToken(ctx, hashOneTimeToken(token), &model.OneTimeToken{
+		Purpose: model.TokenPurposePasswordReset,
+		Email:   user.Email,
+		Version: user.Version,
+	}, s.passwordReset.TTL)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// forced - пароль уже сброшен администратором, а не запрошен пользователем
+func (s *AuthServiceImpl) sendResetEmail(ctx context.Context, email, token string, forced bool) error {
+	link := token
+	if s.passwordReset.URL != "" {
+		link = s.passwordReset.URL + "?token=" + url.QueryEscape(token)
+	}
+	intro, outro := "Someone requested a password reset for your account.\n",
+		"If it wasn't you, ignore this email. Your password has not been changed."
+	if forced {
+		intro, outro = "An administrator has reset the password of your account and signed you out everywhere.\n",
+			"Until you set a new password, you cannot sign in with the old one."
+	}
+	err := s.mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Password reset",
+		Body: intro +
+			"To set a new password, open the link below. It is valid for " + s.passwordReset.TTL.String() + " and can be used once:\n\n" +
+			link + "\n\n" +
+			outro,
+	})
+	if err != nil {
+		return err
+	}
+	s.log.InfoContext(ctx, "password reset email sent", "email", email)
+	return nil
+}
+
+// ResetPassword устанавливает новый пароль по токену из письма и завершает все сессии пользователя
+func (s *AuthServiceImpl) ResetPassword(ctx context.Context, token, newPassword string, client model.ClientInfo) (err error) {
+	var email string
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionPasswordReset, Actor: email, Subject: email}, client, err)
+	}()
+
+	if s.OneTimeTokenStorage == nil {
+		return ErrPasswordResetUnavailable
+	}
+	// Токен гасится только после всех проверок пароля: из-за неподходящего пароля не придётся запрашивать новое письмо
+	tokenHash := hashOneTimeToken(token)
+	reset, err := s.OneTimeTokenStorage.GetToken(ctx, tokenHash)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if reset.Purpose != model.TokenPurposePasswordReset {
+		return ErrInvalidResetToken
+	}
+	email = reset.Email
+
+	user, err := s.UserStorage.GetUser(ctx, reset.Email)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	// Токены, выданные до смены пароля или выхода со всех устройств, недействительны
+	if user.Version != reset.Version {
+		return ErrInvalidResetToken
+	}
+
+	if err = s.passwordPolicy.Check(newPassword, reset.Email); err != nil {
+		return err
+	}
+
+	// Из параллельных запросов с одним токеном пароль меняет только тот, кто погасил токен
+	_, err = s.OneTimeTokenStorage.TakeToken(ctx, tokenHash)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	if _, err = s.UserStorage.ChangePassword(ctx, reset.Email, passwordHash); err != nil {
+		return err
+	}
+	s.log.InfoContext(ctx, "password reset, all sessions revoked", "email", reset.Email)
+	s.revokeAllSessions(ctx, reset.Email)
+	// Владелец подтвердил доступ к почте, блокировка входа после чужих попыток ему больше не нужна
+	s.resetFailures(ctx, reset.Email)
+
+	return nil
+}
+
+// Токен из письма хранится только в виде хэша: утечка хранилища не позволит сбросить чужой пароль
+func hashOneTimeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/service/audit"
+	"lk-auth/internal/service/rbac"
+)
+
+var ErrUnknownRole = rbac.ErrUnknownRole
+
+// WithRoles заменяет [rbac.DefaultRegistry]
+func WithRoles(roles *rbac.Registry) Option {
+	return func(s *AuthServiceImpl) {
+		s.roles = roles
+	}
+}
+
+// signinRole проверяет роль, выбранную при регистрации. Пустая роль заменяется ролью по умолчанию,
+// роли, которые нельзя выбрать самому, назначает только администратор через [AuthServiceImpl.GrantRole]
+func (s *AuthServiceImpl) signinRole(role string) (string, error) {
+	if role == "" {
+		return s.roles.Default(), nil
+	}
+	if !s.roles.Exists(role) {
+		return "", ErrUnknownRole
+	}
+	if !s.roles.SelfAssignable(role) {
+		return "", ErrForbidden
+	}
+	return role, nil
+}
+
+// withPermissions добавляет права роли в выдаваемый access токен.
+// У роли, которой нет в реестре, например [RoleUnverified], прав нет
+func (s *AuthServiceImpl) withPermissions(user model.User) model.User {
+	user.Permissions = s.roles.Permissions(user.Role)
+	return user
+}
+
+// GrantRole назначает пользователю роль. Требует право roles:grant.
+// Версия данных увеличивается, поэтому токены со старой ролью перестают действовать
+func (s *AuthServiceImpl) GrantRole(ctx context.Context, accessToken, email, role string, client model.ClientInfo) error {
+	email = normalizeEmail(email)
+	return s.adminAction(ctx, accessToken, rbac.PermRolesGrant, model.AuditRecord{Action: audit.ActionUserRole, Subject: email, Details: role}, client,
+		func(admin string) error {
+			if !s.roles.Exists(role) {
+				return ErrUnknownRole
+			}
+			if _, err := s.UserStorage.ChangeRole(ctx, email, role); err != nil {
+				return err
+			}
+			s.revokeAllSessions(ctx, email)
+
+			s.log.WarnContext(ctx, "security event: role granted",
+				"event", "role_granted",
+				"email", email,
+				"role", role,
+				"admin", admin,
+			)
+			return nil
+		},
+	)
+}
+
+// authorize проверяет access токен и наличие у роли его владельца права permission, возвращает email владельца,
+// в том числе вместе с ErrForbidden. Права берутся из текущего реестра, а не из токена, чтобы изменение реестра действовало сразу
+func (s *AuthServiceImpl) authorize(ctx context.Context, accessToken, permission string) (string, error) {
+	email, _, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	role, err := s.JWTService.GetRole(ctx, accessToken)
+	if err != nil {
+		return "", ErrInvalidAccessToken
+	}
+	if !s.roles.Has(role, permission) {
+		return email, ErrForbidden
+	}
+
+	return email, nil
+}
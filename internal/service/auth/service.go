@@ -1,156 +1,333 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"os"
+	"time"
 
 	"lk-auth/internal/domain/model"
 	"lk-auth/internal/libs/hash"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/libs/random"
+	"lk-auth/internal/service/audit"
 	"lk-auth/internal/service/jwt"
+	"lk-auth/internal/service/mailer"
+	"lk-auth/internal/service/password"
+	"lk-auth/internal/service/rbac"
 	"lk-auth/internal/storage"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	ErrTokenBlocked      = errors.New("token blocked")
+	ErrRefreshTokenReuse = errors.New("refresh token reuse detected, session revoked")
+	ErrNotRefreshToken   = errors.New("token is not a refresh token")
 )
 
+// Option подключает к сервису необязательные возможности
+type Option func(*AuthServiceImpl)
+
 type AuthServiceImpl struct {
 	JWTService jwt.JWTService
 
 	BlackListStorage storage.BlackListStorage
 	JWTStorage       storage.JWTStorage
+	SessionStorage   storage.SessionStorage
 	UserStorage      storage.UserStorage
+	// Если nil, второй фактор не поддерживается (см. [WithMFA])
+	MFAStorage storage.MFAStorage
+	// Если nil, вход по ключам доступа не поддерживается (см. [WithWebAuthn])
+	WebAuthnStorage storage.WebAuthnStorage
+	// Если nil, число попыток входа не ограничивается (см. [WithLockout])
+	LockoutStorage storage.LockoutStorage
+	// Если nil, сброс забытого пароля не поддерживается (см. [WithPasswordReset])
+	OneTimeTokenStorage storage.OneTimeTokenStorage
+	// Если nil, журнал аудита пишется в журнал приложения и не просматривается (см. [WithAudit])
+	AuditStorage storage.AuditStorage
+
+	mfaIssuer string
+	webAuthn  *webauthn.WebAuthn
+	lockout   LockoutConfig
+	mailer    mailer.Mailer
+	// Проверяется при регистрации, смене и сбросе пароля
+	passwordPolicy *password.Policy
+	// Должен совпадать с хэшером хранилища пользователей, иначе оно не проверит новые хэши
+	hasher hash.PasswordHasher
+	roles  *rbac.Registry
+	log    *slog.Logger
+
+	passwordReset     PasswordResetConfig
+	emailVerification EmailVerificationConfig
+}
+
+// WithPasswordPolicy заменяет [password.DefaultPolicy]
+func WithPasswordPolicy(policy *password.Policy) Option {
+	return func(s *AuthServiceImpl) {
+		s.passwordPolicy = policy
+	}
+}
 
-	log *slog.Logger
+// WithPasswordHasher заменяет [hash.Default]. Хранилище пользователей должно использовать тот же хэшер
+func WithPasswordHasher(hasher hash.PasswordHasher) Option {
+	return func(s *AuthServiceImpl) {
+		s.hasher = hasher
+	}
 }
 
 func NewAuthServiceImpl(
 	jwtService jwt.JWTService,
 	blackListStorage storage.BlackListStorage,
 	jwtStorage storage.JWTStorage,
+	sessionStorage storage.SessionStorage,
 	userStorage storage.UserStorage,
 	log *slog.Logger,
+	opts ...Option,
 ) AuthService {
 	if log == nil {
 		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
 			Level: slog.LevelInfo,
 		}))
 	}
-	return &AuthServiceImpl{
+	s := &AuthServiceImpl{
 		JWTService:       jwtService,
 		BlackListStorage: blackListStorage,
 		JWTStorage:       jwtStorage,
+		SessionStorage:   sessionStorage,
 		UserStorage:      userStorage,
+		passwordPolicy:   password.DefaultPolicy(),
+		hasher:           hash.Default(),
+		roles:            rbac.DefaultRegistry(),
 		log:              log,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func (s *AuthServiceImpl) Signin(email, password, role string) error {
-	passwordHash, err := hash.HashPassword(password)
+func (s *AuthServiceImpl) Signin(ctx context.Context, email, password, role string, client model.ClientInfo) (err error) {
+	email = normalizeEmail(email)
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionSignup, Actor: email, Subject: email, Details: role}, client, err)
+	}()
+
+	if err = validateEmail(email); err != nil {
+		return err
+	}
+	role, err = s.signinRole(role)
+	if err != nil {
+		return err
+	}
+	if err = s.passwordPolicy.Check(password, email); err != nil {
+		return err
+	}
+
+	passwordHash, err := s.hasher.Hash(password)
 	if err != nil {
 		return err
 	}
 	newUser := &model.User{
 		Email:        email,
-		PasswordHash: string(passwordHash),
+		PasswordHash: passwordHash,
 		Role:         role,
 		Version:      1,
+		// Без проверки email владение адресом не подтверждается, и учётная запись сразу активна
+		EmailVerified: s.emailVerification.Mode == "",
 	}
-	err = s.UserStorage.AddUser(newUser)
+	err = s.UserStorage.AddUser(ctx, newUser)
 	if err != nil {
 		return err
 	}
+	if !newUser.EmailVerified {
+		s.sendVerificationEmail(ctx, *newUser)
+	}
 	return nil
 }
 
-func (s *AuthServiceImpl) Login(email, password string) (string, string, error) {
-	version, role, err := s.UserStorage.Login(email, password)
-	if version == -1 {
-		return "", "", errors.New("incorrect email and password")
+func (s *AuthServiceImpl) Login(ctx context.Context, email, password string, client model.ClientInfo) (access, refresh string, err error) {
+	email = normalizeEmail(email)
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionLogin, Actor: email, Subject: email}, client, err)
+	}()
+
+	if err = s.checkLockout(ctx, email, client); err != nil {
+		return "", "", err
+	}
+
+	version, role, err := s.UserStorage.Login(ctx, email, password)
+	if errors.Is(err, storage.ErrInvalidCredentials) || (err == nil && (version == -1 || role == "")) {
+		s.log.WarnContext(ctx, "security event: failed login attempt",
+			"event", "login_failed",
+			"email", email,
+			"ip", client.IP,
+			"user_agent", client.UserAgent,
+		)
+		s.registerFailure(ctx, email, client)
+		return "", "", ErrInvalidCredentials
 	}
-	if role == "" {
-		return "", "", errors.New("incorrect email and password")
+	if errors.Is(err, storage.ErrUserDisabled) {
+		s.log.WarnContext(ctx, "security event: login to disabled account refused",
+			"event", "login_disabled",
+			"email", email,
+			"ip", client.IP,
+			"user_agent", client.UserAgent,
+		)
+		return "", "", ErrAccountDisabled
 	}
 	if err != nil {
 		return "", "", err
 	}
 
-	accessToken, err := s.JWTService.CreateAccessToken(
-		model.User{
-			Email:   email,
-			Version: version,
-			Role:    role,
-		})
-	if err != nil {
+	user := model.User{
+		Email:   email,
+		Version: version,
+		Role:    role,
+	}
+	if err = s.checkEmailVerified(ctx, &user, client); err != nil {
 		return "", "", err
 	}
 
-	refreshToken, err := s.JWTService.CreateRefreshToken(
-		model.User{
-			Email:   email,
-			Version: version,
-			Role:    role,
-		})
-	if err != nil {
+	// Пароль верен, но с включённым вторым фактором вместо пары токенов выдаётся токен подтверждения
+	if err = s.requireMFA(ctx, user); err != nil {
 		return "", "", err
 	}
 
-	err = s.JWTStorage.AddPair(accessToken, refreshToken)
+	accessToken, refreshToken, err := s.startSession(ctx, user, client)
 	if err != nil {
 		return "", "", err
 	}
+	s.resetFailures(ctx, email)
 
 	return accessToken, refreshToken, nil
 }
 
-func (s *AuthServiceImpl) Refresh(refreshToken string) (string, string, error) {
-	// Поиск в чёрном списке
-	ok, err := s.BlackListStorage.IsAllowed(refreshToken)
+func (s *AuthServiceImpl) Refresh(ctx context.Context, refreshToken string, client model.ClientInfo) (access, refresh string, err error) {
+	var user model.User
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionRefresh, Actor: user.Email, Subject: user.Email}, client, err)
+	}()
+
+	user, err = s.JWTService.GetUserInfo(ctx, refreshToken)
 	if err != nil {
 		return "", "", err
 	}
-	if !ok {
-		return "", "", errors.New("token blocked")
+
+	family, err := s.JWTService.GetFamilyID(ctx, refreshToken)
+	if err != nil {
+		return "", "", err
 	}
 
-	user, err := s.JWTService.GetUserInfo(refreshToken)
+	// Поиск в чёрном списке
+	ok, err := s.BlackListStorage.IsAllowed(ctx, refreshToken)
 	if err != nil {
 		return "", "", err
 	}
+	if !ok {
+		// Токен уже был обменян или отозван, значит его предъявляет кто-то, у кого его быть не должно
+		if family != "" {
+			s.reportReuse(ctx, family, user.Email, client)
+			return "", "", ErrRefreshTokenReuse
+		}
+		return "", "", ErrTokenBlocked
+	}
 
-	ok, err = s.UserStorage.IsVersionValid(user.Email, user.Version)
+	ok, err = s.UserStorage.IsVersionValid(ctx, user.Email, user.Version)
 	if err != nil {
 		return "", "", err
 	}
 	if !ok {
 		return "", "", errors.New("version is invalid")
 	}
+	if err = s.restoreVerifiedRole(ctx, &user); err != nil {
+		return "", "", err
+	}
+
+	// Токены, выпущенные до появления семейств, начинают новую сессию
+	if family == "" {
+		// Семейства нет и у access токенов и токенов подтверждения входа, их обменивать нельзя
+		tokenType, err := s.JWTService.GetType(ctx, refreshToken)
+		if err != nil {
+			return "", "", err
+		}
+		if tokenType != "refresh" {
+			return "", "", ErrNotRefreshToken
+		}
+		newAccessToken, newRefreshToken, err := s.startSession(ctx, user, client)
+		if err != nil {
+			return "", "", err
+		}
+		if err = s.retire(ctx, refreshToken); err != nil {
+			return "", "", err
+		}
+		return newAccessToken, newRefreshToken, nil
+	}
 
-	newAccessToken, err := s.JWTService.CreateAccessToken(user)
+	newAccessToken, err := s.JWTService.CreateAccessToken(ctx, s.withPermissions(user), family)
 	if err != nil {
 		return "", "", err
 	}
 
-	newRefreshToken, err := s.JWTService.CreateRefreshToken(user)
+	newRefreshToken, err := s.JWTService.CreateRefreshToken(ctx, user, family)
 	if err != nil {
 		return "", "", err
 	}
 
-	relatedAccess, err := s.JWTStorage.GetAccessByRefresh(refreshToken)
-	if err == nil {
-		err = s.BlackListStorage.AddTokens(refreshToken, relatedAccess)
-		if err != nil {
-			return "", "", err
-		}
+	ok, err = s.JWTStorage.RotateFamily(ctx, family, refreshToken, newRefreshToken)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", "", ErrTokenBlocked
 	}
-	err = s.BlackListStorage.AddTokens(refreshToken)
 	if err != nil {
 		return "", "", err
 	}
+	if !ok {
+		// Тот же токен параллельно уже обменяли: второй обмен считаем повторным использованием
+		s.reportReuse(ctx, family, user.Email, client)
+		return "", "", ErrRefreshTokenReuse
+	}
+
+	err = s.JWTStorage.AddPair(ctx, newAccessToken, newRefreshToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.SessionStorage.TouchSession(ctx, family, client)
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot update session", sl.Err(err), "session", family)
+	}
+
+	if err = s.retire(ctx, refreshToken); err != nil {
+		return "", "", err
+	}
 
 	return newAccessToken, newRefreshToken, nil
 }
 
+// retire заносит обменянный refresh токен и выданный вместе с ним access токен в чёрный список
+func (s *AuthServiceImpl) retire(ctx context.Context, refreshToken string) error {
+	tokens := []string{refreshToken}
+	relatedAccess, err := s.JWTStorage.GetAccessByRefresh(ctx, refreshToken)
+	switch {
+	case err == nil:
+		tokens = append(tokens, relatedAccess)
+	// Пара истекла вместе с access токеном
+	case !errors.Is(err, storage.ErrNotFound):
+		return err
+	}
+	return s.BlackListStorage.AddTokens(ctx, tokens...)
+}
+
 // Return true if token is valid
-func (s *AuthServiceImpl) ValidateToken(token string) (bool, error) {
-	ok, err := s.BlackListStorage.IsAllowed(token)
+// Действительным считается только access токен: refresh токен и токены подтверждения не дают доступа к ресурсам
+func (s *AuthServiceImpl) ValidateToken(ctx context.Context, token string) (bool, error) {
+	return s.checkToken(ctx, token, "access")
+}
+
+// checkToken проверяет чёрный список, подпись, тип и версию данных токена
+func (s *AuthServiceImpl) checkToken(ctx context.Context, token, wantType string) (bool, error) {
+	ok, err := s.BlackListStorage.IsAllowed(ctx, token)
 	if err != nil {
 		return false, err
 	}
@@ -158,7 +335,7 @@ func (s *AuthServiceImpl) ValidateToken(token string) (bool, error) {
 		return false, nil
 	}
 
-	ok, err = s.JWTService.IsTokenValid(token)
+	ok, err = s.JWTService.IsTokenValid(ctx, token)
 	if err != nil {
 		return false, err
 	}
@@ -166,9 +343,215 @@ func (s *AuthServiceImpl) ValidateToken(token string) (bool, error) {
 		return false, nil
 	}
 
-	return true, nil
+	tokenType, err := s.JWTService.GetType(ctx, token)
+	if err != nil {
+		return false, err
+	}
+	if tokenType != wantType {
+		return false, nil
+	}
+
+	// Смена пароля и выход со всех устройств увеличивают версию, после чего токен недействителен
+	user, err := s.JWTService.GetUserInfo(ctx, token)
+	if err != nil {
+		return false, err
+	}
+	ok, err = s.UserStorage.IsVersionValid(ctx, user.Email, user.Version)
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+func (s *AuthServiceImpl) Introspect(ctx context.Context, token string) (TokenInfo, error) {
+	ok, err := s.ValidateToken(ctx, token)
+	if err != nil {
+		// Ошибка проверки подписи или содержимого означает, что токен неактивен
+		s.log.DebugContext(ctx, "introspected token is invalid", sl.Err(err))
+	}
+	if !ok {
+		return TokenInfo{Active: false}, nil
+	}
+
+	claims, err := s.JWTService.GetTokenClaims(ctx, token)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	info := TokenInfo{Active: true}
+	info.Type, _ = claims["type"].(string)
+	info.Email, _ = claims["email"].(string)
+	info.Role, _ = claims["role"].(string)
+	info.Scope, _ = claims["scope"].(string)
+	if iat, ok := claims["iat"].(float64); ok {
+		info.IssuedAt = time.Unix(int64(iat), 0)
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		info.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
+	return info, nil
+}
+
+// startSession создаёт сессию и выпускает первую пару токенов её семейства
+func (s *AuthServiceImpl) startSession(ctx context.Context, user model.User, client model.ClientInfo) (string, string, error) {
+	now := time.Now()
+	session := &model.Session{
+		ID:         random.ID(),
+		Email:      user.Email,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+	}
+
+	accessToken, err := s.JWTService.CreateAccessToken(ctx, s.withPermissions(user), session.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := s.JWTService.CreateRefreshToken(ctx, user, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.JWTStorage.AddPair(ctx, accessToken, refreshToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.JWTStorage.AddFamily(ctx, session.ID, refreshToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.SessionStorage.AddSession(ctx, session)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// reportReuse завершает сессию при повторном предъявлении уже обменянного refresh токена (OAuth 2.0 Security BCP, 4.14.2):
+// нельзя понять, кто из двух предъявителей легитимен, поэтому сессия завершается для обоих.
+func (s *AuthServiceImpl) reportReuse(ctx context.Context, family, email string, client model.ClientInfo) {
+	s.log.WarnContext(ctx, "security event: refresh token reuse detected, revoking token family",
+		"event", "refresh_token_reuse",
+		"email", email,
+		"family", family,
+		"ip", client.IP,
+		"user_agent", client.UserAgent,
+	)
+
+	if err := s.revokeSession(ctx, family); err != nil {
+		s.log.ErrorContext(ctx, "cannot revoke token family", sl.Err(err), "family", family)
+	}
+}
+
+func (s *AuthServiceImpl) ChangePassword(ctx context.Context, email, oldPassword, newPassword string, client model.ClientInfo) (err error) {
+	email = normalizeEmail(email)
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionPasswordChange, Actor: email, Subject: email}, client, err)
+	}()
+
+	// Смена пароля проверяет старый пароль, поэтому подчиняется тем же ограничениям, что и вход
+	if err = s.checkLockout(ctx, email, model.ClientInfo{}); err != nil {
+		return err
+	}
+
+	if err = s.passwordPolicy.Check(newPassword, email); err != nil {
+		return err
+	}
+
+	version, _, err := s.UserStorage.Login(ctx, email, oldPassword)
+	if errors.Is(err, storage.ErrInvalidCredentials) || (err == nil && version == -1) {
+		s.log.WarnContext(ctx, "security event: failed password change attempt", "event", "change_password_failed", "email", email)
+		s.registerFailure(ctx, email, model.ClientInfo{})
+		return ErrInvalidCredentials
+	}
+	if errors.Is(err, storage.ErrUserDisabled) {
+		return ErrAccountDisabled
+	}
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.UserStorage.ChangePassword(ctx, email, passwordHash)
+	if err != nil {
+		return err
+	}
+	s.log.InfoContext(ctx, "password changed, all sessions revoked", "email", email)
+	s.revokeAllSessions(ctx, email)
+
+	return nil
 }
 
-func (s *AuthServiceImpl) Logout(tokens ...string) error {
-	return s.BlackListStorage.AddTokens(tokens...)
+func (s *AuthServiceImpl) LogoutAll(ctx context.Context, accessToken string, client model.ClientInfo) (err error) {
+	var email string
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionLogoutAll, Actor: email, Subject: email}, client, err)
+	}()
+
+	email, _, err = s.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.UserStorage.IncrementVersion(ctx, email)
+	if err != nil {
+		return err
+	}
+	s.revokeAllSessions(ctx, email)
+
+	return nil
+}
+
+// revokeAllSessions удаляет записи о сессиях после увеличения версии.
+// Сами токены к этому моменту уже недействительны, поэтому ошибки только логируются.
+func (s *AuthServiceImpl) revokeAllSessions(ctx context.Context, email string) {
+	sessions, err := s.SessionStorage.ListSessions(ctx, email)
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot list sessions", sl.Err(err), "email", email)
+		return
+	}
+	for _, session := range sessions {
+		if err := s.revokeSession(ctx, session.ID); err != nil {
+			s.log.ErrorContext(ctx, "cannot revoke session", sl.Err(err), "session", session.ID)
+		}
+	}
+}
+
+func (s *AuthServiceImpl) Logout(ctx context.Context, client model.ClientInfo, tokens ...string) (err error) {
+	var email string
+	if len(tokens) > 0 {
+		// Токен может быть уже недействительным, тогда запись журнала останется без автора
+		email, _ = s.JWTService.GetEmail(ctx, tokens[0])
+	}
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionLogout, Actor: email, Subject: email}, client, err)
+	}()
+
+	err = s.BlackListStorage.AddTokens(ctx, tokens...)
+	if err != nil {
+		return err
+	}
+
+	// Выход завершает и сессию, чтобы её refresh токен больше нельзя было обменять
+	for _, token := range tokens {
+		sessionID, err := s.JWTService.GetSessionID(ctx, token)
+		if err != nil || sessionID == "" {
+			continue
+		}
+		if err = s.revokeSession(ctx, sessionID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
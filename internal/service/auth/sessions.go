@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/service/audit"
+	"lk-auth/internal/storage"
+)
+
+var (
+	ErrInvalidAccessToken = errors.New("access token is invalid")
+	ErrSessionNotFound    = errors.New("session not found")
+)
+
+// Sessions возвращает активные сессии владельца accessToken и ID сессии, в которой выдан сам токен.
+func (s *AuthServiceImpl) Sessions(ctx context.Context, accessToken string) ([]model.Session, string, error) {
+	email, currentID, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessions, err := s.SessionStorage.ListSessions(ctx, email)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sessions, currentID, nil
+}
+
+// RevokeSession завершает сессию sessionID, если она принадлежит владельцу accessToken.
+func (s *AuthServiceImpl) RevokeSession(ctx context.Context, accessToken, sessionID string, client model.ClientInfo) (err error) {
+	var email string
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionSessionRevoke, Actor: email, Subject: email, Details: sessionID}, client, err)
+	}()
+
+	email, _, err = s.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.SessionStorage.GetSession(ctx, sessionID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// Чужая сессия неотличима от несуществующей
+	if session.Email != email {
+		return ErrSessionNotFound
+	}
+
+	return s.revokeSession(ctx, sessionID)
+}
+
+// RevokeOtherSessions завершает все сессии владельца accessToken, кроме текущей.
+func (s *AuthServiceImpl) RevokeOtherSessions(ctx context.Context, accessToken string, client model.ClientInfo) (err error) {
+	var email, currentID string
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionSessionsRevoke, Actor: email, Subject: email}, client, err)
+	}()
+
+	email, currentID, err = s.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := s.SessionStorage.ListSessions(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, session := range sessions {
+		if session.ID == currentID {
+			continue
+		}
+		errs = append(errs, s.revokeSession(ctx, session.ID))
+	}
+	return errors.Join(errs...)
+}
+
+// authenticate проверяет access токен и возвращает email владельца и ID сессии
+func (s *AuthServiceImpl) authenticate(ctx context.Context, accessToken string) (string, string, error) {
+	ok, err := s.ValidateToken(ctx, accessToken)
+	if err != nil || !ok {
+		return "", "", ErrInvalidAccessToken
+	}
+
+	email, err := s.JWTService.GetEmail(ctx, accessToken)
+	if err != nil {
+		return "", "", ErrInvalidAccessToken
+	}
+
+	sessionID, err := s.JWTService.GetSessionID(ctx, accessToken)
+	if err != nil {
+		return "", "", ErrInvalidAccessToken
+	}
+
+	return email, sessionID, nil
+}
+
+// revokeSession заносит в чёрный список действующую пару токенов сессии и удаляет её семейство и запись о ней
+func (s *AuthServiceImpl) revokeSession(ctx context.Context, sessionID string) error {
+	head, err := s.JWTStorage.GetFamilyHead(ctx, sessionID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if err == nil {
+		tokens := []string{head}
+		access, err := s.JWTStorage.GetAccessByRefresh(ctx, head)
+		switch {
+		case err == nil:
+			tokens = append(tokens, access)
+		case !errors.Is(err, storage.ErrNotFound):
+			return err
+		}
+		if err := s.BlackListStorage.AddTokens(ctx, tokens...); err != nil {
+			return err
+		}
+		if err := s.JWTStorage.DeleteFamily(ctx, sessionID); err != nil {
+			return err
+		}
+	}
+
+	return s.SessionStorage.DeleteSession(ctx, sessionID)
+}
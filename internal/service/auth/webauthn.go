@@ -0,0 +1,408 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/libs/random"
+	"lk-auth/internal/service/audit"
+	"lk-auth/internal/storage"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Время на ответ аутентификатора, после него challenge не принимается
+const webAuthnCeremonyTTL = 5 * time.Minute
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+var (
+	ErrWebAuthnUnavailable = errors.New("passkeys are not available")
+	ErrWebAuthnCeremony    = errors.New("passkey ceremony is invalid or expired")
+	ErrWebAuthnFailed      = errors.New("passkey verification failed")
+	ErrNoPasskeys          = errors.New("no passkeys registered for this user")
+)
+
+// NewWebAuthn настраивает проверяющую сторону (Relying Party).
+// rpID - домен сайта, origins - адреса страниц, с которых вызываются navigator.credentials.*
+func NewWebAuthn(rpID, rpName string, origins []string) (*webauthn.WebAuthn, error) {
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    webAuthnCeremonyTTL,
+		TimeoutUVD: webAuthnCeremonyTTL,
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpName,
+		RPOrigins:     origins,
+		// Ключ заменяет пароль, поэтому нужен встроенный аутентификатор с проверкой пользователя (PIN, биометрия)
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			AuthenticatorAttachment: protocol.Platform,
+			ResidentKey:             protocol.ResidentKeyRequirementPreferred,
+			UserVerification:        protocol.VerificationRequired,
+		},
+		AttestationPreference: protocol.PreferNoAttestation,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+}
+
+// WithWebAuthn включает вход по ключам доступа (passkeys)
+func WithWebAuthn(webAuthnStorage storage.WebAuthnStorage, webAuthn *webauthn.WebAuthn) Option {
+	return func(s *AuthServiceImpl) {
+		s.WebAuthnStorage = webAuthnStorage
+		s.webAuthn = webAuthn
+	}
+}
+
+// webAuthnCeremony - состояние между началом и завершением регистрации или входа
+type webAuthnCeremony struct {
+	Kind string `json:"kind"`
+	// Пусто при входе с выбором ключа на устройстве
+	Email   string               `json:"email,omitempty"`
+	Session webauthn.SessionData `json:"session"`
+}
+
+// webAuthnUser - пользователь с его ключами в представлении библиотеки webauthn
+type webAuthnUser struct {
+	email       string
+	handle      []byte
+	credentials []model.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte          { return u.handle }
+func (u *webAuthnUser) WebAuthnName() string        { return u.email }
+func (u *webAuthnUser) WebAuthnDisplayName() string { return u.email }
+func (u *webAuthnUser) WebAuthnIcon() string        { return "" }
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(c.Transports))
+		for _, t := range c.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		creds = append(creds, webauthn.Credential{
+			ID:              c.ID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		})
+	}
+	return creds
+}
+
+func (u *webAuthnUser) descriptors() []protocol.CredentialDescriptor {
+	creds := u.WebAuthnCredentials()
+	descriptors := make([]protocol.CredentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		descriptors = append(descriptors, c.Descriptor())
+	}
+	return descriptors
+}
+
+// BeginWebAuthnRegistration начинает регистрацию ключа доступа для владельца accessToken.
+// Параметры передаются в navigator.credentials.create(), ответ - в [AuthServiceImpl.FinishWebAuthnRegistration].
+func (s *AuthServiceImpl) BeginWebAuthnRegistration(ctx context.Context, accessToken string) (string, *protocol.CredentialCreation, error) {
+	email, _, err := s.authenticateVerified(ctx, accessToken)
+	if err != nil {
+		return "", nil, err
+	}
+	if s.WebAuthnStorage == nil {
+		return "", nil, ErrWebAuthnUnavailable
+	}
+
+	user, err := s.webAuthnUser(ctx, email)
+	if err != nil {
+		return "", nil, err
+	}
+	if user.handle == nil {
+		user.handle = make([]byte, 32)
+		rand.Read(user.handle)
+	}
+
+	// Аутентификатор, на котором уже есть ключ пользователя, откажется создавать второй
+	creation, session, err := s.webAuthn.BeginRegistration(user, webauthn.WithExclusions(user.descriptors()))
+	if err != nil {
+		return "", nil, err
+	}
+
+	id, err := s.saveCeremony(ctx, webAuthnCeremony{
+		Kind:    ceremonyRegistration,
+		Email:   email,
+		Session: *session,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return id, creation, nil
+}
+
+// FinishWebAuthnRegistration проверяет ответ аутентификатора и сохраняет новый ключ
+func (s *AuthServiceImpl) FinishWebAuthnRegistration(ctx context.Context, accessToken, ceremonyID string, response *protocol.ParsedCredentialCreationData) error {
+	email, _, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if s.WebAuthnStorage == nil {
+		return ErrWebAuthnUnavailable
+	}
+
+	ceremony, err := s.takeCeremony(ctx, ceremonyID, ceremonyRegistration)
+	if err != nil {
+		return err
+	}
+	if ceremony.Email != email {
+		return ErrWebAuthnCeremony
+	}
+
+	user, err := s.webAuthnUser(ctx, email)
+	if err != nil {
+		return err
+	}
+	// Для первого ключа идентификатор пользователя создан в начале регистрации
+	user.handle = ceremony.Session.UserID
+
+	cred, err := s.webAuthn.CreateCredential(user, ceremony.Session, response)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWebAuthnFailed, webAuthnErrDetails(err))
+	}
+
+	transports := make([]string, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+	err = s.WebAuthnStorage.AddCredential(ctx, &model.WebAuthnCredential{
+		ID:              cred.ID,
+		Email:           email,
+		UserHandle:      user.handle,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transports:      transports,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	})
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return fmt.Errorf("%w: passkey is already registered", ErrWebAuthnFailed)
+	}
+	if err != nil {
+		return err
+	}
+	s.log.InfoContext(ctx, "passkey registered", "email", email)
+
+	return nil
+}
+
+// BeginWebAuthnLogin начинает вход по ключу доступа. Если email пуст, браузер предложит выбрать
+// любой сохранённый на устройстве ключ для этого сайта (discoverable credential).
+func (s *AuthServiceImpl) BeginWebAuthnLogin(ctx context.Context, email string) (string, *protocol.CredentialAssertion, error) {
+	email = normalizeEmail(email)
+	if s.WebAuthnStorage == nil {
+		return "", nil, ErrWebAuthnUnavailable
+	}
+
+	var (
+		assertion *protocol.CredentialAssertion
+		session   *webauthn.SessionData
+		err       error
+	)
+	if email == "" {
+		assertion, session, err = s.webAuthn.BeginDiscoverableLogin()
+	} else {
+		var user *webAuthnUser
+		user, err = s.webAuthnUser(ctx, email)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(user.credentials) == 0 {
+			return "", nil, ErrNoPasskeys
+		}
+		assertion, session, err = s.webAuthn.BeginLogin(user)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	id, err := s.saveCeremony(ctx, webAuthnCeremony{
+		Kind:    ceremonyLogin,
+		Email:   email,
+		Session: *session,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return id, assertion, nil
+}
+
+// FinishWebAuthnLogin проверяет подпись аутентификатора и выдаёт пару токенов, как [AuthServiceImpl.Login].
+// Ключ с проверкой пользователя сам по себе двухфакторный, поэтому TOTP при таком входе не запрашивается.
+func (s *AuthServiceImpl) FinishWebAuthnLogin(ctx context.Context, ceremonyID string, response *protocol.ParsedCredentialAssertionData, client model.ClientInfo) (access, refresh string, err error) {
+	var email string
+	defer func() {
+		s.record(ctx, model.AuditRecord{Action: audit.ActionLoginWebAuthn, Actor: email, Subject: email}, client, err)
+	}()
+
+	if s.WebAuthnStorage == nil {
+		return "", "", ErrWebAuthnUnavailable
+	}
+
+	ceremony, err := s.takeCeremony(ctx, ceremonyID, ceremonyLogin)
+	if err != nil {
+		return "", "", err
+	}
+
+	email = ceremony.Email
+	var cred *webauthn.Credential
+	if email != "" {
+		var user *webAuthnUser
+		user, err = s.webAuthnUser(ctx, email)
+		if err != nil {
+			return "", "", err
+		}
+		cred, err = s.webAuthn.ValidateLogin(user, ceremony.Session, response)
+	} else {
+		// Владелец определяется по ID ключа, user handle из ответа библиотека сверяет с сохранённым
+		cred, err = s.webAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			stored, err := s.WebAuthnStorage.GetCredential(ctx, rawID)
+			if err != nil {
+				return nil, err
+			}
+			email = stored.Email
+			return s.webAuthnUser(ctx, email)
+		}, ceremony.Session, response)
+	}
+	if err != nil {
+		s.log.WarnContext(ctx, "security event: passkey assertion rejected",
+			"event", "webauthn_failed",
+			"email", email,
+			"ip", client.IP,
+			"user_agent", client.UserAgent,
+			"reason", webAuthnErrDetails(err),
+		)
+		return "", "", ErrWebAuthnFailed
+	}
+
+	if cred.Authenticator.CloneWarning {
+		s.log.WarnContext(ctx, "security event: passkey sign count went backwards, possible cloned authenticator",
+			"event", "webauthn_clone_warning",
+			"email", email,
+			"ip", client.IP,
+			"user_agent", client.UserAgent,
+		)
+		return "", "", ErrWebAuthnFailed
+	}
+	if err = s.WebAuthnStorage.UpdateSignCount(ctx, cred.ID, cred.Authenticator.SignCount); err != nil {
+		return "", "", err
+	}
+
+	user, err := s.UserStorage.GetUser(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", "", ErrWebAuthnFailed
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if user.Disabled {
+		s.log.WarnContext(ctx, "security event: login to disabled account refused",
+			"event", "login_disabled",
+			"email", email,
+			"ip", client.IP,
+			"user_agent", client.UserAgent,
+		)
+		return "", "", ErrAccountDisabled
+	}
+
+	sessionUser := model.User{
+		Email:   user.Email,
+		Version: user.Version,
+		Role:    user.Role,
+	}
+	if err = s.checkEmailVerified(ctx, &sessionUser, client); err != nil {
+		return "", "", err
+	}
+
+	return s.startSession(ctx, sessionUser, client)
+}
+
+// webAuthnUser загружает ключи пользователя. У пользователя без ключей handle пуст.
+func (s *AuthServiceImpl) webAuthnUser(ctx context.Context, email string) (*webAuthnUser, error) {
+	creds, err := s.WebAuthnStorage.ListCredentials(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &webAuthnUser{
+		email:       email,
+		credentials: creds,
+	}
+	if len(creds) > 0 {
+		user.handle = creds[0].UserHandle
+	}
+	return user, nil
+}
+
+func (s *AuthServiceImpl) saveCeremony(ctx context.Context, ceremony webAuthnCeremony) (string, error) {
+	data, err := json.Marshal(ceremony)
+	if err != nil {
+		return "", err
+	}
+
+	id := random.ID()
+	if err = s.WebAuthnStorage.SaveCeremony(ctx, id, data, webAuthnCeremonyTTL); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// takeCeremony извлекает состояние церемонии, после чего её challenge больше не принимается
+func (s *AuthServiceImpl) takeCeremony(ctx context.Context, id, kind string) (*webAuthnCeremony, error) {
+	data, err := s.WebAuthnStorage.TakeCeremony(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrWebAuthnCeremony
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ceremony := &webAuthnCeremony{}
+	if err = json.Unmarshal(data, ceremony); err != nil {
+		return nil, err
+	}
+	if ceremony.Kind != kind {
+		return nil, ErrWebAuthnCeremony
+	}
+	return ceremony, nil
+}
+
+// webAuthnErrDetails достаёт из ошибки библиотеки пояснение, пригодное для журнала и ответа клиенту
+func webAuthnErrDetails(err error) string {
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.DevInfo != "" {
+		return protocolErr.Details + ": " + protocolErr.DevInfo
+	}
+	return err.Error()
+}
@@ -1,6 +1,9 @@
 package jwt
 
 import (
+	"context"
+	"time"
+
 	"lk-auth/internal/domain/model"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -8,16 +11,28 @@ import (
 
 type TokenClaims map[string]any
 
+// ctx - контекст запроса для записей журнала. JWKS и RotateKey не зависят от запроса и контекста не принимают
 type JWTService interface {
-	CreateAccessToken(model.User) (string, error)
-	CreateRefreshToken(model.User) (string, error)
+	CreateAccessToken(ctx context.Context, user model.User, sessionID string) (string, error)
+	CreateRefreshToken(ctx context.Context, user model.User, familyID string) (string, error)
+	CreateMFAToken(ctx context.Context, user model.User) (string, error)
+	// Токен из ссылки подтверждения email, действует ttl
+	CreateEmailVerificationToken(ctx context.Context, user model.User, ttl time.Duration) (string, error)
+
+	GetTokenClaims(ctx context.Context, token string) (jwt.MapClaims, error)
+	GetUserInfo(ctx context.Context, token string) (model.User, error)
+	GetVersion(ctx context.Context, token string) (float64, error)
+	GetEmail(ctx context.Context, token string) (string, error)
+	GetRole(ctx context.Context, token string) (string, error)
+	GetType(ctx context.Context, token string) (string, error)
+	GetFamilyID(ctx context.Context, token string) (string, error)
+	GetSessionID(ctx context.Context, token string) (string, error)
 
-	GetTokenClaims(token string) (jwt.MapClaims, error)
-	GetUserInfo(token string) (model.User, error)
-	GetVersion(token string) (float64, error)
-	GetEmail(token string) (string, error)
-	GetRole(token string) (string, error)
-	GetType(token string) (string, error)
+	IsTokenValid(ctx context.Context, token string) (bool, error)
 
-	IsTokenValid(string) (bool, error)
+	// Публичные ключи для проверки подписи сторонними сервисами
+	JWKS() JWKS
+	// Делает key текущим ключом подписи. Прежний ключ принимается при проверке, пока не истекут его токены.
+	// Возвращает false, если key уже является текущим.
+	RotateKey(key any) (bool, error)
 }
@@ -1,6 +1,7 @@
 package jwt_test
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"strings"
@@ -43,30 +44,68 @@ func TestMain(t *testing.T) {
 	}
 	t.Run("CreateAccessToken", createAccessToken)
 	t.Run("CreateRefreshToken", createRefreshToken)
+	t.Run("CreateMFAToken", createMFAToken)
+	t.Run("CreateEmailVerificationToken", createEmailVerificationToken)
 }
 
 func createAccessToken(t *testing.T) {
-	createFunc = jwtService.CreateAccessToken
+	createFunc = func(user model.User) (string, error) {
+		return jwtService.CreateAccessToken(context.Background(), user, "session")
+	}
+	t.Run("GetSessionID", getSessionID)
+	t.Run("Scope", getScope)
 	t.Run("GetClaim", getClaim)
 	t.Run("GetVersion", getVersion)
 	t.Run("IsTokenValid", isTokenValid)
 }
 
 func createRefreshToken(t *testing.T) {
-	createFunc = jwtService.CreateRefreshToken
+	createFunc = func(user model.User) (string, error) {
+		return jwtService.CreateRefreshToken(context.Background(), user, "family")
+	}
+	t.Run("GetFamilyID", getFamilyID)
 	t.Run("GetClaim", getClaim)
 	t.Run("GetVersion", getVersion)
 	t.Run("IsTokenValid", isTokenValid)
 }
 
+func createMFAToken(t *testing.T) {
+	createFunc = func(user model.User) (string, error) {
+		return jwtService.CreateMFAToken(context.Background(), user)
+	}
+	t.Run("GetType", getType("mfa"))
+	t.Run("GetClaim", getClaim)
+	t.Run("IsTokenValid", isTokenValid)
+}
+
+func createEmailVerificationToken(t *testing.T) {
+	createFunc = func(user model.User) (string, error) {
+		return jwtService.CreateEmailVerificationToken(context.Background(), user, time.Hour)
+	}
+	t.Run("GetType", getType("email_verification"))
+	t.Run("GetClaim", getClaim)
+	t.Run("IsTokenValid", isTokenValid)
+}
+
+func getType(expected string) func(t *testing.T) {
+	return func(t *testing.T) {
+		token, err := createFunc(user)
+		assert.Nil(t, err)
+
+		tokenType, err := jwtService.GetType(context.Background(), token)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, tokenType)
+	}
+}
+
 func getClaim(t *testing.T) {
 	actualToken, _ := createFunc(user)
 
-	actualEmail, err := jwtService.GetEmail(actualToken)
+	actualEmail, err := jwtService.GetEmail(context.Background(), actualToken)
 	assert.Nil(t, err)
 	assert.Equal(t, user.Email, actualEmail)
 
-	actualVersion, err := jwtService.GetVersion(actualToken)
+	actualVersion, err := jwtService.GetVersion(context.Background(), actualToken)
 	assert.Nil(t, err)
 	assert.Equal(t, user.Version, actualVersion)
 }
@@ -76,20 +115,60 @@ func getVersion(t *testing.T) {
 
 	assert.Nil(t, err)
 
-	currentVersion, err := jwtService.GetVersion(token)
+	currentVersion, err := jwtService.GetVersion(context.Background(), token)
 
 	assert.Nil(t, err)
 
 	assert.Equal(t, 1., currentVersion)
 }
 
+func getFamilyID(t *testing.T) {
+	token, err := createFunc(user)
+	assert.Nil(t, err)
+
+	familyID, err := jwtService.GetFamilyID(context.Background(), token)
+	assert.Nil(t, err)
+	assert.Equal(t, "family", familyID)
+
+	// Каждый refresh токен уникален, даже если выпущен в ту же секунду
+	other, err := createFunc(user)
+	assert.Nil(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func getSessionID(t *testing.T) {
+	token, err := createFunc(user)
+	assert.Nil(t, err)
+
+	sessionID, err := jwtService.GetSessionID(context.Background(), token)
+	assert.Nil(t, err)
+	assert.Equal(t, "session", sessionID)
+}
+
+func getScope(t *testing.T) {
+	token, err := createFunc(user)
+	assert.Nil(t, err)
+	claims, err := jwtService.GetTokenClaims(context.Background(), token)
+	assert.Nil(t, err)
+	// Без прав claim не добавляется
+	assert.NotContains(t, claims, "scope")
+
+	withPermissions := user
+	withPermissions.Permissions = []string{"profile:read", "profile:write"}
+	token, err = createFunc(withPermissions)
+	assert.Nil(t, err)
+	claims, err = jwtService.GetTokenClaims(context.Background(), token)
+	assert.Nil(t, err)
+	assert.Equal(t, "profile:read profile:write", claims["scope"])
+}
+
 func isTokenValid(t *testing.T) {
 
 	token, err := createFunc(user)
 
 	assert.Nil(t, err)
 
-	res, err := jwtService.IsTokenValid(token)
+	res, err := jwtService.IsTokenValid(context.Background(), token)
 
 	assert.Nil(t, err)
 	assert.Equal(t, true, res)
@@ -98,7 +177,7 @@ func isTokenValid(t *testing.T) {
 
 	builder.WriteString(token[:len(token)-2])
 	builder.WriteRune('J')
-	res, err = jwtService.IsTokenValid(builder.String())
+	res, err = jwtService.IsTokenValid(context.Background(), builder.String())
 
 	assert.NotNil(t, err)
 	assert.Equal(t, false, res)
@@ -107,7 +186,7 @@ func isTokenValid(t *testing.T) {
 	builder.WriteString(token[:49])
 	builder.WriteRune('J')
 	builder.WriteString(token[48:])
-	res, err = jwtService.IsTokenValid(builder.String())
+	res, err = jwtService.IsTokenValid(context.Background(), builder.String())
 
 	assert.NotNil(t, err)
 	assert.Equal(t, false, res)
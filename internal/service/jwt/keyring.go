@@ -0,0 +1,111 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+)
+
+// KeyRing хранит текущий ключ подписи и выведенные из оборота ключи.
+// Выведенные ключи больше не подписывают токены, но принимаются при проверке,
+// пока не истекут выпущенные ими токены.
+type KeyRing struct {
+	mu      sync.RWMutex
+	current *SigningKey
+	retired map[string]retiredKey
+
+	now func() time.Time
+}
+
+type retiredKey struct {
+	key   *SigningKey
+	until time.Time
+}
+
+func NewKeyRing(current *SigningKey) *KeyRing {
+	return &KeyRing{
+		current: current,
+		retired: map[string]retiredKey{},
+		now:     time.Now,
+	}
+}
+
+// Current возвращает ключ, которым подписываются новые токены.
+func (r *KeyRing) Current() *SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.current
+}
+
+// Lookup ищет ключ для проверки подписи по kid среди текущего и действующих выведенных ключей.
+func (r *KeyRing) Lookup(kid string) (*SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.current.ID == kid {
+		return r.current, true
+	}
+	retired, ok := r.retired[kid]
+	if !ok || !r.now().Before(retired.until) {
+		return nil, false
+	}
+	return retired.key, true
+}
+
+// Rotate делает next текущим ключом, а прежний ключ оставляет для проверки на время retireFor.
+// Повторная ротация на тот же ключ ничего не меняет.
+func (r *KeyRing) Rotate(next *SigningKey, retireFor time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current.ID == next.ID {
+		return false
+	}
+	r.prune()
+	r.retired[r.current.ID] = retiredKey{
+		key:   r.current,
+		until: r.now().Add(retireFor),
+	}
+	// Ключ мог быть выведен ранее и теперь возвращается в оборот
+	delete(r.retired, next.ID)
+	r.current = next
+	return true
+}
+
+// Retire добавляет ключ, который принимается только для проверки подписи до until.
+// Используется при старте, чтобы не потерять токены, выпущенные до перезапуска.
+func (r *KeyRing) Retire(key *SigningKey, until time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current.ID == key.ID {
+		return
+	}
+	r.retired[key.ID] = retiredKey{
+		key:   key,
+		until: until,
+	}
+}
+
+// Keys возвращает текущий и все действующие выведенные ключи.
+func (r *KeyRing) Keys() []*SigningKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.prune()
+	keys := make([]*SigningKey, 0, len(r.retired)+1)
+	keys = append(keys, r.current)
+	for _, retired := range r.retired {
+		keys = append(keys, retired.key)
+	}
+	return keys
+}
+
+func (r *KeyRing) prune() {
+	now := r.now()
+	for kid, retired := range r.retired {
+		if !now.Before(retired.until) {
+			delete(r.retired, kid)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	jwtpkg "lk-auth/internal/service/jwt"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func kidOf(t *testing.T, token string) string {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+	return parsed.Header["kid"].(string)
+}
+
+func TestRotateKey(t *testing.T) {
+	secret := []byte("a-string-secret-at-least-256-bits-long")
+	next, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	service, err := jwtpkg.NewJWTServiceImpl(secret, time.Minute, time.Hour, nil)
+	require.NoError(t, err)
+
+	oldToken, err := service.CreateRefreshToken(context.Background(), user, "family")
+	require.NoError(t, err)
+
+	rotated, err := service.RotateKey(next)
+	require.NoError(t, err)
+	assert.True(t, rotated)
+
+	newToken, err := service.CreateRefreshToken(context.Background(), user, "family")
+	require.NoError(t, err)
+	assert.NotEqual(t, kidOf(t, oldToken), kidOf(t, newToken))
+
+	t.Run("Old token is still valid", func(t *testing.T) {
+		ok, err := service.IsTokenValid(context.Background(), oldToken)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("New token is signed with new key", func(t *testing.T) {
+		ok, err := service.IsTokenValid(context.Background(), newToken)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		jwks := service.JWKS()
+		require.Len(t, jwks.Keys, 1)
+		assert.Equal(t, kidOf(t, newToken), jwks.Keys[0].Kid)
+	})
+
+	t.Run("Rotation to the current key is a no-op", func(t *testing.T) {
+		rotated, err := service.RotateKey(next)
+		assert.NoError(t, err)
+		assert.False(t, rotated)
+	})
+}
+
+func TestRetiredKeys(t *testing.T) {
+	_, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	before, err := jwtpkg.NewJWTServiceImpl(oldKey, time.Minute, time.Hour, nil)
+	require.NoError(t, err)
+	token, err := before.CreateAccessToken(context.Background(), user, "session")
+	require.NoError(t, err)
+
+	// Имитация перезапуска с новым ключом и старым в RETIRED_KEY_PATHS
+	after, err := jwtpkg.NewJWTServiceImpl(newKey, time.Minute, time.Hour, nil, jwtpkg.RetiredKey{Key: oldKey, RetiredAt: time.Now()})
+	require.NoError(t, err)
+
+	ok, err := after.IsTokenValid(context.Background(), token)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Len(t, after.JWKS().Keys, 2)
+
+	withoutRetired, err := jwtpkg.NewJWTServiceImpl(newKey, time.Minute, time.Hour, nil)
+	require.NoError(t, err)
+
+	ok, err = withoutRetired.IsTokenValid(context.Background(), token)
+	assert.ErrorIs(t, err, jwtpkg.ErrUnknownKeyID)
+	assert.False(t, ok)
+
+	// Срок проверки отсчитывается от вывода ключа из оборота, а не от запуска
+	restarted, err := jwtpkg.NewJWTServiceImpl(newKey, time.Minute, time.Hour, nil, jwtpkg.RetiredKey{Key: oldKey, RetiredAt: time.Now().Add(-2 * time.Hour)})
+	require.NoError(t, err)
+
+	ok, err = restarted.IsTokenValid(context.Background(), token)
+	assert.ErrorIs(t, err, jwtpkg.ErrUnknownKeyID)
+	assert.False(t, ok)
+	assert.Len(t, restarted.JWKS().Keys, 1)
+}
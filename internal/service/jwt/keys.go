@@ -0,0 +1,228 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnsupportedKey = errors.New("unsupported signing key type")
+
+// SigningKey - ключ подписи токенов вместе с его идентификатором (kid) и алгоритмом.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// []byte для HS256, crypto.Signer для RS256/ES256/EdDSA
+	Private any
+	// nil для HS256: симметричный ключ не публикуется
+	Public crypto.PublicKey
+}
+
+// JWK - публичный ключ в формате RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewSigningKey определяет алгоритм подписи по типу ключа и вычисляет его kid.
+// Поддерживаются: []byte (HS256), *rsa.PrivateKey (RS256),
+// *ecdsa.PrivateKey (ES256/ES384/ES512 в зависимости от кривой) и ed25519.PrivateKey (EdDSA).
+func NewSigningKey(key any) (*SigningKey, error) {
+	switch k := key.(type) {
+	case []byte:
+		if len(k) < 32 {
+			return nil, errors.New("a key of 256 bits or larger MUST be used with HS256 as specified on RFC 7518")
+		}
+		if len(k) > 1024 {
+			return nil, errors.New("secret key is too large (maximum 1024 bytes)")
+		}
+		// kid не должен раскрывать секрет, поэтому берём HMAC от константы, а не хэш самого ключа
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte("lk-auth kid"))
+		return &SigningKey{
+			ID:      base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:12]),
+			Method:  jwt.SigningMethodHS256,
+			Private: k,
+		}, nil
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA key must be at least 2048 bits")
+		}
+		return newAsymmetricKey(jwt.SigningMethodRS256, k, k.Public())
+	case *ecdsa.PrivateKey:
+		var method jwt.SigningMethod
+		switch k.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("%w: unsupported elliptic curve %s", ErrUnsupportedKey, k.Curve.Params().Name)
+		}
+		return newAsymmetricKey(method, k, k.Public())
+	case ed25519.PrivateKey:
+		return newAsymmetricKey(jwt.SigningMethodEdDSA, k, k.Public())
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+}
+
+func newAsymmetricKey(method jwt.SigningMethod, private crypto.Signer, public crypto.PublicKey) (*SigningKey, error) {
+	key := &SigningKey{
+		Method:  method,
+		Private: private,
+		Public:  public,
+	}
+	jwk, err := key.jwk()
+	if err != nil {
+		return nil, err
+	}
+	key.ID, err = thumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// LoadPrivateKey читает закрытый ключ из PEM файла.
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(data)
+}
+
+// ParsePrivateKeyPEM разбирает закрытый ключ в форматах PKCS#8, PKCS#1 (RSA) и SEC 1 (EC).
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+		}
+		return signer, nil
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type)
+	}
+}
+
+// JWK возвращает публичную часть ключа. Для HS256 ключа возвращает false.
+func (k *SigningKey) JWK() (JWK, bool) {
+	if k.Public == nil {
+		return JWK{}, false
+	}
+	jwk, err := k.jwk()
+	if err != nil {
+		return JWK{}, false
+	}
+	jwk.Kid = k.ID
+	jwk.Use = "sig"
+	jwk.Alg = k.Method.Alg()
+	return jwk, true
+}
+
+// jwk заполняет только обязательные по RFC 7638 поля, по которым считается kid.
+func (k *SigningKey) jwk() (JWK, error) {
+	enc := base64.RawURLEncoding
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   enc.EncodeToString(pub.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   enc.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:   enc.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   enc.EncodeToString(pub),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, k.Public)
+	}
+}
+
+// thumbprint вычисляет JWK Thumbprint (RFC 7638).
+// Поля сериализуются в лексикографическом порядке, поэтому используются упорядоченные структуры.
+func thumbprint(jwk JWK) (string, error) {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", fmt.Errorf("%w: kty %q", ErrUnsupportedKey, jwk.Kty)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,149 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwtpkg "lk-auth/internal/service/jwt"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, key crypto.Signer) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	require.NoError(t, err)
+	return path
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name string
+		key  crypto.Signer
+		alg  string
+		kty  string
+	}{
+		{"RS256", rsaKey, "RS256", "RSA"},
+		{"ES256", ecKey, "ES256", "EC"},
+		{"EdDSA", edKey, "EdDSA", "OKP"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			key, err := jwtpkg.LoadPrivateKey(writePEM(t, c.key))
+			require.NoError(t, err)
+
+			service, err := jwtpkg.NewJWTServiceImpl(key, time.Minute, time.Hour, nil)
+			require.NoError(t, err)
+
+			token, err := service.CreateAccessToken(context.Background(), user, "session")
+			require.NoError(t, err)
+
+			ok, err := service.IsTokenValid(context.Background(), token)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			jwks := service.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, c.kty, jwks.Keys[0].Kty)
+			assert.Equal(t, c.alg, jwks.Keys[0].Alg)
+			assert.Equal(t, "sig", jwks.Keys[0].Use)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, c.alg, parsed.Header["alg"])
+			assert.Equal(t, jwks.Keys[0].Kid, parsed.Header["kid"])
+
+			// Опубликованного ключа должно хватать для проверки подписи
+			_, err = jwt.Parse(token, func(*jwt.Token) (any, error) {
+				return c.key.Public(), nil
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestHS256KeyIsNotPublished(t *testing.T) {
+	service, err := jwtpkg.NewJWTServiceImpl(
+		[]byte("a-string-secret-at-least-256-bits-long"),
+		time.Minute,
+		time.Hour,
+		nil,
+	)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(service.JWKS())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"keys":[]}`, string(data))
+}
+
+func TestRejectsForeignKey(t *testing.T) {
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	issuer, err := jwtpkg.NewJWTServiceImpl(first, time.Minute, time.Hour, nil)
+	require.NoError(t, err)
+	verifier, err := jwtpkg.NewJWTServiceImpl(second, time.Minute, time.Hour, nil)
+	require.NoError(t, err)
+
+	token, err := issuer.CreateAccessToken(context.Background(), user, "session")
+	require.NoError(t, err)
+
+	ok, err := verifier.IsTokenValid(context.Background(), token)
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestRejectsAlgorithmConfusion(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	service, err := jwtpkg.NewJWTServiceImpl(key, time.Minute, time.Hour, nil)
+	require.NoError(t, err)
+	kid := service.JWKS().Keys[0].Kid
+
+	// Токен подписан HS256 с публичным ключом в качестве секрета
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email":   user.Email,
+		"exp":     float64(time.Now().Add(time.Minute).Unix()),
+		"role":    user.Role,
+		"type":    "access",
+		"version": user.Version,
+	})
+	forged.Header["kid"] = kid
+	token, err := forged.SignedString([]byte(base64.StdEncoding.EncodeToString(der)))
+	require.NoError(t, err)
+
+	ok, err := service.IsTokenValid(context.Background(), token)
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
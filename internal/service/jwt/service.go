@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -11,32 +12,54 @@ import (
 
 	"lk-auth/internal/domain/model"
 	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/libs/random"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 var ErrInvalidTokenClaims = errors.New("invalid token claims")
 var ErrUnknownClaimType = errors.New("unknown target type")
+var ErrUnknownKeyID = errors.New("unknown signing key id")
+
+// Время на ввод второго фактора после проверки пароля
+const MFATTL = 5 * time.Minute
 
 type JWTServiceImpl struct {
-	SecretKey  []byte
+	Keys       *KeyRing
 	AccessTTL  time.Duration
 	RefreshTTL time.Duration
 
 	log *slog.Logger
 }
 
-func NewJWTServiceImpl(secretKey []byte, accessTTL, refreshTTL time.Duration, log *slog.Logger) (JWTService, error) {
-	if len(secretKey) < 32 {
-		return nil, errors.New("a key of 256 bits or larger MUST be used with HS256 as specified on RFC 7518")
-	}
-	if len(secretKey) > 1024 {
-		return nil, errors.New("secret key is too large (maximum 1024 bytes)")
+// RetiredKey - ключ, которым токены перестали подписываться в RetiredAt.
+// Key - секрет или закрытый ключ, как у [NewJWTServiceImpl]
+type RetiredKey struct {
+	Key       any
+	RetiredAt time.Time
+}
+
+// key - секрет ([]byte) для HS256 или закрытый ключ RSA/ECDSA/Ed25519 (см. [NewSigningKey]).
+// retired - ключи, которыми токены больше не подписываются, но ещё проверяются в течение refreshTTL после
+// их вывода из оборота. Срок отсчитывается от RetiredAt, а не от запуска, поэтому перезапуски его не продлевают
+func NewJWTServiceImpl(key any, accessTTL, refreshTTL time.Duration, log *slog.Logger, retired ...RetiredKey) (JWTService, error) {
+	signingKey, err := NewSigningKey(key)
+	if err != nil {
+		return nil, err
 	}
 	if accessTTL > refreshTTL {
 		return nil, errors.New("accessTTL must be less than refreshTTL")
 	}
 
+	keys := NewKeyRing(signingKey)
+	for _, k := range retired {
+		retiredKey, err := NewSigningKey(k.Key)
+		if err != nil {
+			return nil, err
+		}
+		keys.Retire(retiredKey, k.RetiredAt.Add(refreshTTL))
+	}
+
 	if log == nil {
 		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
 			Level: slog.LevelInfo,
@@ -44,84 +67,160 @@ func NewJWTServiceImpl(secretKey []byte, accessTTL, refreshTTL time.Duration, lo
 	}
 
 	return &JWTServiceImpl{
-		SecretKey:  secretKey,
+		Keys:       keys,
 		AccessTTL:  accessTTL,
 		RefreshTTL: refreshTTL,
 		log:        log,
 	}, nil
 }
 
-func (s *JWTServiceImpl) CreateAccessToken(user model.User) (string, error) {
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
+// sessionID позволяет по access токену найти сессию, в рамках которой он выдан.
+// Права пользователя передаются в claim scope через пробел (RFC 8693, 4.2)
+func (s *JWTServiceImpl) CreateAccessToken(ctx context.Context, user model.User, sessionID string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		// Без jti токены одной сессии, выданные в одну секунду, совпадали бы,
+		// и отзыв старого access токена при обновлении отзывал бы и новый
+		"jti":     random.ID(),
+		"sid":     sessionID,
+		"sub":     user.Email,
+		"email":   user.Email,
+		"iat":     float64(now.Unix()),
+		"exp":     float64(now.Add(s.AccessTTL).Unix()),
+		"role":    user.Role,
+		"type":    "access",
+		"version": user.Version,
+	}
+	if len(user.Permissions) > 0 {
+		claims["scope"] = strings.Join(user.Permissions, " ")
+	}
+	tokenString, err := s.sign(claims)
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot create Access token", sl.Err(err))
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// familyID связывает все refresh токены, полученные цепочкой обновлений из одного входа
+func (s *JWTServiceImpl) CreateRefreshToken(ctx context.Context, user model.User, familyID string) (string, error) {
+	now := time.Now()
+	tokenString, err := s.sign(
 		jwt.MapClaims{
+			"jti":     random.ID(),
+			"fid":     familyID,
+			"sub":     user.Email,
 			"email":   user.Email,
-			"exp":     float64(time.Now().Add(s.AccessTTL).Unix()),
+			"iat":     float64(now.Unix()),
+			"exp":     float64(now.Add(s.RefreshTTL).Unix()),
 			"role":    user.Role,
-			"type":    "access",
+			"type":    "refresh",
 			"version": user.Version,
 		})
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot create Refresh token", sl.Err(err))
+		return "", err
+	}
+	return tokenString, nil
+}
 
-	tokenString, err := token.SignedString(s.SecretKey)
+// Токен подтверждения входа: выдаётся после проверки пароля и обменивается на пару токенов вместе с кодом второго фактора
+func (s *JWTServiceImpl) CreateMFAToken(ctx context.Context, user model.User) (string, error) {
+	now := time.Now()
+	tokenString, err := s.sign(
+		jwt.MapClaims{
+			"jti":     random.ID(),
+			"sub":     user.Email,
+			"email":   user.Email,
+			"iat":     float64(now.Unix()),
+			"exp":     float64(now.Add(MFATTL).Unix()),
+			"role":    user.Role,
+			"type":    "mfa",
+			"version": user.Version,
+		})
 	if err != nil {
-		s.log.Error("cannot create Access token", sl.Err(err))
+		s.log.ErrorContext(ctx, "cannot create MFA token", sl.Err(err))
 		return "", err
 	}
 	return tokenString, nil
 }
 
-func (s *JWTServiceImpl) CreateRefreshToken(user model.User) (string, error) {
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
+// Токен подтверждения email не даёт доступа к ресурсам: он только доказывает, что письмо получено владельцем адреса
+func (s *JWTServiceImpl) CreateEmailVerificationToken(ctx context.Context, user model.User, ttl time.Duration) (string, error) {
+	now := time.Now()
+	tokenString, err := s.sign(
 		jwt.MapClaims{
+			"jti":     random.ID(),
+			"sub":     user.Email,
 			"email":   user.Email,
-			"exp":     float64(time.Now().Add(s.RefreshTTL).Unix()),
+			"iat":     float64(now.Unix()),
+			"exp":     float64(now.Add(ttl).Unix()),
 			"role":    user.Role,
-			"type":    "refresh",
+			"type":    "email_verification",
 			"version": user.Version,
 		})
-	tokenString, err := token.SignedString(s.SecretKey)
 	if err != nil {
-		s.log.Error("cannot create Refresh token", sl.Err(err))
+		s.log.ErrorContext(ctx, "cannot create email verification token", sl.Err(err))
 		return "", err
 	}
 	return tokenString, nil
 }
 
-func (s *JWTServiceImpl) GetTokenClaims(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		return s.SecretKey, nil
-	})
+func (s *JWTServiceImpl) GetTokenClaims(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, s.keyFunc)
 	if err != nil {
-		s.log.Error("cannot get token claime", sl.Err(err))
+		s.log.ErrorContext(ctx, "cannot get token claime", sl.Err(err))
 		return nil, err
 	}
 
 	tokenClaims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		s.log.Error("cannot get token claime", sl.Err(ErrInvalidTokenClaims))
+		s.log.ErrorContext(ctx, "cannot get token claime", sl.Err(ErrInvalidTokenClaims))
 		return nil, ErrInvalidTokenClaims
 	}
 
 	return tokenClaims, nil
 }
 
-func (s *JWTServiceImpl) GetUserInfo(tokenString string) (model.User, error) {
+func (s *JWTServiceImpl) JWKS() JWKS {
+	keys := JWKS{Keys: []JWK{}}
+	for _, key := range s.Keys.Keys() {
+		if jwk, ok := key.JWK(); ok {
+			keys.Keys = append(keys.Keys, jwk)
+		}
+	}
+	return keys
+}
+
+func (s *JWTServiceImpl) RotateKey(key any) (bool, error) {
+	next, err := NewSigningKey(key)
+	if err != nil {
+		return false, err
+	}
+	// Прежний ключ должен проверять токены, пока не истечёт самый долгоживущий из них
+	rotated := s.Keys.Rotate(next, s.RefreshTTL)
+	if rotated {
+		s.log.Info("signing key rotated", "kid", next.ID, "alg", next.Method.Alg())
+	}
+	return rotated, nil
+}
+
+func (s *JWTServiceImpl) GetUserInfo(ctx context.Context, tokenString string) (model.User, error) {
 	user := model.User{}
 
-	if version, err := s.GetVersion(tokenString); err != nil {
+	if version, err := s.GetVersion(ctx, tokenString); err != nil {
 		return model.User{}, err
 	} else {
 		user.Version = version
 	}
 
-	if email, err := s.GetEmail(tokenString); err != nil {
+	if email, err := s.GetEmail(ctx, tokenString); err != nil {
 		return model.User{}, err
 	} else {
 		user.Email = email
 	}
 
-	if role, err := s.GetRole(tokenString); err != nil {
+	if role, err := s.GetRole(ctx, tokenString); err != nil {
 		return model.User{}, err
 	} else {
 		user.Role = role
@@ -130,39 +229,64 @@ func (s *JWTServiceImpl) GetUserInfo(tokenString string) (model.User, error) {
 	return user, nil
 }
 
-func (s *JWTServiceImpl) GetVersion(tokenString string) (float64, error) {
+func (s *JWTServiceImpl) GetVersion(ctx context.Context, tokenString string) (float64, error) {
 	var version float64
-	err := s.getClaim(tokenString, "version", &version)
+	err := s.getClaim(ctx, tokenString, "version", &version)
 
 	return version, err
 }
 
-func (s *JWTServiceImpl) GetEmail(tokenString string) (string, error) {
+func (s *JWTServiceImpl) GetEmail(ctx context.Context, tokenString string) (string, error) {
 	var email string
-	err := s.getClaim(tokenString, "email", &email)
+	err := s.getClaim(ctx, tokenString, "email", &email)
 
 	return email, err
 }
 
-func (s *JWTServiceImpl) GetRole(tokenString string) (string, error) {
+func (s *JWTServiceImpl) GetRole(ctx context.Context, tokenString string) (string, error) {
 	var role string
-	err := s.getClaim(tokenString, "role", &role)
+	err := s.getClaim(ctx, tokenString, "role", &role)
 
 	return role, err
 }
 
-func (s *JWTServiceImpl) GetType(tokenString string) (string, error) {
+func (s *JWTServiceImpl) GetType(ctx context.Context, tokenString string) (string, error) {
 	var userType string
-	err := s.getClaim(tokenString, "type", &userType)
+	err := s.getClaim(ctx, tokenString, "type", &userType)
 
 	return userType, err
 }
 
-func (s *JWTServiceImpl) IsTokenValid(tokenString string) (bool, error) {
-	tokenClaims, err := s.GetTokenClaims(tokenString)
+// Для токенов, выпущенных до появления семейств, возвращает пустую строку
+func (s *JWTServiceImpl) GetFamilyID(ctx context.Context, tokenString string) (string, error) {
+	tokenClaims, err := s.GetTokenClaims(ctx, tokenString)
+	if err != nil {
+		return "", err
+	}
+	familyID, _ := tokenClaims["fid"].(string)
+
+	return familyID, nil
+}
 
+// Для access токена возвращает sid, для refresh - идентификатор семейства, который совпадает с ID сессии
+func (s *JWTServiceImpl) GetSessionID(ctx context.Context, tokenString string) (string, error) {
+	tokenClaims, err := s.GetTokenClaims(ctx, tokenString)
 	if err != nil {
-		s.log.Error("JWT validation failed", sl.Err(err))
+		return "", err
+	}
+	if sessionID, ok := tokenClaims["sid"].(string); ok {
+		return sessionID, nil
+	}
+	familyID, _ := tokenClaims["fid"].(string)
+
+	return familyID, nil
+}
+
+func (s *JWTServiceImpl) IsTokenValid(ctx context.Context, tokenString string) (bool, error) {
+	tokenClaims, err := s.GetTokenClaims(ctx, tokenString)
+
+	if err != nil {
+		s.log.ErrorContext(ctx, "JWT validation failed", sl.Err(err))
 		return false, err
 	}
 
@@ -201,17 +325,50 @@ func (s *JWTServiceImpl) IsTokenValid(tokenString string) (bool, error) {
 	}
 
 	if errFieldsBuilder.Len() != 0 {
-		s.log.Error("invalid token payload", "error with: ", errFieldsBuilder.String())
+		s.log.ErrorContext(ctx, "invalid token payload", "error with: ", errFieldsBuilder.String())
 		return false, errors.New("faild to get " + errFieldsBuilder.String())
 	}
 
 	return true, nil
 }
 
-func (s *JWTServiceImpl) getClaim(tokenString, name string, target any) error {
-	tokenClaims, err := s.GetTokenClaims(tokenString)
+func (s *JWTServiceImpl) sign(claims jwt.MapClaims) (string, error) {
+	key := s.Keys.Current()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+func (s *JWTServiceImpl) keyFunc(token *jwt.Token) (any, error) {
+	var key *SigningKey
+	switch kid := token.Header["kid"].(type) {
+	case nil:
+		// Токены без kid выпущены до его появления, их проверяем текущим ключом
+		key = s.Keys.Current()
+	case string:
+		var ok bool
+		if key, ok = s.Keys.Lookup(kid); !ok {
+			return nil, ErrUnknownKeyID
+		}
+	default:
+		return nil, ErrUnknownKeyID
+	}
+
+	// Алгоритм определяется ключом, а не заголовком токена, иначе возможна подмена алгоритма
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+	if key.Public == nil {
+		return key.Private, nil
+	}
+	return key.Public, nil
+}
+
+func (s *JWTServiceImpl) getClaim(ctx context.Context, tokenString, name string, target any) error {
+	tokenClaims, err := s.GetTokenClaims(ctx, tokenString)
 	if err != nil {
-		s.log.Error("cannot get token claime", sl.Err(err))
+		s.log.ErrorContext(ctx, "cannot get token claime", sl.Err(err))
 		return ErrInvalidTokenClaims
 	}
 
@@ -219,14 +376,14 @@ func (s *JWTServiceImpl) getClaim(tokenString, name string, target any) error {
 	case *float64:
 		val, ok := tokenClaims[name].(float64)
 		if !ok {
-			s.log.Error("cannot get token claime", sl.Err(ErrInvalidTokenClaims))
+			s.log.ErrorContext(ctx, "cannot get token claime", sl.Err(ErrInvalidTokenClaims))
 			return ErrInvalidTokenClaims
 		}
 		*t = val
 	case *string:
 		val, ok := tokenClaims[name].(string)
 		if !ok {
-			s.log.Error("cannot get token claime", sl.Err(ErrInvalidTokenClaims))
+			s.log.ErrorContext(ctx, "cannot get token claime", sl.Err(ErrInvalidTokenClaims))
 			return ErrInvalidTokenClaims
 		}
 		*t = val
@@ -235,7 +392,7 @@ func (s *JWTServiceImpl) getClaim(tokenString, name string, target any) error {
 			floatType *float64
 			stringype *string
 		)
-		s.log.Error("unknown target type",
+		s.log.ErrorContext(ctx, "unknown target type",
 			sl.Err(ErrInvalidTokenClaims),
 			"input type", fmt.Sprintf("%T", t),
 			"valid types", fmt.Sprintf("%T, %T", floatType, stringype),
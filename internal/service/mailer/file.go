@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileMailer дописывает письма в файл вместо отправки. Для локальной разработки и тестов
+type FileMailer struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+func NewFileMailer(path, from string) (Mailer, error) {
+	// Проверяем, что файл доступен для записи, до первого письма
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	return &FileMailer{path: path, from: from}, nil
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	data, err := format(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(data, "\r\n"...)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LogMailer пишет в журнал получателя и тему письма вместо отправки. Текст письма со ссылками сброса пароля
+// и подтверждения email не пишется: кто читает журнал, получил бы доступ к учётной записи
+type LogMailer struct {
+	log *slog.Logger
+}
+
+func NewLogMailer(log *slog.Logger) Mailer {
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+	return &LogMailer{log: log}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	m.log.Info("mail is written to the log instead of being sent",
+		"to", msg.To,
+		"subject", msg.Subject,
+	)
+	return nil
+}
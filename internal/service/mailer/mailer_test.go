@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	data, err := format("lk-auth <noreply@example.com>", Message{
+		To:      "user@example.com",
+		Subject: "Сброс пароля",
+		Body:    "line 1\nline 2",
+	}, date)
+	require.NoError(t, err)
+
+	msg := string(data)
+	assert.Contains(t, msg, "From: lk-auth <noreply@example.com>\r\n")
+	assert.Contains(t, msg, "To: <user@example.com>\r\n")
+	assert.Contains(t, msg, "Subject: =?utf-8?q?")
+	assert.Contains(t, msg, "Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n")
+	assert.True(t, strings.HasSuffix(msg, "\r\n\r\nline 1\r\nline 2\r\n"))
+
+	t.Run("header injection", func(t *testing.T) {
+		_, err := format("noreply@example.com", Message{To: "user@example.com", Subject: "hi\r\nBcc: victim@example.com"}, date)
+		assert.Error(t, err)
+
+		_, err = format("noreply@example.com", Message{To: "user@example.com\r\nBcc: victim@example.com", Subject: "hi"}, date)
+		assert.Error(t, err)
+	})
+}
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.txt")
+	m, err := NewFileMailer(path, "noreply@example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Send(Message{To: "first@example.com", Subject: "first", Body: "token-1"}))
+	require.NoError(t, m.Send(Message{To: "second@example.com", Subject: "second", Body: "token-2"}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "token-1")
+	assert.Contains(t, string(data), "token-2")
+	assert.Equal(t, 2, strings.Count(string(data), "From: noreply@example.com"))
+}
+
+func TestLogMailer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	m := NewLogMailer(slog.New(slog.NewTextHandler(buf, nil)))
+
+	require.NoError(t, m.Send(Message{To: "first@example.com", Subject: "Password reset", Body: "https://example.com/reset?token=secret"}))
+
+	assert.Contains(t, buf.String(), "first@example.com")
+	assert.Contains(t, buf.String(), "Password reset")
+	assert.NotContains(t, buf.String(), "secret")
+}
@@ -0,0 +1,269 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Длина префикса SHA-1, по которому запрашиваются хэши из базы утечек
+const PrefixLength = 5
+
+// Длина SHA-1 в шестнадцатеричной записи
+const hashLength = 40
+
+// Сколько байт читается за раз при поиске конца строки
+const chunkSize = 128
+
+// fileCorpus ищет хэши в отсортированном файле двоичным поиском через ReadAt, не загружая файл в память:
+// полная выгрузка Pwned Passwords - около миллиарда строк
+type fileCorpus struct {
+	file *os.File
+	path string
+	size int64
+}
+
+// OpenBreachedFile открывает базу утечек. Каждая строка файла - SHA-1 пароля
+// в шестнадцатеричной записи и, через двоеточие, сколько раз он встречался,
+// как в выгрузке Pwned Passwords: "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:10434004".
+// Строки должны быть отсортированы по хэшу без учёта регистра, как в выгрузке "ordered by hash".
+// Пустые строки и строки, начинающиеся с #, пропускаются.
+// При открытии проверяются первая и последняя строки, остальные - при поиске. Файл открыт до завершения процесса
+func OpenBreachedFile(path string) (BreachedCorpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	c := &fileCorpus{file: file, path: path, size: info.Size()}
+
+	if err := c.check(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// check разбирает первую и последнюю строки с хэшами: неверный формат файла обнаруживается при запуске, а не при регистрации
+func (c *fileCorpus) check() error {
+	first, firstOffset, err := c.hashLineFrom(0)
+	if err != nil {
+		return err
+	}
+	if first == "" {
+		return fmt.Errorf("%s: no hashes", c.path)
+	}
+	firstHash, _, err := c.parse(first, firstOffset)
+	if err != nil {
+		return err
+	}
+
+	lastOffset, err := c.lineStart(c.size - 1)
+	if err != nil {
+		return err
+	}
+	// Файл может заканчиваться переводом строки или комментарием
+	for lastOffset > 0 {
+		last, err := c.lineAt(lastOffset)
+		if err != nil {
+			return err
+		}
+		if !isComment(last) {
+			break
+		}
+		if lastOffset, err = c.lineStart(lastOffset - 1); err != nil {
+			return err
+		}
+	}
+	last, err := c.lineAt(lastOffset)
+	if err != nil {
+		return err
+	}
+	lastHash, _, err := c.parse(last, lastOffset)
+	if err != nil {
+		return err
+	}
+	if lastHash < firstHash {
+		return fmt.Errorf("%s: hashes are not sorted", c.path)
+	}
+	return nil
+}
+
+// hashLineFrom возвращает первую строку с хэшем, которая начинается не раньше offset, и её начало.
+// В конце файла возвращается пустая строка и размер файла
+func (c *fileCorpus) hashLineFrom(offset int64) (string, int64, error) {
+	offset, err := c.nextLine(offset)
+	for err == nil && offset < c.size {
+		var line string
+		if line, err = c.lineAt(offset); err != nil {
+			break
+		}
+		if !isComment(line) {
+			return line, offset, nil
+		}
+		offset, err = c.nextLine(offset + 1)
+	}
+	return "", c.size, err
+}
+
+func (c *fileCorpus) Range(prefix string) (map[string]int64, error) {
+	prefix = strings.ToUpper(prefix)
+
+	// Двоичный поиск первой строки, начало хэша в которой не меньше prefix.
+	// Строка для позиции p - первая строка с хэшем, которая начинается не раньше p
+	lo, hi := int64(0), c.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, _, err := c.hashLineFrom(mid)
+		if err != nil {
+			return nil, err
+		}
+		if line != "" && lineKey(line) < prefix {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	_, start, err := c.hashLineFrom(lo)
+	if err != nil {
+		return nil, err
+	}
+
+	suffixes := map[string]int64{}
+	reader := bufio.NewReader(io.NewSectionReader(c.file, start, c.size-start))
+	for offset := start; ; {
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		text := strings.TrimSpace(line)
+		if !isComment(text) {
+			if lineKey(text) != prefix {
+				break
+			}
+			hash, count, parseErr := c.parse(text, offset)
+			if parseErr != nil {
+				return nil, parseErr
+			}
+			suffixes[hash[PrefixLength:]] += count
+		}
+		if err != nil {
+			break
+		}
+		offset += int64(len(line))
+	}
+	return suffixes, nil
+}
+
+// parse разбирает строку "HASH:COUNT" или "HASH", хэш возвращается в верхнем регистре
+func (c *fileCorpus) parse(text string, offset int64) (string, int64, error) {
+	hash, countText, hasCount := strings.Cut(text, ":")
+	count := int64(1)
+	if hasCount {
+		var err error
+		count, err = strconv.ParseInt(countText, 10, 64)
+		if err != nil || count < 1 {
+			return "", 0, fmt.Errorf("%s: offset %d: invalid count %q", c.path, offset, countText)
+		}
+	}
+	if !isSHA1(hash) {
+		return "", 0, fmt.Errorf("%s: offset %d: invalid SHA-1 %q", c.path, offset, hash)
+	}
+	return strings.ToUpper(hash), count, nil
+}
+
+// lineAt читает строку, которая начинается в offset, без перевода строки и пробелов по краям
+func (c *fileCorpus) lineAt(offset int64) (string, error) {
+	var line []byte
+	buf := make([]byte, chunkSize)
+	for offset < c.size {
+		n, err := c.file.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			line = append(line, buf[:i]...)
+			break
+		}
+		line = append(line, buf[:n]...)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return "", err
+		}
+		offset += int64(n)
+	}
+	return strings.TrimSpace(string(line)), nil
+}
+
+// nextLine возвращает начало первой строки, которая начинается не раньше offset, или размер файла
+func (c *fileCorpus) nextLine(offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+	// Строка начинается в offset, если перед ним перевод строки
+	offset--
+	buf := make([]byte, chunkSize)
+	for offset < c.size {
+		n, err := c.file.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return offset + int64(i) + 1, nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, err
+		}
+		offset += int64(n)
+	}
+	return c.size, nil
+}
+
+// lineStart возвращает начало строки, в которую попадает offset
+func (c *fileCorpus) lineStart(offset int64) (int64, error) {
+	buf := make([]byte, chunkSize)
+	for offset > 0 {
+		from := max(offset-chunkSize, 0)
+		n, err := c.file.ReadAt(buf[:offset-from], from)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return from + int64(i) + 1, nil
+		}
+		offset = from
+	}
+	return 0, nil
+}
+
+// lineKey - начало хэша в верхнем регистре для сравнения с префиксом
+func lineKey(line string) string {
+	if len(line) > PrefixLength {
+		line = line[:PrefixLength]
+	}
+	return strings.ToUpper(line)
+}
+
+func isComment(line string) bool {
+	return line == "" || strings.HasPrefix(line, "#")
+}
+
+func isSHA1(s string) bool {
+	if len(s) != hashLength {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// SHA-1 от "password" и "Password1"
+const (
+	passwordSHA1  = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+	password1SHA1 = "70CCD9007338D6D81DD3B6271621B9CF9A97EA00"
+)
+
+func rules(err error) []string {
+	policyErr, ok := err.(*PolicyError)
+	if !ok {
+		return nil
+	}
+	var rules []string
+	for _, v := range policyErr.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPolicy(t *testing.T) {
+	policy := &Policy{MinLength: 10, MinClasses: 3}
+
+	cases := []struct {
+		name     string
+		password string
+		email    string
+		rules    []string
+	}{
+		{"valid", "Correct-horse", "user@example.com", nil},
+		{"empty", "", "", []string{RuleMinLength, RuleClasses}},
+		{"short", "Ab1-", "", []string{RuleMinLength}},
+		// Длина считается в символах, а не в байтах
+		{"multibyte", "Пароль-123", "", nil},
+		{"too few classes", "correcthorse", "", []string{RuleClasses}},
+		{"too long for bcrypt", "Aa1-" + strings.Repeat("я", 35), "", []string{RuleMaxBytes}},
+		{"same as email", "User1@Example.com", "user1@example.com", []string{RuleEmail}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := policy.Check(c.password, c.email)
+			if c.rules == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, c.rules, rules(err))
+		})
+	}
+}
+
+func TestBreached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	require.NoError(t, os.WriteFile(path, []byte(
+		"# top passwords\n"+
+			passwordSHA1+":10434004\n"+
+			"\n"+
+			strings.ToLower(password1SHA1)+"\n",
+	), 0o600))
+
+	corpus, err := OpenBreachedFile(path)
+	require.NoError(t, err)
+
+	// Базе передаётся только префикс хэша
+	suffixes, err := corpus.Range(passwordSHA1[:PrefixLength])
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{passwordSHA1[PrefixLength:]: 10434004}, suffixes)
+
+	policy := &Policy{MinLength: 8, MinClasses: 1, Breached: corpus}
+	assert.Equal(t, []string{RuleBreached}, rules(policy.Check("password", "")))
+	assert.Equal(t, []string{RuleBreached}, rules(policy.Check("Password1", "")))
+	assert.NoError(t, policy.Check("Password2", ""))
+
+	t.Run("invalid file", func(t *testing.T) {
+		for _, data := range []string{"not a hash\n", passwordSHA1 + ":many\n", passwordSHA1[1:] + "\n"} {
+			require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+			_, err := OpenBreachedFile(path)
+			assert.Error(t, err, data)
+		}
+
+		require.NoError(t, os.WriteFile(path, []byte(password1SHA1+"\n"+passwordSHA1+"\n"), 0o600))
+		_, err := OpenBreachedFile(path)
+		assert.Error(t, err, "unsorted")
+
+		_, err = OpenBreachedFile(filepath.Join(t.TempDir(), "missing.txt"))
+		assert.Error(t, err)
+	})
+}
+
+// Выгрузка в формате Pwned Passwords "ordered by hash": миллион строк HASH:COUNT с CRLF
+func TestBreachedLargeFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes a 50 MB file")
+	}
+
+	const lines = 1 << 20
+	hashes := make([]string, lines)
+	counts := make(map[string]int64, lines)
+	for i := range hashes {
+		sum := sha1.Sum([]byte(fmt.Sprintf("password-%d", i)))
+		hashes[i] = strings.ToUpper(hex.EncodeToString(sum[:]))
+		counts[hashes[i]] = int64(i%1000 + 1)
+	}
+	slices.Sort(hashes)
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	w := bufio.NewWriter(file)
+	for _, hash := range hashes {
+		fmt.Fprintf(w, "%s:%d\r\n", hash, counts[hash])
+	}
+	require.NoError(t, w.Flush())
+	require.NoError(t, file.Close())
+
+	corpus, err := OpenBreachedFile(path)
+	require.NoError(t, err)
+
+	// Первый и последний префиксы, префиксы из середины и отсутствующие в файле
+	prefixes := []string{hashes[0][:PrefixLength], hashes[lines-1][:PrefixLength], "00000", "FFFFF"}
+	for i := 0; i < lines; i += lines / 256 {
+		prefixes = append(prefixes, hashes[i][:PrefixLength], strings.ToLower(hashes[i][:PrefixLength]))
+	}
+	for _, prefix := range prefixes {
+		expected := map[string]int64{}
+		from, _ := slices.BinarySearch(hashes, strings.ToUpper(prefix))
+		for _, hash := range hashes[from:] {
+			if !strings.HasPrefix(hash, strings.ToUpper(prefix)) {
+				break
+			}
+			expected[hash[PrefixLength:]] = counts[hash]
+		}
+
+		suffixes, err := corpus.Range(prefix)
+		require.NoError(t, err)
+		assert.Equal(t, expected, suffixes, prefix)
+	}
+
+	breached, err := IsBreached(corpus, "password-12345")
+	require.NoError(t, err)
+	assert.True(t, breached)
+	breached, err = IsBreached(corpus, "password-"+fmt.Sprint(lines))
+	require.NoError(t, err)
+	assert.False(t, breached)
+}
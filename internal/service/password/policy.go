@@ -0,0 +1,151 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Предел длины пароля. Совпадает с пределом bcrypt, которым проверяются хэши, заведённые до перехода на Argon2id
+const MaxBytes = 72
+
+// Правила политики паролей, см. [Violation]
+const (
+	RuleMinLength = "min_length"
+	RuleMaxBytes  = "max_bytes"
+	RuleClasses   = "character_classes"
+	RuleEmail     = "not_email"
+	RuleBreached  = "breached"
+)
+
+// Violation - нарушенное правило и понятное пользователю пояснение
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// PolicyError перечисляет все правила, которым не соответствует пароль
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+type Policy struct {
+	// Минимальная длина в символах
+	MinLength int
+	// Сколько разных классов символов должно быть в пароле: строчные и заглавные буквы, цифры, прочие символы
+	MinClasses int
+	// Если nil, пароли не проверяются по утечкам
+	Breached BreachedCorpus
+}
+
+// DefaultPolicy действует, если политика не задана явно
+func DefaultPolicy() *Policy {
+	return &Policy{MinLength: 8, MinClasses: 1}
+}
+
+// Check проверяет пароль пользователя email. Если email пуст, совпадение с ним не проверяется.
+// Возвращает *PolicyError со всеми нарушениями или ошибку обращения к базе утечек
+func (p *Policy) Check(password, email string) error {
+	var violations []Violation
+
+	if length := utf8.RuneCountInString(password); length < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: "must be at least " + strconv.Itoa(p.MinLength) + " characters long",
+		})
+	}
+	if len(password) > MaxBytes {
+		violations = append(violations, Violation{
+			Rule:    RuleMaxBytes,
+			Message: "must be at most " + strconv.Itoa(MaxBytes) + " bytes long",
+		})
+	}
+	if classes(password) < p.MinClasses {
+		violations = append(violations, Violation{
+			Rule: RuleClasses,
+			Message: "must contain at least " + strconv.Itoa(p.MinClasses) +
+				" of: lowercase letters, uppercase letters, digits, other characters",
+		})
+	}
+	if email != "" && strings.EqualFold(password, email) {
+		violations = append(violations, Violation{
+			Rule:    RuleEmail,
+			Message: "must not be the same as the email",
+		})
+	}
+
+	// Пароль, который заведомо не пройдёт проверку, незачем искать в базе утечек
+	if len(violations) == 0 && p.Breached != nil {
+		breached, err := IsBreached(p.Breached, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, Violation{
+				Rule:    RuleBreached,
+				Message: "has appeared in a data breach, choose another one",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// classes считает классы символов, встречающиеся в пароле
+func classes(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	n := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			n++
+		}
+	}
+	return n
+}
+
+// BreachedCorpus - база утёкших паролей с k-анонимным доступом (как range API Have I Been Pwned):
+// по первым 5 символам SHA-1 пароля возвращаются все известные хвосты хэшей с таким началом,
+// поэтому ни пароль, ни его полный хэш базе не передаются
+type BreachedCorpus interface {
+	// Range возвращает хвосты хэшей (35 символов, верхний регистр) и сколько раз пароль встречался в утечках
+	Range(prefix string) (map[string]int64, error)
+}
+
+// IsBreached ищет пароль в базе утечек
+func IsBreached(corpus BreachedCorpus, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := corpus.Range(hash[:PrefixLength])
+	if err != nil {
+		return false, err
+	}
+	return suffixes[hash[PrefixLength:]] > 0, nil
+}
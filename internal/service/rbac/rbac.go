@@ -0,0 +1,163 @@
+package rbac
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Права, которые проверяет сам сервис авторизации
+const (
+	PermUsersRead      = "users:read"
+	PermUsersWrite     = "users:write"
+	PermRolesGrant     = "roles:grant"
+	PermLockoutsManage = "lockouts:manage"
+	PermAuditRead      = "audit:read"
+)
+
+// Роли реестра по умолчанию
+const (
+	RoleGuest = "guest"
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+type Role struct {
+	Name string `json:"name"`
+	// Роли, все права которых есть и у этой роли
+	Inherits    []string `json:"inherits,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// Роль можно выбрать при регистрации. Остальные роли назначает пользователь с правом roles:grant
+	SelfAssignable bool `json:"self_assignable,omitempty"`
+}
+
+// Registry - неизменяемый набор ролей с вычисленными с учётом наследования правами
+type Registry struct {
+	defaultRole string
+	roles       map[string]Role
+	permissions map[string][]string
+}
+
+// NewRegistry проверяет роли: имена уникальны, наследуемые роли существуют и не образуют цикл,
+// роль по умолчанию существует и может быть выбрана при регистрации
+func NewRegistry(defaultRole string, roles ...Role) (*Registry, error) {
+	r := &Registry{
+		defaultRole: defaultRole,
+		roles:       make(map[string]Role, len(roles)),
+		permissions: make(map[string][]string, len(roles)),
+	}
+	for _, role := range roles {
+		if role.Name == "" {
+			return nil, errors.New("role name cannot be empty")
+		}
+		if _, ok := r.roles[role.Name]; ok {
+			return nil, fmt.Errorf("role %q is defined twice", role.Name)
+		}
+		r.roles[role.Name] = role
+	}
+
+	for _, role := range roles {
+		permissions, err := r.resolve(role.Name, nil)
+		if err != nil {
+			return nil, err
+		}
+		slices.Sort(permissions)
+		r.permissions[role.Name] = slices.Compact(permissions)
+	}
+
+	def, ok := r.roles[defaultRole]
+	if !ok {
+		return nil, fmt.Errorf("default role %q: %w", defaultRole, ErrUnknownRole)
+	}
+	if !def.SelfAssignable {
+		return nil, fmt.Errorf("default role %q must be self-assignable", defaultRole)
+	}
+
+	return r, nil
+}
+
+// resolve собирает права роли и всех наследуемых ею ролей. path - цепочка наследования для поиска циклов
+func (r *Registry) resolve(name string, path []string) ([]string, error) {
+	if slices.Contains(path, name) {
+		return nil, fmt.Errorf("role inheritance cycle: %v -> %s", path, name)
+	}
+	role, ok := r.roles[name]
+	if !ok {
+		return nil, fmt.Errorf("role %q inherited by %v: %w", name, path, ErrUnknownRole)
+	}
+
+	permissions := slices.Clone(role.Permissions)
+	for _, parent := range role.Inherits {
+		inherited, err := r.resolve(parent, append(path, name))
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, inherited...)
+	}
+	return permissions, nil
+}
+
+// Default - роль, которая назначается при регистрации без явно указанной роли
+func (r *Registry) Default() string {
+	return r.defaultRole
+}
+
+func (r *Registry) Exists(role string) bool {
+	_, ok := r.roles[role]
+	return ok
+}
+
+func (r *Registry) SelfAssignable(role string) bool {
+	return r.roles[role].SelfAssignable
+}
+
+// Permissions возвращает отсортированные права роли с учётом наследования. У неизвестной роли прав нет
+func (r *Registry) Permissions(role string) []string {
+	return slices.Clone(r.permissions[role])
+}
+
+func (r *Registry) Has(role, permission string) bool {
+	_, found := slices.BinarySearch(r.permissions[role], permission)
+	return found
+}
+
+// DefaultRegistry - guest, user и admin. Регистрироваться можно только как guest или user
+func DefaultRegistry() *Registry {
+	r, err := NewRegistry(RoleUser,
+		Role{Name: RoleGuest, Permissions: []string{"profile:read"}, SelfAssignable: true},
+		Role{Name: RoleUser, Inherits: []string{RoleGuest}, Permissions: []string{"profile:write"}, SelfAssignable: true},
+		Role{Name: RoleAdmin, Inherits: []string{RoleUser}, Permissions: []string{
+			PermUsersRead, PermUsersWrite, PermRolesGrant, PermLockoutsManage, PermAuditRead,
+		}},
+	)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// LoadFile читает реестр из JSON файла вида {"default": "user", "roles": [{"name": "user", ...}]}
+func LoadFile(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := struct {
+		Default string `json:"default"`
+		Roles   []Role `json:"roles"`
+	}{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	r, err := NewRegistry(file.Default, file.Roles...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,87 @@
+package rbac
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultRegistry(t *testing.T) {
+	r := DefaultRegistry()
+
+	assert.Equal(t, RoleUser, r.Default())
+	assert.True(t, r.SelfAssignable(RoleGuest))
+	assert.True(t, r.SelfAssignable(RoleUser))
+	assert.False(t, r.SelfAssignable(RoleAdmin))
+	assert.False(t, r.Exists("student"))
+
+	// Права наследуются через всю цепочку admin -> user -> guest
+	assert.Equal(t, []string{"profile:read", "profile:write"}, r.Permissions(RoleUser))
+	assert.True(t, r.Has(RoleAdmin, "profile:read"))
+	assert.True(t, r.Has(RoleAdmin, PermRolesGrant))
+	assert.False(t, r.Has(RoleUser, PermRolesGrant))
+	assert.False(t, r.Has("student", "profile:read"))
+	assert.Empty(t, r.Permissions("student"))
+}
+
+func TestNewRegistry(t *testing.T) {
+	cases := []struct {
+		name  string
+		def   string
+		roles []Role
+	}{
+		{"unknown default", "user", []Role{{Name: "guest", SelfAssignable: true}}},
+		{"default not self-assignable", "admin", []Role{{Name: "admin"}}},
+		{"duplicate", "user", []Role{{Name: "user", SelfAssignable: true}, {Name: "user"}}},
+		{"empty name", "user", []Role{{Name: "user", SelfAssignable: true}, {}}},
+		{"unknown parent", "user", []Role{{Name: "user", Inherits: []string{"guest"}, SelfAssignable: true}}},
+		{"cycle", "a", []Role{
+			{Name: "a", Inherits: []string{"b"}, SelfAssignable: true},
+			{Name: "b", Inherits: []string{"c"}},
+			{Name: "c", Inherits: []string{"a"}},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewRegistry(c.def, c.roles...)
+			assert.Error(t, err)
+		})
+	}
+
+	// Ромбовидное наследование не цикл, общие права не дублируются
+	r, err := NewRegistry("a",
+		Role{Name: "a", Inherits: []string{"b", "c"}, SelfAssignable: true},
+		Role{Name: "b", Inherits: []string{"d"}, Permissions: []string{"b"}},
+		Role{Name: "c", Inherits: []string{"d"}, Permissions: []string{"c"}},
+		Role{Name: "d", Permissions: []string{"d"}},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "d"}, r.Permissions("a"))
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roles.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"default": "student",
+		"roles": [
+			{"name": "student", "permissions": ["courses:read"], "self_assignable": true},
+			{"name": "teacher", "inherits": ["student"], "permissions": ["courses:write"]}
+		]
+	}`), 0o600))
+
+	r, err := LoadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "student", r.Default())
+	assert.Equal(t, []string{"courses:read", "courses:write"}, r.Permissions("teacher"))
+	assert.False(t, r.SelfAssignable("teacher"))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"default": "student", "roles": []}`), 0o600))
+	_, err = LoadFile(path)
+	assert.ErrorIs(t, err, ErrUnknownRole)
+
+	_, err = LoadFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,114 @@
+// Пакет file содержит хранилища в локальных файлах
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+)
+
+// Запись журнала аудита - одна строка JSON
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Result    string    `json:"result"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// FileAuditStorage дописывает журнал аудита в файл JSON Lines. Выборка читает файл целиком,
+// поэтому подходит для небольших установок или при внешней ротации файла
+type FileAuditStorage struct {
+	mu   sync.Mutex
+	path string
+	log  *slog.Logger
+}
+
+func NewFileAuditStorage(path string, log *slog.Logger) (storage.AuditStorage, error) {
+	// Проверяем, что файл доступен для записи, до первой записи
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+
+	return &FileAuditStorage{path: path, log: log}, nil
+}
+
+func (s *FileAuditStorage) AddRecord(ctx context.Context, rec *model.AuditRecord) error {
+	line, err := json.Marshal(auditRecord(*rec))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	// Строка пишется одним вызовом, чтобы записи других процессов не вклинивались в неё
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *FileAuditStorage) ListRecords(ctx context.Context, filter model.AuditFilter) ([]model.AuditRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []model.AuditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := auditRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			// Например, строка, оборванная при аварийном завершении
+			s.log.ErrorContext(ctx, "malformed audit record", sl.Err(err), "path", s.path)
+			continue
+		}
+		rec := model.AuditRecord(line)
+		if !filter.Match(rec) {
+			continue
+		}
+		records = append(records, rec)
+		if filter.Limit > 0 && len(records) == filter.Limit {
+			break
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *FileAuditStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
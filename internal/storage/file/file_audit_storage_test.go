@@ -0,0 +1,44 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+	"lk-auth/internal/storage/storagetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileAuditStorage(t *testing.T) {
+	storagetest.RunAuditSuite(t, func(t *testing.T) storage.AuditStorage {
+		s, err := NewFileAuditStorage(filepath.Join(t.TempDir(), "audit.jsonl"), nil)
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func TestFileAuditStorageSkipsMalformedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	s, err := NewFileAuditStorage(path, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, s.AddRecord(context.Background(), &model.AuditRecord{Action: "auth.login", Result: "success"}))
+	// Строка, оборванная при аварийном завершении
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"action":"auth.lo`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	records, err := s.ListRecords(context.Background(), model.AuditFilter{})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	_, err = NewFileAuditStorage(filepath.Join(t.TempDir(), "missing", "audit.jsonl"), nil)
+	assert.Error(t, err)
+}
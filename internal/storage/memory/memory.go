@@ -0,0 +1,84 @@
+// Пакет memory хранит данные в памяти процесса.
+// Используется для локальной разработки и тестов (REDIS_URL=memory://): данные теряются при перезапуске
+// и не разделяются между репликами.
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// URL, при котором вместо Redis используются хранилища в памяти
+const URL = "memory://"
+
+type entry[V any] struct {
+	value V
+	// Нулевое значение означает запись без срока жизни
+	expiresAt time.Time
+}
+
+func (e entry[V]) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// expiringMap - словарь с временем жизни записей, аналог ключей Redis с TTL.
+// Не потокобезопасен: синхронизацию обеспечивает хранилище, которому он принадлежит.
+type expiringMap[V any] map[string]entry[V]
+
+func (m expiringMap[V]) get(key string, now time.Time) (V, bool) {
+	e, ok := m[key]
+	if !ok || e.expired(now) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// ttl <= 0 означает запись без срока жизни, как у SET без EX в Redis
+func (m expiringMap[V]) set(key string, value V, ttl time.Duration, now time.Time) {
+	e := entry[V]{value: value}
+	if ttl > 0 {
+		e.expiresAt = now.Add(ttl)
+	}
+	m[key] = e
+}
+
+func (m expiringMap[V]) sweep(now time.Time) {
+	for key, e := range m {
+		if e.expired(now) {
+			delete(m, key)
+		}
+	}
+}
+
+// startSweeper периодически удаляет истёкшие записи, чтобы память не росла.
+// Корректность от него не зависит: истёкшие записи не возвращаются и до удаления.
+func startSweeper(ctx context.Context, wg *sync.WaitGroup, name string, interval time.Duration, log *slog.Logger, sweep func()) {
+	wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug(name + " sweeper goroutine stopped")
+				wg.Done()
+				return
+			case <-ticker.C:
+				sweep()
+			}
+		}
+	}()
+}
+
+func defaultLogger(log *slog.Logger) *slog.Logger {
+	if log != nil {
+		return log
+	}
+	return slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+)
+
+type MemoryAuditStorage struct {
+	mu      sync.Mutex
+	records []model.AuditRecord
+	log     *slog.Logger
+}
+
+func NewMemoryAuditStorage(log *slog.Logger) (storage.AuditStorage, error) {
+	return &MemoryAuditStorage{
+		log: defaultLogger(log),
+	}, nil
+}
+
+func (s *MemoryAuditStorage) AddRecord(ctx context.Context, rec *model.AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = append(s.records, *rec)
+	return nil
+}
+
+func (s *MemoryAuditStorage) ListRecords(ctx context.Context, filter model.AuditFilter) ([]model.AuditRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []model.AuditRecord
+	for _, rec := range s.records {
+		if filter.Match(rec) {
+			records = append(records, rec)
+		}
+	}
+	// Записи параллельных запросов могут добавиться не в порядке времени
+	slices.SortStableFunc(records, func(a, b model.AuditRecord) int {
+		return a.Time.Compare(b.Time)
+	})
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[:filter.Limit]
+	}
+	return records, nil
+}
+
+func (s *MemoryAuditStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"lk-auth/internal/service/jwt"
+	"lk-auth/internal/storage"
+)
+
+type MemoryBlackListStorage struct {
+	mu         sync.Mutex
+	tokens     expiringMap[struct{}]
+	jwtService jwt.JWTService
+	now        func() time.Time
+
+	log *slog.Logger
+}
+
+func NewMemoryBlackListStorage(ctx context.Context, wg *sync.WaitGroup, jwtService jwt.JWTService, log *slog.Logger, sweepTime time.Duration) (storage.BlackListStorage, error) {
+	log = defaultLogger(log)
+	s := &MemoryBlackListStorage{
+		tokens:     expiringMap[struct{}]{},
+		jwtService: jwtService,
+		now:        time.Now,
+		log:        log,
+	}
+	startSweeper(ctx, wg, "MemoryBlackListStorage", sweepTime, log, s.sweep)
+
+	return s, nil
+}
+
+// Токен хранится в чёрном списке до истечения его срока действия
+func (s *MemoryBlackListStorage) AddTokens(ctx context.Context, tokens ...string) error {
+	// Подпись проверяется до блокировки, чтобы не задерживать IsAllowed на каждом запросе
+	expires := make(map[string]time.Time, len(tokens))
+	for _, token := range tokens {
+		claims, err := s.jwtService.GetTokenClaims(ctx, token)
+		if err != nil {
+			continue
+		}
+
+		exp, ok := claims["exp"].(float64)
+		if !ok {
+			s.log.ErrorContext(ctx, "token expiration claim is not a number", "exp", claims["exp"])
+			return errors.New("token expiration claim is not a number")
+		}
+		expires[token] = time.Unix(int64(exp), 0)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for token, exp := range expires {
+		dur := exp.Sub(now)
+		if dur <= 0 {
+			// Истёкший токен и так не пройдёт проверку
+			continue
+		}
+		s.tokens.set(token, struct{}{}, dur, now)
+	}
+	return nil
+}
+
+func (s *MemoryBlackListStorage) IsAllowed(ctx context.Context, token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, blocked := s.tokens.get(token, s.now())
+	return !blocked, nil
+}
+
+func (s *MemoryBlackListStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
+
+func (s *MemoryBlackListStorage) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens.sweep(s.now())
+}
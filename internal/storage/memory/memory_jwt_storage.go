@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"lk-auth/internal/storage"
+)
+
+type MemoryJWTStorage struct {
+	mu       sync.Mutex
+	pairs    expiringMap[string]
+	families expiringMap[string]
+	ttl      time.Duration
+	now      func() time.Time
+	log      *slog.Logger
+}
+
+// sweepTime - период удаления истёкших записей
+func NewMemoryJWTStorage(ctx context.Context, wg *sync.WaitGroup, ttl time.Duration, log *slog.Logger, sweepTime time.Duration) (storage.JWTStorage, error) {
+	log = defaultLogger(log)
+	s := &MemoryJWTStorage{
+		pairs:    expiringMap[string]{},
+		families: expiringMap[string]{},
+		ttl:      ttl,
+		now:      time.Now,
+		log:      log,
+	}
+	startSweeper(ctx, wg, "MemoryJWTStorage", sweepTime, log, s.sweep)
+
+	return s, nil
+}
+
+func (s *MemoryJWTStorage) AddPair(ctx context.Context, access string, refresh string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pairs.set(refresh, access, s.ttl, s.now())
+	return nil
+}
+
+func (s *MemoryJWTStorage) GetAccessByRefresh(ctx context.Context, refresh string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	access, ok := s.pairs.get(refresh, s.now())
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	delete(s.pairs, refresh)
+
+	return access, nil
+}
+
+func (s *MemoryJWTStorage) AddFamily(ctx context.Context, family, refresh string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.families.set(family, refresh, s.ttl, s.now())
+	return nil
+}
+
+func (s *MemoryJWTStorage) RotateFamily(ctx context.Context, family, current, next string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	head, ok := s.families.get(family, now)
+	if !ok {
+		return false, storage.ErrNotFound
+	}
+	if head != current {
+		return false, nil
+	}
+	s.families.set(family, next, s.ttl, now)
+
+	return true, nil
+}
+
+func (s *MemoryJWTStorage) GetFamilyHead(ctx context.Context, family string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	head, ok := s.families.get(family, s.now())
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+
+	return head, nil
+}
+
+func (s *MemoryJWTStorage) DeleteFamily(ctx context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.families, family)
+	return nil
+}
+
+func (s *MemoryJWTStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
+
+func (s *MemoryJWTStorage) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.pairs.sweep(now)
+	s.families.sweep(now)
+}
@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"lk-auth/internal/storage"
+)
+
+type MemoryLockoutStorage struct {
+	mu       sync.Mutex
+	failures expiringMap[int64]
+	// Значение - момент окончания блокировки
+	locks expiringMap[time.Time]
+	now   func() time.Time
+	log   *slog.Logger
+}
+
+// sweepTime - период удаления истёкших записей
+func NewMemoryLockoutStorage(ctx context.Context, wg *sync.WaitGroup, log *slog.Logger, sweepTime time.Duration) (storage.LockoutStorage, error) {
+	log = defaultLogger(log)
+	s := &MemoryLockoutStorage{
+		failures: expiringMap[int64]{},
+		locks:    expiringMap[time.Time]{},
+		now:      time.Now,
+		log:      log,
+	}
+	startSweeper(ctx, wg, "MemoryLockoutStorage", sweepTime, log, s.sweep)
+
+	return s, nil
+}
+
+func (s *MemoryLockoutStorage) AddFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	failures, _ := s.failures.get(key, now)
+	failures++
+	s.failures.set(key, failures, window, now)
+
+	return failures, nil
+}
+
+func (s *MemoryLockoutStorage) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	until := now.Add(ttl)
+	if current, ok := s.locks.get(key, now); ok && current.After(until) {
+		return nil
+	}
+	s.locks.set(key, until, ttl, now)
+
+	return nil
+}
+
+func (s *MemoryLockoutStorage) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	until, ok := s.locks.get(key, now)
+	if !ok {
+		return 0, nil
+	}
+
+	return until.Sub(now), nil
+}
+
+func (s *MemoryLockoutStorage) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	delete(s.locks, key)
+	return nil
+}
+
+func (s *MemoryLockoutStorage) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.failures.sweep(now)
+	s.locks.sweep(now)
+}
+
+func (s *MemoryLockoutStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+)
+
+type MemoryMFAStorage struct {
+	mu       sync.Mutex
+	settings map[string]model.MFA
+	log      *slog.Logger
+}
+
+func NewMemoryMFAStorage(log *slog.Logger) (storage.MFAStorage, error) {
+	return &MemoryMFAStorage{
+		settings: map[string]model.MFA{},
+		log:      defaultLogger(log),
+	}, nil
+}
+
+func (s *MemoryMFAStorage) GetMFA(ctx context.Context, email string) (*model.MFA, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mfa, ok := s.settings[email]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	mfa.RecoveryCodes = slices.Clone(mfa.RecoveryCodes)
+
+	return &mfa, nil
+}
+
+func (s *MemoryMFAStorage) SetMFA(ctx context.Context, email string, mfa *model.MFA) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *mfa
+	stored.RecoveryCodes = slices.Clone(mfa.RecoveryCodes)
+	s.settings[email] = stored
+
+	return nil
+}
+
+func (s *MemoryMFAStorage) DeleteMFA(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.settings, email)
+	return nil
+}
+
+func (s *MemoryMFAStorage) UseRecoveryCode(ctx context.Context, email, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mfa, ok := s.settings[email]
+	if !ok {
+		return false, nil
+	}
+	i := slices.Index(mfa.RecoveryCodes, codeHash)
+	if i == -1 {
+		return false, nil
+	}
+	mfa.RecoveryCodes = slices.Delete(mfa.RecoveryCodes, i, i+1)
+	s.settings[email] = mfa
+
+	return true, nil
+}
+
+func (s *MemoryMFAStorage) UseTOTPCounter(ctx context.Context, email string, counter int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mfa, ok := s.settings[email]
+	if !ok {
+		return false, storage.ErrNotFound
+	}
+	if counter <= mfa.LastCounter {
+		return false, nil
+	}
+	mfa.LastCounter = counter
+	s.settings[email] = mfa
+
+	return true, nil
+}
+
+func (s *MemoryMFAStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
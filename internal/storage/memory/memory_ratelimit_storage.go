@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+)
+
+// slidingWindow - счётчики текущего и предыдущего окна ключа
+type slidingWindow struct {
+	// Номер текущего окна: время от начала эпохи, делённое на длину окна
+	index   int64
+	current int64
+	prev    int64
+}
+
+type MemoryRateLimitStorage struct {
+	mu      sync.Mutex
+	windows expiringMap[slidingWindow]
+	now     func() time.Time
+	log     *slog.Logger
+}
+
+// sweepTime - период удаления истёкших записей
+func NewMemoryRateLimitStorage(ctx context.Context, wg *sync.WaitGroup, log *slog.Logger, sweepTime time.Duration) (storage.RateLimitStorage, error) {
+	log = defaultLogger(log)
+	s := &MemoryRateLimitStorage{
+		windows: expiringMap[slidingWindow]{},
+		now:     time.Now,
+		log:     log,
+	}
+	startSweeper(ctx, wg, "MemoryRateLimitStorage", sweepTime, log, s.sweep)
+
+	return s, nil
+}
+
+// Вычисления ведутся в миллисекундах, как и в Lua-скрипте RedisRateLimitStorage, чтобы бэкенды считали одинаково
+func (s *MemoryRateLimitStorage) Hit(ctx context.Context, key string, limit int64, window time.Duration) (model.RateLimit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	windowMs := window.Milliseconds()
+	nowMs := now.UnixMilli()
+	index := nowMs / windowMs
+	elapsed := nowMs - index*windowMs
+
+	w, _ := s.windows.get(key, now)
+	switch w.index {
+	case index:
+	case index - 1:
+		w = slidingWindow{index: index, prev: w.current}
+	default:
+		w = slidingWindow{index: index}
+	}
+
+	result := model.RateLimit{Limit: limit}
+	estimate := float64(w.prev)*float64(windowMs-elapsed)/float64(windowMs) + float64(w.current)
+	if estimate+1 > float64(limit) {
+		var retryMs float64
+		if w.current >= limit {
+			// Текущее окно уже исчерпано: ждём его конца и пока его доля в следующем окне не уменьшится
+			retryMs = float64(windowMs-elapsed) + float64(windowMs)*(1-float64(limit-1)/float64(w.current))
+		} else {
+			retryMs = float64(windowMs)*(1-float64(limit-1-w.current)/float64(w.prev)) - float64(elapsed)
+		}
+		result.RetryAfter = time.Duration(max(math.Ceil(retryMs), 1)) * time.Millisecond
+		result.Reset = result.RetryAfter
+		return result, nil
+	}
+
+	w.current++
+	s.windows.set(key, w, time.Duration(2*windowMs-elapsed)*time.Millisecond, now)
+
+	result.Allowed = true
+	result.Remaining = max(int64(math.Floor(float64(limit)-estimate-1)), 0)
+	result.Reset = time.Duration(windowMs-elapsed) * time.Millisecond
+	return result, nil
+}
+
+func (s *MemoryRateLimitStorage) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.windows.sweep(s.now())
+}
+
+func (s *MemoryRateLimitStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
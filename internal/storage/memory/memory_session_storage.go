@@ -0,0 +1,154 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+)
+
+type MemorySessionStorage struct {
+	mu       sync.Mutex
+	sessions expiringMap[model.Session]
+	// email -> идентификаторы сессий пользователя
+	byUser map[string]map[string]struct{}
+	ttl    time.Duration
+	now    func() time.Time
+	log    *slog.Logger
+}
+
+// ttl - время жизни сессии без использования, совпадает с временем жизни refresh токена
+func NewMemorySessionStorage(ctx context.Context, wg *sync.WaitGroup, ttl time.Duration, log *slog.Logger, sweepTime time.Duration) (storage.SessionStorage, error) {
+	log = defaultLogger(log)
+	s := &MemorySessionStorage{
+		sessions: expiringMap[model.Session]{},
+		byUser:   map[string]map[string]struct{}{},
+		ttl:      ttl,
+		now:      time.Now,
+		log:      log,
+	}
+	startSweeper(ctx, wg, "MemorySessionStorage", sweepTime, log, s.sweep)
+
+	return s, nil
+}
+
+func (s *MemorySessionStorage) AddSession(ctx context.Context, session *model.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Время хранится с точностью до секунды, как и в Redis
+	stored := *session
+	stored.CreatedAt = time.Unix(session.CreatedAt.Unix(), 0)
+	stored.LastUsedAt = time.Unix(session.LastUsedAt.Unix(), 0)
+
+	s.sessions.set(session.ID, stored, s.ttl, s.now())
+	ids, ok := s.byUser[session.Email]
+	if !ok {
+		ids = map[string]struct{}{}
+		s.byUser[session.Email] = ids
+	}
+	ids[session.ID] = struct{}{}
+
+	return nil
+}
+
+func (s *MemorySessionStorage) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions.get(id, s.now())
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &session, nil
+}
+
+func (s *MemorySessionStorage) ListSessions(ctx context.Context, email string) ([]model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	ids := s.byUser[email]
+	sessions := make([]model.Session, 0, len(ids))
+	for id := range ids {
+		session, ok := s.sessions.get(id, now)
+		if !ok {
+			// Сессия истекла, убираем её из индекса
+			delete(ids, id)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	if len(ids) == 0 {
+		delete(s.byUser, email)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (s *MemorySessionStorage) TouchSession(ctx context.Context, id string, client model.ClientInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	session, ok := s.sessions.get(id, now)
+	if !ok {
+		return storage.ErrNotFound
+	}
+	session.LastUsedAt = time.Unix(now.Unix(), 0)
+	session.IP = client.IP
+	session.UserAgent = client.UserAgent
+	s.sessions.set(id, session, s.ttl, now)
+
+	return nil
+}
+
+func (s *MemorySessionStorage) DeleteSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions.get(id, s.now())
+	if !ok {
+		return nil
+	}
+	delete(s.sessions, id)
+	if ids, ok := s.byUser[session.Email]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(s.byUser, session.Email)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
+
+func (s *MemorySessionStorage) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for id, e := range s.sessions {
+		if !e.expired(now) {
+			continue
+		}
+		delete(s.sessions, id)
+		if ids, ok := s.byUser[e.value.Email]; ok {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(s.byUser, e.value.Email)
+			}
+		}
+	}
+}
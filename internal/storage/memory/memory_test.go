@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"lk-auth/internal/service/jwt"
+	"lk-auth/internal/storage"
+	"lk-auth/internal/storage/storagetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// clock подменяет time.Now, чтобы проверять истечение записей без ожидания
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newClock() *clock {
+	return &clock{now: time.Now()}
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newWaitGroup(t *testing.T) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+	t.Cleanup(wg.Wait)
+	return wg
+}
+
+func TestMemoryJWTStorage(t *testing.T) {
+	storagetest.RunJWTSuite(t, func(t *testing.T, ttl time.Duration) (storage.JWTStorage, storagetest.Advance) {
+		s, err := NewMemoryJWTStorage(t.Context(), newWaitGroup(t), ttl, nil, time.Minute)
+		require.NoError(t, err)
+		c := newClock()
+		s.(*MemoryJWTStorage).now = c.Now
+		return s, c.Advance
+	})
+}
+
+func TestMemoryBlackListStorage(t *testing.T) {
+	storagetest.RunBlackListSuite(t, func(t *testing.T, jwtService jwt.JWTService) (storage.BlackListStorage, storagetest.Advance) {
+		s, err := NewMemoryBlackListStorage(t.Context(), newWaitGroup(t), jwtService, nil, time.Minute)
+		require.NoError(t, err)
+		c := newClock()
+		s.(*MemoryBlackListStorage).now = c.Now
+		return s, c.Advance
+	})
+}
+
+func TestMemoryUserStorage(t *testing.T) {
+	storagetest.RunUserSuite(t, func(t *testing.T) storage.UserStorage {
+		s, err := NewMemoryUserStorage(nil, nil)
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func TestMemorySessionStorage(t *testing.T) {
+	storagetest.RunSessionSuite(t, func(t *testing.T, ttl time.Duration) (storage.SessionStorage, storagetest.Advance) {
+		s, err := NewMemorySessionStorage(t.Context(), newWaitGroup(t), ttl, nil, time.Minute)
+		require.NoError(t, err)
+		c := newClock()
+		s.(*MemorySessionStorage).now = c.Now
+		return s, c.Advance
+	})
+}
+
+func TestMemoryMFAStorage(t *testing.T) {
+	storagetest.RunMFASuite(t, func(t *testing.T) storage.MFAStorage {
+		s, err := NewMemoryMFAStorage(nil)
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func TestMemoryWebAuthnStorage(t *testing.T) {
+	storagetest.RunWebAuthnSuite(t, func(t *testing.T) (storage.WebAuthnStorage, storagetest.Advance) {
+		s, err := NewMemoryWebAuthnStorage(t.Context(), newWaitGroup(t), nil, time.Minute)
+		require.NoError(t, err)
+		c := newClock()
+		s.(*MemoryWebAuthnStorage).now = c.Now
+		return s, c.Advance
+	})
+}
+
+func TestMemoryLockoutStorage(t *testing.T) {
+	storagetest.RunLockoutSuite(t, func(t *testing.T) (storage.LockoutStorage, storagetest.Advance) {
+		s, err := NewMemoryLockoutStorage(t.Context(), newWaitGroup(t), nil, time.Minute)
+		require.NoError(t, err)
+		c := newClock()
+		s.(*MemoryLockoutStorage).now = c.Now
+		return s, c.Advance
+	})
+}
+
+func TestMemoryRateLimitStorage(t *testing.T) {
+	storagetest.RunRateLimitSuite(t, func(t *testing.T) (storage.RateLimitStorage, storagetest.Advance) {
+		s, err := NewMemoryRateLimitStorage(t.Context(), newWaitGroup(t), nil, time.Minute)
+		require.NoError(t, err)
+		c := newClock()
+		s.(*MemoryRateLimitStorage).now = c.Now
+		return s, c.Advance
+	})
+}
+
+func TestMemoryOneTimeTokenStorage(t *testing.T) {
+	storagetest.RunOneTimeTokenSuite(t, func(t *testing.T) (storage.OneTimeTokenStorage, storagetest.Advance) {
+		s, err := NewMemoryOneTimeTokenStorage(t.Context(), newWaitGroup(t), nil, time.Minute)
+		require.NoError(t, err)
+		c := newClock()
+		s.(*MemoryOneTimeTokenStorage).now = c.Now
+		return s, c.Advance
+	})
+}
+
+func TestSweep(t *testing.T) {
+	c := newClock()
+	m := expiringMap[string]{}
+	m.set("short", "value", time.Minute, c.Now())
+	m.set("long", "value", time.Hour, c.Now())
+	m.set("forever", "value", 0, c.Now())
+
+	c.Advance(time.Minute)
+	_, ok := m.get("short", c.Now())
+	require.False(t, ok)
+
+	m.sweep(c.Now())
+	require.Len(t, m, 2)
+	require.Contains(t, m, "long")
+	require.Contains(t, m, "forever")
+}
+
+func TestMemoryAuditStorage(t *testing.T) {
+	storagetest.RunAuditSuite(t, func(t *testing.T) storage.AuditStorage {
+		s, err := NewMemoryAuditStorage(nil)
+		require.NoError(t, err)
+		return s
+	})
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+)
+
+type MemoryOneTimeTokenStorage struct {
+	mu     sync.Mutex
+	tokens expiringMap[model.OneTimeToken]
+	now    func() time.Time
+	log    *slog.Logger
+}
+
+// sweepTime - период удаления истёкших записей
+func NewMemoryOneTimeTokenStorage(ctx context.Context, wg *sync.WaitGroup, log *slog.Logger, sweepTime time.Duration) (storage.OneTimeTokenStorage, error) {
+	log = defaultLogger(log)
+	s := &MemoryOneTimeTokenStorage{
+		tokens: expiringMap[model.OneTimeToken]{},
+		now:    time.Now,
+		log:    log,
+	}
+	startSweeper(ctx, wg, "MemoryOneTimeTokenStorage", sweepTime, log, s.sweep)
+
+	return s, nil
+}
+
+func (s *MemoryOneTimeTokenStorage) SaveToken(ctx context.Context, hash string, token *model.OneTimeToken, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens.set(hash, *token, ttl, s.now())
+	return nil
+}
+
+func (s *MemoryOneTimeTokenStorage) GetToken(ctx context.Context, hash string) (*model.OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens.get(hash, s.now())
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &token, nil
+}
+
+func (s *MemoryOneTimeTokenStorage) TakeToken(ctx context.Context, hash string) (*model.OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens.get(hash, s.now())
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	delete(s.tokens, hash)
+
+	return &token, nil
+}
+
+func (s *MemoryOneTimeTokenStorage) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens.sweep(s.now())
+}
+
+func (s *MemoryOneTimeTokenStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
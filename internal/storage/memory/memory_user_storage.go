@@ -0,0 +1,257 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/libs/hash"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+)
+
+var errUserNotFound = fmt.Errorf("user %w", storage.ErrNotFound)
+
+type MemoryUserStorage struct {
+	mu sync.RWMutex
+	// Ключ - email в нижнем регистре, см. userKey
+	users  map[string]model.User
+	hasher hash.PasswordHasher
+	log    *slog.Logger
+}
+
+// userKey приводит email к нижнему регистру: адреса сравниваются без учёта регистра
+func userKey(email string) string {
+	return strings.ToLower(email)
+}
+
+// Если hasher nil, используется [hash.Default]
+func NewMemoryUserStorage(hasher hash.PasswordHasher, log *slog.Logger) (storage.UserStorage, error) {
+	if hasher == nil {
+		hasher = hash.Default()
+	}
+	return &MemoryUserStorage{
+		users:  map[string]model.User{},
+		hasher: hasher,
+		log:    defaultLogger(log),
+	}, nil
+}
+
+// from UserProvider interface
+func (s *MemoryUserStorage) Login(ctx context.Context, email, password string) (float64, string, error) {
+	if email == "" || len(password) == 0 {
+		return -1, "", storage.ErrInvalidCredentials
+	}
+
+	s.mu.RLock()
+	user, ok := s.users[userKey(email)]
+	s.mu.RUnlock()
+	if !ok {
+		s.hasher.Simulate(password)
+		return -1, "", storage.ErrInvalidCredentials
+	}
+
+	valid, rehash := s.hasher.Verify(password, user.PasswordHash)
+	if len(user.PasswordHash) == 0 || !valid {
+		return -1, "", storage.ErrInvalidCredentials
+	}
+	if rehash {
+		s.rehash(ctx, email, user.PasswordHash, password)
+	}
+	if user.Disabled {
+		return -1, "", storage.ErrUserDisabled
+	}
+
+	return user.Version, user.Role, nil
+}
+
+// rehash заменяет устаревший хэш пароля, если его не изменили после проверки. Версия данных не меняется
+func (s *MemoryUserStorage) rehash(ctx context.Context, email, oldHash, password string) {
+	newHash, err := s.hasher.Hash(password)
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot rehash password", sl.Err(err), "email", email)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userKey(email)]
+	if !ok || user.PasswordHash != oldHash {
+		return
+	}
+	user.PasswordHash = newHash
+	s.users[userKey(email)] = user
+	s.log.InfoContext(ctx, "password rehashed", "email", email)
+}
+
+func (s *MemoryUserStorage) GetUser(ctx context.Context, email string) (*model.User, error) {
+	if len(email) == 0 {
+		return nil, errors.New("email cannot be empty")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userKey(email)]
+	if !ok {
+		return nil, errUserNotFound
+	}
+
+	return &user, nil
+}
+
+// from UserProvider interface
+func (s *MemoryUserStorage) IsVersionValid(ctx context.Context, email string, version float64) (bool, error) {
+	if len(email) == 0 {
+		return false, errors.New("email cannot be empty")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userKey(email)]
+	if !ok {
+		return false, errUserNotFound
+	}
+
+	return user.Version == version, nil
+}
+
+// метод для добавления пользователей в базу данных
+func (s *MemoryUserStorage) AddUser(ctx context.Context, user *model.User) error {
+	if user == nil {
+		return errors.New("user instance is nil")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userKey(user.Email)]; ok {
+		return storage.ErrAlreadyExists
+	}
+	s.users[userKey(user.Email)] = *user
+
+	return nil
+}
+
+func (s *MemoryUserStorage) IncrementVersion(ctx context.Context, email string) (float64, error) {
+	return s.update(email, func(user *model.User) {})
+}
+
+func (s *MemoryUserStorage) ChangePassword(ctx context.Context, email, passwordHash string) (float64, error) {
+	if passwordHash == "" {
+		return -1, errors.New("password hash cannot be empty")
+	}
+	return s.update(email, func(user *model.User) {
+		user.PasswordHash = passwordHash
+	})
+}
+
+func (s *MemoryUserStorage) ChangeRole(ctx context.Context, email, role string) (float64, error) {
+	if role == "" {
+		return -1, errors.New("role cannot be empty")
+	}
+	return s.update(email, func(user *model.User) {
+		user.Role = role
+	})
+}
+
+func (s *MemoryUserStorage) VerifyEmail(ctx context.Context, email string) error {
+	if len(email) == 0 {
+		return errors.New("email cannot be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userKey(email)]
+	if !ok {
+		return errUserNotFound
+	}
+	user.EmailVerified = true
+	s.users[userKey(email)] = user
+
+	return nil
+}
+
+func (s *MemoryUserStorage) SetDisabled(ctx context.Context, email string, disabled bool) (float64, error) {
+	return s.update(email, func(user *model.User) {
+		user.Disabled = disabled
+	})
+}
+
+func (s *MemoryUserStorage) DeleteUser(ctx context.Context, email string) error {
+	if len(email) == 0 {
+		return errors.New("email cannot be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userKey(email)]; !ok {
+		return errUserNotFound
+	}
+	delete(s.users, userKey(email))
+
+	return nil
+}
+
+// ListUsers возвращает пользователей по возрастанию email, next - email последнего из них
+func (s *MemoryUserStorage) ListUsers(ctx context.Context, query, cursor string, limit int) ([]model.User, string, error) {
+	if limit <= 0 {
+		return nil, "", errors.New("limit must be positive")
+	}
+	query = strings.ToLower(query)
+
+	s.mu.RLock()
+	emails := make([]string, 0, len(s.users))
+	for email := range s.users {
+		if email > cursor && strings.Contains(strings.ToLower(email), query) {
+			emails = append(emails, email)
+		}
+	}
+	slices.Sort(emails)
+
+	next := ""
+	if len(emails) > limit {
+		emails = emails[:limit]
+		next = emails[limit-1]
+	}
+	users := make([]model.User, len(emails))
+	for i, email := range emails {
+		users[i] = s.users[email]
+	}
+	s.mu.RUnlock()
+
+	return users, next, nil
+}
+
+// update изменяет пользователя и увеличивает версию данных под одной блокировкой
+func (s *MemoryUserStorage) update(email string, change func(*model.User)) (float64, error) {
+	if len(email) == 0 {
+		return -1, errors.New("email cannot be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userKey(email)]
+	if !ok {
+		return -1, errUserNotFound
+	}
+	change(&user)
+	user.Version++
+	s.users[userKey(email)] = user
+
+	return user.Version, nil
+}
+
+func (s *MemoryUserStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
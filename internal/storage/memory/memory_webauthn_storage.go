@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+)
+
+type MemoryWebAuthnStorage struct {
+	mu sync.Mutex
+	// Ключи по строке из байт ID
+	credentials map[string]model.WebAuthnCredential
+	ceremonies  expiringMap[[]byte]
+	now         func() time.Time
+	log         *slog.Logger
+}
+
+// sweepTime - период удаления истёкших церемоний
+func NewMemoryWebAuthnStorage(ctx context.Context, wg *sync.WaitGroup, log *slog.Logger, sweepTime time.Duration) (storage.WebAuthnStorage, error) {
+	log = defaultLogger(log)
+	s := &MemoryWebAuthnStorage{
+		credentials: map[string]model.WebAuthnCredential{},
+		ceremonies:  expiringMap[[]byte]{},
+		now:         time.Now,
+		log:         log,
+	}
+	startSweeper(ctx, wg, "MemoryWebAuthnStorage", sweepTime, log, s.sweep)
+
+	return s, nil
+}
+
+func (s *MemoryWebAuthnStorage) AddCredential(ctx context.Context, cred *model.WebAuthnCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.credentials[string(cred.ID)]; ok {
+		return storage.ErrAlreadyExists
+	}
+	s.credentials[string(cred.ID)] = cloneCredential(*cred)
+
+	return nil
+}
+
+func (s *MemoryWebAuthnStorage) GetCredential(ctx context.Context, id []byte) (*model.WebAuthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cred, ok := s.credentials[string(id)]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	cred = cloneCredential(cred)
+
+	return &cred, nil
+}
+
+func (s *MemoryWebAuthnStorage) ListCredentials(ctx context.Context, email string) ([]model.WebAuthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	creds := []model.WebAuthnCredential{}
+	for _, cred := range s.credentials {
+		if cred.Email == email {
+			creds = append(creds, cloneCredential(cred))
+		}
+	}
+	slices.SortFunc(creds, func(a, b model.WebAuthnCredential) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return creds, nil
+}
+
+func (s *MemoryWebAuthnStorage) UpdateSignCount(ctx context.Context, id []byte, signCount uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cred, ok := s.credentials[string(id)]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if signCount > cred.SignCount {
+		cred.SignCount = signCount
+		s.credentials[string(id)] = cred
+	}
+
+	return nil
+}
+
+func (s *MemoryWebAuthnStorage) DeleteCredentials(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, cred := range s.credentials {
+		if cred.Email == email {
+			delete(s.credentials, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryWebAuthnStorage) SaveCeremony(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ceremonies.set(id, slices.Clone(data), ttl, s.now())
+	return nil
+}
+
+func (s *MemoryWebAuthnStorage) TakeCeremony(ctx context.Context, id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.ceremonies.get(id, s.now())
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	delete(s.ceremonies, id)
+
+	return data, nil
+}
+
+func (s *MemoryWebAuthnStorage) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ceremonies.sweep(s.now())
+}
+
+func (s *MemoryWebAuthnStorage) ShutDown(shutDownCtx context.Context) error {
+	return nil
+}
+
+// Вызывающий не должен менять срезы внутри хранилища
+func cloneCredential(cred model.WebAuthnCredential) model.WebAuthnCredential {
+	cred.ID = slices.Clone(cred.ID)
+	cred.UserHandle = slices.Clone(cred.UserHandle)
+	cred.PublicKey = slices.Clone(cred.PublicKey)
+	cred.Transports = slices.Clone(cred.Transports)
+	cred.AAGUID = slices.Clone(cred.AAGUID)
+	return cred
+}
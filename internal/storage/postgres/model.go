@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"lk-auth/internal/domain/model"
+)
+
+type User struct {
+	Email         string
+	PasswordHash  string
+	Role          string
+	Version       int64
+	EmailVerified bool
+	Disabled      bool
+}
+
+func fromDomain(u *model.User) *User {
+	return &User{
+		Email:         u.Email,
+		PasswordHash:  u.PasswordHash,
+		Role:          u.Role,
+		Version:       int64(u.Version),
+		EmailVerified: u.EmailVerified,
+		Disabled:      u.Disabled,
+	}
+}
+
+func (u *User) toDomain() *model.User {
+	return &model.User{
+		Email:         u.Email,
+		PasswordHash:  u.PasswordHash,
+		Role:          u.Role,
+		Version:       float64(u.Version),
+		EmailVerified: u.EmailVerified,
+		Disabled:      u.Disabled,
+	}
+}
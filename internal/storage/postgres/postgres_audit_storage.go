@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresAuditStorage хранит журнал аудита в таблице audit_log
+type PostgresAuditStorage struct {
+	pool *pgxpool.Pool
+	log  *slog.Logger
+}
+
+// Схема таблицы audit_log создаётся миграциями (см. migrations/sql)
+func NewPostgresAuditStorage(ctx context.Context, wg *sync.WaitGroup, url string, log *slog.Logger, pingTime time.Duration) (storage.AuditStorage, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+
+	wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(pingTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug("PostgresAuditStorage ping goroutine stopped")
+				wg.Done()
+				return
+			case <-ticker.C:
+				if err := pool.Ping(ctx); err != nil {
+					log.Error("PostgresAuditStorage didn't answer", "host", pool.Config().ConnConfig.Host)
+				}
+			}
+		}
+	}()
+
+	return &PostgresAuditStorage{
+		pool: pool,
+		log:  log,
+	}, nil
+}
+
+func (s *PostgresAuditStorage) AddRecord(ctx context.Context, rec *model.AuditRecord) error {
+	_, err := s.pool.Exec(ctx,
+		`INSERT INTO audit_log (time, action, actor, subject, details, ip, user_agent, result, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		rec.Time, rec.Action, rec.Actor, rec.Subject, rec.Details, rec.IP, rec.UserAgent, rec.Result, rec.Reason,
+	)
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+	}
+	return err
+}
+
+func (s *PostgresAuditStorage) ListRecords(ctx context.Context, filter model.AuditFilter) ([]model.AuditRecord, error) {
+	// NULL вместо границы или LIMIT снимает ограничение
+	var from, to *time.Time
+	if !filter.From.IsZero() {
+		from = &filter.From
+	}
+	if !filter.To.IsZero() {
+		to = &filter.To
+	}
+	var limit *int
+	if filter.Limit > 0 {
+		limit = &filter.Limit
+	}
+
+	rows, err := s.pool.Query(ctx,
+		`SELECT time, action, actor, subject, details, ip, user_agent, result, reason FROM audit_log
+		WHERE ($1::timestamptz IS NULL OR time >= $1)
+			AND ($2::timestamptz IS NULL OR time < $2)
+			AND ($3 = '' OR actor = $3)
+			AND ($4 = '' OR subject = $4)
+			AND ($5 = '' OR action = $5)
+		ORDER BY time, id
+		LIMIT $6`,
+		from, to, filter.Actor, filter.Subject, filter.Action, limit,
+	)
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []model.AuditRecord
+	for rows.Next() {
+		rec := model.AuditRecord{}
+		err = rows.Scan(&rec.Time, &rec.Action, &rec.Actor, &rec.Subject, &rec.Details, &rec.IP, &rec.UserAgent, &rec.Result, &rec.Reason)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	if err = rows.Err(); err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *PostgresAuditStorage) ShutDown(shutDownCtx context.Context) error {
+	s.pool.Close()
+	return nil
+}
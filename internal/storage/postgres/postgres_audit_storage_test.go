@@ -0,0 +1,41 @@
+//go:build integration
+
+package postgres_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"lk-auth/internal/storage"
+	postgrespkg "lk-auth/internal/storage/postgres"
+	"lk-auth/internal/storage/storagetest"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// Набор тестов очищает таблицу audit_log, поэтому USERS_URL должен указывать на тестовую базу
+func TestPostgresAuditStorageSuite(t *testing.T) {
+	storagetest.RunAuditSuite(t, func(t *testing.T) storage.AuditStorage {
+		conn, err := pgx.Connect(t.Context(), os.Getenv("USERS_URL"))
+		require.NoError(t, err)
+		_, err = conn.Exec(t.Context(), `TRUNCATE audit_log`)
+		require.NoError(t, err)
+		require.NoError(t, conn.Close(t.Context()))
+
+		s, err := postgrespkg.NewPostgresAuditStorage(
+			context.Background(),
+			&sync.WaitGroup{},
+			os.Getenv("USERS_URL"),
+			slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})),
+			time.Second*30,
+		)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(context.Background()) })
+		return s
+	})
+}
@@ -0,0 +1,346 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/libs/hash"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Код ошибки нарушения уникальности (unique_violation)
+const uniqueViolation = "23505"
+
+var errUserNotFound = fmt.Errorf("user %w", storage.ErrNotFound)
+
+type PostgresUserStorage struct {
+	pool   *pgxpool.Pool
+	hasher hash.PasswordHasher
+	log    *slog.Logger
+}
+
+// Схема таблицы users создаётся миграциями (см. migrations/sql). Если hasher nil, используется [hash.Default]
+func NewPostgresUserStorage(ctx context.Context, wg *sync.WaitGroup, url string, hasher hash.PasswordHasher, log *slog.Logger, pingTime time.Duration) (storage.UserStorage, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+
+	wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(pingTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug("PostgresUserStorage ping goroutine stopped")
+				wg.Done()
+				return
+			case <-ticker.C:
+				if err := pool.Ping(ctx); err != nil {
+					log.Error("PostgresUserStorage didn't answer", "host", pool.Config().ConnConfig.Host)
+				}
+			}
+		}
+	}()
+
+	if hasher == nil {
+		hasher = hash.Default()
+	}
+
+	return &PostgresUserStorage{
+		pool:   pool,
+		hasher: hasher,
+		log:    log,
+	}, nil
+}
+
+// from UserProvider interface
+func (s *PostgresUserStorage) Login(ctx context.Context, email, password string) (float64, string, error) {
+	if email == "" || len(password) == 0 {
+		return -1, "", storage.ErrInvalidCredentials
+	}
+
+	user, err := s.getUser(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		s.hasher.Simulate(password)
+		return -1, "", storage.ErrInvalidCredentials
+	}
+	if err != nil {
+		return -1, "", err
+	}
+
+	valid, rehash := s.hasher.Verify(password, user.PasswordHash)
+	if len(user.PasswordHash) == 0 || !valid {
+		return -1, "", storage.ErrInvalidCredentials
+	}
+	if rehash {
+		s.rehash(ctx, user.Email, user.PasswordHash, password)
+	}
+	if user.Disabled {
+		return -1, "", storage.ErrUserDisabled
+	}
+
+	return user.Version, user.Role, nil
+}
+
+// rehash заменяет устаревший хэш пароля на хэш текущего алгоритма. Версия данных не меняется,
+// а ошибка только логируется: пароль уже проверен, и вход не должен от неё зависеть
+func (s *PostgresUserStorage) rehash(ctx context.Context, email, oldHash, password string) {
+	newHash, err := s.hasher.Hash(password)
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot rehash password", sl.Err(err), "email", email)
+		return
+	}
+
+	// Условие на старый хэш не даёт затереть пароль, сменённый после проверки
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE users SET password_hash = $3 WHERE lower(email) = lower($1) AND password_hash = $2`,
+		email, oldHash, newHash,
+	)
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot rehash password", sl.Err(err), "email", email)
+		return
+	}
+	if tag.RowsAffected() == 1 {
+		s.log.InfoContext(ctx, "password rehashed", "email", email)
+	}
+}
+
+func (s *PostgresUserStorage) GetUser(ctx context.Context, email string) (*model.User, error) {
+	if len(email) == 0 {
+		return nil, errors.New("email cannot be empty")
+	}
+	return s.getUser(ctx, email)
+}
+
+// from UserProvider interface
+func (s *PostgresUserStorage) IsVersionValid(ctx context.Context, email string, version float64) (bool, error) {
+	if len(email) == 0 {
+		return false, errors.New("email cannot be empty")
+	}
+
+	var current int64
+	err := s.pool.QueryRow(ctx,
+		`SELECT version FROM users WHERE lower(email) = lower($1)`,
+		email,
+	).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, errUserNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return float64(current) == version, nil
+}
+
+// метод для добавления пользователей в базу данных
+func (s *PostgresUserStorage) AddUser(ctx context.Context, user *model.User) error {
+	if user == nil {
+		return errors.New("user instance is nil")
+	}
+
+	row := fromDomain(user)
+	if row.Version < 1 {
+		row.Version = 1
+	}
+	_, err := s.pool.Exec(ctx,
+		`INSERT INTO users (email, password_hash, role, version, email_verified, disabled) VALUES ($1, $2, $3, $4, $5, $6)`,
+		row.Email, row.PasswordHash, row.Role, row.Version, row.EmailVerified, row.Disabled,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return storage.ErrAlreadyExists
+	}
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+	}
+	return err
+}
+
+func (s *PostgresUserStorage) IncrementVersion(ctx context.Context, email string) (float64, error) {
+	return s.updateReturningVersion(ctx,
+		`UPDATE users SET version = version + 1, updated_at = now()
+		WHERE lower(email) = lower($1)
+		RETURNING version`,
+		email,
+	)
+}
+
+func (s *PostgresUserStorage) ChangePassword(ctx context.Context, email, passwordHash string) (float64, error) {
+	if passwordHash == "" {
+		return -1, errors.New("password hash cannot be empty")
+	}
+	// Одна инструкция UPDATE выполняется атомарно: хэш и версия меняются вместе
+	return s.updateReturningVersion(ctx,
+		`UPDATE users SET password_hash = $2, version = version + 1, updated_at = now()
+		WHERE lower(email) = lower($1)
+		RETURNING version`,
+		email, passwordHash,
+	)
+}
+
+func (s *PostgresUserStorage) ChangeRole(ctx context.Context, email, role string) (float64, error) {
+	if role == "" {
+		return -1, errors.New("role cannot be empty")
+	}
+	return s.updateReturningVersion(ctx,
+		`UPDATE users SET role = $2, version = version + 1, updated_at = now()
+		WHERE lower(email) = lower($1)
+		RETURNING version`,
+		email, role,
+	)
+}
+
+func (s *PostgresUserStorage) SetDisabled(ctx context.Context, email string, disabled bool) (float64, error) {
+	return s.updateReturningVersion(ctx,
+		`UPDATE users SET disabled = $2, version = version + 1, updated_at = now()
+		WHERE lower(email) = lower($1)
+		RETURNING version`,
+		email, disabled,
+	)
+}
+
+func (s *PostgresUserStorage) DeleteUser(ctx context.Context, email string) error {
+	if len(email) == 0 {
+		return errors.New("email cannot be empty")
+	}
+
+	tag, err := s.pool.Exec(ctx, `DELETE FROM users WHERE lower(email) = lower($1)`, email)
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// ListUsers возвращает пользователей по возрастанию email без учёта регистра, next - email последнего из них.
+// Поиск по подстроке не использует индекс, но для административного интерфейса этого достаточно
+func (s *PostgresUserStorage) ListUsers(ctx context.Context, query, cursor string, limit int) ([]model.User, string, error) {
+	if limit <= 0 {
+		return nil, "", errors.New("limit must be positive")
+	}
+
+	// Символы шаблона LIKE в строке поиска ищутся буквально
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(query)) + "%"
+	rows, err := s.pool.Query(ctx,
+		`SELECT email, password_hash, role, version, email_verified, disabled FROM users
+		WHERE lower(email) LIKE $1 AND lower(email) > lower($2)
+		ORDER BY lower(email)
+		LIMIT $3`,
+		pattern, cursor, limit+1,
+	)
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user := User{}
+		if err = rows.Scan(&user.Email, &user.PasswordHash, &user.Role, &user.Version, &user.EmailVerified, &user.Disabled); err != nil {
+			return nil, "", err
+		}
+		users = append(users, *user.toDomain())
+	}
+	if err = rows.Err(); err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return nil, "", err
+	}
+
+	next := ""
+	if len(users) > limit {
+		users = users[:limit]
+		next = users[limit-1].Email
+	}
+	return users, next, nil
+}
+
+// Экранирует символы шаблона LIKE. Обратная косая черта - экранирующий символ PostgreSQL по умолчанию
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *PostgresUserStorage) VerifyEmail(ctx context.Context, email string) error {
+	if len(email) == 0 {
+		return errors.New("email cannot be empty")
+	}
+
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE users SET email_verified = TRUE, updated_at = now() WHERE lower(email) = lower($1)`,
+		email,
+	)
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+func (s *PostgresUserStorage) ShutDown(shutDownCtx context.Context) error {
+	s.pool.Close()
+	return nil
+}
+
+func (s *PostgresUserStorage) getUser(ctx context.Context, email string) (*model.User, error) {
+	user := User{}
+	err := s.pool.QueryRow(ctx,
+		`SELECT email, password_hash, role, version, email_verified, disabled FROM users WHERE lower(email) = lower($1)`,
+		email,
+	).Scan(&user.Email, &user.PasswordHash, &user.Role, &user.Version, &user.EmailVerified, &user.Disabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return nil, err
+	}
+
+	return user.toDomain(), nil
+}
+
+func (s *PostgresUserStorage) updateReturningVersion(ctx context.Context, query string, args ...any) (float64, error) {
+	if email, _ := args[0].(string); email == "" {
+		return -1, errors.New("email cannot be empty")
+	}
+
+	var version int64
+	err := s.pool.QueryRow(ctx, query, args...).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return -1, errUserNotFound
+	}
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return -1, err
+	}
+
+	return float64(version), nil
+}
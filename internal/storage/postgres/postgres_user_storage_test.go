@@ -0,0 +1,127 @@
+//go:build integration
+
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/libs/hash"
+	"lk-auth/internal/storage"
+	postgrespkg "lk-auth/internal/storage/postgres"
+	"lk-auth/internal/storage/storagetest"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	err := godotenv.Load()
+	if err != nil {
+		fmt.Println("error: " + err.Error())
+	}
+
+	m.Run()
+}
+
+func getPostgresUserStorage() (storage.UserStorage, error) {
+	url := os.Getenv("USERS_URL")
+	if url == "" {
+		return nil, errors.New("USERS_URL is not set")
+	}
+
+	return postgrespkg.NewPostgresUserStorage(
+		context.Background(),
+		&sync.WaitGroup{},
+		url,
+		nil,
+		slog.New(
+			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		),
+		time.Duration(time.Second*30),
+	)
+}
+
+func TestPostgresUserStorage(t *testing.T) {
+	users, err := getPostgresUserStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passwordHash, err := hash.Default().Hash("password")
+	require.NoError(t, err)
+	user := &model.User{
+		Email:        fmt.Sprintf("pg_%d@mail.com", time.Now().UnixNano()),
+		PasswordHash: passwordHash,
+		Role:         "student",
+		Version:      1,
+	}
+
+	t.Run("AddUser", func(t *testing.T) {
+		assert.NoError(t, users.AddUser(context.Background(), user))
+
+		duplicate := *user
+		assert.Error(t, users.AddUser(context.Background(), &duplicate))
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		version, role, err := users.Login(context.Background(), user.Email, "password")
+		assert.NoError(t, err)
+		assert.Equal(t, user.Version, version)
+		assert.Equal(t, user.Role, role)
+
+		version, _, err = users.Login(context.Background(), user.Email, "wrong")
+		assert.Error(t, err)
+		assert.Equal(t, float64(-1), version)
+	})
+
+	t.Run("ChangePassword", func(t *testing.T) {
+		newHash, err := hash.Default().Hash("new_password")
+		require.NoError(t, err)
+
+		version, err := users.ChangePassword(context.Background(), user.Email, newHash)
+		assert.NoError(t, err)
+		assert.Equal(t, user.Version+1, version)
+
+		ok, err := users.IsVersionValid(context.Background(), user.Email, user.Version)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		_, _, err = users.Login(context.Background(), user.Email, "new_password")
+		assert.NoError(t, err)
+	})
+
+	t.Run("IncrementVersion", func(t *testing.T) {
+		version, err := users.IncrementVersion(context.Background(), user.Email)
+		assert.NoError(t, err)
+		assert.Equal(t, user.Version+2, version)
+
+		_, err = users.IncrementVersion(context.Background(), "missing@mail.com")
+		assert.Error(t, err)
+	})
+}
+
+// Набор тестов очищает таблицу users, поэтому USERS_URL должен указывать на тестовую базу
+func TestPostgresUserStorageSuite(t *testing.T) {
+	storagetest.RunUserSuite(t, func(t *testing.T) storage.UserStorage {
+		conn, err := pgx.Connect(t.Context(), os.Getenv("USERS_URL"))
+		require.NoError(t, err)
+		_, err = conn.Exec(t.Context(), `TRUNCATE users`)
+		require.NoError(t, err)
+		require.NoError(t, conn.Close(t.Context()))
+
+		users, err := getPostgresUserStorage()
+		require.NoError(t, err)
+		t.Cleanup(func() { users.ShutDown(context.Background()) })
+		return users
+	})
+}
@@ -1,16 +1,24 @@
 package redis
 
 import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"lk-auth/internal/domain/model"
 )
 
 type User struct {
 	Email        string `redis:"email"`
 	PasswordHash string `redis:"passHash"`
-	// TODO: добавить валидацию для поля Role
-	// Пример: `validate:"required,oneof=admin user guest"`
+	// Роль проверяется по реестру ролей при регистрации и назначении, см. пакет rbac
 	Role    string  `redis:"role"`
 	Version float64 `redis:"version"`
+	// Хранится признак неподтверждённого адреса: у записей, созданных до проверки email, поля нет, и они считаются подтверждёнными
+	Unverified bool `redis:"unverified"`
+	Disabled   bool `redis:"disabled"`
 }
 
 func fromDomain(u *model.User) *User {
@@ -19,14 +27,231 @@ func fromDomain(u *model.User) *User {
 		PasswordHash: u.PasswordHash,
 		Role:         u.Role,
 		Version:      u.Version,
+		Unverified:   !u.EmailVerified,
+		Disabled:     u.Disabled,
 	}
 }
 
 func (u *User) toDomain() *model.User {
 	return &model.User{
-		Email:        u.Email,
-		PasswordHash: u.PasswordHash,
-		Role:         u.Role,
-		Version:      u.Version,
+		Email:         u.Email,
+		PasswordHash:  u.PasswordHash,
+		Role:          u.Role,
+		Version:       u.Version,
+		EmailVerified: !u.Unverified,
+		Disabled:      u.Disabled,
+	}
+}
+
+type Session struct {
+	ID         string `redis:"id"`
+	Email      string `redis:"email"`
+	CreatedAt  int64  `redis:"createdAt"`
+	LastUsedAt int64  `redis:"lastUsedAt"`
+	IP         string `redis:"ip"`
+	UserAgent  string `redis:"userAgent"`
+}
+
+func sessionFromDomain(s *model.Session) *Session {
+	return &Session{
+		ID:         s.ID,
+		Email:      s.Email,
+		CreatedAt:  s.CreatedAt.Unix(),
+		LastUsedAt: s.LastUsedAt.Unix(),
+		IP:         s.IP,
+		UserAgent:  s.UserAgent,
+	}
+}
+
+func (s *Session) toDomain() *model.Session {
+	return &model.Session{
+		ID:         s.ID,
+		Email:      s.Email,
+		CreatedAt:  time.Unix(s.CreatedAt, 0),
+		LastUsedAt: time.Unix(s.LastUsedAt, 0),
+		IP:         s.IP,
+		UserAgent:  s.UserAgent,
+	}
+}
+
+// Коды восстановления хранятся отдельным множеством, чтобы удалять их атомарно
+type MFA struct {
+	Secret      string `redis:"secret"`
+	Confirmed   bool   `redis:"confirmed"`
+	LastCounter int64  `redis:"lastCounter"`
+}
+
+func mfaFromDomain(m *model.MFA) *MFA {
+	return &MFA{
+		Secret:      m.Secret,
+		Confirmed:   m.Confirmed,
+		LastCounter: m.LastCounter,
+	}
+}
+
+func (m *MFA) toDomain(recoveryCodes []string) *model.MFA {
+	return &model.MFA{
+		Secret:        m.Secret,
+		Confirmed:     m.Confirmed,
+		RecoveryCodes: recoveryCodes,
+		LastCounter:   m.LastCounter,
+	}
+}
+
+// Байтовые поля хранятся в base64url, транспорты - через запятую
+type WebAuthnCredential struct {
+	ID              string `redis:"id"`
+	Email           string `redis:"email"`
+	UserHandle      string `redis:"userHandle"`
+	PublicKey       string `redis:"publicKey"`
+	AttestationType string `redis:"attestationType"`
+	Transports      string `redis:"transports"`
+	AAGUID          string `redis:"aaguid"`
+	SignCount       uint32 `redis:"signCount"`
+	BackupEligible  bool   `redis:"backupEligible"`
+	BackupState     bool   `redis:"backupState"`
+	CreatedAt       int64  `redis:"createdAt"`
+}
+
+func credentialFromDomain(c *model.WebAuthnCredential) *WebAuthnCredential {
+	return &WebAuthnCredential{
+		ID:              encodeBytes(c.ID),
+		Email:           c.Email,
+		UserHandle:      encodeBytes(c.UserHandle),
+		PublicKey:       encodeBytes(c.PublicKey),
+		AttestationType: c.AttestationType,
+		Transports:      strings.Join(c.Transports, ","),
+		AAGUID:          encodeBytes(c.AAGUID),
+		SignCount:       c.SignCount,
+		BackupEligible:  c.BackupEligible,
+		BackupState:     c.BackupState,
+		CreatedAt:       c.CreatedAt.Unix(),
+	}
+}
+
+// args возвращает поля в виде пар имя-значение для HSET в скрипте
+func (c *WebAuthnCredential) args() []any {
+	return []any{
+		"id", c.ID,
+		"email", c.Email,
+		"userHandle", c.UserHandle,
+		"publicKey", c.PublicKey,
+		"attestationType", c.AttestationType,
+		"transports", c.Transports,
+		"aaguid", c.AAGUID,
+		"signCount", c.SignCount,
+		"backupEligible", c.BackupEligible,
+		"backupState", c.BackupState,
+		"createdAt", c.CreatedAt,
+	}
+}
+
+func (c *WebAuthnCredential) toDomain() (*model.WebAuthnCredential, error) {
+	var (
+		cred = &model.WebAuthnCredential{
+			Email:           c.Email,
+			AttestationType: c.AttestationType,
+			SignCount:       c.SignCount,
+			BackupEligible:  c.BackupEligible,
+			BackupState:     c.BackupState,
+			CreatedAt:       time.Unix(c.CreatedAt, 0),
+		}
+		err error
+	)
+	if c.Transports != "" {
+		cred.Transports = strings.Split(c.Transports, ",")
+	}
+	if cred.ID, err = decodeBytes(c.ID); err != nil {
+		return nil, err
+	}
+	if cred.UserHandle, err = decodeBytes(c.UserHandle); err != nil {
+		return nil, err
+	}
+	if cred.PublicKey, err = decodeBytes(c.PublicKey); err != nil {
+		return nil, err
+	}
+	if cred.AAGUID, err = decodeBytes(c.AAGUID); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+type OneTimeToken struct {
+	Purpose string  `redis:"purpose"`
+	Email   string  `redis:"email"`
+	Version float64 `redis:"version"`
+}
+
+func tokenFromDomain(t *model.OneTimeToken) *OneTimeToken {
+	return &OneTimeToken{
+		Purpose: t.Purpose,
+		Email:   t.Email,
+		Version: t.Version,
+	}
+}
+
+func (t *OneTimeToken) toDomain() *model.OneTimeToken {
+	return &model.OneTimeToken{
+		Purpose: t.Purpose,
+		Email:   t.Email,
+		Version: t.Version,
+	}
+}
+
+func encodeBytes(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeBytes(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// Запись журнала аудита - поля записи потока Redis
+type AuditRecord struct {
+	Time      int64  `redis:"time"`
+	Action    string `redis:"action"`
+	Actor     string `redis:"actor"`
+	Subject   string `redis:"subject"`
+	Details   string `redis:"details"`
+	IP        string `redis:"ip"`
+	UserAgent string `redis:"userAgent"`
+	Result    string `redis:"result"`
+	Reason    string `redis:"reason"`
+}
+
+func auditRecordFromDomain(r *model.AuditRecord) *AuditRecord {
+	return &AuditRecord{
+		Time:      r.Time.UnixNano(),
+		Action:    r.Action,
+		Actor:     r.Actor,
+		Subject:   r.Subject,
+		Details:   r.Details,
+		IP:        r.IP,
+		UserAgent: r.UserAgent,
+		Result:    r.Result,
+		Reason:    r.Reason,
+	}
+}
+
+// auditRecordFromValues разбирает поля записи потока. XRANGE возвращает их строками
+func auditRecordFromValues(values map[string]any) (model.AuditRecord, error) {
+	field := func(name string) string {
+		v, _ := values[name].(string)
+		return v
+	}
+	nanos, err := strconv.ParseInt(field("time"), 10, 64)
+	if err != nil {
+		return model.AuditRecord{}, fmt.Errorf("audit record time: %w", err)
 	}
+	return model.AuditRecord{
+		Time:      time.Unix(0, nanos),
+		Action:    field("action"),
+		Actor:     field("actor"),
+		Subject:   field("subject"),
+		Details:   field("details"),
+		IP:        field("ip"),
+		UserAgent: field("userAgent"),
+		Result:    field("result"),
+		Reason:    field("reason"),
+	}, nil
 }
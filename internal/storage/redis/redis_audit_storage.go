@@ -0,0 +1,127 @@
+package redis
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	auditStream = "auth:audit"
+	// Сколько записей потока читается за один XRANGE
+	auditRangeCount = 100
+	// Идентификатор записи потока - время её получения Redis, а фильтр задаётся временем записи в сервисе.
+	// Промежуток XRANGE расширяется на допустимое расхождение часов, точная проверка выполняется по времени записи
+	auditClockSkew = time.Minute
+)
+
+// RedisAuditStorage хранит журнал аудита в потоке Redis
+type RedisAuditStorage struct {
+	client *redis.Client
+	// Примерное наибольшее число записей в потоке, 0 - без ограничения
+	maxLen int64
+	log    *slog.Logger
+}
+
+func NewRedisAuditStorage(ctx context.Context, wg *sync.WaitGroup, options *redis.Options, maxLen int64, log *slog.Logger, pingTime time.Duration) (storage.AuditStorage, error) {
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+
+	wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(pingTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug("RedisAuditStorage ping goroutine stopped")
+				wg.Done()
+				return
+			case <-ticker.C:
+				if err := client.Ping(ctx).Err(); err != nil {
+					log.Error("RedisAuditStorage didn't answer", "url", options.Addr)
+				}
+			}
+		}
+	}()
+
+	return &RedisAuditStorage{
+		client: client,
+		maxLen: maxLen,
+		log:    log,
+	}, nil
+}
+
+func (s *RedisAuditStorage) AddRecord(ctx context.Context, rec *model.AuditRecord) error {
+	err := s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: auditStream,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: auditRecordFromDomain(rec),
+	}).Err()
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+	}
+	return err
+}
+
+func (s *RedisAuditStorage) ListRecords(ctx context.Context, filter model.AuditFilter) ([]model.AuditRecord, error) {
+	start, end := "-", "+"
+	if !filter.From.IsZero() {
+		start = strconv.FormatInt(filter.From.Add(-auditClockSkew).UnixMilli(), 10)
+	}
+	if !filter.To.IsZero() {
+		end = strconv.FormatInt(filter.To.Add(auditClockSkew).UnixMilli(), 10)
+	}
+
+	var records []model.AuditRecord
+	for {
+		entries, err := s.client.XRangeN(ctx, auditStream, start, end, auditRangeCount).Result()
+		if err != nil {
+			s.log.ErrorContext(ctx, "database error", sl.Err(err))
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			rec, err := auditRecordFromValues(entry.Values)
+			if err != nil {
+				s.log.ErrorContext(ctx, "malformed audit record", sl.Err(err), "id", entry.ID)
+				continue
+			}
+			if !filter.Match(rec) {
+				continue
+			}
+			records = append(records, rec)
+			if filter.Limit > 0 && len(records) == filter.Limit {
+				return records, nil
+			}
+		}
+
+		if len(entries) < auditRangeCount {
+			return records, nil
+		}
+		// Следующая страница начинается после последней прочитанной записи
+		start = "(" + entries[len(entries)-1].ID
+	}
+}
+
+func (s *RedisAuditStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.client.Close()
+}
@@ -17,7 +17,6 @@ import (
 const blacklistPref = "auth:blacklist:"
 
 type RedisBlackListStorage struct {
-	ctx        context.Context
 	client     *redis.Client
 	jwtService jwt.JWTService
 
@@ -55,16 +54,15 @@ func NewRedisBlackListStorage(ctx context.Context, wg *sync.WaitGroup, options *
 	}()
 
 	return &RedisBlackListStorage{
-		ctx:        ctx,
 		client:     client,
 		jwtService: jwtService,
 		log:        log,
 	}, nil
 }
 
-func (s *RedisBlackListStorage) AddTokens(tokens ...string) error {
+func (s *RedisBlackListStorage) AddTokens(ctx context.Context, tokens ...string) error {
 	for _, token := range tokens {
-		claims, err := s.jwtService.GetTokenClaims(token)
+		claims, err := s.jwtService.GetTokenClaims(ctx, token)
 		if err != nil {
 			continue
 		}
@@ -72,11 +70,11 @@ func (s *RedisBlackListStorage) AddTokens(tokens ...string) error {
 
 		exp, ok := expClaim.(float64)
 		if !ok {
-			s.log.Error("token expiration claim is not a number", "token", token)
+			s.log.ErrorContext(ctx, "token expiration claim is not a number", "exp", expClaim)
 			return errors.New("token expiration claim is not a number")
 		}
 		dur := time.Duration(int64(exp)-time.Now().Unix()) * time.Second
-		err = s.client.Set(s.ctx, blacklistPref+token, true, dur).Err()
+		err = s.client.Set(ctx, blacklistPref+token, true, dur).Err()
 		if err != nil {
 			return err
 		}
@@ -84,8 +82,8 @@ func (s *RedisBlackListStorage) AddTokens(tokens ...string) error {
 	return nil
 }
 
-func (s *RedisBlackListStorage) IsAllowed(token string) (bool, error) {
-	response, err := s.client.Exists(s.ctx, blacklistPref+token).Result()
+func (s *RedisBlackListStorage) IsAllowed(ctx context.Context, token string) (bool, error) {
+	response, err := s.client.Exists(ctx, blacklistPref+token).Result()
 	if err != nil {
 		return false, err
 	}
@@ -13,10 +13,25 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-const jwtPref = "auth:jwt:"
+const (
+	jwtPref    = "auth:jwt:"
+	familyPref = "auth:family:"
+)
+
+// Атомарная замена действующего токена семейства (compare-and-set)
+var rotateFamilyScript = redis.NewScript(`
+local head = redis.call("GET", KEYS[1])
+if not head then
+	return -1
+end
+if head ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
+`)
 
 type RedisJWTStorage struct {
-	ctx    context.Context
 	client *redis.Client
 	ttl    time.Duration
 	log    *slog.Logger
@@ -55,33 +70,77 @@ func NewRedisJWTStorage(ctx context.Context, wg *sync.WaitGroup, options *redis.
 	return &RedisJWTStorage{
 		ttl:    ttl,
 		client: client,
-		ctx:    ctx,
 		log:    log,
 	}, nil
 }
 
-func (s *RedisJWTStorage) AddPair(access string, refresh string) error {
-	err := s.client.Set(s.ctx, jwtPref+refresh, access, s.ttl).Err()
+func (s *RedisJWTStorage) AddPair(ctx context.Context, access string, refresh string) error {
+	err := s.client.Set(ctx, jwtPref+refresh, access, s.ttl).Err()
 	if err != nil {
-		s.log.Error("Cannot add pair", sl.Err(err))
+		s.log.ErrorContext(ctx, "Cannot add pair", sl.Err(err))
 	}
 
 	return err
 }
 
-func (s *RedisJWTStorage) GetAccessByRefresh(refresh string) (string, error) {
-	res, err := s.client.Get(s.ctx, jwtPref+refresh).Result()
-	if err != nil {
-		return "", err
+func (s *RedisJWTStorage) GetAccessByRefresh(ctx context.Context, refresh string) (string, error) {
+	// GETDEL атомарен: при одновременных запросах пару получает только один из них
+	res, err := s.client.GetDel(ctx, jwtPref+refresh).Result()
+	if err == redis.Nil {
+		return "", storage.ErrNotFound
 	}
-	if err = s.client.Del(s.ctx, jwtPref+refresh).Err(); err != nil {
-		s.log.Error("Cannot delete pair", sl.Err(err))
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot get pair", sl.Err(err))
 		return "", err
 	}
 
 	return res, nil
 }
 
+func (s *RedisJWTStorage) AddFamily(ctx context.Context, family, refresh string) error {
+	err := s.client.Set(ctx, familyPref+family, refresh, s.ttl).Err()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot add family", sl.Err(err))
+	}
+
+	return err
+}
+
+func (s *RedisJWTStorage) RotateFamily(ctx context.Context, family, current, next string) (bool, error) {
+	res, err := rotateFamilyScript.Run(
+		ctx,
+		s.client,
+		[]string{familyPref + family},
+		current, next, s.ttl.Milliseconds(),
+	).Int()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot rotate family", sl.Err(err))
+		return false, err
+	}
+
+	switch res {
+	case -1:
+		return false, storage.ErrNotFound
+	case 0:
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+func (s *RedisJWTStorage) GetFamilyHead(ctx context.Context, family string) (string, error) {
+	res, err := s.client.Get(ctx, familyPref+family).Result()
+	if err == redis.Nil {
+		return "", storage.ErrNotFound
+	}
+
+	return res, err
+}
+
+func (s *RedisJWTStorage) DeleteFamily(ctx context.Context, family string) error {
+	return s.client.Del(ctx, familyPref+family).Err()
+}
+
 func (s *RedisJWTStorage) ShutDown(shutDownCtx context.Context) error {
 	return s.client.Close()
 }
@@ -0,0 +1,115 @@
+package redis
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	failuresPref = "auth:lockout:failures:"
+	lockPref     = "auth:lockout:lock:"
+)
+
+// Блокировка продлевается, но не сокращается
+var lockScript = redis.NewScript(`
+local current = redis.call("PTTL", KEYS[1])
+if current >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("SET", KEYS[1], "1", "PX", ARGV[1])
+return 1
+`)
+
+type RedisLockoutStorage struct {
+	client *redis.Client
+	log    *slog.Logger
+}
+
+func NewRedisLockoutStorage(ctx context.Context, wg *sync.WaitGroup, options *redis.Options, log *slog.Logger, pingTime time.Duration) (storage.LockoutStorage, error) {
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+
+	wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(pingTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug("RedisLockoutStorage ping goroutine stopped")
+				wg.Done()
+				return
+			case <-ticker.C:
+				if err := client.Ping(ctx).Err(); err != nil {
+					log.Error("RedisLockoutStorage didn't answer", "url", options.Addr)
+				}
+			}
+		}
+	}()
+
+	return &RedisLockoutStorage{
+		client: client,
+		log:    log,
+	}, nil
+}
+
+func (s *RedisLockoutStorage) AddFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, failuresPref+key)
+		pipe.PExpire(ctx, failuresPref+key, window)
+		return nil
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot count failed attempt", sl.Err(err))
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+func (s *RedisLockoutStorage) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	err := lockScript.Run(ctx, s.client, []string{lockPref + key}, ttl.Milliseconds()).Err()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot lock", sl.Err(err))
+	}
+	return err
+}
+
+func (s *RedisLockoutStorage) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, lockPref+key).Result()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot get lock", sl.Err(err))
+		return 0, err
+	}
+	// Отрицательные значения: ключа нет (-2) или у него нет срока жизни (-1), последнее не ставится
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+func (s *RedisLockoutStorage) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, failuresPref+key, lockPref+key).Err()
+}
+
+func (s *RedisLockoutStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.client.Close()
+}
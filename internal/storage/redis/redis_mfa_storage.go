@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	mfaPref      = "auth:mfa:"
+	recoveryPref = "auth:mfa_recovery:"
+)
+
+// Запоминает шаг кода, только если он новее последнего принятого
+var useTOTPCounterScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+local last = tonumber(redis.call("HGET", KEYS[1], "lastCounter") or "0")
+if tonumber(ARGV[1]) <= last then
+	return 0
+end
+redis.call("HSET", KEYS[1], "lastCounter", ARGV[1])
+return 1
+`)
+
+type RedisMFAStorage struct {
+	client *redis.Client
+	log    *slog.Logger
+}
+
+func NewRedisMFAStorage(ctx context.Context, wg *sync.WaitGroup, options *redis.Options, log *slog.Logger, pingTime time.Duration) (storage.MFAStorage, error) {
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+
+	wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(pingTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug("RedisMFAStorage ping goroutine stopped")
+				wg.Done()
+				return
+			case <-ticker.C:
+				if err := client.Ping(ctx).Err(); err != nil {
+					log.Error("RedisMFAStorage didn't answer", "url", options.Addr)
+				}
+			}
+		}
+	}()
+
+	return &RedisMFAStorage{
+		client: client,
+		log:    log,
+	}, nil
+}
+
+func (s *RedisMFAStorage) GetMFA(ctx context.Context, email string) (*model.MFA, error) {
+	res := s.client.HGetAll(ctx, mfaPref+email)
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	// HGETALL для отсутствующего ключа возвращает пустой ответ, а не redis.Nil
+	if len(res.Val()) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	mfa := MFA{}
+	if err := res.Scan(&mfa); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.client.SMembers(ctx, recoveryPref+email).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return mfa.toDomain(codes), nil
+}
+
+func (s *RedisMFAStorage) SetMFA(ctx context.Context, email string, mfa *model.MFA) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, mfaPref+email, recoveryPref+email)
+		pipe.HSet(ctx, mfaPref+email, mfaFromDomain(mfa))
+		if len(mfa.RecoveryCodes) > 0 {
+			codes := make([]any, 0, len(mfa.RecoveryCodes))
+			for _, code := range mfa.RecoveryCodes {
+				codes = append(codes, code)
+			}
+			pipe.SAdd(ctx, recoveryPref+email, codes...)
+		}
+		return nil
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot save MFA settings", sl.Err(err))
+	}
+
+	return err
+}
+
+func (s *RedisMFAStorage) DeleteMFA(ctx context.Context, email string) error {
+	return s.client.Del(ctx, mfaPref+email, recoveryPref+email).Err()
+}
+
+func (s *RedisMFAStorage) UseRecoveryCode(ctx context.Context, email, codeHash string) (bool, error) {
+	removed, err := s.client.SRem(ctx, recoveryPref+email, codeHash).Result()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot use recovery code", sl.Err(err))
+		return false, err
+	}
+
+	return removed == 1, nil
+}
+
+func (s *RedisMFAStorage) UseTOTPCounter(ctx context.Context, email string, counter int64) (bool, error) {
+	res, err := useTOTPCounterScript.Run(ctx, s.client, []string{mfaPref + email}, counter).Int()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot save TOTP counter", sl.Err(err))
+		return false, err
+	}
+
+	switch res {
+	case -1:
+		return false, storage.ErrNotFound
+	case 0:
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+func (s *RedisMFAStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.client.Close()
+}
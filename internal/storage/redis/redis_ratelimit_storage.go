@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitPref = "auth:ratelimit:"
+
+// Скользящее окно: в хэше ключа номер текущего окна (w) и счётчики текущего (c) и предыдущего (p) окна.
+// Время берётся у Redis, чтобы все реплики сервиса считали окна одинаково.
+// Возвращает {разрешён, осталось, мс до освобождения квоты, мс до следующей попытки}.
+var rateLimitScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local index = math.floor(now / window)
+local elapsed = now - index * window
+
+local state = redis.call("HMGET", KEYS[1], "w", "c", "p")
+local w = tonumber(state[1])
+local current = tonumber(state[2]) or 0
+local prev = tonumber(state[3]) or 0
+if w == index - 1 then
+	prev = current
+	current = 0
+elseif w ~= index then
+	prev = 0
+	current = 0
+end
+
+local estimate = prev * (window - elapsed) / window + current
+if estimate + 1 > limit then
+	local retry
+	if current >= limit then
+		retry = (window - elapsed) + window * (1 - (limit - 1) / current)
+	else
+		retry = window * (1 - (limit - 1 - current) / prev) - elapsed
+	end
+	retry = math.max(math.ceil(retry), 1)
+	return {0, 0, retry, retry}
+end
+
+current = current + 1
+redis.call("HSET", KEYS[1], "w", index, "c", current, "p", prev)
+redis.call("PEXPIRE", KEYS[1], 2 * window - elapsed)
+return {1, math.max(math.floor(limit - estimate - 1), 0), window - elapsed, 0}
+`)
+
+type RedisRateLimitStorage struct {
+	client *redis.Client
+	log    *slog.Logger
+}
+
+func NewRedisRateLimitStorage(ctx context.Context, wg *sync.WaitGroup, options *redis.Options, log *slog.Logger, pingTime time.Duration) (storage.RateLimitStorage, error) {
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+
+	wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(pingTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug("RedisRateLimitStorage ping goroutine stopped")
+				wg.Done()
+				return
+			case <-ticker.C:
+				if err := client.Ping(ctx).Err(); err != nil {
+					log.Error("RedisRateLimitStorage didn't answer", "url", options.Addr)
+				}
+			}
+		}
+	}()
+
+	return &RedisRateLimitStorage{
+		client: client,
+		log:    log,
+	}, nil
+}
+
+func (s *RedisRateLimitStorage) Hit(ctx context.Context, key string, limit int64, window time.Duration) (model.RateLimit, error) {
+	res, err := rateLimitScript.Run(ctx, s.client, []string{rateLimitPref + key}, limit, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot count request", sl.Err(err))
+		return model.RateLimit{}, err
+	}
+
+	return model.RateLimit{
+		Allowed:    res[0] == 1,
+		Limit:      limit,
+		Remaining:  res[1],
+		Reset:      time.Duration(res[2]) * time.Millisecond,
+		RetryAfter: time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
+
+func (s *RedisRateLimitStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.client.Close()
+}
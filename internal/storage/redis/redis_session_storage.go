@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionPref      = "auth:sessions:"
+	userSessionsPref = "auth:user_sessions:"
+)
+
+// Обновляет только существующую сессию: завершённая между проверкой и записью сессия не должна
+// появиться снова. Возвращает email владельца или nil, если сессии нет
+var touchSessionScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return false
+end
+redis.call("HSET", KEYS[1], "lastUsedAt", ARGV[1], "ip", ARGV[2], "userAgent", ARGV[3])
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return redis.call("HGET", KEYS[1], "email")
+`)
+
+type RedisSessionStorage struct {
+	client *redis.Client
+	ttl    time.Duration
+	log    *slog.Logger
+}
+
+// ttl - время жизни сессии без использования, совпадает с временем жизни refresh токена
+func NewRedisSessionStorage(ctx context.Context, wg *sync.WaitGroup, options *redis.Options, ttl time.Duration, log *slog.Logger, pingTime time.Duration) (storage.SessionStorage, error) {
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+
+	wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(pingTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug("RedisSessionStorage ping goroutine stopped")
+				wg.Done()
+				return
+			case <-ticker.C:
+				if err := client.Ping(ctx).Err(); err != nil {
+					log.Error("RedisSessionStorage didn't answer", "url", options.Addr)
+				}
+			}
+		}
+	}()
+
+	return &RedisSessionStorage{
+		client: client,
+		ttl:    ttl,
+		log:    log,
+	}, nil
+}
+
+func (s *RedisSessionStorage) AddSession(ctx context.Context, session *model.Session) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, sessionPref+session.ID, sessionFromDomain(session))
+		pipe.Expire(ctx, sessionPref+session.ID, s.ttl)
+		pipe.SAdd(ctx, userSessionsPref+session.Email, session.ID)
+		// Индекс живёт не меньше самой свежей сессии пользователя
+		pipe.Expire(ctx, userSessionsPref+session.Email, s.ttl)
+		return nil
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot add session", sl.Err(err))
+	}
+
+	return err
+}
+
+func (s *RedisSessionStorage) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	session := Session{}
+	res := s.client.HGetAll(ctx, sessionPref+id)
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	// HGETALL для отсутствующего ключа возвращает пустой ответ, а не redis.Nil
+	if len(res.Val()) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	if err := res.Scan(&session); err != nil {
+		return nil, err
+	}
+
+	return session.toDomain(), nil
+}
+
+func (s *RedisSessionStorage) ListSessions(ctx context.Context, email string) ([]model.Session, error) {
+	ids, err := s.client.SMembers(ctx, userSessionsPref+email).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]model.Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := s.GetSession(ctx, id)
+		if err == storage.ErrNotFound {
+			// Сессия истекла, убираем её из индекса
+			s.client.SRem(ctx, userSessionsPref+email, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (s *RedisSessionStorage) TouchSession(ctx context.Context, id string, client model.ClientInfo) error {
+	email, err := touchSessionScript.Run(
+		ctx,
+		s.client,
+		[]string{sessionPref + id},
+		time.Now().Unix(), client.IP, client.UserAgent, s.ttl.Milliseconds(),
+	).Text()
+	if err == redis.Nil {
+		return storage.ErrNotFound
+	}
+	if err == nil {
+		// Индекс может пережить удалённую сессию: ListSessions убирает из него отсутствующие
+		err = s.client.Expire(ctx, userSessionsPref+email, s.ttl).Err()
+	}
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot update session", sl.Err(err))
+	}
+
+	return err
+}
+
+func (s *RedisSessionStorage) DeleteSession(ctx context.Context, id string) error {
+	session, err := s.GetSession(ctx, id)
+	if err == storage.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionPref+id)
+		pipe.SRem(ctx, userSessionsPref+session.Email, id)
+		return nil
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot delete session", sl.Err(err))
+	}
+
+	return err
+}
+
+func (s *RedisSessionStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.client.Close()
+}
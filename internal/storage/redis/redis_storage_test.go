@@ -0,0 +1,137 @@
+package redis_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"lk-auth/internal/service/jwt"
+	"lk-auth/internal/storage"
+	redispkg "lk-auth/internal/storage/redis"
+	"lk-auth/internal/storage/storagetest"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// Хранилища проверяются на встроенном miniredis, живой сервер Redis не нужен
+func newRedis(t *testing.T) (*redis.Options, storagetest.Advance) {
+	mr := miniredis.RunT(t)
+	// Время miniredis заморожено: FastForward сдвигает сроки жизни ключей, SetTime - ответ TIME в скриптах
+	now := time.Now()
+	mr.SetTime(now)
+	advance := func(d time.Duration) {
+		now = now.Add(d)
+		mr.SetTime(now)
+		mr.FastForward(d)
+	}
+	return &redis.Options{Addr: mr.Addr()}, advance
+}
+
+// Горутины проверки соединения завершаются по отмене t.Context()
+func newWaitGroup(t *testing.T) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+	t.Cleanup(wg.Wait)
+	return wg
+}
+
+func TestRedisJWTStorage(t *testing.T) {
+	storagetest.RunJWTSuite(t, func(t *testing.T, ttl time.Duration) (storage.JWTStorage, storagetest.Advance) {
+		opts, advance := newRedis(t)
+		s, err := redispkg.NewRedisJWTStorage(t.Context(), newWaitGroup(t), opts, ttl, nil, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(t.Context()) })
+		return s, advance
+	})
+}
+
+func TestRedisBlackListStorage(t *testing.T) {
+	storagetest.RunBlackListSuite(t, func(t *testing.T, jwtService jwt.JWTService) (storage.BlackListStorage, storagetest.Advance) {
+		opts, advance := newRedis(t)
+		s, err := redispkg.NewRedisBlackListStorage(t.Context(), newWaitGroup(t), opts, jwtService, nil, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(t.Context()) })
+		return s, advance
+	})
+}
+
+func TestRedisUserStorage(t *testing.T) {
+	storagetest.RunUserSuite(t, func(t *testing.T) storage.UserStorage {
+		opts, _ := newRedis(t)
+		s, err := redispkg.NewRedisUserStorage(t.Context(), newWaitGroup(t), opts, nil, nil, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(t.Context()) })
+		return s
+	})
+}
+
+func TestRedisSessionStorage(t *testing.T) {
+	storagetest.RunSessionSuite(t, func(t *testing.T, ttl time.Duration) (storage.SessionStorage, storagetest.Advance) {
+		opts, advance := newRedis(t)
+		s, err := redispkg.NewRedisSessionStorage(t.Context(), newWaitGroup(t), opts, ttl, nil, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(t.Context()) })
+		return s, advance
+	})
+}
+
+func TestRedisMFAStorage(t *testing.T) {
+	storagetest.RunMFASuite(t, func(t *testing.T) storage.MFAStorage {
+		opts, _ := newRedis(t)
+		s, err := redispkg.NewRedisMFAStorage(t.Context(), newWaitGroup(t), opts, nil, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(t.Context()) })
+		return s
+	})
+}
+
+func TestRedisWebAuthnStorage(t *testing.T) {
+	storagetest.RunWebAuthnSuite(t, func(t *testing.T) (storage.WebAuthnStorage, storagetest.Advance) {
+		opts, advance := newRedis(t)
+		s, err := redispkg.NewRedisWebAuthnStorage(t.Context(), newWaitGroup(t), opts, nil, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(t.Context()) })
+		return s, advance
+	})
+}
+
+func TestRedisLockoutStorage(t *testing.T) {
+	storagetest.RunLockoutSuite(t, func(t *testing.T) (storage.LockoutStorage, storagetest.Advance) {
+		opts, advance := newRedis(t)
+		s, err := redispkg.NewRedisLockoutStorage(t.Context(), newWaitGroup(t), opts, nil, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(t.Context()) })
+		return s, advance
+	})
+}
+
+func TestRedisRateLimitStorage(t *testing.T) {
+	storagetest.RunRateLimitSuite(t, func(t *testing.T) (storage.RateLimitStorage, storagetest.Advance) {
+		opts, advance := newRedis(t)
+		s, err := redispkg.NewRedisRateLimitStorage(t.Context(), newWaitGroup(t), opts, nil, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(t.Context()) })
+		return s, advance
+	})
+}
+
+func TestRedisOneTimeTokenStorage(t *testing.T) {
+	storagetest.RunOneTimeTokenSuite(t, func(t *testing.T) (storage.OneTimeTokenStorage, storagetest.Advance) {
+		opts, advance := newRedis(t)
+		s, err := redispkg.NewRedisOneTimeTokenStorage(t.Context(), newWaitGroup(t), opts, nil, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(t.Context()) })
+		return s, advance
+	})
+}
+
+func TestRedisAuditStorage(t *testing.T) {
+	storagetest.RunAuditSuite(t, func(t *testing.T) storage.AuditStorage {
+		opts, _ := newRedis(t)
+		s, err := redispkg.NewRedisAuditStorage(t.Context(), newWaitGroup(t), opts, 0, nil, time.Minute)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.ShutDown(t.Context()) })
+		return s
+	})
+}
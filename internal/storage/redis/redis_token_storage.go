@@ -0,0 +1,116 @@
+package redis
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const oneTimeTokenPref = "auth:token:"
+
+type RedisOneTimeTokenStorage struct {
+	client *redis.Client
+	log    *slog.Logger
+}
+
+func NewRedisOneTimeTokenStorage(ctx context.Context, wg *sync.WaitGroup, options *redis.Options, log *slog.Logger, pingTime time.Duration) (storage.OneTimeTokenStorage, error) {
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+
+	wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(pingTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug("RedisOneTimeTokenStorage ping goroutine stopped")
+				wg.Done()
+				return
+			case <-ticker.C:
+				if err := client.Ping(ctx).Err(); err != nil {
+					log.Error("RedisOneTimeTokenStorage didn't answer", "url", options.Addr)
+				}
+			}
+		}
+	}()
+
+	return &RedisOneTimeTokenStorage{
+		client: client,
+		log:    log,
+	}, nil
+}
+
+func (s *RedisOneTimeTokenStorage) SaveToken(ctx context.Context, hash string, token *model.OneTimeToken, ttl time.Duration) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, oneTimeTokenPref+hash, tokenFromDomain(token))
+		pipe.PExpire(ctx, oneTimeTokenPref+hash, ttl)
+		return nil
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot save one-time token", sl.Err(err))
+	}
+	return err
+}
+
+func (s *RedisOneTimeTokenStorage) GetToken(ctx context.Context, hash string) (*model.OneTimeToken, error) {
+	res := s.client.HGetAll(ctx, oneTimeTokenPref+hash)
+	if err := res.Err(); err != nil {
+		s.log.ErrorContext(ctx, "Cannot get one-time token", sl.Err(err))
+		return nil, err
+	}
+	if len(res.Val()) == 0 {
+		return nil, storage.ErrNotFound
+	}
+
+	token := OneTimeToken{}
+	if err := res.Scan(&token); err != nil {
+		return nil, err
+	}
+
+	return token.toDomain(), nil
+}
+
+func (s *RedisOneTimeTokenStorage) TakeToken(ctx context.Context, hash string) (*model.OneTimeToken, error) {
+	// Чтение и удаление в одной транзакции: токен может использовать только один из параллельных запросов
+	var res *redis.MapStringStringCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		res = pipe.HGetAll(ctx, oneTimeTokenPref+hash)
+		pipe.Del(ctx, oneTimeTokenPref+hash)
+		return nil
+	})
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot take one-time token", sl.Err(err))
+		return nil, err
+	}
+	if len(res.Val()) == 0 {
+		return nil, storage.ErrNotFound
+	}
+
+	token := OneTimeToken{}
+	if err = res.Scan(&token); err != nil {
+		return nil, err
+	}
+
+	return token.toDomain(), nil
+}
+
+func (s *RedisOneTimeTokenStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.client.Close()
+}
@@ -3,8 +3,11 @@ package redis
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,13 +21,72 @@ import (
 
 const usersPref = "auth:users:"
 
+var errUserNotFound = fmt.Errorf("user %w", storage.ErrNotFound)
+
+// UsersPrefix - префикс ключей хэшей пользователей, нужен для переноса учётных записей в SQL хранилище
+const UsersPrefix = usersPref
+
+// Проверка и запись в одном скрипте, чтобы одновременные регистрации не перезаписали друг друга
+var addUserScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+redis.call("HSET", KEYS[1], "email", ARGV[1], "passHash", ARGV[2], "role", ARGV[3], "version", ARGV[4], "unverified", ARGV[5], "disabled", ARGV[6])
+return 1
+`)
+
+// Без проверки существования HINCRBYFLOAT создал бы пустого пользователя
+var incrementVersionScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return false
+end
+if ARGV[1] ~= "" then
+	redis.call("HSET", KEYS[1], "passHash", ARGV[1])
+end
+if ARGV[2] ~= "" then
+	redis.call("HSET", KEYS[1], "role", ARGV[2])
+end
+return redis.call("HINCRBYFLOAT", KEYS[1], "version", 1)
+`)
+
+// Хэш заменяется, только если его не изменила смена пароля после проверки
+var rehashScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "passHash") ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "passHash", ARGV[2])
+return 1
+`)
+
+var setDisabledScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return false
+end
+redis.call("HSET", KEYS[1], "disabled", ARGV[1])
+return redis.call("HINCRBYFLOAT", KEYS[1], "version", 1)
+`)
+
+var verifyEmailScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HDEL", KEYS[1], "unverified")
+return 1
+`)
+
+// userKey - ключ хэша пользователя. email в нём в нижнем регистре: адреса сравниваются без учёта регистра
+func userKey(email string) string {
+	return usersPref + strings.ToLower(email)
+}
+
 type RedisUserStorage struct {
-	ctx    context.Context
 	client *redis.Client
+	hasher hash.PasswordHasher
 	log    *slog.Logger
 }
 
-func NewRedisUserStorage(ctx context.Context, wg *sync.WaitGroup, options *redis.Options, log *slog.Logger, pingTime time.Duration) (storage.UserStorage, error) {
+// Если hasher nil, используется [hash.Default]
+func NewRedisUserStorage(ctx context.Context, wg *sync.WaitGroup, options *redis.Options, hasher hash.PasswordHasher, log *slog.Logger, pingTime time.Duration) (storage.UserStorage, error) {
 	client := redis.NewClient(options)
 	if err := client.Ping(ctx).Err(); err != nil {
 		return nil, err
@@ -54,51 +116,86 @@ func NewRedisUserStorage(ctx context.Context, wg *sync.WaitGroup, options *redis
 		}
 	}()
 
+	if hasher == nil {
+		hasher = hash.Default()
+	}
+
 	return &RedisUserStorage{
 		client: client,
-		ctx:    ctx,
+		hasher: hasher,
 		log:    log,
 	}, nil
 }
 
 // from UserProvider interface
-func (s *RedisUserStorage) Login(email, password string) (float64, string, error) {
+func (s *RedisUserStorage) Login(ctx context.Context, email, password string) (float64, string, error) {
 	if email == "" || len(password) == 0 {
-		s.log.Error("invalid input parameters")
-		return -1, "", errors.New("invalid input parameters")
+		return -1, "", storage.ErrInvalidCredentials
 	}
 
-	userInfo := User{}
-	err := s.client.HGetAll(s.ctx, usersPref+email).Scan(&userInfo)
-
+	userInfo, err := s.getUser(ctx, email)
+	if errors.Is(err, storage.ErrNotFound) {
+		s.hasher.Simulate(password)
+		return -1, "", storage.ErrInvalidCredentials
+	}
 	if err != nil {
-		if err == redis.Nil {
-			return -1, "", errors.New("user not found")
-		}
-		s.log.Error("database error", sl.Err(err))
 		return -1, "", err
 	}
 
-	if len(userInfo.PasswordHash) == 0 || !hash.CheckPasswordHash([]byte(password), []byte(userInfo.PasswordHash)) {
-		return -1, "", errors.New("incorrect email and password")
+	valid, rehash := s.hasher.Verify(password, userInfo.PasswordHash)
+	if len(userInfo.PasswordHash) == 0 || !valid {
+		return -1, "", storage.ErrInvalidCredentials
+	}
+	if rehash {
+		s.rehash(ctx, email, userInfo.PasswordHash, password)
+	}
+	if userInfo.Disabled {
+		return -1, "", storage.ErrUserDisabled
 	}
 
 	return userInfo.Version, userInfo.Role, nil
 }
 
+// rehash заменяет устаревший хэш пароля на хэш текущего алгоритма. Версия данных не меняется,
+// а ошибка только логируется: пароль уже проверен, и вход не должен от неё зависеть
+func (s *RedisUserStorage) rehash(ctx context.Context, email, oldHash, password string) {
+	newHash, err := s.hasher.Hash(password)
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot rehash password", sl.Err(err), "email", email)
+		return
+	}
+
+	replaced, err := rehashScript.Run(ctx, s.client, []string{userKey(email)}, oldHash, newHash).Int()
+	if err != nil {
+		s.log.ErrorContext(ctx, "cannot rehash password", sl.Err(err), "email", email)
+		return
+	}
+	if replaced == 1 {
+		s.log.InfoContext(ctx, "password rehashed", "email", email)
+	}
+}
+
+func (s *RedisUserStorage) GetUser(ctx context.Context, email string) (*model.User, error) {
+	if len(email) == 0 {
+		return nil, errors.New("email cannot be empty")
+	}
+
+	userInfo, err := s.getUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return userInfo.toDomain(), nil
+}
+
 // from UserProvider interface
-func (s *RedisUserStorage) IsVersionValid(email string, version float64) (bool, error) {
+func (s *RedisUserStorage) IsVersionValid(ctx context.Context, email string, version float64) (bool, error) {
 	if len(email) == 0 {
 		return false, errors.New("email cannot be empty")
 	}
 
-	userInfo := User{}
-	err := s.client.HGetAll(s.ctx, usersPref+email).Scan(&userInfo)
-
+	userInfo, err := s.getUser(ctx, email)
 	if err != nil {
-		if err == redis.Nil {
-			return false, errors.New("user not found")
-		}
 		return false, err
 	}
 
@@ -106,22 +203,195 @@ func (s *RedisUserStorage) IsVersionValid(email string, version float64) (bool,
 }
 
 // метод для добавления пользователей в базу данных
-func (s *RedisUserStorage) AddUser(user *model.User) error {
+func (s *RedisUserStorage) AddUser(ctx context.Context, user *model.User) error {
 	if user == nil {
 		return errors.New("user instance is nil")
 	}
-	response := s.client.HGet(s.ctx, usersPref+user.Email, "email")
-	if response.Err() != nil {
-		return response.Err()
+	row := fromDomain(user)
+	added, err := addUserScript.Run(
+		ctx,
+		s.client,
+		[]string{userKey(row.Email)},
+		row.Email, row.PasswordHash, row.Role, row.Version, row.Unverified, row.Disabled,
+	).Int()
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return err
+	}
+	if added == 0 {
+		return storage.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (s *RedisUserStorage) IncrementVersion(ctx context.Context, email string) (float64, error) {
+	return s.incrementVersion(ctx, email, "", "")
+}
+
+func (s *RedisUserStorage) ChangePassword(ctx context.Context, email, passwordHash string) (float64, error) {
+	if passwordHash == "" {
+		return -1, errors.New("password hash cannot be empty")
+	}
+	return s.incrementVersion(ctx, email, passwordHash, "")
+}
+
+func (s *RedisUserStorage) ChangeRole(ctx context.Context, email, role string) (float64, error) {
+	if role == "" {
+		return -1, errors.New("role cannot be empty")
 	}
-	if response.Val() != "" {
-		return errors.New("the email has already been used")
+	return s.incrementVersion(ctx, email, "", role)
+}
+
+func (s *RedisUserStorage) SetDisabled(ctx context.Context, email string, disabled bool) (float64, error) {
+	if len(email) == 0 {
+		return -1, errors.New("email cannot be empty")
+	}
+
+	version, err := setDisabledScript.Run(ctx, s.client, []string{userKey(email)}, disabled).Float64()
+	if err == redis.Nil {
+		return -1, errUserNotFound
 	}
-	err := s.client.HSet(s.ctx, usersPref+user.Email, fromDomain(user)).Err()
 	if err != nil {
-		s.log.Error("database error", sl.Err(err))
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return -1, err
+	}
+
+	return version, nil
+}
+
+func (s *RedisUserStorage) DeleteUser(ctx context.Context, email string) error {
+	if len(email) == 0 {
+		return errors.New("email cannot be empty")
+	}
+
+	deleted, err := s.client.Del(ctx, userKey(email)).Result()
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return err
+	}
+	if deleted == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// Сколько ключей просматривает один вызов SCAN
+const listUsersScanCount = 100
+
+// ListUsers обходит пользователей командой SCAN, поэтому порядок не определён. Курсор "<курсор SCAN>:<пропуск>":
+// если пачка SCAN не поместилась в страницу, следующая страница повторяет её, пропуская уже возвращённых пользователей
+func (s *RedisUserStorage) ListUsers(ctx context.Context, query, cursor string, limit int) ([]model.User, string, error) {
+	if limit <= 0 {
+		return nil, "", errors.New("limit must be positive")
+	}
+
+	var (
+		scanCursor uint64
+		skip       int
+	)
+	if cursor != "" {
+		c, sk, ok := strings.Cut(cursor, ":")
+		var err1, err2 error
+		scanCursor, err1 = strconv.ParseUint(c, 10, 64)
+		skip, err2 = strconv.Atoi(sk)
+		if !ok || err1 != nil || err2 != nil || skip < 0 {
+			return nil, "", errors.New("invalid cursor")
+		}
+	}
+	query = strings.ToLower(query)
+
+	users := []model.User{}
+	for {
+		keys, nextCursor, err := s.client.Scan(ctx, scanCursor, usersPref+"*", listUsersScanCount).Result()
+		if err != nil {
+			s.log.ErrorContext(ctx, "database error", sl.Err(err))
+			return nil, "", err
+		}
+
+		matched := 0
+		for _, key := range keys {
+			email := strings.TrimPrefix(key, usersPref)
+			if !strings.Contains(strings.ToLower(email), query) {
+				continue
+			}
+			matched++
+			if matched <= skip {
+				continue
+			}
+			if len(users) == limit {
+				return users, strconv.FormatUint(scanCursor, 10) + ":" + strconv.Itoa(matched-1), nil
+			}
+
+			user, err := s.getUser(ctx, email)
+			// Пользователя удалили после SCAN
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			users = append(users, *user.toDomain())
+		}
+
+		if nextCursor == 0 {
+			return users, "", nil
+		}
+		scanCursor, skip = nextCursor, 0
+		if len(users) == limit {
+			return users, strconv.FormatUint(scanCursor, 10) + ":0", nil
+		}
+	}
+}
+
+func (s *RedisUserStorage) VerifyEmail(ctx context.Context, email string) error {
+	if len(email) == 0 {
+		return errors.New("email cannot be empty")
+	}
+
+	found, err := verifyEmailScript.Run(ctx, s.client, []string{userKey(email)}).Int()
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return err
+	}
+	if found == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+func (s *RedisUserStorage) incrementVersion(ctx context.Context, email, passwordHash, role string) (float64, error) {
+	if len(email) == 0 {
+		return -1, errors.New("email cannot be empty")
+	}
+
+	version, err := incrementVersionScript.Run(ctx, s.client, []string{userKey(email)}, passwordHash, role).Float64()
+	if err == redis.Nil {
+		return -1, errUserNotFound
+	}
+	if err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return -1, err
+	}
+
+	return version, nil
+}
+
+func (s *RedisUserStorage) getUser(ctx context.Context, email string) (*User, error) {
+	res := s.client.HGetAll(ctx, userKey(email))
+	if err := res.Err(); err != nil {
+		s.log.ErrorContext(ctx, "database error", sl.Err(err))
+		return nil, err
+	}
+	// HGETALL для отсутствующего ключа возвращает пустой ответ, а не redis.Nil
+	if len(res.Val()) == 0 {
+		return nil, errUserNotFound
+	}
+
+	userInfo := &User{}
+	if err := res.Scan(userInfo); err != nil {
+		return nil, err
 	}
-	return err
+	return userInfo, nil
 }
 
 func (s *RedisUserStorage) ShutDown(shutDownCtx context.Context) error {
@@ -0,0 +1,205 @@
+package redis
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	sl "lk-auth/internal/libs/logger"
+	"lk-auth/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	credentialPref      = "auth:webauthn:cred:"
+	userCredentialsPref = "auth:webauthn:user:"
+	ceremonyPref        = "auth:webauthn:ceremony:"
+)
+
+// Ключ и его запись в множестве ключей пользователя создаются вместе, существующий ключ не перезаписывается
+var addCredentialScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+redis.call("HSET", KEYS[1], unpack(ARGV, 2))
+redis.call("SADD", KEYS[2], ARGV[1])
+return 1
+`)
+
+// Счётчик подписей только растёт, даже если ответы аутентификатора обрабатываются не по порядку
+var updateSignCountScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+local current = tonumber(redis.call("HGET", KEYS[1], "signCount") or "0")
+if tonumber(ARGV[1]) > current then
+	redis.call("HSET", KEYS[1], "signCount", ARGV[1])
+end
+return 1
+`)
+
+// Ключи удаляются вместе с множеством ключей пользователя
+var deleteCredentialsScript = redis.NewScript(`
+local ids = redis.call("SMEMBERS", KEYS[1])
+for _, id in ipairs(ids) do
+	redis.call("DEL", ARGV[1] .. id)
+end
+redis.call("DEL", KEYS[1])
+return #ids
+`)
+
+type RedisWebAuthnStorage struct {
+	client *redis.Client
+	log    *slog.Logger
+}
+
+func NewRedisWebAuthnStorage(ctx context.Context, wg *sync.WaitGroup, options *redis.Options, log *slog.Logger, pingTime time.Duration) (storage.WebAuthnStorage, error) {
+	client := redis.NewClient(options)
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(os.Stdin, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+		}))
+	}
+
+	wg.Add(1)
+	go func() {
+		ticker := time.NewTicker(pingTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Debug("RedisWebAuthnStorage ping goroutine stopped")
+				wg.Done()
+				return
+			case <-ticker.C:
+				if err := client.Ping(ctx).Err(); err != nil {
+					log.Error("RedisWebAuthnStorage didn't answer", "url", options.Addr)
+				}
+			}
+		}
+	}()
+
+	return &RedisWebAuthnStorage{
+		client: client,
+		log:    log,
+	}, nil
+}
+
+func (s *RedisWebAuthnStorage) AddCredential(ctx context.Context, cred *model.WebAuthnCredential) error {
+	row := credentialFromDomain(cred)
+	added, err := addCredentialScript.Run(
+		ctx,
+		s.client,
+		[]string{credentialPref + row.ID, userCredentialsPref + row.Email},
+		append([]any{row.ID}, row.args()...)...,
+	).Int()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot save WebAuthn credential", sl.Err(err))
+		return err
+	}
+	if added == 0 {
+		return storage.ErrAlreadyExists
+	}
+
+	return nil
+}
+
+func (s *RedisWebAuthnStorage) GetCredential(ctx context.Context, id []byte) (*model.WebAuthnCredential, error) {
+	return s.getCredential(ctx, encodeBytes(id))
+}
+
+func (s *RedisWebAuthnStorage) ListCredentials(ctx context.Context, email string) ([]model.WebAuthnCredential, error) {
+	ids, err := s.client.SMembers(ctx, userCredentialsPref+email).Result()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot list WebAuthn credentials", sl.Err(err))
+		return nil, err
+	}
+
+	creds := make([]model.WebAuthnCredential, 0, len(ids))
+	for _, id := range ids {
+		cred, err := s.getCredential(ctx, id)
+		if err == storage.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, *cred)
+	}
+	slices.SortFunc(creds, func(a, b model.WebAuthnCredential) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return creds, nil
+}
+
+func (s *RedisWebAuthnStorage) UpdateSignCount(ctx context.Context, id []byte, signCount uint32) error {
+	res, err := updateSignCountScript.Run(ctx, s.client, []string{credentialPref + encodeBytes(id)}, signCount).Int()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot update WebAuthn sign count", sl.Err(err))
+		return err
+	}
+	if res == -1 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *RedisWebAuthnStorage) DeleteCredentials(ctx context.Context, email string) error {
+	err := deleteCredentialsScript.Run(ctx, s.client, []string{userCredentialsPref + email}, credentialPref).Err()
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot delete WebAuthn credentials", sl.Err(err))
+		return err
+	}
+	return nil
+}
+
+func (s *RedisWebAuthnStorage) SaveCeremony(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, ceremonyPref+id, data, ttl).Err()
+}
+
+func (s *RedisWebAuthnStorage) TakeCeremony(ctx context.Context, id string) ([]byte, error) {
+	data, err := s.client.GetDel(ctx, ceremonyPref+id).Bytes()
+	if err == redis.Nil {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		s.log.ErrorContext(ctx, "Cannot get WebAuthn ceremony", sl.Err(err))
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *RedisWebAuthnStorage) getCredential(ctx context.Context, id string) (*model.WebAuthnCredential, error) {
+	res := s.client.HGetAll(ctx, credentialPref+id)
+	if err := res.Err(); err != nil {
+		s.log.ErrorContext(ctx, "Cannot get WebAuthn credential", sl.Err(err))
+		return nil, err
+	}
+	// HGETALL для отсутствующего ключа возвращает пустой ответ, а не redis.Nil
+	if len(res.Val()) == 0 {
+		return nil, storage.ErrNotFound
+	}
+
+	row := WebAuthnCredential{}
+	if err := res.Scan(&row); err != nil {
+		return nil, err
+	}
+
+	return row.toDomain()
+}
+
+func (s *RedisWebAuthnStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.client.Close()
+}
@@ -2,25 +2,157 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
+
 	"lk-auth/internal/domain/model"
 )
 
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	// Пользователя нет или пароль неверен. Причины не различаются, чтобы нельзя было перебирать учётные записи
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// Пароль верен, но пользователь заблокирован администратором
+	ErrUserDisabled = errors.New("user is disabled")
+)
+
+// Операции хранилищ, кроме ShutDown, принимают контекст запроса: его отмена прерывает обращение к хранилищу,
+// а ID запроса из него попадает в записи журнала хранилища
 type BlackListStorage interface {
-	AddTokens(...string) error
-	IsAllowed(string) (bool, error) // true если токен не в чёрном списке
+	AddTokens(ctx context.Context, tokens ...string) error
+	IsAllowed(ctx context.Context, token string) (bool, error) // true если токен не в чёрном списке
 	ShutDown(context.Context) error
 }
 
 type JWTStorage interface {
-	AddPair(access string, refresh string) error
-	GetAccessByRefresh(string) (string, error)
+	AddPair(ctx context.Context, access string, refresh string) error
+	// Возвращает и удаляет access токен пары. Возвращает ErrNotFound, если пары нет, она истекла или уже получена
+	GetAccessByRefresh(ctx context.Context, refresh string) (string, error)
+
+	// Семейство - цепочка refresh токенов, полученных обновлениями из одного входа.
+	// Хранится только последний (действующий) refresh токен семейства.
+	AddFamily(ctx context.Context, family, refresh string) error
+	// Заменяет действующий токен семейства на next, только если им сейчас является current.
+	// Возвращает false, если current уже был заменён, и ErrNotFound, если семейство отозвано или истекло.
+	RotateFamily(ctx context.Context, family, current, next string) (bool, error)
+	GetFamilyHead(ctx context.Context, family string) (string, error)
+	DeleteFamily(ctx context.Context, family string) error
+
+	ShutDown(context.Context) error
+}
+
+type SessionStorage interface {
+	AddSession(ctx context.Context, session *model.Session) error
+	// Возвращает ErrNotFound, если сессия завершена или истекла
+	GetSession(ctx context.Context, id string) (*model.Session, error)
+	ListSessions(ctx context.Context, email string) ([]model.Session, error)
+	// Обновляет время последнего использования и сведения о клиенте
+	TouchSession(ctx context.Context, id string, client model.ClientInfo) error
+	DeleteSession(ctx context.Context, id string) error
 	ShutDown(context.Context) error
 }
 
+// Email пользователя сравнивается без учёта регистра: "Alice@x" и "alice@x" - одна учётная запись
 type UserStorage interface {
-	Login(email, password string) (dataVersion float64, role string, err error)
+	// Возвращает ErrInvalidCredentials, если пользователя нет или пароль неверен,
+	// и ErrUserDisabled, если пароль верен, но пользователь заблокирован
+	Login(ctx context.Context, email, password string) (dataVersion float64, role string, err error)
+	// Возвращает ErrNotFound, если пользователя нет
+	GetUser(ctx context.Context, email string) (*model.User, error)
 	// Проверка на соответствие версии данных
-	IsVersionValid(email string, version float64) (bool, error)
+	IsVersionValid(ctx context.Context, email string, version float64) (bool, error)
+	ShutDown(context.Context) error
+	// Возвращает ErrAlreadyExists, если пользователь с таким email уже есть
+	AddUser(ctx context.Context, user *model.User) error
+	// Увеличивает версию данных пользователя, делая недействительными все выданные ему токены
+	IncrementVersion(ctx context.Context, email string) (newVersion float64, err error)
+	// Атомарно заменяет хэш пароля и увеличивает версию данных
+	ChangePassword(ctx context.Context, email, passwordHash string) (newVersion float64, err error)
+	// Атомарно заменяет роль и увеличивает версию данных: токены со старой ролью становятся недействительными
+	ChangeRole(ctx context.Context, email, role string) (newVersion float64, err error)
+	// Отмечает email подтверждённым. Возвращает ErrNotFound, если пользователя нет
+	VerifyEmail(ctx context.Context, email string) error
+	// Атомарно блокирует или разблокирует пользователя и увеличивает версию данных
+	SetDisabled(ctx context.Context, email string, disabled bool) (newVersion float64, err error)
+	// Возвращает ErrNotFound, если пользователя нет
+	DeleteUser(ctx context.Context, email string) error
+	// Страница пользователей, email которых содержит query без учёта регистра. cursor - next предыдущей страницы,
+	// пустой для первой. Пустой next - последняя страница. Порядок задаёт хранилище
+	ListUsers(ctx context.Context, query, cursor string, limit int) (users []model.User, next string, err error)
+}
+
+// AuditStorage - журнал аудита. Записи только добавляются
+type AuditStorage interface {
+	AddRecord(ctx context.Context, rec *model.AuditRecord) error
+	// Записи, подходящие под filter, по возрастанию времени
+	ListRecords(ctx context.Context, filter model.AuditFilter) ([]model.AuditRecord, error)
+	ShutDown(context.Context) error
+}
+
+type MFAStorage interface {
+	// Возвращает ErrNotFound, если второй фактор не настроен
+	GetMFA(ctx context.Context, email string) (*model.MFA, error)
+	// Полностью заменяет настройки, включая коды восстановления
+	SetMFA(ctx context.Context, email string, mfa *model.MFA) error
+	DeleteMFA(ctx context.Context, email string) error
+	// Атомарно удаляет код восстановления. Возвращает false, если такого кода нет
+	UseRecoveryCode(ctx context.Context, email, codeHash string) (bool, error)
+	// Атомарно запоминает шаг принятого TOTP кода. Возвращает false, если код этого шага уже использован.
+	UseTOTPCounter(ctx context.Context, email string, counter int64) (bool, error)
+	ShutDown(context.Context) error
+}
+
+type WebAuthnStorage interface {
+	// Возвращает ErrAlreadyExists, если ключ с таким ID уже зарегистрирован
+	AddCredential(ctx context.Context, cred *model.WebAuthnCredential) error
+	// Возвращает ErrNotFound, если ключа нет
+	GetCredential(ctx context.Context, id []byte) (*model.WebAuthnCredential, error)
+	// Ключи пользователя в порядке регистрации, пустой список, если их нет
+	ListCredentials(ctx context.Context, email string) ([]model.WebAuthnCredential, error)
+	// Атомарно запоминает счётчик подписей, если он больше сохранённого.
+	// Возвращает ErrNotFound, если ключа нет.
+	UpdateSignCount(ctx context.Context, id []byte, signCount uint32) error
+	// Удаляет все ключи пользователя. Отсутствие ключей не ошибка
+	DeleteCredentials(ctx context.Context, email string) error
+
+	// Состояние начатой регистрации или входа (challenge) живёт ttl
+	SaveCeremony(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	// Возвращает и удаляет состояние, чтобы challenge нельзя было использовать повторно.
+	// Возвращает ErrNotFound, если состояния нет или оно истекло.
+	TakeCeremony(ctx context.Context, id string) ([]byte, error)
+
+	ShutDown(context.Context) error
+}
+
+// Счётчики неудачных попыток входа и временные блокировки.
+// Ключ задаёт вызывающий, например "account:<email>" или "ip:<адрес>".
+type LockoutStorage interface {
+	// Увеличивает счётчик неудач. Счётчик обнуляется, если window не было новых неудач
+	AddFailure(ctx context.Context, key string, window time.Duration) (failures int64, err error)
+	// Блокирует ключ на ttl. Действующая более длинная блокировка не сокращается
+	Lock(ctx context.Context, key string, ttl time.Duration) error
+	// Оставшееся время блокировки, 0 - блокировки нет
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Снимает блокировку и обнуляет счётчик
+	Reset(ctx context.Context, key string) error
+	ShutDown(context.Context) error
+}
+
+// Лимиты запросов по скользящему окну: число запросов за window оценивается как сумма запросов
+// текущего окна и доли предыдущего, пропорциональной ещё не истёкшей его части.
+type RateLimitStorage interface {
+	// Учитывает запрос по ключу, если за окно их было меньше limit. Отклонённые запросы не учитываются
+	Hit(ctx context.Context, key string, limit int64, window time.Duration) (model.RateLimit, error)
+	ShutDown(context.Context) error
+}
+
+// Одноразовые токены из писем (сброс пароля). Ключ - хэш токена
+type OneTimeTokenStorage interface {
+	SaveToken(ctx context.Context, hash string, token *model.OneTimeToken, ttl time.Duration) error
+	// Возвращает токен, не удаляя его, ErrNotFound - токена нет или он истёк
+	GetToken(ctx context.Context, hash string) (*model.OneTimeToken, error)
+	// Возвращает и удаляет токен, ErrNotFound - токена нет или он истёк
+	TakeToken(ctx context.Context, hash string) (*model.OneTimeToken, error)
 	ShutDown(context.Context) error
-	AddUser(*model.User) error
 }
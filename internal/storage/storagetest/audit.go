@@ -0,0 +1,137 @@
+package storagetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// AuditFactory создаёт пустой журнал аудита
+type AuditFactory func(t *testing.T) storage.AuditStorage
+
+func RunAuditSuite(t *testing.T, newStorage AuditFactory) {
+	// Время записей близко к текущему: Redis выбирает промежуток по времени добавления записи
+	start := time.Now().Truncate(time.Millisecond)
+	newRecord := func(i int, action, actor string) *model.AuditRecord {
+		return &model.AuditRecord{
+			Time:      start.Add(time.Duration(i) * time.Millisecond),
+			Action:    action,
+			Actor:     actor,
+			Subject:   "user@mail.com",
+			Details:   fmt.Sprint("record ", i),
+			IP:        "10.0.0.1",
+			UserAgent: "test",
+			Result:    "success",
+		}
+	}
+	// fill добавляет записи 0..4: вход user@mail.com, затем действия admin@mail.com
+	fill := func(t *testing.T, s storage.AuditStorage) []*model.AuditRecord {
+		records := []*model.AuditRecord{
+			newRecord(0, "auth.login", "user@mail.com"),
+			newRecord(1, "admin.user.get", "admin@mail.com"),
+			newRecord(2, "admin.user.disable", "admin@mail.com"),
+			newRecord(3, "admin.user.enable", "admin@mail.com"),
+			newRecord(4, "auth.login", "user@mail.com"),
+		}
+		records[2].Result = "failure"
+		records[2].Reason = "forbidden"
+		for _, rec := range records {
+			require.NoError(t, s.AddRecord(ctx, rec))
+		}
+		return records
+	}
+	details := func(records []model.AuditRecord) []string {
+		var ds []string
+		for _, rec := range records {
+			ds = append(ds, rec.Details)
+		}
+		return ds
+	}
+
+	t.Run("AddRecord and ListRecords", func(t *testing.T) {
+		s := newStorage(t)
+		want := fill(t, s)
+
+		got, err := s.ListRecords(ctx, model.AuditFilter{})
+		require.NoError(t, err)
+		require.Len(t, got, len(want))
+		for i := range want {
+			assert.True(t, want[i].Time.Equal(got[i].Time), "time of record %d", i)
+			got[i].Time = want[i].Time
+			assert.Equal(t, *want[i], got[i])
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		s := newStorage(t)
+
+		got, err := s.ListRecords(ctx, model.AuditFilter{})
+		assert.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		s := newStorage(t)
+		fill(t, s)
+
+		got, err := s.ListRecords(ctx, model.AuditFilter{Actor: "admin@mail.com"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"record 1", "record 2", "record 3"}, details(got))
+
+		got, err = s.ListRecords(ctx, model.AuditFilter{Action: "auth.login", Subject: "user@mail.com"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"record 0", "record 4"}, details(got))
+
+		got, err = s.ListRecords(ctx, model.AuditFilter{Subject: "other@mail.com"})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("time range", func(t *testing.T) {
+		s := newStorage(t)
+		fill(t, s)
+
+		// Начало промежутка включается, конец - нет
+		got, err := s.ListRecords(ctx, model.AuditFilter{
+			From: start.Add(1 * time.Millisecond),
+			To:   start.Add(3 * time.Millisecond),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"record 1", "record 2"}, details(got))
+
+		got, err = s.ListRecords(ctx, model.AuditFilter{From: start.Add(time.Hour)})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+
+		got, err = s.ListRecords(ctx, model.AuditFilter{To: start})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		s := newStorage(t)
+		fill(t, s)
+
+		got, err := s.ListRecords(ctx, model.AuditFilter{Actor: "admin@mail.com", Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"record 1", "record 2"}, details(got))
+	})
+
+	t.Run("concurrent AddRecord", func(t *testing.T) {
+		s := newStorage(t)
+
+		parallel(func(i int) {
+			assert.NoError(t, s.AddRecord(ctx, newRecord(i, "auth.refresh", "user@mail.com")))
+		})
+
+		got, err := s.ListRecords(ctx, model.AuditFilter{Action: "auth.refresh"})
+		require.NoError(t, err)
+		assert.Len(t, got, workers)
+	})
+}
@@ -0,0 +1,100 @@
+package storagetest
+
+import (
+	"testing"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/service/jwt"
+	"lk-auth/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// BlackListFactory создаёт пустое хранилище, которое определяет срок хранения токенов через jwtService
+type BlackListFactory func(t *testing.T, jwtService jwt.JWTService) (storage.BlackListStorage, Advance)
+
+func RunBlackListSuite(t *testing.T, newStorage BlackListFactory) {
+	const accessTTL = time.Minute
+
+	jwtService, err := jwt.NewJWTServiceImpl(
+		[]byte("a-string-secret-at-least-256-bits-long"),
+		accessTTL,
+		time.Hour,
+		nil,
+	)
+	require.NoError(t, err)
+
+	user := model.User{Email: "test@mail.com", Role: "user", Version: 1}
+	newToken := func(t *testing.T) string {
+		token, err := jwtService.CreateAccessToken(ctx, user, "session")
+		require.NoError(t, err)
+		return token
+	}
+
+	t.Run("unknown token is allowed", func(t *testing.T) {
+		s, _ := newStorage(t, jwtService)
+
+		allowed, err := s.IsAllowed(ctx, newToken(t))
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	})
+
+	t.Run("AddTokens", func(t *testing.T) {
+		s, _ := newStorage(t, jwtService)
+		first, second, other := newToken(t), newToken(t), newToken(t)
+		require.NoError(t, s.AddTokens(ctx, first, second))
+
+		for _, token := range []string{first, second} {
+			allowed, err := s.IsAllowed(ctx, token)
+			assert.NoError(t, err)
+			assert.False(t, allowed)
+		}
+
+		allowed, err := s.IsAllowed(ctx, other)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	})
+
+	t.Run("invalid token is skipped", func(t *testing.T) {
+		s, _ := newStorage(t, jwtService)
+		token := newToken(t)
+
+		assert.NoError(t, s.AddTokens(ctx, "not a token", token))
+		allowed, err := s.IsAllowed(ctx, token)
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+	})
+
+	t.Run("entry expires with the token", func(t *testing.T) {
+		s, advance := newStorage(t, jwtService)
+		token := newToken(t)
+		require.NoError(t, s.AddTokens(ctx, token))
+
+		advance(accessTTL / 2)
+		allowed, err := s.IsAllowed(ctx, token)
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+
+		advance(accessTTL/2 + 2*time.Second)
+		allowed, err = s.IsAllowed(ctx, token)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	})
+
+	t.Run("concurrent access", func(t *testing.T) {
+		s, _ := newStorage(t, jwtService)
+		tokens := make([]string, workers)
+		for i := range tokens {
+			tokens[i] = newToken(t)
+		}
+
+		parallel(func(i int) {
+			assert.NoError(t, s.AddTokens(ctx, tokens[i]))
+			allowed, err := s.IsAllowed(ctx, tokens[i])
+			assert.NoError(t, err)
+			assert.False(t, allowed)
+		})
+	})
+}
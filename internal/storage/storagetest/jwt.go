@@ -0,0 +1,142 @@
+package storagetest
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lk-auth/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// JWTFactory создаёт пустое хранилище, в котором записи живут ttl
+type JWTFactory func(t *testing.T, ttl time.Duration) (storage.JWTStorage, Advance)
+
+func RunJWTSuite(t *testing.T, newStorage JWTFactory) {
+	const ttl = time.Hour
+
+	t.Run("GetAccessByRefresh is one-shot", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+		require.NoError(t, s.AddPair(ctx, "access", "refresh"))
+
+		access, err := s.GetAccessByRefresh(ctx, "refresh")
+		assert.NoError(t, err)
+		assert.Equal(t, "access", access)
+
+		access, err = s.GetAccessByRefresh(ctx, "refresh")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		assert.Empty(t, access)
+	})
+
+	t.Run("GetAccessByRefresh unknown token", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+
+		access, err := s.GetAccessByRefresh(ctx, "unknown")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		assert.Empty(t, access)
+	})
+
+	t.Run("pair expires", func(t *testing.T) {
+		s, advance := newStorage(t, ttl)
+		require.NoError(t, s.AddPair(ctx, "access", "refresh"))
+
+		advance(ttl + time.Second)
+		_, err := s.GetAccessByRefresh(ctx, "refresh")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("GetAccessByRefresh concurrent", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+		require.NoError(t, s.AddPair(ctx, "access", "refresh"))
+
+		// Пару получает ровно один из одновременных запросов
+		var got atomic.Int32
+		parallel(func(int) {
+			if access, err := s.GetAccessByRefresh(ctx, "refresh"); err == nil && access == "access" {
+				got.Add(1)
+			}
+		})
+		assert.Equal(t, int32(1), got.Load())
+	})
+
+	t.Run("RotateFamily", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+		require.NoError(t, s.AddFamily(ctx, "family", "refresh_1"))
+
+		ok, err := s.RotateFamily(ctx, "family", "refresh_1", "refresh_2")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		// Повторный обмен уже заменённого токена
+		ok, err = s.RotateFamily(ctx, "family", "refresh_1", "refresh_3")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		head, err := s.GetFamilyHead(ctx, "family")
+		assert.NoError(t, err)
+		assert.Equal(t, "refresh_2", head)
+	})
+
+	t.Run("unknown family", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+
+		_, err := s.GetFamilyHead(ctx, "unknown")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		ok, err := s.RotateFamily(ctx, "unknown", "refresh_1", "refresh_2")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		assert.False(t, ok)
+	})
+
+	t.Run("DeleteFamily", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+		require.NoError(t, s.AddFamily(ctx, "family", "refresh_1"))
+		require.NoError(t, s.DeleteFamily(ctx, "family"))
+
+		_, err := s.GetFamilyHead(ctx, "family")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = s.RotateFamily(ctx, "family", "refresh_1", "refresh_2")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		// Удаление отсутствующего семейства не ошибка
+		assert.NoError(t, s.DeleteFamily(ctx, "family"))
+	})
+
+	t.Run("family expires unless rotated", func(t *testing.T) {
+		s, advance := newStorage(t, ttl)
+		require.NoError(t, s.AddFamily(ctx, "active", "refresh_1"))
+		require.NoError(t, s.AddFamily(ctx, "idle", "refresh_1"))
+
+		advance(ttl / 2)
+		ok, err := s.RotateFamily(ctx, "active", "refresh_1", "refresh_2")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		// Обмен продлевает жизнь семейства
+		advance(ttl/2 + time.Second)
+		head, err := s.GetFamilyHead(ctx, "active")
+		assert.NoError(t, err)
+		assert.Equal(t, "refresh_2", head)
+
+		_, err = s.GetFamilyHead(ctx, "idle")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("RotateFamily concurrent", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+		require.NoError(t, s.AddFamily(ctx, "family", "refresh_1"))
+
+		// Один и тот же токен обменивается успешно ровно один раз
+		var rotated atomic.Int32
+		parallel(func(i int) {
+			ok, err := s.RotateFamily(ctx, "family", "refresh_1", fmt.Sprintf("refresh_%d", i+2))
+			if err == nil && ok {
+				rotated.Add(1)
+			}
+		})
+		assert.Equal(t, int32(1), rotated.Load())
+	})
+}
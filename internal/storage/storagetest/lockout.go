@@ -0,0 +1,101 @@
+package storagetest
+
+import (
+	"testing"
+	"time"
+
+	"lk-auth/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// LockoutFactory создаёт пустое хранилище счётчиков неудачных попыток
+type LockoutFactory func(t *testing.T) (storage.LockoutStorage, Advance)
+
+func RunLockoutSuite(t *testing.T, newStorage LockoutFactory) {
+	const key = "account:test@mail.com"
+
+	t.Run("AddFailure counts within window", func(t *testing.T) {
+		s, advance := newStorage(t)
+
+		for i := int64(1); i <= 3; i++ {
+			failures, err := s.AddFailure(ctx, key, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, i, failures)
+			// Каждая неудача продлевает окно
+			advance(30 * time.Second)
+		}
+
+		advance(time.Minute)
+		failures, err := s.AddFailure(ctx, key, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), failures)
+
+		failures, err = s.AddFailure(ctx, "ip:127.0.0.1", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), failures)
+	})
+
+	t.Run("Lock and LockedFor", func(t *testing.T) {
+		s, advance := newStorage(t)
+
+		locked, err := s.LockedFor(ctx, key)
+		require.NoError(t, err)
+		assert.Zero(t, locked)
+
+		require.NoError(t, s.Lock(ctx, key, time.Minute))
+		locked, err = s.LockedFor(ctx, key)
+		require.NoError(t, err)
+		assert.InDelta(t, time.Minute, locked, float64(time.Second))
+
+		advance(time.Minute)
+		locked, err = s.LockedFor(ctx, key)
+		require.NoError(t, err)
+		assert.Zero(t, locked)
+	})
+
+	t.Run("Lock does not shorten", func(t *testing.T) {
+		s, _ := newStorage(t)
+		require.NoError(t, s.Lock(ctx, key, time.Hour))
+		require.NoError(t, s.Lock(ctx, key, time.Minute))
+
+		locked, err := s.LockedFor(ctx, key)
+		require.NoError(t, err)
+		assert.InDelta(t, time.Hour, locked, float64(time.Second))
+
+		require.NoError(t, s.Lock(ctx, key, 2*time.Hour))
+		locked, err = s.LockedFor(ctx, key)
+		require.NoError(t, err)
+		assert.InDelta(t, 2*time.Hour, locked, float64(time.Second))
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		s, _ := newStorage(t)
+		_, err := s.AddFailure(ctx, key, time.Minute)
+		require.NoError(t, err)
+		require.NoError(t, s.Lock(ctx, key, time.Minute))
+
+		require.NoError(t, s.Reset(ctx, key))
+		locked, err := s.LockedFor(ctx, key)
+		require.NoError(t, err)
+		assert.Zero(t, locked)
+		failures, err := s.AddFailure(ctx, key, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), failures)
+
+		assert.NoError(t, s.Reset(ctx, "unknown"))
+	})
+
+	t.Run("AddFailure concurrent", func(t *testing.T) {
+		s, _ := newStorage(t)
+
+		parallel(func(int) {
+			_, err := s.AddFailure(ctx, key, time.Minute)
+			assert.NoError(t, err)
+		})
+		failures, err := s.AddFailure(ctx, key, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(workers+1), failures)
+	})
+}
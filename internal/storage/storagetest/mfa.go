@@ -0,0 +1,150 @@
+package storagetest
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MFAFactory создаёт пустое хранилище настроек второго фактора
+type MFAFactory func(t *testing.T) storage.MFAStorage
+
+func RunMFASuite(t *testing.T, newStorage MFAFactory) {
+	const email = "test@mail.com"
+
+	newMFA := func() *model.MFA {
+		return &model.MFA{
+			Secret:        "JBSWY3DPEHPK3PXP",
+			Confirmed:     true,
+			RecoveryCodes: []string{"hash_1", "hash_2"},
+			LastCounter:   10,
+		}
+	}
+
+	t.Run("SetMFA and GetMFA", func(t *testing.T) {
+		s := newStorage(t)
+		mfa := newMFA()
+		require.NoError(t, s.SetMFA(ctx, email, mfa))
+
+		got, err := s.GetMFA(ctx, email)
+		require.NoError(t, err)
+		assert.Equal(t, mfa.Secret, got.Secret)
+		assert.Equal(t, mfa.Confirmed, got.Confirmed)
+		assert.Equal(t, mfa.LastCounter, got.LastCounter)
+		assert.ElementsMatch(t, mfa.RecoveryCodes, got.RecoveryCodes)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		s := newStorage(t)
+
+		_, err := s.GetMFA(ctx, email)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		ok, err := s.UseTOTPCounter(ctx, email, 1)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		assert.False(t, ok)
+
+		ok, err = s.UseRecoveryCode(ctx, email, "hash_1")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("SetMFA replaces settings", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.SetMFA(ctx, email, newMFA()))
+		require.NoError(t, s.SetMFA(ctx, email, &model.MFA{Secret: "NEWSECRET"}))
+
+		got, err := s.GetMFA(ctx, email)
+		require.NoError(t, err)
+		assert.Equal(t, "NEWSECRET", got.Secret)
+		assert.False(t, got.Confirmed)
+		assert.Empty(t, got.RecoveryCodes)
+		assert.Zero(t, got.LastCounter)
+	})
+
+	t.Run("DeleteMFA", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.SetMFA(ctx, email, newMFA()))
+		require.NoError(t, s.DeleteMFA(ctx, email))
+
+		_, err := s.GetMFA(ctx, email)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		ok, err := s.UseRecoveryCode(ctx, email, "hash_1")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.NoError(t, s.DeleteMFA(ctx, email))
+	})
+
+	t.Run("recovery code is single-use", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.SetMFA(ctx, email, newMFA()))
+
+		ok, err := s.UseRecoveryCode(ctx, email, "hash_1")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = s.UseRecoveryCode(ctx, email, "hash_1")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		got, err := s.GetMFA(ctx, email)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"hash_2"}, got.RecoveryCodes)
+	})
+
+	t.Run("UseTOTPCounter rejects replay", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.SetMFA(ctx, email, newMFA()))
+
+		for _, c := range []struct {
+			counter int64
+			ok      bool
+		}{{9, false}, {10, false}, {11, true}, {11, false}, {13, true}, {12, false}} {
+			ok, err := s.UseTOTPCounter(ctx, email, c.counter)
+			assert.NoError(t, err)
+			assert.Equal(t, c.ok, ok, "counter %d", c.counter)
+		}
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		s := newStorage(t)
+		mfa := newMFA()
+		mfa.RecoveryCodes = []string{"hash"}
+		require.NoError(t, s.SetMFA(ctx, email, mfa))
+
+		// Один код восстановления и один шаг TOTP принимаются ровно один раз
+		var codes, counters atomic.Int32
+		parallel(func(int) {
+			if ok, err := s.UseRecoveryCode(ctx, email, "hash"); err == nil && ok {
+				codes.Add(1)
+			}
+			if ok, err := s.UseTOTPCounter(ctx, email, 11); err == nil && ok {
+				counters.Add(1)
+			}
+		})
+		assert.Equal(t, int32(1), codes.Load())
+		assert.Equal(t, int32(1), counters.Load())
+	})
+
+	t.Run("users are independent", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.SetMFA(ctx, email, newMFA()))
+		other := fmt.Sprintf("other_%s", email)
+		require.NoError(t, s.SetMFA(ctx, other, newMFA()))
+
+		ok, err := s.UseRecoveryCode(ctx, email, "hash_1")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = s.UseRecoveryCode(ctx, other, "hash_1")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
@@ -0,0 +1,107 @@
+package storagetest
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lk-auth/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RateLimitFactory создаёт пустое хранилище лимитов запросов
+type RateLimitFactory func(t *testing.T) (storage.RateLimitStorage, Advance)
+
+func RunRateLimitSuite(t *testing.T, newStorage RateLimitFactory) {
+	const (
+		key    = "login:ip:127.0.0.1"
+		limit  = 5
+		window = time.Minute
+	)
+
+	t.Run("Hit allows up to limit", func(t *testing.T) {
+		s, _ := newStorage(t)
+
+		for i := range int64(limit) {
+			res, err := s.Hit(ctx, key, limit, window)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+			assert.Equal(t, int64(limit), res.Limit)
+			assert.Equal(t, limit-1-i, res.Remaining)
+			assert.Zero(t, res.RetryAfter)
+			assert.Positive(t, res.Reset)
+			assert.LessOrEqual(t, res.Reset, window)
+		}
+
+		res, err := s.Hit(ctx, key, limit, window)
+		require.NoError(t, err)
+		assert.False(t, res.Allowed)
+		assert.Zero(t, res.Remaining)
+		assert.Positive(t, res.RetryAfter)
+		assert.LessOrEqual(t, res.RetryAfter, 2*window)
+
+		res, err = s.Hit(ctx, "login:ip:10.0.0.1", limit, window)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("Hit allows again after RetryAfter", func(t *testing.T) {
+		s, advance := newStorage(t)
+
+		for range limit {
+			_, err := s.Hit(ctx, key, limit, window)
+			require.NoError(t, err)
+		}
+		res, err := s.Hit(ctx, key, limit, window)
+		require.NoError(t, err)
+		require.False(t, res.Allowed)
+		retryAfter := res.RetryAfter
+
+		// Оценка числа запросов в окне убывает плавно: на полпути лимит ещё исчерпан
+		advance(retryAfter / 2)
+		res, err = s.Hit(ctx, key, limit, window)
+		require.NoError(t, err)
+		assert.False(t, res.Allowed)
+
+		// Отклонённые запросы не учитываются и не отодвигают момент, когда запрос снова разрешён
+		advance(retryAfter - retryAfter/2)
+		res, err = s.Hit(ctx, key, limit, window)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+
+		res, err = s.Hit(ctx, key, limit, window)
+		require.NoError(t, err)
+		assert.False(t, res.Allowed)
+	})
+
+	t.Run("Hit forgets after two windows", func(t *testing.T) {
+		s, advance := newStorage(t)
+
+		for range limit {
+			_, err := s.Hit(ctx, key, limit, window)
+			require.NoError(t, err)
+		}
+
+		advance(2 * window)
+		res, err := s.Hit(ctx, key, limit, window)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, int64(limit-1), res.Remaining)
+	})
+
+	t.Run("Concurrent Hit does not exceed limit", func(t *testing.T) {
+		s, _ := newStorage(t)
+
+		var allowed atomic.Int64
+		parallel(func(int) {
+			res, err := s.Hit(ctx, key, workers/2, window)
+			assert.NoError(t, err)
+			if res.Allowed {
+				allowed.Add(1)
+			}
+		})
+		assert.Equal(t, int64(workers/2), allowed.Load())
+	})
+}
@@ -0,0 +1,137 @@
+package storagetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// SessionFactory создаёт пустое хранилище, в котором неиспользуемые сессии живут ttl
+type SessionFactory func(t *testing.T, ttl time.Duration) (storage.SessionStorage, Advance)
+
+func RunSessionSuite(t *testing.T, newStorage SessionFactory) {
+	const ttl = time.Hour
+
+	// Время хранится с точностью до секунды
+	now := time.Unix(time.Now().Unix(), 0)
+	newSession := func(id, email string, lastUsedAt time.Time) *model.Session {
+		return &model.Session{
+			ID:         id,
+			Email:      email,
+			CreatedAt:  now,
+			LastUsedAt: lastUsedAt,
+			IP:         "127.0.0.1",
+			UserAgent:  "test",
+		}
+	}
+
+	t.Run("AddSession and GetSession", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+		session := newSession("session", "test@mail.com", now)
+		require.NoError(t, s.AddSession(ctx, session))
+
+		got, err := s.GetSession(ctx, "session")
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, got.ID)
+		assert.Equal(t, session.Email, got.Email)
+		assert.True(t, session.CreatedAt.Equal(got.CreatedAt))
+		assert.True(t, session.LastUsedAt.Equal(got.LastUsedAt))
+		assert.Equal(t, session.IP, got.IP)
+		assert.Equal(t, session.UserAgent, got.UserAgent)
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+
+		_, err := s.GetSession(ctx, "unknown")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		assert.ErrorIs(t, s.TouchSession(ctx, "unknown", model.ClientInfo{}), storage.ErrNotFound)
+		assert.NoError(t, s.DeleteSession(ctx, "unknown"))
+
+		sessions, err := s.ListSessions(ctx, "unknown@mail.com")
+		assert.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("ListSessions", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+		require.NoError(t, s.AddSession(ctx, newSession("old", "test@mail.com", now.Add(-time.Minute))))
+		require.NoError(t, s.AddSession(ctx, newSession("new", "test@mail.com", now)))
+		require.NoError(t, s.AddSession(ctx, newSession("other", "other@mail.com", now)))
+
+		sessions, err := s.ListSessions(ctx, "test@mail.com")
+		require.NoError(t, err)
+		// Сначала последние использованные
+		require.Len(t, sessions, 2)
+		assert.Equal(t, "new", sessions[0].ID)
+		assert.Equal(t, "old", sessions[1].ID)
+	})
+
+	t.Run("TouchSession", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+		require.NoError(t, s.AddSession(ctx, newSession("session", "test@mail.com", now.Add(-time.Minute))))
+
+		client := model.ClientInfo{IP: "10.0.0.1", UserAgent: "other"}
+		require.NoError(t, s.TouchSession(ctx, "session", client))
+
+		got, err := s.GetSession(ctx, "session")
+		require.NoError(t, err)
+		assert.Equal(t, client.IP, got.IP)
+		assert.Equal(t, client.UserAgent, got.UserAgent)
+		assert.True(t, got.LastUsedAt.After(now.Add(-time.Minute)))
+		assert.True(t, now.Equal(got.CreatedAt))
+	})
+
+	t.Run("DeleteSession", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+		require.NoError(t, s.AddSession(ctx, newSession("first", "test@mail.com", now)))
+		require.NoError(t, s.AddSession(ctx, newSession("second", "test@mail.com", now)))
+		require.NoError(t, s.DeleteSession(ctx, "first"))
+
+		// Обновление завершённой сессии не восстанавливает её
+		assert.ErrorIs(t, s.TouchSession(ctx, "first", model.ClientInfo{IP: "10.0.0.1"}), storage.ErrNotFound)
+		_, err := s.GetSession(ctx, "first")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		sessions, err := s.ListSessions(ctx, "test@mail.com")
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "second", sessions[0].ID)
+	})
+
+	t.Run("session expires unless touched", func(t *testing.T) {
+		s, advance := newStorage(t, ttl)
+		require.NoError(t, s.AddSession(ctx, newSession("active", "test@mail.com", now)))
+		require.NoError(t, s.AddSession(ctx, newSession("idle", "test@mail.com", now)))
+
+		advance(ttl / 2)
+		require.NoError(t, s.TouchSession(ctx, "active", model.ClientInfo{}))
+
+		advance(ttl/2 + time.Second)
+		_, err := s.GetSession(ctx, "idle")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		sessions, err := s.ListSessions(ctx, "test@mail.com")
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, "active", sessions[0].ID)
+	})
+
+	t.Run("AddSession concurrent", func(t *testing.T) {
+		s, _ := newStorage(t, ttl)
+
+		parallel(func(i int) {
+			assert.NoError(t, s.AddSession(ctx, newSession(fmt.Sprintf("session_%d", i), "test@mail.com", now)))
+		})
+
+		sessions, err := s.ListSessions(ctx, "test@mail.com")
+		assert.NoError(t, err)
+		assert.Len(t, sessions, workers)
+	})
+}
@@ -0,0 +1,43 @@
+// Пакет storagetest содержит общие наборы тестов для реализаций интерфейсов пакета storage.
+// Каждая реализация должна проходить их без исключений:
+//
+//	func TestJWTStorage(t *testing.T) {
+//		storagetest.RunJWTSuite(t, func(t *testing.T, ttl time.Duration) (storage.JWTStorage, storagetest.Advance) {
+//			...
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Контекст операций хранилищ в наборах тестов
+var ctx = context.Background()
+
+// Advance сдвигает время хранилища вперёд, чтобы проверить истечение записей без ожидания.
+// Для Redis это FastForward у miniredis, для хранилищ в памяти - подменённые часы.
+type Advance func(time.Duration)
+
+// Количество горутин в проверках конкурентного доступа
+const workers = 16
+
+// parallel запускает fn в workers горутинах одновременно и ждёт их завершения
+func parallel(fn func(i int)) {
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+	)
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			fn(i)
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
@@ -0,0 +1,81 @@
+package storagetest
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// OneTimeTokenFactory создаёт пустое хранилище одноразовых токенов
+type OneTimeTokenFactory func(t *testing.T) (storage.OneTimeTokenStorage, Advance)
+
+func RunOneTimeTokenSuite(t *testing.T, newStorage OneTimeTokenFactory) {
+	token := &model.OneTimeToken{
+		Purpose: model.TokenPurposePasswordReset,
+		Email:   "test@mail.com",
+		Version: 3,
+	}
+
+	t.Run("GetToken keeps the token", func(t *testing.T) {
+		s, advance := newStorage(t)
+		require.NoError(t, s.SaveToken(ctx, "hash", token, time.Minute))
+
+		got, err := s.GetToken(ctx, "hash")
+		require.NoError(t, err)
+		assert.Equal(t, token, got)
+		got, err = s.TakeToken(ctx, "hash")
+		require.NoError(t, err)
+		assert.Equal(t, token, got)
+
+		_, err = s.GetToken(ctx, "hash")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		require.NoError(t, s.SaveToken(ctx, "expiring", token, time.Minute))
+		advance(time.Minute + time.Second)
+		_, err = s.GetToken(ctx, "expiring")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("TakeToken is single-use", func(t *testing.T) {
+		s, _ := newStorage(t)
+		require.NoError(t, s.SaveToken(ctx, "hash", token, time.Minute))
+
+		got, err := s.TakeToken(ctx, "hash")
+		require.NoError(t, err)
+		assert.Equal(t, token, got)
+
+		_, err = s.TakeToken(ctx, "hash")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		_, err = s.TakeToken(ctx, "unknown")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("TakeToken after expiry", func(t *testing.T) {
+		s, advance := newStorage(t)
+		require.NoError(t, s.SaveToken(ctx, "hash", token, time.Minute))
+
+		advance(time.Minute + time.Second)
+		_, err := s.TakeToken(ctx, "hash")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("Concurrent TakeToken", func(t *testing.T) {
+		s, _ := newStorage(t)
+		require.NoError(t, s.SaveToken(ctx, "hash", token, time.Minute))
+
+		var taken atomic.Int64
+		parallel(func(int) {
+			if _, err := s.TakeToken(ctx, "hash"); err == nil {
+				taken.Add(1)
+			}
+		})
+		assert.Equal(t, int64(1), taken.Load())
+	})
+}
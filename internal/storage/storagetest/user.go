@@ -0,0 +1,384 @@
+package storagetest
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/libs/hash"
+	"lk-auth/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserFactory создаёт пустое хранилище пользователей
+type UserFactory func(t *testing.T) storage.UserStorage
+
+func RunUserSuite(t *testing.T, newStorage UserFactory) {
+	const (
+		email    = "test@mail.com"
+		password = "password"
+	)
+
+	newUser := func(t *testing.T, email, password string) *model.User {
+		passwordHash, err := hash.Default().Hash(password)
+		require.NoError(t, err)
+		return &model.User{Email: email, PasswordHash: passwordHash, Role: "user", Version: 1}
+	}
+
+	t.Run("AddUser and Login", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		version, role, err := s.Login(ctx, email, password)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(1), version)
+		assert.Equal(t, "user", role)
+	})
+
+	t.Run("duplicate email", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		assert.ErrorIs(t, s.AddUser(ctx, newUser(t, email, "other")), storage.ErrAlreadyExists)
+		// Существующая запись не перезаписана
+		_, _, err := s.Login(ctx, email, password)
+		assert.NoError(t, err)
+	})
+
+	t.Run("email is case-insensitive", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+		upper := strings.ToUpper(email)
+
+		assert.ErrorIs(t, s.AddUser(ctx, newUser(t, upper, password)), storage.ErrAlreadyExists)
+
+		version, _, err := s.Login(ctx, upper, password)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(1), version)
+
+		user, err := s.GetUser(ctx, upper)
+		require.NoError(t, err)
+		assert.Equal(t, email, user.Email)
+
+		version, err = s.IncrementVersion(ctx, upper)
+		assert.NoError(t, err)
+		ok, err := s.IsVersionValid(ctx, email, version)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		require.NoError(t, s.DeleteUser(ctx, upper))
+		_, err = s.GetUser(ctx, email)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("AddUser nil", func(t *testing.T) {
+		s := newStorage(t)
+		assert.Error(t, s.AddUser(ctx, nil))
+	})
+
+	t.Run("Login failures", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		cases := []struct {
+			name     string
+			email    string
+			password string
+		}{
+			{"wrong password", email, "wrong"},
+			{"unknown user", "unknown@mail.com", password},
+			{"empty email", "", password},
+			{"empty password", email, ""},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				version, _, err := s.Login(ctx, c.email, c.password)
+				// Причина неудачи не раскрывается
+				assert.ErrorIs(t, err, storage.ErrInvalidCredentials)
+				assert.Equal(t, storage.ErrInvalidCredentials.Error(), err.Error())
+				assert.Equal(t, float64(-1), version)
+			})
+		}
+	})
+
+	t.Run("GetUser", func(t *testing.T) {
+		s := newStorage(t)
+		user := newUser(t, email, password)
+		require.NoError(t, s.AddUser(ctx, user))
+
+		got, err := s.GetUser(ctx, email)
+		require.NoError(t, err)
+		assert.Equal(t, user, got)
+
+		_, err = s.GetUser(ctx, "unknown@mail.com")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = s.GetUser(ctx, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("IsVersionValid", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		ok, err := s.IsVersionValid(ctx, email, 1)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = s.IsVersionValid(ctx, email, 2)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		_, err = s.IsVersionValid(ctx, "unknown@mail.com", 1)
+		assert.Error(t, err)
+		_, err = s.IsVersionValid(ctx, "", 1)
+		assert.Error(t, err)
+	})
+
+	t.Run("IncrementVersion", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		version, err := s.IncrementVersion(ctx, email)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(2), version)
+
+		ok, err := s.IsVersionValid(ctx, email, 1)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		ok, err = s.IsVersionValid(ctx, email, 2)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		_, err = s.IncrementVersion(ctx, "unknown@mail.com")
+		assert.Error(t, err)
+		// Увеличение версии не создаёт пользователя
+		_, err = s.IsVersionValid(ctx, "unknown@mail.com", 1)
+		assert.Error(t, err)
+	})
+
+	t.Run("ChangePassword", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		passwordHash, err := hash.Default().Hash("new-password")
+		require.NoError(t, err)
+		version, err := s.ChangePassword(ctx, email, passwordHash)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(2), version)
+
+		_, _, err = s.Login(ctx, email, password)
+		assert.Error(t, err)
+		version, role, err := s.Login(ctx, email, "new-password")
+		assert.NoError(t, err)
+		assert.Equal(t, float64(2), version)
+		assert.Equal(t, "user", role)
+
+		_, err = s.ChangePassword(ctx, email, "")
+		assert.Error(t, err)
+		_, err = s.ChangePassword(ctx, "unknown@mail.com", passwordHash)
+		assert.Error(t, err)
+	})
+
+	t.Run("ChangeRole", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		version, err := s.ChangeRole(ctx, email, "admin")
+		assert.NoError(t, err)
+		assert.Equal(t, float64(2), version)
+
+		version, role, err := s.Login(ctx, email, password)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(2), version)
+		assert.Equal(t, "admin", role)
+		got, err := s.GetUser(ctx, email)
+		require.NoError(t, err)
+		assert.Equal(t, "admin", got.Role)
+
+		_, err = s.ChangeRole(ctx, email, "")
+		assert.Error(t, err)
+		_, err = s.ChangeRole(ctx, "unknown@mail.com", "admin")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = s.GetUser(ctx, "unknown@mail.com")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("SetDisabled", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		version, err := s.SetDisabled(ctx, email, true)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(2), version)
+		got, err := s.GetUser(ctx, email)
+		require.NoError(t, err)
+		assert.True(t, got.Disabled)
+
+		// Заблокированный пользователь узнаёт о блокировке, только если пароль верен
+		_, _, err = s.Login(ctx, email, password)
+		assert.ErrorIs(t, err, storage.ErrUserDisabled)
+		_, _, err = s.Login(ctx, email, "wrong")
+		assert.ErrorIs(t, err, storage.ErrInvalidCredentials)
+
+		version, err = s.SetDisabled(ctx, email, false)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(3), version)
+		_, _, err = s.Login(ctx, email, password)
+		assert.NoError(t, err)
+
+		_, err = s.SetDisabled(ctx, "unknown@mail.com", true)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = s.GetUser(ctx, "unknown@mail.com")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("DeleteUser", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		require.NoError(t, s.DeleteUser(ctx, email))
+		_, err := s.GetUser(ctx, email)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, _, err = s.Login(ctx, email, password)
+		assert.ErrorIs(t, err, storage.ErrInvalidCredentials)
+
+		assert.ErrorIs(t, s.DeleteUser(ctx, email), storage.ErrNotFound)
+		assert.Error(t, s.DeleteUser(ctx, ""))
+		// Email освободился
+		assert.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+	})
+
+	t.Run("ListUsers", func(t *testing.T) {
+		s := newStorage(t)
+		emails := []string{"alice@mail.com", "Bob@mail.com", "carol@example.com", "dave@mail.com", "eve@mail.com"}
+		for _, e := range emails {
+			// Хэш не проверяется, поэтому не вычисляется
+			require.NoError(t, s.AddUser(ctx, &model.User{Email: e, PasswordHash: "hash", Role: "user", Version: 1}))
+		}
+
+		list := func(query string, limit int) []string {
+			var (
+				found  []string
+				cursor string
+			)
+			for range len(emails) + 1 {
+				users, next, err := s.ListUsers(ctx, query, cursor, limit)
+				require.NoError(t, err)
+				assert.LessOrEqual(t, len(users), limit)
+				for _, u := range users {
+					found = append(found, u.Email)
+				}
+				if next == "" {
+					return found
+				}
+				cursor = next
+			}
+			t.Fatal("pagination did not terminate")
+			return nil
+		}
+
+		assert.ElementsMatch(t, emails, list("", 2))
+		assert.ElementsMatch(t, emails, list("", 100))
+		// Поиск по подстроке без учёта регистра
+		assert.ElementsMatch(t, []string{"Bob@mail.com"}, list("BOB", 2))
+		assert.ElementsMatch(t, []string{"carol@example.com"}, list("example", 1))
+		assert.Empty(t, list("%", 2))
+
+		_, _, err := s.ListUsers(ctx, "", "", 0)
+		assert.Error(t, err)
+	})
+
+	t.Run("Login rehashes legacy bcrypt hash", func(t *testing.T) {
+		s := newStorage(t)
+		legacy, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		require.NoError(t, err)
+		require.NoError(t, s.AddUser(ctx, &model.User{Email: email, PasswordHash: string(legacy), Role: "user", Version: 1}))
+
+		version, _, err := s.Login(ctx, email, password)
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), version)
+
+		got, err := s.GetUser(ctx, email)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(got.PasswordHash, "$argon2id$"), got.PasswordHash)
+		// Пересчёт хэша не меняет версию данных: выданные токены остаются действительными
+		assert.Equal(t, float64(1), got.Version)
+
+		_, _, err = s.Login(ctx, email, password)
+		assert.NoError(t, err)
+		_, _, err = s.Login(ctx, email, "wrong")
+		assert.ErrorIs(t, err, storage.ErrInvalidCredentials)
+	})
+
+	t.Run("VerifyEmail", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		got, err := s.GetUser(ctx, email)
+		require.NoError(t, err)
+		assert.False(t, got.EmailVerified)
+
+		require.NoError(t, s.VerifyEmail(ctx, email))
+		got, err = s.GetUser(ctx, email)
+		require.NoError(t, err)
+		assert.True(t, got.EmailVerified)
+		// Подтверждение адреса не меняет версию данных: выданные токены остаются действительными
+		assert.Equal(t, float64(1), got.Version)
+
+		// Повторное подтверждение не ошибка
+		assert.NoError(t, s.VerifyEmail(ctx, email))
+
+		err = s.VerifyEmail(ctx, "unknown@mail.com")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = s.GetUser(ctx, "unknown@mail.com")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		assert.Error(t, s.VerifyEmail(ctx, ""))
+	})
+
+	t.Run("IncrementVersion concurrent", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.AddUser(ctx, newUser(t, email, password)))
+
+		versions := make([]float64, workers)
+		parallel(func(i int) {
+			version, err := s.IncrementVersion(ctx, email)
+			assert.NoError(t, err)
+			versions[i] = version
+		})
+
+		// Ни одно увеличение не потеряно, и каждый вызов получил свою версию
+		assert.ElementsMatch(t, expectedVersions(), versions)
+		ok, err := s.IsVersionValid(ctx, email, float64(1+workers))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("AddUser concurrent", func(t *testing.T) {
+		s := newStorage(t)
+		users := make([]*model.User, workers)
+		for i := range users {
+			users[i] = newUser(t, email, fmt.Sprintf("password_%d", i))
+		}
+
+		var added atomic.Int32
+		parallel(func(i int) {
+			if s.AddUser(ctx, users[i]) == nil {
+				added.Add(1)
+			}
+		})
+		assert.Equal(t, int32(1), added.Load())
+	})
+}
+
+func expectedVersions() []float64 {
+	versions := make([]float64, workers)
+	for i := range versions {
+		versions[i] = float64(i + 2)
+	}
+	return versions
+}
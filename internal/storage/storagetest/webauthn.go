@@ -0,0 +1,182 @@
+package storagetest
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// WebAuthnFactory создаёт пустое хранилище ключей доступа
+type WebAuthnFactory func(t *testing.T) (storage.WebAuthnStorage, Advance)
+
+func RunWebAuthnSuite(t *testing.T, newStorage WebAuthnFactory) {
+	const email = "test@mail.com"
+
+	// Время с точностью до секунды: Redis хранит его в Unix секундах
+	created := time.Now().Truncate(time.Second)
+	newCredential := func(id string, email string) *model.WebAuthnCredential {
+		return &model.WebAuthnCredential{
+			ID:              []byte(id),
+			Email:           email,
+			UserHandle:      []byte("handle_" + email),
+			PublicKey:       []byte("public_key_" + id),
+			AttestationType: "none",
+			Transports:      []string{"internal", "hybrid"},
+			AAGUID:          make([]byte, 16),
+			SignCount:       5,
+			BackupEligible:  true,
+			BackupState:     true,
+			CreatedAt:       created,
+		}
+	}
+
+	t.Run("AddCredential and GetCredential", func(t *testing.T) {
+		s, _ := newStorage(t)
+		cred := newCredential("cred_1", email)
+		require.NoError(t, s.AddCredential(ctx, cred))
+
+		got, err := s.GetCredential(ctx, cred.ID)
+		require.NoError(t, err)
+		assert.Equal(t, cred.ID, got.ID)
+		assert.Equal(t, cred.Email, got.Email)
+		assert.Equal(t, cred.UserHandle, got.UserHandle)
+		assert.Equal(t, cred.PublicKey, got.PublicKey)
+		assert.Equal(t, cred.AttestationType, got.AttestationType)
+		assert.Equal(t, cred.Transports, got.Transports)
+		assert.Equal(t, cred.AAGUID, got.AAGUID)
+		assert.Equal(t, cred.SignCount, got.SignCount)
+		assert.True(t, got.BackupEligible)
+		assert.True(t, got.BackupState)
+		assert.True(t, cred.CreatedAt.Equal(got.CreatedAt))
+
+		_, err = s.GetCredential(ctx, []byte("unknown"))
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("duplicate credential", func(t *testing.T) {
+		s, _ := newStorage(t)
+		require.NoError(t, s.AddCredential(ctx, newCredential("cred_1", email)))
+
+		err := s.AddCredential(ctx, newCredential("cred_1", "other@mail.com"))
+		assert.ErrorIs(t, err, storage.ErrAlreadyExists)
+
+		// Ключ остался за первым владельцем
+		got, err := s.GetCredential(ctx, []byte("cred_1"))
+		require.NoError(t, err)
+		assert.Equal(t, email, got.Email)
+		creds, err := s.ListCredentials(ctx, "other@mail.com")
+		assert.NoError(t, err)
+		assert.Empty(t, creds)
+	})
+
+	t.Run("ListCredentials", func(t *testing.T) {
+		s, _ := newStorage(t)
+
+		creds, err := s.ListCredentials(ctx, email)
+		assert.NoError(t, err)
+		assert.Empty(t, creds)
+
+		first := newCredential("cred_1", email)
+		second := newCredential("cred_2", email)
+		second.CreatedAt = created.Add(time.Minute)
+		require.NoError(t, s.AddCredential(ctx, second))
+		require.NoError(t, s.AddCredential(ctx, first))
+		require.NoError(t, s.AddCredential(ctx, newCredential("cred_3", "other@mail.com")))
+
+		creds, err = s.ListCredentials(ctx, email)
+		require.NoError(t, err)
+		require.Len(t, creds, 2)
+		assert.Equal(t, first.ID, creds[0].ID)
+		assert.Equal(t, second.ID, creds[1].ID)
+	})
+
+	t.Run("DeleteCredentials", func(t *testing.T) {
+		s, _ := newStorage(t)
+		require.NoError(t, s.AddCredential(ctx, newCredential("cred_1", email)))
+		require.NoError(t, s.AddCredential(ctx, newCredential("cred_2", email)))
+		require.NoError(t, s.AddCredential(ctx, newCredential("cred_3", "other@mail.com")))
+
+		require.NoError(t, s.DeleteCredentials(ctx, email))
+		creds, err := s.ListCredentials(ctx, email)
+		assert.NoError(t, err)
+		assert.Empty(t, creds)
+		_, err = s.GetCredential(ctx, []byte("cred_1"))
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		// Чужие ключи не затронуты
+		creds, err = s.ListCredentials(ctx, "other@mail.com")
+		assert.NoError(t, err)
+		assert.Len(t, creds, 1)
+
+		assert.NoError(t, s.DeleteCredentials(ctx, "unknown@mail.com"))
+	})
+
+	t.Run("UpdateSignCount", func(t *testing.T) {
+		s, _ := newStorage(t)
+		cred := newCredential("cred_1", email)
+		require.NoError(t, s.AddCredential(ctx, cred))
+
+		require.NoError(t, s.UpdateSignCount(ctx, cred.ID, 7))
+		got, err := s.GetCredential(ctx, cred.ID)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(7), got.SignCount)
+
+		// Меньшее значение не уменьшает счётчик
+		require.NoError(t, s.UpdateSignCount(ctx, cred.ID, 6))
+		got, err = s.GetCredential(ctx, cred.ID)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(7), got.SignCount)
+
+		assert.ErrorIs(t, s.UpdateSignCount(ctx, []byte("unknown"), 1), storage.ErrNotFound)
+		// Обновление не создаёт ключ
+		_, err = s.GetCredential(ctx, []byte("unknown"))
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("ceremony is single-use", func(t *testing.T) {
+		s, _ := newStorage(t)
+		require.NoError(t, s.SaveCeremony(ctx, "ceremony", []byte("data"), time.Minute))
+
+		data, err := s.TakeCeremony(ctx, "ceremony")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("data"), data)
+
+		_, err = s.TakeCeremony(ctx, "ceremony")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		_, err = s.TakeCeremony(ctx, "unknown")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("ceremony expires", func(t *testing.T) {
+		s, advance := newStorage(t)
+		require.NoError(t, s.SaveCeremony(ctx, "ceremony", []byte("data"), time.Minute))
+
+		advance(time.Minute + time.Second)
+		_, err := s.TakeCeremony(ctx, "ceremony")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		s, _ := newStorage(t)
+		require.NoError(t, s.SaveCeremony(ctx, "ceremony", []byte("data"), time.Minute))
+
+		// Один challenge принимается ровно один раз, один ID регистрируется ровно один раз
+		var taken, added atomic.Int32
+		parallel(func(int) {
+			if _, err := s.TakeCeremony(ctx, "ceremony"); err == nil {
+				taken.Add(1)
+			}
+			if s.AddCredential(ctx, newCredential("cred_1", email)) == nil {
+				added.Add(1)
+			}
+		})
+		assert.Equal(t, int32(1), taken.Load())
+		assert.Equal(t, int32(1), added.Load())
+	})
+}
@@ -0,0 +1,448 @@
+// Хранилища этого пакета ограничивают время каждой операции другого хранилища: контекст операции получает
+// срок timeout, в том числе вне HTTP запросов - при запуске и в записях журнала аудита. Срок запроса короче timeout
+// по-прежнему действует. timeout <= 0 - хранилище возвращается без ограничения
+package timeout
+
+import (
+	"context"
+	"time"
+
+	"lk-auth/internal/domain/model"
+	"lk-auth/internal/storage"
+)
+
+type blackListStorage struct {
+	next    storage.BlackListStorage
+	timeout time.Duration
+}
+
+func NewBlackListStorage(next storage.BlackListStorage, timeout time.Duration) storage.BlackListStorage {
+	if timeout <= 0 {
+		return next
+	}
+	return &blackListStorage{next: next, timeout: timeout}
+}
+
+func (s *blackListStorage) AddTokens(ctx context.Context, tokens ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.AddTokens(ctx, tokens...)
+}
+
+func (s *blackListStorage) IsAllowed(ctx context.Context, token string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.IsAllowed(ctx, token)
+}
+
+func (s *blackListStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.next.ShutDown(shutDownCtx)
+}
+
+type jwtStorage struct {
+	next    storage.JWTStorage
+	timeout time.Duration
+}
+
+func NewJWTStorage(next storage.JWTStorage, timeout time.Duration) storage.JWTStorage {
+	if timeout <= 0 {
+		return next
+	}
+	return &jwtStorage{next: next, timeout: timeout}
+}
+
+func (s *jwtStorage) AddPair(ctx context.Context, access string, refresh string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.AddPair(ctx, access, refresh)
+}
+
+func (s *jwtStorage) GetAccessByRefresh(ctx context.Context, refresh string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.GetAccessByRefresh(ctx, refresh)
+}
+
+func (s *jwtStorage) AddFamily(ctx context.Context, family, refresh string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.AddFamily(ctx, family, refresh)
+}
+
+func (s *jwtStorage) RotateFamily(ctx context.Context, family, current, next string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.RotateFamily(ctx, family, current, next)
+}
+
+func (s *jwtStorage) GetFamilyHead(ctx context.Context, family string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.GetFamilyHead(ctx, family)
+}
+
+func (s *jwtStorage) DeleteFamily(ctx context.Context, family string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.DeleteFamily(ctx, family)
+}
+
+func (s *jwtStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.next.ShutDown(shutDownCtx)
+}
+
+type sessionStorage struct {
+	next    storage.SessionStorage
+	timeout time.Duration
+}
+
+func NewSessionStorage(next storage.SessionStorage, timeout time.Duration) storage.SessionStorage {
+	if timeout <= 0 {
+		return next
+	}
+	return &sessionStorage{next: next, timeout: timeout}
+}
+
+func (s *sessionStorage) AddSession(ctx context.Context, session *model.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.AddSession(ctx, session)
+}
+
+func (s *sessionStorage) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.GetSession(ctx, id)
+}
+
+func (s *sessionStorage) ListSessions(ctx context.Context, email string) ([]model.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.ListSessions(ctx, email)
+}
+
+func (s *sessionStorage) TouchSession(ctx context.Context, id string, client model.ClientInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.TouchSession(ctx, id, client)
+}
+
+func (s *sessionStorage) DeleteSession(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.DeleteSession(ctx, id)
+}
+
+func (s *sessionStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.next.ShutDown(shutDownCtx)
+}
+
+type userStorage struct {
+	next    storage.UserStorage
+	timeout time.Duration
+}
+
+func NewUserStorage(next storage.UserStorage, timeout time.Duration) storage.UserStorage {
+	if timeout <= 0 {
+		return next
+	}
+	return &userStorage{next: next, timeout: timeout}
+}
+
+func (s *userStorage) Login(ctx context.Context, email, password string) (dataVersion float64, role string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.Login(ctx, email, password)
+}
+
+func (s *userStorage) GetUser(ctx context.Context, email string) (*model.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.GetUser(ctx, email)
+}
+
+func (s *userStorage) IsVersionValid(ctx context.Context, email string, version float64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.IsVersionValid(ctx, email, version)
+}
+
+func (s *userStorage) AddUser(ctx context.Context, user *model.User) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.AddUser(ctx, user)
+}
+
+func (s *userStorage) IncrementVersion(ctx context.Context, email string) (newVersion float64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.IncrementVersion(ctx, email)
+}
+
+func (s *userStorage) ChangePassword(ctx context.Context, email, passwordHash string) (newVersion float64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.ChangePassword(ctx, email, passwordHash)
+}
+
+func (s *userStorage) ChangeRole(ctx context.Context, email, role string) (newVersion float64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.ChangeRole(ctx, email, role)
+}
+
+func (s *userStorage) VerifyEmail(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.VerifyEmail(ctx, email)
+}
+
+func (s *userStorage) SetDisabled(ctx context.Context, email string, disabled bool) (newVersion float64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.SetDisabled(ctx, email, disabled)
+}
+
+func (s *userStorage) DeleteUser(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.DeleteUser(ctx, email)
+}
+
+func (s *userStorage) ListUsers(ctx context.Context, query, cursor string, limit int) (users []model.User, next string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.ListUsers(ctx, query, cursor, limit)
+}
+
+func (s *userStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.next.ShutDown(shutDownCtx)
+}
+
+type auditStorage struct {
+	next    storage.AuditStorage
+	timeout time.Duration
+}
+
+func NewAuditStorage(next storage.AuditStorage, timeout time.Duration) storage.AuditStorage {
+	if timeout <= 0 {
+		return next
+	}
+	return &auditStorage{next: next, timeout: timeout}
+}
+
+func (s *auditStorage) AddRecord(ctx context.Context, rec *model.AuditRecord) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.AddRecord(ctx, rec)
+}
+
+func (s *auditStorage) ListRecords(ctx context.Context, filter model.AuditFilter) ([]model.AuditRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.ListRecords(ctx, filter)
+}
+
+func (s *auditStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.next.ShutDown(shutDownCtx)
+}
+
+type mfaStorage struct {
+	next    storage.MFAStorage
+	timeout time.Duration
+}
+
+func NewMFAStorage(next storage.MFAStorage, timeout time.Duration) storage.MFAStorage {
+	if timeout <= 0 {
+		return next
+	}
+	return &mfaStorage{next: next, timeout: timeout}
+}
+
+func (s *mfaStorage) GetMFA(ctx context.Context, email string) (*model.MFA, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.GetMFA(ctx, email)
+}
+
+func (s *mfaStorage) SetMFA(ctx context.Context, email string, mfa *model.MFA) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.SetMFA(ctx, email, mfa)
+}
+
+func (s *mfaStorage) DeleteMFA(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.DeleteMFA(ctx, email)
+}
+
+func (s *mfaStorage) UseRecoveryCode(ctx context.Context, email, codeHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.UseRecoveryCode(ctx, email, codeHash)
+}
+
+func (s *mfaStorage) UseTOTPCounter(ctx context.Context, email string, counter int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.UseTOTPCounter(ctx, email, counter)
+}
+
+func (s *mfaStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.next.ShutDown(shutDownCtx)
+}
+
+type webAuthnStorage struct {
+	next    storage.WebAuthnStorage
+	timeout time.Duration
+}
+
+func NewWebAuthnStorage(next storage.WebAuthnStorage, timeout time.Duration) storage.WebAuthnStorage {
+	if timeout <= 0 {
+		return next
+	}
+	return &webAuthnStorage{next: next, timeout: timeout}
+}
+
+func (s *webAuthnStorage) AddCredential(ctx context.Context, cred *model.WebAuthnCredential) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.AddCredential(ctx, cred)
+}
+
+func (s *webAuthnStorage) GetCredential(ctx context.Context, id []byte) (*model.WebAuthnCredential, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.GetCredential(ctx, id)
+}
+
+func (s *webAuthnStorage) ListCredentials(ctx context.Context, email string) ([]model.WebAuthnCredential, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.ListCredentials(ctx, email)
+}
+
+func (s *webAuthnStorage) UpdateSignCount(ctx context.Context, id []byte, signCount uint32) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.UpdateSignCount(ctx, id, signCount)
+}
+
+func (s *webAuthnStorage) DeleteCredentials(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.DeleteCredentials(ctx, email)
+}
+
+func (s *webAuthnStorage) SaveCeremony(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.SaveCeremony(ctx, id, data, ttl)
+}
+
+func (s *webAuthnStorage) TakeCeremony(ctx context.Context, id string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.TakeCeremony(ctx, id)
+}
+
+func (s *webAuthnStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.next.ShutDown(shutDownCtx)
+}
+
+type lockoutStorage struct {
+	next    storage.LockoutStorage
+	timeout time.Duration
+}
+
+func NewLockoutStorage(next storage.LockoutStorage, timeout time.Duration) storage.LockoutStorage {
+	if timeout <= 0 {
+		return next
+	}
+	return &lockoutStorage{next: next, timeout: timeout}
+}
+
+func (s *lockoutStorage) AddFailure(ctx context.Context, key string, window time.Duration) (failures int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.AddFailure(ctx, key, window)
+}
+
+func (s *lockoutStorage) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.Lock(ctx, key, ttl)
+}
+
+func (s *lockoutStorage) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.LockedFor(ctx, key)
+}
+
+func (s *lockoutStorage) Reset(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.Reset(ctx, key)
+}
+
+func (s *lockoutStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.next.ShutDown(shutDownCtx)
+}
+
+type rateLimitStorage struct {
+	next    storage.RateLimitStorage
+	timeout time.Duration
+}
+
+func NewRateLimitStorage(next storage.RateLimitStorage, timeout time.Duration) storage.RateLimitStorage {
+	if timeout <= 0 {
+		return next
+	}
+	return &rateLimitStorage{next: next, timeout: timeout}
+}
+
+func (s *rateLimitStorage) Hit(ctx context.Context, key string, limit int64, window time.Duration) (model.RateLimit, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.Hit(ctx, key, limit, window)
+}
+
+func (s *rateLimitStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.next.ShutDown(shutDownCtx)
+}
+
+type oneTimeTokenStorage struct {
+	next    storage.OneTimeTokenStorage
+	timeout time.Duration
+}
+
+func NewOneTimeTokenStorage(next storage.OneTimeTokenStorage, timeout time.Duration) storage.OneTimeTokenStorage {
+	if timeout <= 0 {
+		return next
+	}
+	return &oneTimeTokenStorage{next: next, timeout: timeout}
+}
+
+func (s *oneTimeTokenStorage) SaveToken(ctx context.Context, hash string, token *model.OneTimeToken, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.SaveToken(ctx, hash, token, ttl)
+}
+
+func (s *oneTimeTokenStorage) GetToken(ctx context.Context, hash string) (*model.OneTimeToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.GetToken(ctx, hash)
+}
+
+func (s *oneTimeTokenStorage) TakeToken(ctx context.Context, hash string) (*model.OneTimeToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.next.TakeToken(ctx, hash)
+}
+
+func (s *oneTimeTokenStorage) ShutDown(shutDownCtx context.Context) error {
+	return s.next.ShutDown(shutDownCtx)
+}
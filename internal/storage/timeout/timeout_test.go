@@ -0,0 +1,50 @@
+package timeout_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lk-auth/internal/storage/timeout"
+	mockStorage "lk-auth/internal/testutil/mock/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeout(t *testing.T) {
+	users := &mockStorage.MockUserStorage{}
+	withDeadline := mock.MatchedBy(func(ctx context.Context) bool {
+		deadline, ok := ctx.Deadline()
+		return ok && time.Until(deadline) <= time.Second
+	})
+	users.On("IsVersionValid", withDeadline, "test@example.com", 1.0).Return(true, nil).Once()
+	users.On("DeleteUser", withDeadline, "test@example.com").Return(context.DeadlineExceeded).Once()
+
+	storage := timeout.NewUserStorage(users, time.Second)
+
+	valid, err := storage.IsVersionValid(context.Background(), "test@example.com", 1)
+	require.NoError(t, err)
+	assert.True(t, valid)
+	assert.ErrorIs(t, storage.DeleteUser(context.Background(), "test@example.com"), context.DeadlineExceeded)
+	users.AssertExpectations(t)
+
+	t.Run("shorter request deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		requestDeadline, _ := ctx.Deadline()
+		users.On("GetUser", mock.MatchedBy(func(ctx context.Context) bool {
+			deadline, _ := ctx.Deadline()
+			return deadline.Equal(requestDeadline)
+		}), "test@example.com").Return(nil, context.DeadlineExceeded).Once()
+
+		_, err := storage.GetUser(ctx, "test@example.com")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		users.AssertExpectations(t)
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		assert.Same(t, users, timeout.NewUserStorage(users, 0))
+	})
+}
@@ -1,7 +1,11 @@
 package jwt
 
 import (
+	"context"
+	"time"
+
 	"lk-auth/internal/domain/model"
+	jwtpkg "lk-auth/internal/service/jwt"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/mock"
@@ -11,56 +15,89 @@ type MockJWTService struct {
 	mock.Mock
 }
 
-func (s *MockJWTService) CreateAccessToken(user model.User) (string, error) {
-	args := s.Called(user)
+func (s *MockJWTService) CreateAccessToken(ctx context.Context, user model.User, sessionID string) (string, error) {
+	args := s.Called(ctx, user, sessionID)
+	return args.String(0), args.Error(1)
+}
+
+func (s *MockJWTService) CreateRefreshToken(ctx context.Context, user model.User, familyID string) (string, error) {
+	args := s.Called(ctx, user, familyID)
+	return args.String(0), args.Error(1)
+}
+
+func (s *MockJWTService) CreateMFAToken(ctx context.Context, user model.User) (string, error) {
+	args := s.Called(ctx, user)
 	return args.String(0), args.Error(1)
 }
 
-func (s *MockJWTService) CreateRefreshToken(user model.User) (string, error) {
-	args := s.Called(user)
+func (s *MockJWTService) CreateEmailVerificationToken(ctx context.Context, user model.User, ttl time.Duration) (string, error) {
+	args := s.Called(ctx, user, ttl)
 	return args.String(0), args.Error(1)
 }
 
-func (s *MockJWTService) GetTokenClaims(token string) (jwt.MapClaims, error) {
-	args := s.Called(token)
+func (s *MockJWTService) GetTokenClaims(ctx context.Context, token string) (jwt.MapClaims, error) {
+	args := s.Called(ctx, token)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(jwt.MapClaims), args.Error(1)
 }
 
-func (s *MockJWTService) GetUserInfo(token string) (model.User, error) {
-	args := s.Called(token)
+func (s *MockJWTService) GetUserInfo(ctx context.Context, token string) (model.User, error) {
+	args := s.Called(ctx, token)
 	if ret, ok := args.Get(0).(model.User); ok {
 		return ret, args.Error(1)
 	}
 	return model.User{}, args.Error(1)
 }
 
-func (s *MockJWTService) GetVersion(token string) (float64, error) {
-	args := s.Called(token)
+func (s *MockJWTService) GetVersion(ctx context.Context, token string) (float64, error) {
+	args := s.Called(ctx, token)
 	if f, ok := args.Get(0).(float64); ok {
 		return f, args.Error(1)
 	}
 	return 0, args.Error(1)
 }
 
-func (s *MockJWTService) GetEmail(token string) (string, error) {
-	args := s.Called(token)
+func (s *MockJWTService) GetEmail(ctx context.Context, token string) (string, error) {
+	args := s.Called(ctx, token)
+	return args.String(0), args.Error(1)
+}
+
+func (s *MockJWTService) GetRole(ctx context.Context, token string) (string, error) {
+	args := s.Called(ctx, token)
 	return args.String(0), args.Error(1)
 }
 
-func (s *MockJWTService) GetRole(token string) (string, error) {
-	args := s.Called(token)
+func (s *MockJWTService) GetType(ctx context.Context, token string) (string, error) {
+	args := s.Called(ctx, token)
 	return args.String(0), args.Error(1)
 }
 
-func (s *MockJWTService) GetType(token string) (string, error) {
-	args := s.Called(token)
+func (s *MockJWTService) GetFamilyID(ctx context.Context, token string) (string, error) {
+	args := s.Called(ctx, token)
 	return args.String(0), args.Error(1)
 }
 
-func (s *MockJWTService) IsTokenValid(token string) (bool, error) {
-	args := s.Called(token)
+func (s *MockJWTService) GetSessionID(ctx context.Context, token string) (string, error) {
+	args := s.Called(ctx, token)
+	return args.String(0), args.Error(1)
+}
+
+func (s *MockJWTService) IsTokenValid(ctx context.Context, token string) (bool, error) {
+	args := s.Called(ctx, token)
+	return args.Bool(0), args.Error(1)
+}
+
+func (s *MockJWTService) JWKS() jwtpkg.JWKS {
+	args := s.Called()
+	if ret, ok := args.Get(0).(jwtpkg.JWKS); ok {
+		return ret
+	}
+	return jwtpkg.JWKS{}
+}
+
+func (s *MockJWTService) RotateKey(key any) (bool, error) {
+	args := s.Called(key)
 	return args.Bool(0), args.Error(1)
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"lk-auth/internal/domain/model"
 
@@ -12,13 +13,13 @@ type MockBlackListStorage struct {
 	mock.Mock
 }
 
-func (s *MockBlackListStorage) AddTokens(tokens ...string) error {
-	args := s.Called(tokens)
+func (s *MockBlackListStorage) AddTokens(ctx context.Context, tokens ...string) error {
+	args := s.Called(ctx, tokens)
 	return args.Error(0)
 }
 
-func (s *MockBlackListStorage) IsAllowed(token string) (bool, error) {
-	args := s.Called(token)
+func (s *MockBlackListStorage) IsAllowed(ctx context.Context, token string) (bool, error) {
+	args := s.Called(ctx, token)
 	return args.Bool(0), args.Error(1)
 }
 
@@ -31,21 +32,77 @@ type MockUserStorage struct {
 	mock.Mock
 }
 
-func (s *MockUserStorage) Login(email, passwordHash string) (float64, string, error) {
-	args := s.Called(email, passwordHash)
+func (s *MockUserStorage) Login(ctx context.Context, email, passwordHash string) (float64, string, error) {
+	args := s.Called(ctx, email, passwordHash)
 	if f, ok := args.Get(0).(float64); ok {
 		return f, args.String(1), args.Error(2)
 	}
 	return 0, args.String(1), args.Error(2)
 }
 
-func (s *MockUserStorage) IsVersionValid(email string, version float64) (bool, error) {
-	args := s.Called(email, version)
+func (s *MockUserStorage) GetUser(ctx context.Context, email string) (*model.User, error) {
+	args := s.Called(ctx, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (s *MockUserStorage) IsVersionValid(ctx context.Context, email string, version float64) (bool, error) {
+	args := s.Called(ctx, email, version)
 	return args.Bool(0), args.Error(1)
 }
 
-func (s *MockUserStorage) AddUser(user *model.User) error {
-	args := s.Called(user)
+func (s *MockUserStorage) AddUser(ctx context.Context, user *model.User) error {
+	args := s.Called(ctx, user)
+	return args.Error(0)
+}
+
+func (s *MockUserStorage) IncrementVersion(ctx context.Context, email string) (float64, error) {
+	args := s.Called(ctx, email)
+	if f, ok := args.Get(0).(float64); ok {
+		return f, args.Error(1)
+	}
+	return -1, args.Error(1)
+}
+
+func (s *MockUserStorage) ChangePassword(ctx context.Context, email, passwordHash string) (float64, error) {
+	args := s.Called(ctx, email, passwordHash)
+	if f, ok := args.Get(0).(float64); ok {
+		return f, args.Error(1)
+	}
+	return -1, args.Error(1)
+}
+
+func (s *MockUserStorage) ChangeRole(ctx context.Context, email, role string) (float64, error) {
+	args := s.Called(ctx, email, role)
+	if f, ok := args.Get(0).(float64); ok {
+		return f, args.Error(1)
+	}
+	return -1, args.Error(1)
+}
+
+func (s *MockUserStorage) SetDisabled(ctx context.Context, email string, disabled bool) (float64, error) {
+	args := s.Called(ctx, email, disabled)
+	if f, ok := args.Get(0).(float64); ok {
+		return f, args.Error(1)
+	}
+	return -1, args.Error(1)
+}
+
+func (s *MockUserStorage) DeleteUser(ctx context.Context, email string) error {
+	args := s.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (s *MockUserStorage) ListUsers(ctx context.Context, query, cursor string, limit int) ([]model.User, string, error) {
+	args := s.Called(ctx, query, cursor, limit)
+	users, _ := args.Get(0).([]model.User)
+	return users, args.String(1), args.Error(2)
+}
+
+func (s *MockUserStorage) VerifyEmail(ctx context.Context, email string) error {
+	args := s.Called(ctx, email)
 	return args.Error(0)
 }
 
@@ -54,21 +111,250 @@ func (s *MockUserStorage) ShutDown(shutDownCtx context.Context) error {
 	return args.Error(0)
 }
 
+type MockSessionStorage struct {
+	mock.Mock
+}
+
+func (s *MockSessionStorage) AddSession(ctx context.Context, session *model.Session) error {
+	args := s.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (s *MockSessionStorage) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	args := s.Called(ctx, id)
+	if ret, ok := args.Get(0).(*model.Session); ok {
+		return ret, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (s *MockSessionStorage) ListSessions(ctx context.Context, email string) ([]model.Session, error) {
+	args := s.Called(ctx, email)
+	if ret, ok := args.Get(0).([]model.Session); ok {
+		return ret, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (s *MockSessionStorage) TouchSession(ctx context.Context, id string, client model.ClientInfo) error {
+	args := s.Called(ctx, id, client)
+	return args.Error(0)
+}
+
+func (s *MockSessionStorage) DeleteSession(ctx context.Context, id string) error {
+	args := s.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (s *MockSessionStorage) ShutDown(shutDownCtx context.Context) error {
+	args := s.Called(shutDownCtx)
+	return args.Error(0)
+}
+
 type MockJWTStorage struct {
 	mock.Mock
 }
 
-func (s *MockJWTStorage) AddPair(access string, refresh string) error {
-	args := s.Called(access, refresh)
+func (s *MockJWTStorage) AddPair(ctx context.Context, access string, refresh string) error {
+	args := s.Called(ctx, access, refresh)
 	return args.Error(0)
 }
 
-func (s *MockJWTStorage) GetAccessByRefresh(refresh string) (string, error) {
-	args := s.Called(refresh)
+func (s *MockJWTStorage) GetAccessByRefresh(ctx context.Context, refresh string) (string, error) {
+	args := s.Called(ctx, refresh)
 	return args.String(0), args.Error(1)
 }
 
+func (s *MockJWTStorage) AddFamily(ctx context.Context, family, refresh string) error {
+	args := s.Called(ctx, family, refresh)
+	return args.Error(0)
+}
+
+func (s *MockJWTStorage) RotateFamily(ctx context.Context, family, current, next string) (bool, error) {
+	args := s.Called(ctx, family, current, next)
+	return args.Bool(0), args.Error(1)
+}
+
+func (s *MockJWTStorage) GetFamilyHead(ctx context.Context, family string) (string, error) {
+	args := s.Called(ctx, family)
+	return args.String(0), args.Error(1)
+}
+
+func (s *MockJWTStorage) DeleteFamily(ctx context.Context, family string) error {
+	args := s.Called(ctx, family)
+	return args.Error(0)
+}
+
 func (s *MockJWTStorage) ShutDown(shutDownCtx context.Context) error {
 	args := s.Called(shutDownCtx)
 	return args.Error(0)
 }
+
+type MockMFAStorage struct {
+	mock.Mock
+}
+
+func (s *MockMFAStorage) GetMFA(ctx context.Context, email string) (*model.MFA, error) {
+	args := s.Called(ctx, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.MFA), args.Error(1)
+}
+
+func (s *MockMFAStorage) SetMFA(ctx context.Context, email string, mfa *model.MFA) error {
+	args := s.Called(ctx, email, mfa)
+	return args.Error(0)
+}
+
+func (s *MockMFAStorage) DeleteMFA(ctx context.Context, email string) error {
+	args := s.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (s *MockMFAStorage) UseRecoveryCode(ctx context.Context, email, codeHash string) (bool, error) {
+	args := s.Called(ctx, email, codeHash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (s *MockMFAStorage) UseTOTPCounter(ctx context.Context, email string, counter int64) (bool, error) {
+	args := s.Called(ctx, email, counter)
+	return args.Bool(0), args.Error(1)
+}
+
+func (s *MockMFAStorage) ShutDown(shutDownCtx context.Context) error {
+	args := s.Called(shutDownCtx)
+	return args.Error(0)
+}
+
+type MockWebAuthnStorage struct {
+	mock.Mock
+}
+
+func (s *MockWebAuthnStorage) AddCredential(ctx context.Context, cred *model.WebAuthnCredential) error {
+	args := s.Called(ctx, cred)
+	return args.Error(0)
+}
+
+func (s *MockWebAuthnStorage) GetCredential(ctx context.Context, id []byte) (*model.WebAuthnCredential, error) {
+	args := s.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.WebAuthnCredential), args.Error(1)
+}
+
+func (s *MockWebAuthnStorage) ListCredentials(ctx context.Context, email string) ([]model.WebAuthnCredential, error) {
+	args := s.Called(ctx, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.WebAuthnCredential), args.Error(1)
+}
+
+func (s *MockWebAuthnStorage) UpdateSignCount(ctx context.Context, id []byte, signCount uint32) error {
+	args := s.Called(ctx, id, signCount)
+	return args.Error(0)
+}
+
+func (s *MockWebAuthnStorage) DeleteCredentials(ctx context.Context, email string) error {
+	args := s.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (s *MockWebAuthnStorage) SaveCeremony(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	args := s.Called(ctx, id, data, ttl)
+	return args.Error(0)
+}
+
+func (s *MockWebAuthnStorage) TakeCeremony(ctx context.Context, id string) ([]byte, error) {
+	args := s.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (s *MockWebAuthnStorage) ShutDown(shutDownCtx context.Context) error {
+	args := s.Called(shutDownCtx)
+	return args.Error(0)
+}
+
+type MockLockoutStorage struct {
+	mock.Mock
+}
+
+func (s *MockLockoutStorage) AddFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	args := s.Called(ctx, key, window)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (s *MockLockoutStorage) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	args := s.Called(ctx, key, ttl)
+	return args.Error(0)
+}
+
+func (s *MockLockoutStorage) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	args := s.Called(ctx, key)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (s *MockLockoutStorage) Reset(ctx context.Context, key string) error {
+	args := s.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (s *MockLockoutStorage) ShutDown(shutDownCtx context.Context) error {
+	args := s.Called(shutDownCtx)
+	return args.Error(0)
+}
+
+type MockOneTimeTokenStorage struct {
+	mock.Mock
+}
+
+func (s *MockOneTimeTokenStorage) SaveToken(ctx context.Context, hash string, token *model.OneTimeToken, ttl time.Duration) error {
+	args := s.Called(ctx, hash, token, ttl)
+	return args.Error(0)
+}
+
+func (s *MockOneTimeTokenStorage) GetToken(ctx context.Context, hash string) (*model.OneTimeToken, error) {
+	args := s.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.OneTimeToken), args.Error(1)
+}
+
+func (s *MockOneTimeTokenStorage) TakeToken(ctx context.Context, hash string) (*model.OneTimeToken, error) {
+	args := s.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.OneTimeToken), args.Error(1)
+}
+
+func (s *MockOneTimeTokenStorage) ShutDown(shutDownCtx context.Context) error {
+	args := s.Called(shutDownCtx)
+	return args.Error(0)
+}
+
+type MockAuditStorage struct {
+	mock.Mock
+}
+
+func (s *MockAuditStorage) AddRecord(ctx context.Context, rec *model.AuditRecord) error {
+	args := s.Called(ctx, rec)
+	return args.Error(0)
+}
+
+func (s *MockAuditStorage) ListRecords(ctx context.Context, filter model.AuditFilter) ([]model.AuditRecord, error) {
+	args := s.Called(ctx, filter)
+	records, _ := args.Get(0).([]model.AuditRecord)
+	return records, args.Error(1)
+}
+
+func (s *MockAuditStorage) ShutDown(shutDownCtx context.Context) error {
+	args := s.Called(shutDownCtx)
+	return args.Error(0)
+}
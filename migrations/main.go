@@ -1,2 +1,118 @@
 // Файл для запуска миграции
 package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"lk-auth/internal/config"
+)
+
+const usage = `Использование: migrate <команда> [аргументы]
+
+Команды:
+  up              применить все новые миграции
+  down [N]        откатить N последних миграций (по умолчанию 1)
+  status          показать применённые и ожидающие миграции
+  force V         записать версию V и снять признак dirty без выполнения миграций
+  redis-users     скопировать пользователей auth:users:* из REDIS_URL в USERS_URL
+
+База данных берётся из USERS_URL, Redis - из REDIS_URL.
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.MustLoad()
+	if cfg.Storages.Users == "" {
+		fmt.Fprintln(os.Stderr, "USERS_URL is not set")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, cfg *config.Config, command string, args []string) error {
+	if command == "redis-users" {
+		if cfg.Storages.Redis == "" {
+			return errors.New("REDIS_URL is not set")
+		}
+		copied, skipped, err := copyRedisUsers(ctx, cfg.Storages.Redis, cfg.Storages.Users)
+		fmt.Printf("copied: %d, skipped (already exist): %d\n", copied, skipped)
+		return err
+	}
+
+	m, err := NewMigrator(ctx, cfg.Storages.Users)
+	if err != nil {
+		return err
+	}
+	defer m.Close(context.Background())
+
+	switch command {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("up   %06d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no new migrations")
+		}
+		return err
+	case "down":
+		n := 1
+		if len(args) > 0 {
+			n, err = strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[0])
+			}
+		}
+		reverted, err := m.Down(ctx, n)
+		for _, migration := range reverted {
+			fmt.Printf("down %06d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		statuses, current, dirty, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version: %d, dirty: %t\n", current, dirty)
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%-8s %06d_%s\n", state, status.Version, status.Name)
+		}
+		return nil
+	case "force":
+		if len(args) == 0 {
+			return errors.New("force requires a version")
+		}
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		return m.Force(ctx, version)
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+// Ключ pg_advisory_lock: одновременно миграции выполняет только одна реплика
+const advisoryLockKey int64 = 0x6c6b2d61757468 // "lk-auth"
+
+var (
+	ErrDirty          = errors.New("database is dirty after a failed migration, fix it manually and run force")
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+var fileNameRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// loadMigrations читает встроенные файлы вида 000001_name.up.sql / 000001_name.down.sql
+func loadMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileNameRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if version <= 0 {
+			return nil, fmt.Errorf("migration %q: version must be positive", entry.Name())
+		}
+
+		data, err := fs.ReadFile(files, path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return migrations, nil
+}
+
+// Migrator применяет миграции через одно соединение, на котором держится advisory lock
+type Migrator struct {
+	conn       *pgx.Conn
+	migrations []Migration
+}
+
+// NewMigrator подключается к базе и ждёт advisory lock, пока его держит другой процесс.
+func NewMigrator(ctx context.Context, url string) (*Migrator, error) {
+	migrations, err := loadMigrations(sqlFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Блокировка уровня сессии освобождается и при обрыве соединения
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT      NOT NULL,
+		dirty      BOOLEAN     NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+
+	return &Migrator{
+		conn:       conn,
+		migrations: migrations,
+	}, nil
+}
+
+func (m *Migrator) Close(ctx context.Context) error {
+	_, err := m.conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, advisoryLockKey)
+	return errors.Join(err, m.conn.Close(ctx))
+}
+
+// Version возвращает номер последней применённой миграции (0, если миграций не было)
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := m.conn.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+
+	return version, dirty, err
+}
+
+// Up применяет все ещё не применённые миграции по порядку
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	current, err := m.clean(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+		if err := m.apply(ctx, migration.Version, migration.Up, migration.Version); err != nil {
+			return applied, fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+		}
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// Down откатывает n последних применённых миграций
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	current, err := m.clean(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(reverted) < n; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current {
+			continue
+		}
+		previous := int64(0)
+		if i > 0 {
+			previous = m.migrations[i-1].Version
+		}
+		if err := m.apply(ctx, migration.Version, migration.Down, previous); err != nil {
+			return reverted, fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// Force записывает версию без выполнения миграций и снимает признак dirty
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(migration Migration) bool {
+		return migration.Version == version
+	}) {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return pgx.BeginFunc(ctx, m.conn, func(tx pgx.Tx) error {
+		return setVersion(ctx, tx, version, false)
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, int64, bool, error) {
+	current, dirty, err := m.Version(ctx)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		statuses = append(statuses, MigrationStatus{
+			Migration: migration,
+			Applied:   migration.Version <= current,
+		})
+	}
+
+	return statuses, current, dirty, nil
+}
+
+func (m *Migrator) clean(ctx context.Context) (int64, error) {
+	current, dirty, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w (version %d)", ErrDirty, current)
+	}
+
+	return current, nil
+}
+
+// apply выполняет миграцию в транзакции вместе с записью новой версии.
+// При ошибке версия помечается dirty, чтобы следующие запуски не продолжали поверх неизвестного состояния.
+func (m *Migrator) apply(ctx context.Context, version int64, sql string, target int64) error {
+	err := pgx.BeginFunc(ctx, m.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+		return setVersion(ctx, tx, target, false)
+	})
+	if err == nil {
+		return nil
+	}
+
+	markErr := pgx.BeginFunc(ctx, m.conn, func(tx pgx.Tx) error {
+		return setVersion(ctx, tx, version, true)
+	})
+	return errors.Join(err, markErr)
+}
+
+func setVersion(ctx context.Context, tx pgx.Tx, version int64, dirty bool) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version == 0 && !dirty {
+		return nil
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO schema_migrations (version, dirty, applied_at) VALUES ($1, $2, $3)`,
+		version, dirty, time.Now(),
+	)
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(sqlFiles)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+		if i > 0 {
+			assert.Greater(t, migration.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("sorted", func(t *testing.T) {
+		migrations, err := loadMigrations(fstest.MapFS{
+			"sql/000002_second.up.sql":   {Data: []byte("up 2")},
+			"sql/000002_second.down.sql": {Data: []byte("down 2")},
+			"sql/000010_tenth.up.sql":    {Data: []byte("up 10")},
+			"sql/000010_tenth.down.sql":  {Data: []byte("down 10")},
+			"sql/000001_first.up.sql":    {Data: []byte("up 1")},
+			"sql/000001_first.down.sql":  {Data: []byte("down 1")},
+		})
+		require.NoError(t, err)
+		require.Len(t, migrations, 3)
+		assert.Equal(t, []int64{1, 2, 10}, []int64{migrations[0].Version, migrations[1].Version, migrations[2].Version})
+		assert.Equal(t, "tenth", migrations[2].Name)
+		assert.Equal(t, "down 10", migrations[2].Down)
+	})
+
+	t.Run("missing down", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"sql/000001_first.up.sql": {Data: []byte("up 1")},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("bad name", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"sql/first.sql": {Data: []byte("up 1")},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("different names", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"sql/000001_first.up.sql":   {Data: []byte("up 1")},
+			"sql/000001_other.down.sql": {Data: []byte("down 1")},
+		})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+
+	redisStorage "lk-auth/internal/storage/redis"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// copyRedisUsers переносит учётные записи из Redis в таблицу users.
+// Пользователи, уже существующие в SQL хранилище, пропускаются, поэтому команду можно запускать повторно.
+func copyRedisUsers(ctx context.Context, redisURL, usersURL string) (copied, skipped int, err error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return 0, 0, err
+	}
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+
+	conn, err := pgx.Connect(ctx, usersURL)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close(context.Background())
+
+	var users []redisStorage.User
+	iter := rdb.Scan(ctx, 0, redisStorage.UsersPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		var user redisStorage.User
+		if err := rdb.HGetAll(ctx, iter.Val()).Scan(&user); err != nil {
+			return 0, 0, err
+		}
+		if user.Email == "" {
+			continue
+		}
+		users = append(users, user)
+	}
+	if err := iter.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	// Все записи переносятся одной транзакцией: при ошибке в базе не останется части пользователей
+	err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		copied, skipped = 0, 0
+		for _, user := range users {
+			version := int64(user.Version)
+			if version < 1 {
+				version = 1
+			}
+			tag, err := tx.Exec(ctx,
+				`INSERT INTO users (email, password_hash, role, version, email_verified, disabled) VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT ((lower(email))) DO NOTHING`,
+				user.Email, user.PasswordHash, user.Role, version, !user.Unverified, user.Disabled,
+			)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				skipped++
+			} else {
+				copied++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return copied, skipped, nil
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS users (
+    id            BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    email         TEXT        NOT NULL,
+    password_hash TEXT        NOT NULL,
+    role          TEXT        NOT NULL,
+    -- Версия данных: увеличивается при смене пароля и выходе со всех устройств
+    version       BIGINT      NOT NULL DEFAULT 1 CHECK (version > 0),
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT users_email_not_empty CHECK (email <> '')
+);
+
+-- Адреса сравниваются без учёта регистра
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (lower(email));
@@ -0,0 +1,2 @@
+-- Учётные записи, созданные до проверки адресов, считаются подтверждёнными
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,16 @@
+-- Журнал аудита: записи только добавляются
+CREATE TABLE IF NOT EXISTS audit_log (
+    id         BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    time       TIMESTAMPTZ NOT NULL,
+    action     TEXT        NOT NULL,
+    actor      TEXT        NOT NULL DEFAULT '',
+    subject    TEXT        NOT NULL DEFAULT '',
+    details    TEXT        NOT NULL DEFAULT '',
+    ip         TEXT        NOT NULL DEFAULT '',
+    user_agent TEXT        NOT NULL DEFAULT '',
+    result     TEXT        NOT NULL,
+    reason     TEXT        NOT NULL DEFAULT ''
+);
+
+-- Выборки всегда ограничены промежутком времени
+CREATE INDEX IF NOT EXISTS audit_log_time_idx ON audit_log (time);